@@ -0,0 +1,317 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"ellas-corner/internal/config"
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/mail"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/storage"
+	"ellas-corner/migrations"
+)
+
+const usage = `Usage:
+  forum-app                      start the web server (applies pending migrations first)
+  forum-app migrate up           apply all pending migrations
+  forum-app migrate down [n]     roll back the last n migrations (default 1)
+  forum-app migrate status       list migrations and whether they are applied
+  forum-app user role <user> <role>
+                                 set a user's role (member, moderator or admin) by username or email
+  forum-app user verify <user>   mark a user's email address as confirmed without the emailed link
+  forum-app mail digest          email every member their unread notifications now
+  forum-app uploads push         copy the images in the upload directories to the configured
+                                 storage, such as an S3 bucket, skipping ones already there
+  forum-app uploads sweep [--dry-run]
+                                 remove images no post or user refers to; --dry-run only lists them`
+
+// runCommand handles command-line subcommands and returns the process exit code
+func runCommand(dbInstance *db.Database, store repository.Store, cfg config.Config, args []string) int {
+	switch args[0] {
+	case "migrate":
+		return runMigrateCommand(dbInstance, args[1:])
+	case "user":
+		return runUserCommand(dbInstance, store, args[1:])
+	case "mail":
+		return runMailCommand(dbInstance, store, cfg, args[1:])
+	case "uploads":
+		return runUploadsCommand(dbInstance, store, cfg, args[1:])
+	case "help", "-h", "--help":
+		fmt.Println(usage)
+		return 0
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s\n", args[0], usage)
+		return 2
+	}
+}
+
+func runMigrateCommand(dbInstance *db.Database, args []string) int {
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+
+	embedded, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error loading migrations:", err)
+		return 1
+	}
+
+	switch args[0] {
+	case "up":
+		ran, err := dbInstance.MigrateUp(embedded)
+		for _, m := range ran {
+			fmt.Printf("applied  %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(ran) == 0 {
+			fmt.Println("Database is already up to date")
+		}
+
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				fmt.Fprintln(os.Stderr, "migrate down expects a positive number of steps")
+				return 2
+			}
+		}
+		ran, err := dbInstance.MigrateDown(embedded, steps)
+		for _, m := range ran {
+			fmt.Printf("reverted %04d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		if len(ran) == 0 {
+			fmt.Println("No applied migrations to roll back")
+		}
+
+	case "status":
+		statuses, err := dbInstance.MigrationStatuses(embedded)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		for _, s := range statuses {
+			state := "pending"
+			if s.Applied {
+				state = "applied " + s.AppliedAt
+			}
+			fmt.Printf("%04d_%-30s %s\n", s.Version, s.Name, state)
+		}
+
+		// The search index isn't a numbered migration, since it needs a binary built with FTS5
+		search, err := dbInstance.SearchIndexStatus()
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 1
+		}
+		fmt.Printf("%-35s %s\n", "search index (FTS5)", search)
+
+	default:
+		fmt.Fprintf(os.Stderr, "unknown migrate command %q\n\n%s\n", args[0], usage)
+		return 2
+	}
+
+	return 0
+}
+
+// runUserCommand manages users from the command line. It is how the first admin is created,
+// since only admins can change roles from the dashboard.
+func runUserCommand(dbInstance *db.Database, store repository.Store, args []string) int {
+	validArgs := (len(args) == 3 && args[0] == "role") || (len(args) == 2 && args[0] == "verify")
+	if !validArgs {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if err := dbInstance.RunMigrations(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error running migrations:", err)
+		return 1
+	}
+
+	user, err := store.GetUserByUsernameOrEmail(args[1])
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error looking up user:", err)
+		return 1
+	}
+	if user == nil {
+		fmt.Fprintf(os.Stderr, "no user with username or email %q\n", args[1])
+		return 1
+	}
+
+	if args[0] == "verify" {
+		if err := store.MarkEmailVerified(user.ID); err != nil {
+			fmt.Fprintln(os.Stderr, "Error verifying email:", err)
+			return 1
+		}
+		fmt.Printf("%s's email address is now confirmed\n", user.Username)
+		return 0
+	}
+
+	role := repository.Role(args[2])
+	if !repository.ValidRole(role) {
+		fmt.Fprintf(os.Stderr, "unknown role %q: expected member, moderator or admin\n", args[2])
+		return 2
+	}
+
+	// Logged with moderator 0, meaning the command line rather than a user
+	if err := store.SetUserRole(0, user.ID, role); err != nil {
+		fmt.Fprintln(os.Stderr, "Error setting role:", err)
+		return 1
+	}
+	fmt.Printf("%s is now %s\n", user.Username, role)
+	return 0
+}
+
+// runMailCommand sends email outside the server's own schedule
+func runMailCommand(dbInstance *db.Database, store repository.Store, cfg config.Config, args []string) int {
+	if len(args) != 1 || args[0] != "digest" {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if err := dbInstance.RunMigrations(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error running migrations:", err)
+		return 1
+	}
+
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error setting up email:", err)
+		return 1
+	}
+	sent, err := mail.SendDigests(store, mailer, cfg.Server.SiteURL)
+	fmt.Printf("Sent %d digests\n", sent)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Some digests could not be sent:", err)
+		return 1
+	}
+	return 0
+}
+
+// runUploadsCommand manages the stored images
+func runUploadsCommand(dbInstance *db.Database, store repository.Store, cfg config.Config, args []string) int {
+	switch {
+	case len(args) == 1 && args[0] == "push":
+		return pushUploads(cfg)
+	case len(args) >= 1 && args[0] == "sweep":
+		return sweepUploads(dbInstance, store, cfg, args[1:])
+	default:
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+}
+
+// pushUploads copies images saved on local disk to the configured storage. It is how the
+// default pictures and older uploads reach a bucket when moving to the s3 backend.
+func pushUploads(cfg config.Config) int {
+	if cfg.Storage.Backend == "local" {
+		fmt.Println("Storage is the local upload directories already; nothing to copy")
+		return 0
+	}
+
+	postImages, profilePictures, err := newBlobStores(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error setting up image storage:", err)
+		return 1
+	}
+	ctx := context.Background()
+	failed := false
+	sources := []struct {
+		dir   string
+		store storage.BlobStore
+	}{{cfg.Uploads.PostDir, postImages}, {cfg.Uploads.ProfilePictureDir, profilePictures}}
+	for _, source := range sources {
+		dir, store := source.dir, source.store
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "Error reading upload directory:", err)
+			return 1
+		}
+		copied, skipped := 0, 0
+		for _, entry := range entries {
+			name := entry.Name()
+			if entry.IsDir() || strings.HasPrefix(name, ".") {
+				continue
+			}
+			if _, err := store.Stat(ctx, name); err == nil {
+				skipped++
+				continue
+			}
+			data, err := os.ReadFile(filepath.Join(dir, name))
+			if err == nil {
+				err = store.Put(ctx, name, data, mime.TypeByExtension(filepath.Ext(name)))
+			}
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error copying %s: %v\n", name, err)
+				failed = true
+				continue
+			}
+			copied++
+		}
+		fmt.Printf("%s: copied %d, already there %d\n", dir, copied, skipped)
+	}
+	if failed {
+		return 1
+	}
+	return 0
+}
+
+// sweepUploads removes unreferenced images straight away, or lists what would go
+func sweepUploads(dbInstance *db.Database, store repository.Store, cfg config.Config, args []string) int {
+	dryRun := len(args) == 1 && args[0] == "--dry-run"
+	if len(args) > 1 || (len(args) == 1 && !dryRun) {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	if err := dbInstance.RunMigrations(); err != nil {
+		fmt.Fprintln(os.Stderr, "Error running migrations:", err)
+		return 1
+	}
+
+	postImages, profilePictures, err := newBlobStores(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error setting up image storage:", err)
+		return 1
+	}
+	reports, err := newSweeper(store, cfg, postImages, profilePictures).Sweep(context.Background(), dryRun)
+	for _, report := range reports {
+		verb := "unreferenced"
+		if dryRun {
+			verb = "would remove"
+		}
+		for _, blob := range report.Orphans {
+			fmt.Printf("%s %s/%s (%s, uploaded %s)\n", verb, report.Store, blob.Key, byteSize(blob.Size), blob.ModTime.Format("2006-01-02"))
+		}
+		fmt.Printf("%s: %d images, %d in use, %d too new to remove, %d unreferenced (%s), %d removed\n",
+			report.Store, report.Blobs, report.InUse, report.Recent, len(report.Orphans), byteSize(report.OrphanBytes()), report.Removed)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Error sweeping images:", err)
+		return 1
+	}
+	return 0
+}
+
+// byteSize formats a size in bytes for people
+func byteSize(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	default:
+		return fmt.Sprintf("%d B", n)
+	}
+}
@@ -0,0 +1,85 @@
+// Package authz decides what a signed-in user may do. Every handler that changes posts,
+// comments or users asks Can or CanManageUser before acting, so the rules live in one place.
+package authz
+
+import (
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+)
+
+// Action is something a user may or may not be allowed to do
+type Action string
+
+const (
+	CreateContent    Action = "create_content" // Write posts and comments, and react to them
+	EditPost         Action = "edit_post"
+	DeletePost       Action = "delete_post"
+	EditComment      Action = "edit_comment"
+	DeleteComment    Action = "delete_comment"
+	ReportContent    Action = "report_content"   // Report someone else's post or comment to moderators
+	ManageDonation   Action = "manage_donation"  // Reserve, hand over or withdraw your own donated item
+	RequestDonation  Action = "request_donation" // Ask for someone else's donated item
+	HideContent      Action = "hide_content"     // Hide or unhide posts and comments
+	ViewHidden       Action = "view_hidden"      // See hidden posts and comments
+	Moderate         Action = "moderate"         // Open the moderation dashboard
+	BanUser          Action = "ban_user"
+	ManageRoles      Action = "manage_roles"
+	ManageCategories Action = "manage_categories" // Add, rename and remove the categories posts are filed under
+)
+
+// rank orders roles so that a user can only moderate users below them
+var rank = map[repository.Role]int{
+	repository.RoleMember:    0,
+	repository.RoleModerator: 1,
+	repository.RoleAdmin:     2,
+}
+
+// atLeast reports whether the user's role is the given role or higher
+func atLeast(user *utils.SessionUser, role repository.Role) bool {
+	return rank[user.Role] >= rank[role]
+}
+
+// Can reports whether user may perform action on something owned by ownerID (0 for
+// actions that don't target content). A nil user is signed out and may do nothing.
+//
+// Members must verify their email address before they post, comment, react, message or take
+// part in donations; until then they can only browse and report. Authors can edit and delete
+// their own posts and comments, and report anyone else's. Only donors manage their donations,
+// and anyone else can ask for them.
+// Moderators and admins can also delete and hide anyone's content and ban members, but not
+// edit other people's words. Only admins can change roles and categories.
+func Can(user *utils.SessionUser, action Action, ownerID int) bool {
+	if user == nil {
+		return false
+	}
+
+	switch action {
+	case CreateContent:
+		return user.EmailVerified
+	case EditPost, EditComment:
+		return user.ID == ownerID
+	case ManageDonation:
+		return user.EmailVerified && user.ID == ownerID
+	case RequestDonation:
+		return user.EmailVerified && user.ID != ownerID
+	case ReportContent:
+		return user.ID != ownerID
+	case DeletePost, DeleteComment:
+		return user.ID == ownerID || atLeast(user, repository.RoleModerator)
+	case HideContent, ViewHidden, Moderate, BanUser:
+		return atLeast(user, repository.RoleModerator)
+	case ManageRoles, ManageCategories:
+		return atLeast(user, repository.RoleAdmin)
+	}
+	return false
+}
+
+// CanManageUser reports whether user may perform action (BanUser or ManageRoles) on target.
+// Nobody can act on themselves or on someone of equal or higher rank, so moderators can't
+// ban each other and admins can't demote each other.
+func CanManageUser(user *utils.SessionUser, action Action, target repository.User) bool {
+	if !Can(user, action, 0) || user.ID == target.ID {
+		return false
+	}
+	return rank[user.Role] > rank[target.Role]
+}
@@ -0,0 +1,86 @@
+package authz_test
+
+import (
+	"testing"
+
+	"ellas-corner/internal/authz"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+)
+
+func TestCan(t *testing.T) {
+	member := &utils.SessionUser{ID: 1, Role: repository.RoleMember, EmailVerified: true}
+	unverified := &utils.SessionUser{ID: 4, Role: repository.RoleMember}
+	moderator := &utils.SessionUser{ID: 2, Role: repository.RoleModerator, EmailVerified: true}
+	admin := &utils.SessionUser{ID: 3, Role: repository.RoleAdmin, EmailVerified: true}
+	const someoneElse = 99
+
+	tests := []struct {
+		name    string
+		user    *utils.SessionUser
+		action  authz.Action
+		ownerID int
+		want    bool
+	}{
+		{"signed out can't post", nil, authz.CreateContent, 0, false},
+		{"member can post", member, authz.CreateContent, 0, true},
+		{"unverified member can't post", unverified, authz.CreateContent, 0, false},
+		{"unverified member can't offer donations", unverified, authz.ManageDonation, unverified.ID, false},
+		{"unverified member can't request donations", unverified, authz.RequestDonation, someoneElse, false},
+		{"unverified member can still report", unverified, authz.ReportContent, someoneElse, true},
+		{"member edits own post", member, authz.EditPost, member.ID, true},
+		{"member can't edit others' posts", member, authz.EditPost, someoneElse, false},
+		{"member deletes own comment", member, authz.DeleteComment, member.ID, true},
+		{"member can't delete others' comments", member, authz.DeleteComment, someoneElse, false},
+		{"member can't moderate", member, authz.Moderate, 0, false},
+		{"member reports others' posts", member, authz.ReportContent, someoneElse, true},
+		{"member can't report own post", member, authz.ReportContent, member.ID, false},
+		{"donor manages own donation", member, authz.ManageDonation, member.ID, true},
+		{"admin can't manage others' donations", admin, authz.ManageDonation, someoneElse, false},
+		{"member requests others' donations", member, authz.RequestDonation, someoneElse, true},
+		{"donor can't request own donation", member, authz.RequestDonation, member.ID, false},
+		{"moderator deletes any post", moderator, authz.DeletePost, someoneElse, true},
+		{"moderator can't edit others' posts", moderator, authz.EditPost, someoneElse, false},
+		{"moderator hides content", moderator, authz.HideContent, 0, true},
+		{"moderator can't manage roles", moderator, authz.ManageRoles, 0, false},
+		{"admin manages roles", admin, authz.ManageRoles, 0, true},
+		{"moderator can't manage categories", moderator, authz.ManageCategories, 0, false},
+		{"admin manages categories", admin, authz.ManageCategories, 0, true},
+		{"admin deletes any comment", admin, authz.DeleteComment, someoneElse, true},
+	}
+	for _, tt := range tests {
+		if got := authz.Can(tt.user, tt.action, tt.ownerID); got != tt.want {
+			t.Errorf("%s: Can(%s) = %v, want %v", tt.name, tt.action, got, tt.want)
+		}
+	}
+}
+
+func TestCanManageUser(t *testing.T) {
+	moderator := &utils.SessionUser{ID: 2, Role: repository.RoleModerator}
+	admin := &utils.SessionUser{ID: 3, Role: repository.RoleAdmin}
+
+	memberUser := repository.User{ID: 1, Role: repository.RoleMember}
+	otherModerator := repository.User{ID: 4, Role: repository.RoleModerator}
+	otherAdmin := repository.User{ID: 5, Role: repository.RoleAdmin}
+
+	tests := []struct {
+		name   string
+		user   *utils.SessionUser
+		action authz.Action
+		target repository.User
+		want   bool
+	}{
+		{"moderator bans a member", moderator, authz.BanUser, memberUser, true},
+		{"moderator can't ban a moderator", moderator, authz.BanUser, otherModerator, false},
+		{"moderator can't ban themselves", moderator, authz.BanUser, repository.User{ID: moderator.ID, Role: repository.RoleModerator}, false},
+		{"moderator can't change roles", moderator, authz.ManageRoles, memberUser, false},
+		{"admin bans a moderator", admin, authz.BanUser, otherModerator, true},
+		{"admin promotes a member", admin, authz.ManageRoles, memberUser, true},
+		{"admin can't demote another admin", admin, authz.ManageRoles, otherAdmin, false},
+	}
+	for _, tt := range tests {
+		if got := authz.CanManageUser(tt.user, tt.action, tt.target); got != tt.want {
+			t.Errorf("%s: CanManageUser = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,228 @@
+// Package config loads the server's settings. Each setting has a default, which can be
+// overridden by a TOML file and then by an environment variable.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// DefaultFile is loaded when CONFIG_FILE is not set, if it exists
+const DefaultFile = "config.toml"
+
+// Config is every setting the server reads at startup. The toml tags name the section and key
+// in the config file and the env tags the environment variable.
+type Config struct {
+	Server   Server   `toml:"server"`
+	Database Database `toml:"database"`
+	Uploads  Uploads  `toml:"uploads"`
+	Storage  Storage  `toml:"storage"`
+	Auth     Auth     `toml:"auth"`
+	Mail     Mail     `toml:"mail"`
+}
+
+// Server is where and how the site is served
+type Server struct {
+	Addr         string        `toml:"addr" env:"ADDR"`
+	SiteURL      string        `toml:"site_url" env:"SITE_URL"` // Public address, used for links in emails
+	TLSCertFile  string        `toml:"tls_cert_file" env:"TLS_CERT_FILE"`
+	TLSKeyFile   string        `toml:"tls_key_file" env:"TLS_KEY_FILE"`
+	ReadTimeout  time.Duration `toml:"read_timeout" env:"READ_TIMEOUT"`
+	WriteTimeout time.Duration `toml:"write_timeout" env:"WRITE_TIMEOUT"`
+	// ShutdownTimeout is how long in-flight requests get to finish after SIGTERM or Ctrl+C
+	ShutdownTimeout time.Duration `toml:"shutdown_timeout" env:"SHUTDOWN_TIMEOUT"`
+}
+
+// Database is the SQLite database file
+type Database struct {
+	Path string `toml:"path" env:"DB_PATH"`
+}
+
+// Uploads is where uploaded images are kept and how big they can be
+type Uploads struct {
+	PostDir           string `toml:"post_dir" env:"UPLOAD_DIR"`
+	ProfilePictureDir string `toml:"profile_picture_dir" env:"PROFILE_PICTURE_DIR"`
+	MaxSizeMB         int    `toml:"max_size_mb" env:"MAX_UPLOAD_MB"`
+	// MaxImageDimension is the widest or tallest image accepted, in pixels
+	MaxImageDimension int `toml:"max_image_dimension" env:"MAX_IMAGE_DIMENSION"`
+	// SweepInterval is how often images nothing refers to are removed; 0 turns it off.
+	// SweepGracePeriod spares images uploaded more recently than that.
+	SweepInterval    time.Duration `toml:"sweep_interval" env:"UPLOAD_SWEEP_INTERVAL"`
+	SweepGracePeriod time.Duration `toml:"sweep_grace_period" env:"UPLOAD_SWEEP_GRACE_PERIOD"`
+}
+
+// MaxBytes is the upload limit in bytes
+func (u Uploads) MaxBytes() int64 {
+	return int64(u.MaxSizeMB) << 20
+}
+
+// Storage is where uploaded images are kept. The "local" backend saves them in the upload
+// directories. The "s3" backend saves them in a bucket on an S3-compatible service, under
+// uploads/ and profile_pictures/.
+type Storage struct {
+	Backend     string `toml:"backend" env:"STORAGE_BACKEND"`
+	S3Endpoint  string `toml:"s3_endpoint" env:"S3_ENDPOINT"`
+	S3Region    string `toml:"s3_region" env:"S3_REGION"`
+	S3Bucket    string `toml:"s3_bucket" env:"S3_BUCKET"`
+	S3AccessKey string `toml:"s3_access_key" env:"S3_ACCESS_KEY"`
+	S3SecretKey string `toml:"s3_secret_key" env:"S3_SECRET_KEY"`
+	// S3PathStyle puts the bucket in the URL path, which MinIO and most self-hosted services need
+	S3PathStyle bool `toml:"s3_path_style" env:"S3_PATH_STYLE"`
+	// SignedURLExpiry, when set, sends browsers to the bucket with signed links that last this
+	// long instead of serving images through the site
+	SignedURLExpiry time.Duration `toml:"signed_url_expiry" env:"S3_SIGNED_URL_EXPIRY"`
+}
+
+// Auth is how passwords are hashed and how long sign-ins last
+type Auth struct {
+	BcryptCost int `toml:"bcrypt_cost" env:"BCRYPT_COST"`
+	// SessionIdleTimeout is how long a session, or a visitor's cookie, lasts without activity
+	SessionIdleTimeout time.Duration `toml:"session_idle_timeout" env:"SESSION_IDLE_TIMEOUT"`
+	// SessionMaxLifetime caps how long activity can keep a session alive
+	SessionMaxLifetime time.Duration `toml:"session_max_lifetime" env:"SESSION_MAX_LIFETIME"`
+}
+
+// Mail is how email is sent. Without an SMTP address, emails are written to OutboxDir.
+type Mail struct {
+	SMTPAddr       string        `toml:"smtp_addr" env:"SMTP_ADDR"`
+	SMTPUsername   string        `toml:"smtp_username" env:"SMTP_USERNAME"`
+	SMTPPassword   string        `toml:"smtp_password" env:"SMTP_PASSWORD"`
+	From           string        `toml:"from" env:"MAIL_FROM"`
+	OutboxDir      string        `toml:"outbox_dir" env:"OUTBOX_DIR"`
+	DigestInterval time.Duration `toml:"digest_interval" env:"DIGEST_INTERVAL"`
+}
+
+// Default returns the settings used when nothing is configured, which suit local development
+func Default() Config {
+	return Config{
+		Server: Server{
+			Addr:         ":8080",
+			SiteURL:      "http://localhost:8080",
+			ReadTimeout:  30 * time.Second,
+			WriteTimeout: 60 * time.Second,
+			// Under the 30 second grace period docker-compose.yml gives the container to stop
+			ShutdownTimeout: 25 * time.Second,
+		},
+		Database: Database{Path: "data/forum.db"},
+		Uploads: Uploads{
+			PostDir:           "web/static/uploads",
+			ProfilePictureDir: "web/static/profile_pictures",
+			MaxSizeMB:         10,
+			MaxImageDimension: 8000,
+			SweepInterval:     24 * time.Hour,
+			SweepGracePeriod:  time.Hour,
+		},
+		Storage: Storage{
+			Backend:  "local",
+			S3Region: "us-east-1",
+		},
+		Auth: Auth{
+			BcryptCost:         14,
+			SessionIdleTimeout: 24 * time.Hour,
+			SessionMaxLifetime: 30 * 24 * time.Hour,
+		},
+		Mail: Mail{
+			From:           "Ella's Corner <no-reply@ellascorner.local>",
+			OutboxDir:      "data/outbox",
+			DigestInterval: 24 * time.Hour,
+		},
+	}
+}
+
+// Load reads the configuration: the defaults, then the file at path if there is one, then the
+// environment. An empty path loads DefaultFile if it exists. The result is validated.
+func Load(path string) (Config, error) {
+	cfg := Default()
+
+	if path == "" {
+		if _, err := os.Stat(DefaultFile); err == nil {
+			path = DefaultFile
+		}
+	}
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return Config{}, fmt.Errorf("reading config file: %w", err)
+		}
+		if err := parseTOML(string(data), &cfg); err != nil {
+			return Config{}, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if err := applyEnv(&cfg, os.LookupEnv); err != nil {
+		return Config{}, err
+	}
+	cfg.Server.SiteURL = strings.TrimSuffix(cfg.Server.SiteURL, "/")
+
+	if err := cfg.Validate(); err != nil {
+		return Config{}, err
+	}
+	return cfg, nil
+}
+
+// Validate reports every setting that can't work, so they can all be fixed at once
+func (c Config) Validate() error {
+	var problems []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			problems = append(problems, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr (ADDR) is required")
+	siteURL, err := url.Parse(c.Server.SiteURL)
+	check(err == nil && (siteURL.Scheme == "http" || siteURL.Scheme == "https") && siteURL.Host != "",
+		"server.site_url (SITE_URL) must be an http or https address, got %q", c.Server.SiteURL)
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""),
+		"server.tls_cert_file (TLS_CERT_FILE) and server.tls_key_file (TLS_KEY_FILE) must be set together")
+	check(c.Server.ReadTimeout > 0, "server.read_timeout (READ_TIMEOUT) must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout (WRITE_TIMEOUT) must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout (SHUTDOWN_TIMEOUT) must be positive")
+
+	check(c.Database.Path != "", "database.path (DB_PATH) is required")
+
+	check(c.Uploads.PostDir != "", "uploads.post_dir (UPLOAD_DIR) is required")
+	check(c.Uploads.ProfilePictureDir != "", "uploads.profile_picture_dir (PROFILE_PICTURE_DIR) is required")
+	check(c.Uploads.MaxSizeMB > 0, "uploads.max_size_mb (MAX_UPLOAD_MB) must be positive")
+	check(c.Uploads.MaxImageDimension > 0, "uploads.max_image_dimension (MAX_IMAGE_DIMENSION) must be positive")
+	check(c.Uploads.SweepInterval >= 0, "uploads.sweep_interval (UPLOAD_SWEEP_INTERVAL) can't be negative")
+	check(c.Uploads.SweepGracePeriod >= time.Minute, "uploads.sweep_grace_period (UPLOAD_SWEEP_GRACE_PERIOD) must be at least a minute")
+
+	switch c.Storage.Backend {
+	case "local":
+		check(c.Storage.SignedURLExpiry == 0, "storage.signed_url_expiry (S3_SIGNED_URL_EXPIRY) only works with the s3 backend")
+	case "s3":
+		endpoint, err := url.Parse(c.Storage.S3Endpoint)
+		check(err == nil && (endpoint.Scheme == "http" || endpoint.Scheme == "https") && endpoint.Host != "",
+			"storage.s3_endpoint (S3_ENDPOINT) must be an http or https address, got %q", c.Storage.S3Endpoint)
+		check(c.Storage.S3Region != "", "storage.s3_region (S3_REGION) is required")
+		check(c.Storage.S3Bucket != "", "storage.s3_bucket (S3_BUCKET) is required")
+		check(c.Storage.S3AccessKey != "" && c.Storage.S3SecretKey != "",
+			"storage.s3_access_key (S3_ACCESS_KEY) and storage.s3_secret_key (S3_SECRET_KEY) are required")
+		check(c.Storage.SignedURLExpiry == 0 || (c.Storage.SignedURLExpiry >= time.Minute && c.Storage.SignedURLExpiry <= 7*24*time.Hour),
+			"storage.signed_url_expiry (S3_SIGNED_URL_EXPIRY) must be between 1m and 168h, got %s", c.Storage.SignedURLExpiry)
+	default:
+		check(false, "storage.backend (STORAGE_BACKEND) must be local or s3, got %q", c.Storage.Backend)
+	}
+
+	check(c.Auth.BcryptCost >= bcrypt.MinCost && c.Auth.BcryptCost <= bcrypt.MaxCost,
+		"auth.bcrypt_cost (BCRYPT_COST) must be between %d and %d, got %d", bcrypt.MinCost, bcrypt.MaxCost, c.Auth.BcryptCost)
+	check(c.Auth.SessionIdleTimeout > 0, "auth.session_idle_timeout (SESSION_IDLE_TIMEOUT) must be positive")
+	check(c.Auth.SessionMaxLifetime >= c.Auth.SessionIdleTimeout,
+		"auth.session_max_lifetime (SESSION_MAX_LIFETIME) must be at least the idle timeout")
+
+	check(c.Mail.From != "", "mail.from (MAIL_FROM) is required")
+	check(c.Mail.SMTPAddr != "" || c.Mail.OutboxDir != "", "mail.outbox_dir (OUTBOX_DIR) is required when no SMTP server is set")
+	check(c.Mail.DigestInterval > 0, "mail.digest_interval (DIGEST_INTERVAL) must be positive")
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(problems...))
+	}
+	return nil
+}
@@ -0,0 +1,140 @@
+package config_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ellas-corner/internal/config"
+)
+
+func writeConfigFile(t *testing.T, contents string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(contents), 0o644); err != nil {
+		t.Fatalf("Failed to write config file: %v", err)
+	}
+	return path
+}
+
+func TestDefaultsAreValid(t *testing.T) {
+	cfg := config.Default()
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("expected the defaults to be valid, got %v", err)
+	}
+	if cfg.Server.Addr != ":8080" || cfg.Database.Path != "data/forum.db" || cfg.Uploads.MaxBytes() != 10<<20 {
+		t.Errorf("unexpected defaults: %+v", cfg)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	path := writeConfigFile(t, `
+# Ella's Corner settings
+[server]
+addr = ":9090"
+site_url = "https://ellas.example/" # trailing slash is trimmed
+
+[uploads]
+max_size_mb = 5
+
+[auth]
+bcrypt_cost = 10
+session_idle_timeout = "2h"
+
+[mail]
+from = "Ella # Corner <hi@ellas.example>"
+`)
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Server.Addr != ":9090" || cfg.Server.SiteURL != "https://ellas.example" {
+		t.Errorf("unexpected server settings: %+v", cfg.Server)
+	}
+	if cfg.Uploads.MaxBytes() != 5<<20 {
+		t.Errorf("expected a 5 MB upload limit, got %d bytes", cfg.Uploads.MaxBytes())
+	}
+	if cfg.Auth.BcryptCost != 10 || cfg.Auth.SessionIdleTimeout != 2*time.Hour {
+		t.Errorf("unexpected auth settings: %+v", cfg.Auth)
+	}
+	if cfg.Mail.From != "Ella # Corner <hi@ellas.example>" {
+		t.Errorf("expected a # inside quotes to be kept, got %q", cfg.Mail.From)
+	}
+	// Settings the file leaves out keep their defaults
+	if cfg.Database.Path != "data/forum.db" {
+		t.Errorf("expected the default database path, got %q", cfg.Database.Path)
+	}
+}
+
+func TestEnvironmentOverridesFile(t *testing.T) {
+	path := writeConfigFile(t, "[server]\naddr = \":9090\"\n\n[auth]\nbcrypt_cost = 10\n")
+	t.Setenv("ADDR", ":7070")
+	t.Setenv("DB_PATH", "/var/lib/ellas/forum.db")
+	t.Setenv("DIGEST_INTERVAL", "12h")
+
+	cfg, err := config.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if cfg.Server.Addr != ":7070" {
+		t.Errorf("expected ADDR to win over the file, got %q", cfg.Server.Addr)
+	}
+	if cfg.Database.Path != "/var/lib/ellas/forum.db" || cfg.Mail.DigestInterval != 12*time.Hour {
+		t.Errorf("expected environment settings to be applied, got %+v", cfg)
+	}
+	if cfg.Auth.BcryptCost != 10 {
+		t.Errorf("expected the file's bcrypt cost to be kept, got %d", cfg.Auth.BcryptCost)
+	}
+}
+
+func TestLoadRejectsBadInput(t *testing.T) {
+	tests := []struct {
+		name, file, env, value, want string
+	}{
+		{name: "unknown key", file: "[server]\nport = 8080\n", want: "unknown setting server.port"},
+		{name: "unknown section", file: "[cache]\nsize = 1\n", want: "unknown section [cache]"},
+		{name: "key outside section", file: "addr = \":8080\"\n", want: "inside a section"},
+		{name: "wrong type", file: "[auth]\nbcrypt_cost = \"high\"\n", want: "auth.bcrypt_cost"},
+		{name: "bad duration", env: "SESSION_IDLE_TIMEOUT", value: "soon", want: "SESSION_IDLE_TIMEOUT"},
+		{name: "bcrypt cost too high", env: "BCRYPT_COST", value: "40", want: "bcrypt_cost"},
+		{name: "cert without key", env: "TLS_CERT_FILE", value: "cert.pem", want: "must be set together"},
+		{name: "site url without scheme", env: "SITE_URL", value: "ellas.example", want: "site_url"},
+		{name: "unknown storage backend", env: "STORAGE_BACKEND", value: "ftp", want: "storage.backend"},
+		{name: "s3 without a bucket", file: "[storage]\nbackend = \"s3\"\ns3_endpoint = \"http://minio:9000\"\n", want: "storage.s3_bucket"},
+		{name: "signed urls on local disk", env: "S3_SIGNED_URL_EXPIRY", value: "15m", want: "only works with the s3 backend"},
+		{name: "no grace period for uploads", env: "UPLOAD_SWEEP_GRACE_PERIOD", value: "0s", want: "uploads.sweep_grace_period"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writeConfigFile(t, tt.file)
+			if tt.env != "" {
+				t.Setenv(tt.env, tt.value)
+			}
+			_, err := config.Load(path)
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("expected an error mentioning %q, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestValidateReportsEveryProblem(t *testing.T) {
+	cfg := config.Default()
+	cfg.Server.Addr = ""
+	cfg.Uploads.MaxSizeMB = 0
+	cfg.Auth.SessionMaxLifetime = time.Minute
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("expected an invalid configuration to be rejected")
+	}
+	for _, want := range []string{"server.addr", "uploads.max_size_mb", "auth.session_max_lifetime"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("expected the error to mention %s, got %v", want, err)
+		}
+	}
+}
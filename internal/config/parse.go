@@ -0,0 +1,165 @@
+package config
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// parseTOML reads the subset of TOML the config file needs: [section] headers and
+// key = value lines, where a value is a quoted string, an integer or a boolean. Durations are
+// strings such as "24h". Unknown sections and keys are errors, so typos don't go unnoticed.
+func parseTOML(data string, cfg *Config) error {
+	root := reflect.ValueOf(cfg).Elem()
+	var section reflect.Value
+	var sectionName string
+
+	for n, line := range strings.Split(data, "\n") {
+		lineNo := n + 1
+		line = strings.TrimSpace(stripComment(line))
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") {
+			if !strings.HasSuffix(line, "]") {
+				return fmt.Errorf("line %d: unterminated section header", lineNo)
+			}
+			sectionName = strings.TrimSpace(line[1 : len(line)-1])
+			field, ok := fieldByTag(root, "toml", sectionName)
+			if !ok {
+				return fmt.Errorf("line %d: unknown section [%s]", lineNo, sectionName)
+			}
+			section = field
+			continue
+		}
+
+		key, raw, ok := strings.Cut(line, "=")
+		if !ok {
+			return fmt.Errorf("line %d: expected key = value", lineNo)
+		}
+		key, raw = strings.TrimSpace(key), strings.TrimSpace(raw)
+		if !section.IsValid() {
+			return fmt.Errorf("line %d: %s must be inside a section such as [server]", lineNo, key)
+		}
+		field, ok := fieldByTag(section, "toml", key)
+		if !ok {
+			return fmt.Errorf("line %d: unknown setting %s.%s", lineNo, sectionName, key)
+		}
+
+		value, err := tomlValue(raw)
+		if err != nil {
+			return fmt.Errorf("line %d: %s.%s: %w", lineNo, sectionName, key, err)
+		}
+		if err := setField(field, value); err != nil {
+			return fmt.Errorf("line %d: %s.%s: %w", lineNo, sectionName, key, err)
+		}
+	}
+	return nil
+}
+
+// stripComment removes a # comment that isn't inside a quoted string
+func stripComment(line string) string {
+	var quote byte
+	for i := 0; i < len(line); i++ {
+		c := line[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++ // Skip the escaped character
+		case quote != 0 && c == quote:
+			quote = 0
+		case quote == 0 && (c == '"' || c == '\''):
+			quote = c
+		case quote == 0 && c == '#':
+			return line[:i]
+		}
+	}
+	return line
+}
+
+// tomlValue turns a TOML value into the text setField parses: strings are unquoted, and
+// integers and booleans are checked and passed through
+func tomlValue(raw string) (string, error) {
+	switch {
+	case strings.HasPrefix(raw, `"`):
+		s, err := strconv.Unquote(raw)
+		if err != nil {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return s, nil
+	case strings.HasPrefix(raw, "'"):
+		if len(raw) < 2 || !strings.HasSuffix(raw, "'") {
+			return "", fmt.Errorf("invalid string %s", raw)
+		}
+		return raw[1 : len(raw)-1], nil
+	case raw == "true" || raw == "false":
+		return raw, nil
+	default:
+		if _, err := strconv.ParseInt(strings.ReplaceAll(raw, "_", ""), 10, 64); err != nil {
+			return "", fmt.Errorf("expected a quoted string, an integer or true/false, got %s", raw)
+		}
+		return strings.ReplaceAll(raw, "_", ""), nil
+	}
+}
+
+// applyEnv overrides settings from the environment variables named in the env tags
+func applyEnv(cfg *Config, lookup func(string) (string, bool)) error {
+	root := reflect.ValueOf(cfg).Elem()
+	for i := 0; i < root.NumField(); i++ {
+		section := root.Field(i)
+		for j := 0; j < section.NumField(); j++ {
+			name := section.Type().Field(j).Tag.Get("env")
+			value, ok := lookup(name)
+			if name == "" || !ok || value == "" {
+				continue
+			}
+			if err := setField(section.Field(j), value); err != nil {
+				return fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// fieldByTag finds the field of a struct whose tag matches name
+func fieldByTag(v reflect.Value, tag, name string) (reflect.Value, bool) {
+	for i := 0; i < v.NumField(); i++ {
+		if v.Type().Field(i).Tag.Get(tag) == name {
+			return v.Field(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setField parses value into a string, int, bool or time.Duration field
+func setField(field reflect.Value, value string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Errorf("expected a duration such as \"30s\" or \"24h\", got %q", value)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(value)
+	case field.Kind() == reflect.Int:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("expected a whole number, got %q", value)
+		}
+		field.SetInt(int64(n))
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("expected true or false, got %q", value)
+		}
+		field.SetBool(b)
+	default:
+		return fmt.Errorf("unsupported setting type %s", field.Type())
+	}
+	return nil
+}
@@ -3,13 +3,17 @@ package db
 import (
 	"database/sql"
 	"fmt"
-	"os"
+
+	"ellas-corner/migrations"
 
 	_ "github.com/mattn/go-sqlite3"
 )
 
 type Database struct {
 	Conn *sql.DB
+
+	// FullTextSearch is set by SetupSearchIndex when the post_search FTS5 index is available
+	FullTextSearch bool
 }
 
 // InitDB initialises the SQLite database connection
@@ -27,32 +31,37 @@ func InitDB(dataSourceName string) (*Database, error) {
 	return &Database{Conn: conn}, nil
 }
 
-// RunMigrations executes migrations using the current DB connection
+// RunMigrations applies every pending migration embedded in the binary, then sets up the
+// optional full-text search index
 func (db *Database) RunMigrations() error {
-	// Try common relative path
-	pathsToTry := []string{
-		"migrations/create_tables.sql",       // when run from root
-		"../migrations/create_tables.sql",    // from inside /internal
-		"../../migrations/create_tables.sql", // from inside /internal/handlers or repository
+	embedded, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return err
 	}
 
-	var sqlBytes []byte
-	var err error
-
-	for _, path := range pathsToTry {
-		sqlBytes, err = os.ReadFile(path)
-		if err == nil {
-			goto Execute
-		}
+	if _, err := db.MigrateUp(embedded); err != nil {
+		return err
 	}
 
-	return fmt.Errorf("error reading migration file after trying paths: %w", err)
+	return db.SetupSearchIndex()
+}
 
-Execute:
-	_, err = db.Conn.Exec(string(sqlBytes))
+// PendingMigrations lists the migrations embedded in the binary that haven't been applied yet
+func (db *Database) PendingMigrations() ([]Migration, error) {
+	embedded, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := db.MigrationStatuses(embedded)
 	if err != nil {
-		return fmt.Errorf("error executing migration: %w", err)
+		return nil, err
 	}
 
-	return nil
+	var pending []Migration
+	for _, s := range statuses {
+		if !s.Applied {
+			pending = append(pending, s.Migration)
+		}
+	}
+	return pending, nil
 }
@@ -0,0 +1,136 @@
+package db_test
+
+import (
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+
+	"ellas-corner/internal/db"
+	"ellas-corner/migrations"
+)
+
+func testMigrations() fstest.MapFS {
+	return fstest.MapFS{
+		"0001_widgets.up.sql":       {Data: []byte("CREATE TABLE widgets (id INTEGER PRIMARY KEY, name TEXT);")},
+		"0001_widgets.down.sql":     {Data: []byte("DROP TABLE widgets;")},
+		"0002_widget_size.up.sql":   {Data: []byte("ALTER TABLE widgets ADD COLUMN size INTEGER DEFAULT 0;")},
+		"0002_widget_size.down.sql": {Data: []byte("ALTER TABLE widgets DROP COLUMN size;")},
+	}
+}
+
+func TestMigrateUpAndDown(t *testing.T) {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize test DB: %v", err)
+	}
+	defer conn.Conn.Close()
+
+	loaded, err := db.LoadMigrations(testMigrations())
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].Version != 1 || loaded[1].Name != "widget_size" {
+		t.Fatalf("unexpected migrations loaded: %+v", loaded)
+	}
+
+	ran, err := conn.MigrateUp(loaded)
+	if err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+	if len(ran) != 2 {
+		t.Fatalf("expected 2 migrations to run, got %d", len(ran))
+	}
+	if _, err := conn.Conn.Exec("INSERT INTO widgets (name, size) VALUES ('rattle', 3)"); err != nil {
+		t.Fatalf("expected widgets.size to exist after migrating up: %v", err)
+	}
+
+	// Running up again should be a no-op
+	ran, err = conn.MigrateUp(loaded)
+	if err != nil || len(ran) != 0 {
+		t.Fatalf("expected no pending migrations, got %d (err=%v)", len(ran), err)
+	}
+
+	// Roll back only the latest migration
+	ran, err = conn.MigrateDown(loaded, 1)
+	if err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	if len(ran) != 1 || ran[0].Version != 2 {
+		t.Fatalf("expected migration 2 to be reverted, got %+v", ran)
+	}
+	if _, err := conn.Conn.Exec("INSERT INTO widgets (name, size) VALUES ('rattle', 3)"); err == nil {
+		t.Error("expected widgets.size to be gone after rolling back")
+	}
+
+	statuses, err := conn.MigrationStatuses(loaded)
+	if err != nil {
+		t.Fatalf("MigrationStatuses failed: %v", err)
+	}
+	if !statuses[0].Applied || statuses[1].Applied {
+		t.Errorf("expected only migration 1 to be applied, got %+v", statuses)
+	}
+}
+
+func TestLoadMigrationsRejectsBadNames(t *testing.T) {
+	_, err := db.LoadMigrations(fstest.MapFS{
+		"init.up.sql": {Data: []byte("SELECT 1;")},
+	})
+	if err == nil {
+		t.Error("expected an error for a migration without a version number")
+	}
+}
+
+func TestEmbeddedMigrationsRoundTrip(t *testing.T) {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize test DB: %v", err)
+	}
+	defer conn.Conn.Close()
+
+	embedded, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	if _, err := conn.MigrateUp(embedded); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+	if _, err := conn.MigrateDown(embedded, len(embedded)); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	if _, err := conn.MigrateUp(embedded); err != nil {
+		t.Fatalf("MigrateUp after full rollback failed: %v", err)
+	}
+}
+
+func TestMigrateDownPastSearchIndex(t *testing.T) {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize test DB: %v", err)
+	}
+	defer conn.Conn.Close()
+
+	embedded, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+	if _, err := conn.Conn.Exec("INSERT INTO users (username, email, password) VALUES ('ella', 'ella@example.com', 'hash')"); err != nil {
+		t.Fatalf("failed to insert user: %v", err)
+	}
+	if _, err := conn.Conn.Exec("INSERT INTO posts (user_id, title, content, category) VALUES (1, 'Pram', 'Folds flat', 'General')"); err != nil {
+		t.Fatalf("failed to insert post: %v", err)
+	}
+
+	// The search index's triggers refer to columns that rolling back removes
+	if _, err := conn.MigrateDown(embedded, len(embedded)); err != nil {
+		t.Fatalf("MigrateDown failed: %v", err)
+	}
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("RunMigrations after full rollback failed: %v", err)
+	}
+	if status, err := conn.SearchIndexStatus(); err != nil || (conn.FullTextSearch && status != db.SearchIndexReady) {
+		t.Errorf("expected the search index to be rebuilt, got %q (err %v)", status, err)
+	}
+}
@@ -0,0 +1,185 @@
+package db
+
+import (
+	"database/sql"
+	"log"
+)
+
+// searchIndexSchema creates the post_search full-text index and the triggers that keep it in
+// step with posts, comments and usernames. Each row's rowid is the post ID, and the comments
+// column holds the text of every visible comment on the post, so a search also finds posts by
+// their discussion but never shows a hidden comment in a snippet.
+const searchIndexSchema = `
+CREATE VIRTUAL TABLE IF NOT EXISTS post_search USING fts5(
+    title, content, category, username, comments,
+    tokenize = 'porter unicode61 remove_diacritics 2'
+);
+
+CREATE TRIGGER IF NOT EXISTS post_search_after_post_insert AFTER INSERT ON posts BEGIN
+    INSERT INTO post_search (rowid, title, content, category, username, comments)
+    VALUES (NEW.id, NEW.title, NEW.content, COALESCE(NEW.category, ''),
+            COALESCE((SELECT username FROM users WHERE id = NEW.user_id), ''), '');
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_search_after_post_update AFTER UPDATE OF title, content, category ON posts BEGIN
+    UPDATE post_search SET title = NEW.title, content = NEW.content, category = COALESCE(NEW.category, '')
+    WHERE rowid = NEW.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_search_after_post_delete AFTER DELETE ON posts BEGIN
+    DELETE FROM post_search WHERE rowid = OLD.id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_search_after_comment_insert AFTER INSERT ON comments BEGIN
+    UPDATE post_search
+    SET comments = (SELECT COALESCE(group_concat(content, ' '), '') FROM comments WHERE post_id = NEW.post_id AND hidden_at IS NULL)
+    WHERE rowid = NEW.post_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_search_after_comment_change AFTER UPDATE OF content, hidden_at ON comments BEGIN
+    UPDATE post_search
+    SET comments = (SELECT COALESCE(group_concat(content, ' '), '') FROM comments WHERE post_id = NEW.post_id AND hidden_at IS NULL)
+    WHERE rowid = NEW.post_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_search_after_comment_delete AFTER DELETE ON comments BEGIN
+    UPDATE post_search
+    SET comments = (SELECT COALESCE(group_concat(content, ' '), '') FROM comments WHERE post_id = OLD.post_id AND hidden_at IS NULL)
+    WHERE rowid = OLD.post_id;
+END;
+
+CREATE TRIGGER IF NOT EXISTS post_search_after_user_rename AFTER UPDATE OF username ON users BEGIN
+    UPDATE post_search SET username = NEW.username
+    WHERE rowid IN (SELECT id FROM posts WHERE user_id = NEW.id);
+END;
+`
+
+// rebuildSearchIndex refills post_search from the posts and comments tables
+const rebuildSearchIndex = `
+DELETE FROM post_search;
+INSERT INTO post_search (rowid, title, content, category, username, comments)
+SELECT posts.id, posts.title, posts.content, COALESCE(posts.category, ''), COALESCE(users.username, ''),
+       COALESCE((SELECT group_concat(content, ' ') FROM comments WHERE comments.post_id = posts.id AND comments.hidden_at IS NULL), '')
+FROM posts
+LEFT JOIN users ON posts.user_id = users.id;
+`
+
+// fullTextSearchAvailable reports whether this SQLite build includes FTS5. mattn/go-sqlite3
+// only compiles it in with the sqlite_fts5 build tag.
+func (db *Database) fullTextSearchAvailable() bool {
+	if _, err := db.Conn.Exec("CREATE VIRTUAL TABLE temp.fts5_probe USING fts5(x)"); err != nil {
+		return false
+	}
+	db.Conn.Exec("DROP TABLE temp.fts5_probe")
+	return true
+}
+
+// searchIndexTriggers are dropped when FTS5 is unavailable, so that a database indexed by an
+// FTS5 build can still be written to by one without it. A trigger whose behaviour changes
+// gets a new name, so databases indexed the old way are rebuilt.
+var searchIndexTriggers = []string{
+	"post_search_after_post_insert", "post_search_after_post_update", "post_search_after_post_delete",
+	"post_search_after_comment_insert", "post_search_after_comment_change", "post_search_after_comment_delete",
+	"post_search_after_user_rename",
+}
+
+// retiredSearchIndexTriggers are triggers earlier versions created, dropped on upgrade
+var retiredSearchIndexTriggers = []string{"post_search_after_comment_update"}
+
+// SearchIndexStatus is how far the search index is set up, as shown by migrate status
+type SearchIndexStatus string
+
+const (
+	// SearchIndexReady means the index and all its triggers are in place
+	SearchIndexReady SearchIndexStatus = "ready"
+	// SearchIndexPending means the index is missing or was built by older triggers. It is
+	// built when the server next starts.
+	SearchIndexPending SearchIndexStatus = "built when the server next starts"
+	// SearchIndexUnavailable means this binary was built without FTS5, so search uses LIKE
+	SearchIndexUnavailable SearchIndexStatus = "unavailable without -tags sqlite_fts5, using basic search"
+)
+
+// searchIndexTriggerCount counts the current search index triggers present in the database
+func searchIndexTriggerCount(q interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}) (int, error) {
+	var indexed int
+	for _, trigger := range searchIndexTriggers {
+		var exists int
+		if err := q.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'trigger' AND name = ?", trigger).Scan(&exists); err != nil {
+			return 0, err
+		}
+		indexed += exists
+	}
+	return indexed, nil
+}
+
+// dropSearchIndexTriggers removes the triggers that keep post_search up to date, which leaves
+// the index to be rebuilt by the next SetupSearchIndex
+func dropSearchIndexTriggers(exec interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}) error {
+	for _, trigger := range append(searchIndexTriggers, retiredSearchIndexTriggers...) {
+		if _, err := exec.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SearchIndexStatus reports whether the full-text search index is set up. The index is not
+// one of the numbered migrations, since whether it can exist depends on the binary being
+// built with FTS5.
+func (db *Database) SearchIndexStatus() (SearchIndexStatus, error) {
+	if !db.fullTextSearchAvailable() {
+		return SearchIndexUnavailable, nil
+	}
+	indexed, err := searchIndexTriggerCount(db.Conn)
+	if err != nil {
+		return "", err
+	}
+	if indexed < len(searchIndexTriggers) {
+		return SearchIndexPending, nil
+	}
+	return SearchIndexReady, nil
+}
+
+// SetupSearchIndex creates the full-text search index when SQLite has FTS5, and records the
+// result in db.FullTextSearch. The index is rebuilt from existing posts whenever any of its
+// triggers were missing, since posts written in the meantime weren't indexed, or were indexed
+// by older triggers. Without FTS5, search falls back to matching words with LIKE.
+func (db *Database) SetupSearchIndex() error {
+	if !db.fullTextSearchAvailable() {
+		log.Println("SetupSearchIndex: SQLite was built without FTS5 (build with -tags sqlite_fts5); using basic search")
+		db.FullTextSearch = false
+		return dropSearchIndexTriggers(db.Conn)
+	}
+
+	err := db.inTx(func(tx *sql.Tx) error {
+		indexed, err := searchIndexTriggerCount(tx)
+		if err != nil {
+			return err
+		}
+		for _, trigger := range retiredSearchIndexTriggers {
+			if _, err := tx.Exec("DROP TRIGGER IF EXISTS " + trigger); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(searchIndexSchema); err != nil {
+			return err
+		}
+		if indexed < len(searchIndexTriggers) {
+			log.Println("SetupSearchIndex: Building search index from existing posts")
+			if _, err := tx.Exec(rebuildSearchIndex); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	db.FullTextSearch = true
+	return nil
+}
@@ -3,13 +3,12 @@ package handlers
 import (
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"html/template"
 	"log"
 	"net/http"
 )
 
-func AboutHandler(w http.ResponseWriter, r *http.Request) {
-	tmpl, err := template.ParseFiles("web/templates/about.html", "web/templates/partials/navbar.html")
+func (app *App) AboutHandler(w http.ResponseWriter, r *http.Request) {
+	tmpl, err := parseTemplates(r, "web/templates/about.html", "web/templates/partials/navbar.html")
 	if err != nil {
 		log.Println("Error parsing About page templates:", err)
 		http.Error(w, "Error loading About page", http.StatusInternalServerError)
@@ -20,15 +19,17 @@ func AboutHandler(w http.ResponseWriter, r *http.Request) {
 	var profilePicture string
 
 	// Determine login state
-	sessionUser, err := utils.GetSessionUser(r)
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	if err == nil {
 		isLoggedIn = true
 		profilePicture = sessionUser.ProfilePicture
 	}
 
 	data := viewmodels.HomePageData{
-		IsLoggedIn:     isLoggedIn,
-		ProfilePicture: profilePicture,
+		IsLoggedIn:          isLoggedIn,
+		ProfilePicture:      profilePicture,
+		UnreadMessages:      app.unreadMessages(viewerIDOf(sessionUser)),
+		UnreadNotifications: app.unreadNotifications(viewerIDOf(sessionUser)),
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"ellas-corner/internal/mail"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+const (
+	// passwordResetLifetime is how long a password reset link works
+	passwordResetLifetime = time.Hour
+	// verifyEmailLifetime is how long an email verification link works
+	verifyEmailLifetime = 48 * time.Hour
+)
+
+// newEmailToken stores a single-use token for the member and returns the link to email them
+func (app *App) newEmailToken(userID int, purpose repository.TokenPurpose, path string, lifetime time.Duration) (string, error) {
+	token := utils.GenerateSessionToken() + utils.GenerateSessionToken()
+	if err := app.Store.CreateUserToken(userID, purpose, utils.HashToken(token), time.Now().Add(lifetime)); err != nil {
+		return "", err
+	}
+	return app.SiteURL + path + "?token=" + url.QueryEscape(token), nil
+}
+
+// sendVerificationEmail emails a member a link to confirm their address. New members get it
+// as part of the welcome email.
+func (app *App) sendVerificationEmail(userID int, username, email string, welcome bool) error {
+	verifyURL, err := app.newEmailToken(userID, repository.TokenVerifyEmail, "/verify-email", verifyEmailLifetime)
+	if err != nil {
+		return err
+	}
+	name := "verify_email"
+	if welcome {
+		name = "registration"
+	}
+	app.sendMail(email, name, mail.RegistrationData{Username: username, SiteURL: app.SiteURL, VerifyURL: verifyURL})
+	return nil
+}
+
+// renderAccountPage renders one of the signed-out account pages (forgot and reset password)
+// with the minimal navbar
+func renderAccountPage(w http.ResponseWriter, r *http.Request, page string, data map[string]interface{}) {
+	tmpl, err := parseTemplates(r, "web/templates/"+page, "web/templates/partials/navbar_minimal.html")
+	if err != nil {
+		log.Println("renderAccountPage: Error parsing template:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("renderAccountPage: Error executing template:", err)
+	}
+}
+
+// ForgotPasswordHandler asks for an email address and sends a password reset link to it.
+// The reply is the same whether or not an account uses the address, so the form can't be
+// used to find out who is a member.
+func (app *App) ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		renderAccountPage(w, r, "forgot_password.html", map[string]interface{}{})
+
+	case http.MethodPost:
+		email := r.FormValue("email")
+		user, err := app.Store.GetUserByEmail(email)
+		if err != nil {
+			log.Println("ForgotPasswordHandler: Error looking up user:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			utils.RenderServerErrorPage(w)
+			return
+		}
+
+		if user != nil && !user.Banned {
+			resetURL, err := app.newEmailToken(user.ID, repository.TokenPasswordReset, "/reset-password", passwordResetLifetime)
+			if err != nil {
+				log.Println("ForgotPasswordHandler: Error creating reset token:", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				utils.RenderServerErrorPage(w)
+				return
+			}
+			app.sendMail(user.Email, "password_reset", mail.PasswordResetData{Username: user.Username, ResetURL: resetURL, ExpiresIn: "1 hour"})
+		}
+
+		renderAccountPage(w, r, "forgot_password.html", map[string]interface{}{
+			"Message": "If an account uses " + email + ", we've emailed it a link to reset the password. The link works for 1 hour.",
+		})
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// expiredResetLink is shown for reset links that are unknown, used or out of date
+const expiredResetLink = "That link has expired or was already used. Ask for a new one below."
+
+// ResetPasswordHandler shows the new password form for a reset link, and sets the password
+// on POST. Every session is signed out so the new password is needed everywhere.
+func (app *App) ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	token := r.FormValue("token")
+
+	switch r.Method {
+	case http.MethodGet:
+		if _, err := app.Store.CheckUserToken(repository.TokenPasswordReset, utils.HashToken(token), time.Now()); errors.Is(err, repository.ErrInvalidToken) {
+			renderAccountPage(w, r, "forgot_password.html", map[string]interface{}{"Error": expiredResetLink})
+			return
+		} else if err != nil {
+			log.Println("ResetPasswordHandler: Error checking token:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			utils.RenderServerErrorPage(w)
+			return
+		}
+		renderAccountPage(w, r, "reset_password.html", map[string]interface{}{"Token": token})
+
+	case http.MethodPost:
+		password := r.FormValue("password")
+		if password == "" || password != r.FormValue("confirm_password") {
+			renderAccountPage(w, r, "reset_password.html", map[string]interface{}{
+				"Token": token,
+				"Error": "Please enter the same new password twice.",
+			})
+			return
+		}
+
+		hashedPassword, err := utils.HashPassword(password)
+		if err != nil {
+			w.WriteHeader(http.StatusInternalServerError)
+			utils.RenderServerErrorPage(w)
+			return
+		}
+
+		userID, err := app.Store.ResetPassword(utils.HashToken(token), hashedPassword, time.Now())
+		if errors.Is(err, repository.ErrInvalidToken) {
+			renderAccountPage(w, r, "forgot_password.html", map[string]interface{}{"Error": expiredResetLink})
+			return
+		} else if err != nil {
+			log.Println("ResetPasswordHandler: Error resetting password:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			utils.RenderServerErrorPage(w)
+			return
+		}
+
+		log.Printf("ResetPasswordHandler: User %d reset their password\n", userID)
+		http.Redirect(w, r, "/login?message=Your+password+has+been+changed.+Please+log+in.", http.StatusSeeOther)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// VerifyEmailHandler confirms an email address from the emailed link (GET with ?token=).
+// Without a token it tells a signed-in member whether their address is confirmed, and POST
+// sends them a new link.
+func (app *App) VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, _ := utils.GetSessionUser(app.Store, r)
+	data := viewmodels.VerifyEmailPageData{
+		IsLoggedIn: sessionUser != nil,
+		Message:    r.URL.Query().Get("message"),
+	}
+
+	switch {
+	case r.Method == http.MethodGet && r.URL.Query().Has("token"):
+		_, err := app.Store.VerifyEmail(utils.HashToken(r.URL.Query().Get("token")), time.Now())
+		if errors.Is(err, repository.ErrInvalidToken) {
+			data.Error = "That link has expired or was already used."
+		} else if err != nil {
+			log.Println("VerifyEmailHandler: Error verifying email:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			utils.RenderServerErrorPage(w)
+			return
+		} else {
+			data.Verified = true
+			data.Message = "Thank you, your email address is confirmed."
+		}
+
+	case r.Method == http.MethodGet || r.Method == http.MethodPost:
+		if sessionUser == nil {
+			http.Redirect(w, r, "/login?message=Please+log+in+to+confirm+your+email+address.", http.StatusSeeOther)
+			return
+		}
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Reload the member, since verifying just now changes what they can do
+	if sessionUser != nil {
+		user, err := app.Store.GetUserByID(sessionUser.ID)
+		if err != nil {
+			log.Println("VerifyEmailHandler: Error fetching user:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			utils.RenderServerErrorPage(w)
+			return
+		}
+		data.Email = user.Email
+		data.Verified = data.Verified || user.EmailVerified
+		data.ProfilePicture = user.ProfilePicture
+		data.UnreadMessages = app.unreadMessages(user.ID)
+		data.UnreadNotifications = app.unreadNotifications(user.ID)
+
+		if r.Method == http.MethodPost && !user.EmailVerified {
+			if err := app.sendVerificationEmail(user.ID, user.Username, user.Email, false); err != nil {
+				log.Println("VerifyEmailHandler: Error creating verification token:", err)
+				w.WriteHeader(http.StatusInternalServerError)
+				utils.RenderServerErrorPage(w)
+				return
+			}
+			http.Redirect(w, r, "/verify-email?message="+url.QueryEscape("We've sent a new link to "+user.Email+"."), http.StatusSeeOther)
+			return
+		}
+	}
+
+	tmpl, err := parseTemplates(r, "web/templates/verify_email.html", "web/templates/partials/navbar.html")
+	if err != nil {
+		log.Println("VerifyEmailHandler: Error parsing template:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("VerifyEmailHandler: Error executing template:", err)
+	}
+}
@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"ellas-corner/internal/mail"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+)
+
+// emailedToken returns the token from the link to path in an email
+func emailedToken(t *testing.T, msg mail.Message, path string) string {
+	t.Helper()
+	match := regexp.MustCompile(regexp.QuoteMeta(path) + `\?token=([^\s"]+)`).FindStringSubmatch(msg.Text)
+	if match == nil {
+		t.Fatalf("expected a %s link in %q", path, msg.Text)
+	}
+	token, err := url.QueryUnescape(match[1])
+	if err != nil {
+		t.Fatalf("bad token in link: %v", err)
+	}
+	return token
+}
+
+func postAccountForm(handler http.HandlerFunc, path string, form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if cookie != nil {
+		req.AddCookie(cookie)
+	}
+	rr := httptest.NewRecorder()
+	handler(rr, req)
+	return rr
+}
+
+func TestPasswordReset(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	outbox := &mail.OutboxMailer{}
+	app.Mailer, app.SiteURL = outbox, "https://ellas.example"
+
+	hashed, _ := utils.HashPassword("secret123")
+	if err := app.Store.CreateUser("ella", "ella@example.com", hashed, "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	cookie := loginAndGetCookie(t, app, "ella@example.com", "secret123", "Laptop")
+	if _, err := app.Store.CreateAPIToken(1, utils.HashToken("ella-script-token"), "script"); err != nil {
+		t.Fatalf("Failed to create API token: %v", err)
+	}
+
+	// Unknown addresses get no email, but the same reply
+	postAccountForm(app.ForgotPasswordHandler, "/forgot-password", url.Values{"email": {"nobody@example.com"}}, nil)
+	if sent := outbox.Sent(); len(sent) != 0 {
+		t.Fatalf("expected no email for an unknown address, got %+v", sent)
+	}
+
+	postAccountForm(app.ForgotPasswordHandler, "/forgot-password", url.Values{"email": {"ella@example.com"}}, nil)
+	sent := outbox.Sent()
+	if len(sent) != 1 || sent[0].To != "ella@example.com" {
+		t.Fatalf("expected one reset email to ella, got %+v", sent)
+	}
+	token := emailedToken(t, sent[0], "/reset-password")
+
+	// Mismatched passwords change nothing and keep the link working
+	postAccountForm(app.ResetPasswordHandler, "/reset-password", url.Values{
+		"token": {token}, "password": {"newpass456"}, "confirm_password": {"newpass457"},
+	}, nil)
+	if _, err := app.Store.CheckUserToken(repository.TokenPasswordReset, utils.HashToken(token), time.Now()); err != nil {
+		t.Fatalf("expected the link to still work after a mismatched password, got %v", err)
+	}
+
+	rr := postAccountForm(app.ResetPasswordHandler, "/reset-password", url.Values{
+		"token": {token}, "password": {"newpass456"}, "confirm_password": {"newpass456"},
+	}, nil)
+	if rr.Code != http.StatusSeeOther || !strings.HasPrefix(rr.Header().Get("Location"), "/login?message=") {
+		t.Fatalf("expected a redirect to /login, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	// The old session and API token are signed out and only the new password works
+	if _, err := utils.GetSessionUser(app.Store, requestWithCookie(http.MethodGet, "/", cookie)); err == nil {
+		t.Error("expected resetting the password to sign out existing sessions")
+	}
+	if rr, _ := apiRequest(t, app.Routes(), http.MethodGet, "/api/v1/users/me", "ella-script-token", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected resetting the password to revoke API tokens, got %d", rr.Code)
+	}
+	loginAndGetCookie(t, app, "ella@example.com", "newpass456", "Phone")
+
+	// The link works once
+	postAccountForm(app.ResetPasswordHandler, "/reset-password", url.Values{
+		"token": {token}, "password": {"third789"}, "confirm_password": {"third789"},
+	}, nil)
+	user, _ := app.Store.GetUserByEmail("ella@example.com")
+	if !utils.CheckPasswordHash("newpass456", user.Password) {
+		t.Error("expected a used reset link not to change the password again")
+	}
+}
+
+func TestVerifyEmail(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	outbox := &mail.OutboxMailer{}
+	app.Mailer, app.SiteURL = outbox, "https://ellas.example"
+
+	postAccountForm(app.RegisterHandler, "/register", url.Values{
+		"username": {"ella"}, "email": {"ella@example.com"}, "password": {"secret123"},
+	}, nil)
+	cookie := loginAndGetCookie(t, app, "ella@example.com", "secret123", "Laptop")
+
+	// Unverified members can't comment
+	rr := postAccountForm(app.AddCommentHandler, "/add-comment", url.Values{"post_id": {"1"}, "content": {"Hello"}}, cookie)
+	if rr.Code != http.StatusForbidden {
+		t.Fatalf("expected 403 commenting before verifying, got %d", rr.Code)
+	}
+
+	// Asking for a new link replaces the one in the welcome email
+	rr = postAccountForm(app.VerifyEmailHandler, "/verify-email", nil, cookie)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after sending a new link, got %d", rr.Code)
+	}
+	sent := outbox.Sent()
+	if len(sent) != 2 || sent[1].Subject != "Confirm your email address for Ella's Corner" {
+		t.Fatalf("expected a welcome email and a verification email, got %+v", sent)
+	}
+	oldToken := emailedToken(t, sent[0], "/verify-email")
+	newToken := emailedToken(t, sent[1], "/verify-email")
+
+	verify := func(token string) bool {
+		app.VerifyEmailHandler(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/verify-email?token="+url.QueryEscape(token), nil))
+		user, _ := app.Store.GetUserByEmail("ella@example.com")
+		return user.EmailVerified
+	}
+	if verify(oldToken) {
+		t.Fatal("expected the superseded link to stop working")
+	}
+	if !verify(newToken) {
+		t.Fatal("expected the latest link to confirm the address")
+	}
+
+	sessionUser, err := utils.GetSessionUser(app.Store, requestWithCookie(http.MethodGet, "/", cookie))
+	if err != nil || !sessionUser.EmailVerified {
+		t.Errorf("expected the signed-in member to be verified straight away, got %+v, %v", sessionUser, err)
+	}
+}
@@ -0,0 +1,239 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ellas-corner/internal/authz"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+const (
+	// adminListSize is how many posts, comments and log entries the dashboard shows
+	adminListSize = 50
+	adminTemplate = "web/templates/admin.html"
+)
+
+// requireModerator returns the signed-in user if they may use the moderation dashboard.
+// Signed-out users are sent to the login page and members get a 403.
+func (app *App) requireModerator(w http.ResponseWriter, r *http.Request) (*utils.SessionUser, bool) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+moderate.", http.StatusSeeOther)
+		return nil, false
+	}
+	if !authz.Can(sessionUser, authz.Moderate, 0) {
+		log.Printf("requireModerator: User %d is not a moderator\n", sessionUser.ID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return sessionUser, true
+}
+
+// AdminHandler renders the moderation dashboard: recent posts and comments including hidden
+// ones, every user with their role and ban status, and the moderation log
+func (app *App) AdminHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := app.Store.FetchPostPage(repository.PostQuery{IncludeHidden: true, Limit: adminListSize})
+	if err != nil {
+		log.Println("AdminHandler: Error fetching posts:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	comments, err := app.Store.FetchRecentComments(adminListSize)
+	if err != nil {
+		log.Println("AdminHandler: Error fetching comments:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	users, err := app.Store.FetchUsers()
+	if err != nil {
+		log.Println("AdminHandler: Error fetching users:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	entries, err := app.Store.FetchModerationLog(adminListSize)
+	if err != nil {
+		log.Println("AdminHandler: Error fetching moderation log:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	reported, err := app.Store.FetchReportQueue()
+	if err != nil {
+		log.Println("AdminHandler: Error fetching report queue:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	adminUsers := make([]viewmodels.AdminUser, len(users))
+	for i, user := range users {
+		adminUsers[i] = viewmodels.AdminUser{
+			User:          user,
+			CanBan:        authz.CanManageUser(sessionUser, authz.BanUser, user),
+			CanChangeRole: authz.CanManageUser(sessionUser, authz.ManageRoles, user),
+		}
+	}
+
+	tmpl, err := parseTemplates(r, adminTemplate, "web/templates/partials/navbar.html")
+	if err != nil {
+		log.Println("AdminHandler: Error parsing template:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	data := viewmodels.AdminPageData{
+		IsLoggedIn:          true,
+		ProfilePicture:      sessionUser.ProfilePicture,
+		UnreadMessages:      app.unreadMessages(sessionUser.ID),
+		UnreadNotifications: app.unreadNotifications(sessionUser.ID),
+		Role:                sessionUser.Role,
+		Roles:               []repository.Role{repository.RoleMember, repository.RoleModerator, repository.RoleAdmin},
+		Posts:               page.Posts,
+		Comments:            comments,
+		Users:               adminUsers,
+		Log:                 entries,
+		ReportedItems:       len(reported),
+	}
+
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("AdminHandler: Error executing template:", err)
+	}
+}
+
+// finishModeration redirects back to the dashboard, or reports why a moderation action failed
+func finishModeration(w http.ResponseWriter, r *http.Request, handler string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Printf("%s: Error applying moderation action: %v\n", handler, err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+// AdminPostActionHandler hides, unhides or deletes a post: POST /admin/posts/{id}/{action}
+func (app *App) AdminPostActionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireModerator(w, r)
+	if !ok {
+		return
+	}
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid post ID", http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+
+	switch r.PathValue("action") {
+	case "hide":
+		err = app.Store.SetPostHidden(sessionUser.ID, postID, true, reason)
+	case "unhide":
+		err = app.Store.SetPostHidden(sessionUser.ID, postID, false, reason)
+	case "delete":
+		err = app.Store.ModeratorDeletePost(sessionUser.ID, postID, reason)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	finishModeration(w, r, "AdminPostActionHandler", err)
+}
+
+// AdminCommentActionHandler hides, unhides or deletes a comment: POST /admin/comments/{id}/{action}
+func (app *App) AdminCommentActionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireModerator(w, r)
+	if !ok {
+		return
+	}
+	commentID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid comment ID", http.StatusBadRequest)
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+
+	switch r.PathValue("action") {
+	case "hide":
+		err = app.Store.SetCommentHidden(sessionUser.ID, commentID, true, reason)
+	case "unhide":
+		err = app.Store.SetCommentHidden(sessionUser.ID, commentID, false, reason)
+	case "delete":
+		err = app.Store.ModeratorDeleteComment(sessionUser.ID, commentID, reason)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	finishModeration(w, r, "AdminCommentActionHandler", err)
+}
+
+// AdminUserActionHandler bans, unbans or changes the role of a user: POST /admin/users/{id}/{action}.
+// Moderators can ban members; only admins can ban moderators or change roles.
+func (app *App) AdminUserActionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireModerator(w, r)
+	if !ok {
+		return
+	}
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	target, err := app.Store.GetUserByID(userID)
+	if err != nil {
+		finishModeration(w, r, "AdminUserActionHandler", err)
+		return
+	}
+	reason := strings.TrimSpace(r.FormValue("reason"))
+
+	action := r.PathValue("action")
+	permission := authz.BanUser
+	if action == "role" {
+		permission = authz.ManageRoles
+	}
+	if !authz.CanManageUser(sessionUser, permission, target) {
+		log.Printf("AdminUserActionHandler: User %d may not %s user %d\n", sessionUser.ID, action, userID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	switch action {
+	case "ban":
+		err = app.Store.BanUser(sessionUser.ID, userID, reason)
+	case "unban":
+		err = app.Store.UnbanUser(sessionUser.ID, userID, reason)
+	case "role":
+		role := repository.Role(r.FormValue("role"))
+		if !repository.ValidRole(role) {
+			http.Error(w, "Invalid role", http.StatusBadRequest)
+			return
+		}
+		err = app.Store.SetUserRole(sessionUser.ID, userID, role)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	finishModeration(w, r, "AdminUserActionHandler", err)
+}
@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+// moderationRequest sends a form POST to the dashboard routes with a session cookie
+func moderationRequest(mux *http.ServeMux, path string, cookie *http.Cookie, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestModeration(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+
+	aliceToken := createAPIUser(t, app, mux, "alice", "alice@example.com")
+	bobToken := createAPIUser(t, app, mux, "bob", "bob@example.com")
+	modToken := createAPIUser(t, app, mux, "mod", "mod@example.com")
+	if err := app.Store.SetUserRole(0, 3, repository.RoleModerator); err != nil {
+		t.Fatalf("SetUserRole failed: %v", err)
+	}
+	bobCookie := loginAndGetCookie(t, app, "bob@example.com", "secret123", "test")
+	modCookie := loginAndGetCookie(t, app, "mod@example.com", "secret123", "test")
+
+	for _, title := range []string{"First", "Second"} {
+		rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts", aliceToken, `{"title":"`+title+`","content":"text"}`)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("expected 201 creating post, got %d", rr.Code)
+		}
+	}
+
+	// Anyone could delete any post by ID; now only the author or a moderator can
+	if rr := moderationRequest(mux, "/delete-post", bobCookie, url.Values{"post_id": {"1"}}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 deleting someone else's post, got %d", rr.Code)
+	}
+	if rr, _ := apiRequest(t, mux, http.MethodDelete, "/api/v1/posts/1", bobToken, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 deleting someone else's post over the API, got %d", rr.Code)
+	}
+	if rr := moderationRequest(mux, "/admin/posts/1/hide", bobCookie, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a member using the dashboard, got %d", rr.Code)
+	}
+
+	// Hidden posts disappear for members but not for moderators
+	if rr := moderationRequest(mux, "/admin/posts/1/hide", modCookie, url.Values{"reason": {"spam"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after hiding, got %d", rr.Code)
+	}
+	if rr, _ := apiRequest(t, mux, http.MethodGet, "/api/v1/posts/1", bobToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for a hidden post, got %d", rr.Code)
+	}
+	if rr, _ := apiRequest(t, mux, http.MethodGet, "/api/v1/posts/1", modToken, ""); rr.Code != http.StatusOK {
+		t.Errorf("expected moderators to see hidden posts, got %d", rr.Code)
+	}
+
+	if rr, _ := apiRequest(t, mux, http.MethodDelete, "/api/v1/posts/2?reason=duplicate", modToken, ""); rr.Code != http.StatusNoContent {
+		t.Errorf("expected a moderator to delete the post, got %d", rr.Code)
+	}
+
+	// Moderators can ban members, which signs them out and stops them logging in again
+	if rr := moderationRequest(mux, "/admin/users/3/ban", modCookie, nil); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a moderator banning themselves, got %d", rr.Code)
+	}
+	if rr := moderationRequest(mux, "/admin/users/2/role", modCookie, url.Values{"role": {"admin"}}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a moderator changing roles, got %d", rr.Code)
+	}
+	if rr := moderationRequest(mux, "/admin/users/2/ban", modCookie, url.Values{"reason": {"abuse"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after banning, got %d", rr.Code)
+	}
+	if rr, _ := apiRequest(t, mux, http.MethodGet, "/api/v1/users/me", bobToken, ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected the banned user's token to stop working, got %d", rr.Code)
+	}
+	rr, body := apiRequest(t, mux, http.MethodPost, "/api/v1/tokens", "", `{"email":"bob@example.com","password":"secret123"}`)
+	if rr.Code != http.StatusForbidden || body["error"].(map[string]interface{})["code"] != "banned" {
+		t.Errorf("expected 403 banned creating a token, got %d", rr.Code)
+	}
+
+	entries, err := app.Store.FetchModerationLog(10)
+	if err != nil {
+		t.Fatalf("FetchModerationLog failed: %v", err)
+	}
+	var actions []string
+	for _, e := range entries {
+		actions = append(actions, e.Action)
+	}
+	if got := strings.Join(actions, ","); got != "ban_user,delete_post,hide_post,set_role" {
+		t.Errorf("unexpected moderation log: %s", got)
+	}
+}
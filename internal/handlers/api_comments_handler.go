@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ellas-corner/internal/authz"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+// loadAPIComment fetches a comment, writing a 404 or 500 response and returning nil if it cannot
+// be loaded. Hidden comments are only visible to moderators; viewer is nil for anonymous requests.
+func (app *App) loadAPIComment(w http.ResponseWriter, commentID int, viewer *utils.SessionUser) *repository.Comment {
+	comment, err := app.Store.GetCommentByID(commentID, viewerIDOf(viewer))
+	if err != nil {
+		log.Println("loadAPIComment: Error fetching comment:", err)
+		writeAPIServerError(w)
+		return nil
+	}
+	if comment == nil || (comment.Hidden && !authz.Can(viewer, authz.ViewHidden, 0)) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Comment not found")
+		return nil
+	}
+	return comment
+}
+
+// APIListCommentsHandler returns the comment tree for a post
+func (app *App) APIListCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	postID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	post := app.loadAPIPost(w, postID, app.apiViewer(r))
+	if post == nil {
+		return
+	}
+
+	comments := viewmodels.NewCommentsJSON(post.Comments)
+	if comments == nil {
+		comments = []viewmodels.CommentJSON{}
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"comments": comments})
+}
+
+// APIGetCommentHandler returns a single comment
+func (app *App) APIGetCommentHandler(w http.ResponseWriter, r *http.Request) {
+	commentID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	comment := app.loadAPIComment(w, commentID, app.apiViewer(r))
+	if comment == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, viewmodels.NewCommentJSON(*comment))
+}
+
+// APICreateCommentHandler adds a comment, or a reply when parent_comment_id is set
+func (app *App) APICreateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok || !authorizeAPI(w, sessionUser, authz.CreateContent, 0, cannotPostMessage) {
+		return
+	}
+	postID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Content         string `json:"content"`
+		ParentCommentID *int   `json:"parent_comment_id"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.Content) == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "Comment cannot be empty or only spaces")
+		return
+	}
+
+	if post := app.loadAPIPost(w, postID, sessionUser); post == nil {
+		return
+	}
+
+	commentID, err := app.Store.CreateCommentReturningID(sessionUser.ID, postID, body.Content, body.ParentCommentID)
+	if err == repository.ErrInvalidParentComment {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "parent_comment_id must be a comment on the same post")
+		return
+	} else if err != nil {
+		log.Println("APICreateCommentHandler: Error creating comment:", err)
+		writeAPIServerError(w)
+		return
+	}
+
+	comment := app.loadAPIComment(w, commentID, sessionUser)
+	if comment == nil {
+		return
+	}
+	w.Header().Set("Location", "/api/v1/comments/"+strconv.Itoa(commentID))
+	writeJSON(w, http.StatusCreated, viewmodels.NewCommentJSON(*comment))
+}
+
+// APIUpdateCommentHandler changes the text of a comment. Only the author can edit a comment.
+func (app *App) APIUpdateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	comment := app.loadAPIComment(w, commentID, sessionUser)
+	if comment == nil {
+		return
+	}
+	if !authorizeAPI(w, sessionUser, authz.EditComment, comment.UserID, "You can only edit your own comments") {
+		return
+	}
+
+	var body struct {
+		Content string `json:"content"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	if strings.TrimSpace(body.Content) == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "Comment cannot be empty or only spaces")
+		return
+	}
+
+	if err := app.Store.UpdateComment(commentID, body.Content); err != nil {
+		writeAPIServerError(w)
+		return
+	}
+
+	comment = app.loadAPIComment(w, commentID, sessionUser)
+	if comment == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, viewmodels.NewCommentJSON(*comment))
+}
+
+// APIDeleteCommentHandler deletes a comment. Authors can delete their own comments, and
+// moderators any comment, optionally giving a ?reason= for the moderation log.
+func (app *App) APIDeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok {
+		return
+	}
+	commentID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	comment := app.loadAPIComment(w, commentID, sessionUser)
+	if comment == nil {
+		return
+	}
+	if !authorizeAPI(w, sessionUser, authz.DeleteComment, comment.UserID, "You can only delete your own comments") {
+		return
+	}
+
+	if err := app.deleteCommentAs(sessionUser, comment, r.URL.Query().Get("reason")); err != nil {
+		writeAPIServerError(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APICommentReactionHandler toggles the user's reaction on a comment, like APIPostReactionHandler
+func (app *App) APICommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok || !authorizeAPI(w, sessionUser, authz.CreateContent, 0, cannotPostMessage) {
+		return
+	}
+	commentID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reaction string `json:"reaction"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	if !validReaction(body.Reaction) {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "reaction must be \"like\" or \"dislike\"")
+		return
+	}
+
+	if comment := app.loadAPIComment(w, commentID, sessionUser); comment == nil {
+		return
+	} else if comment.UserReaction == body.Reaction {
+		if err := app.Store.RemoveCommentReaction(sessionUser.ID, commentID); err != nil {
+			writeAPIServerError(w)
+			return
+		}
+	} else if err := app.Store.AddCommentReaction(sessionUser.ID, commentID, body.Reaction); err != nil {
+		writeAPIServerError(w)
+		return
+	}
+
+	comment := app.loadAPIComment(w, commentID, sessionUser)
+	if comment == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, viewmodels.ReactionJSON{Likes: comment.Likes, Dislikes: comment.Dislikes, UserReaction: comment.UserReaction})
+}
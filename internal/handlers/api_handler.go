@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ellas-corner/internal/authz"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+// maxAPIBodySize caps JSON request bodies for the /api/v1 endpoints
+const maxAPIBodySize = 1 << 20
+
+// writeJSON encodes v as the JSON response body with the given status code
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Println("writeJSON: Error encoding response:", err)
+	}
+}
+
+// writeAPIError sends a structured error body, e.g. {"error": {"code": "not_found", "message": "..."}}
+func writeAPIError(w http.ResponseWriter, status int, code, message string) {
+	writeJSON(w, status, viewmodels.APIErrorResponse{
+		Error: viewmodels.APIError{Code: code, Message: message},
+	})
+}
+
+func writeAPIServerError(w http.ResponseWriter) {
+	writeAPIError(w, http.StatusInternalServerError, "internal_error", "Something went wrong on our side. Please try again later.")
+}
+
+// decodeJSON reads a JSON request body into v, rejecting unknown fields and oversized bodies
+func decodeJSON(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodySize)
+	decoder := json.NewDecoder(r.Body)
+	decoder.DisallowUnknownFields()
+
+	if err := decoder.Decode(v); err != nil {
+		message := "Request body must be valid JSON"
+		var maxBytesErr *http.MaxBytesError
+		switch {
+		case errors.As(err, &maxBytesErr):
+			writeAPIError(w, http.StatusRequestEntityTooLarge, "body_too_large", "Request body is too large")
+			return false
+		case errors.Is(err, io.EOF):
+			message = "Request body is empty"
+		case strings.HasPrefix(err.Error(), "json: unknown field"):
+			message = strings.TrimPrefix(err.Error(), "json: ")
+		}
+		writeAPIError(w, http.StatusBadRequest, "invalid_json", message)
+		return false
+	}
+	return true
+}
+
+// requireAPIUser returns the authenticated user, or writes a 401 response and returns false
+func (app *App) requireAPIUser(w http.ResponseWriter, r *http.Request) (*utils.SessionUser, bool) {
+	sessionUser, err := utils.GetAPIUser(app.Store, r)
+	if err != nil {
+		writeAPIError(w, http.StatusUnauthorized, "unauthenticated", "Log in or send an 'Authorization: Bearer <token>' header")
+		return nil, false
+	}
+	return sessionUser, true
+}
+
+// cannotPostMessage is the API error for members who may not post, comment or react, which
+// until they confirm their email address includes new members
+const cannotPostMessage = "Your account can't post or react. If you joined recently, confirm your email address first"
+
+// authorizeAPI checks authz.Can, writing a 403 response with message and returning false if
+// the user may not perform action on something owned by ownerID
+func authorizeAPI(w http.ResponseWriter, user *utils.SessionUser, action authz.Action, ownerID int, message string) bool {
+	if !authz.Can(user, action, ownerID) {
+		writeAPIError(w, http.StatusForbidden, "forbidden", message)
+		return false
+	}
+	return true
+}
+
+// apiViewer returns the user making the request, or nil for anonymous requests
+func (app *App) apiViewer(r *http.Request) *utils.SessionUser {
+	sessionUser, err := utils.GetAPIUser(app.Store, r)
+	if err != nil {
+		return nil
+	}
+	return sessionUser
+}
+
+// apiViewerID returns the ID of the user making the request, or 0 for anonymous requests
+func (app *App) apiViewerID(r *http.Request) int {
+	return viewerIDOf(app.apiViewer(r))
+}
+
+// viewerIDOf returns the user's ID, or 0 for a nil (anonymous) user
+func viewerIDOf(user *utils.SessionUser) int {
+	if user == nil {
+		return 0
+	}
+	return user.ID
+}
+
+// pathID parses a numeric path parameter such as {id}, writing a 400 response if it is invalid
+func pathID(w http.ResponseWriter, r *http.Request, name string) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue(name))
+	if err != nil || id <= 0 {
+		writeAPIError(w, http.StatusBadRequest, "invalid_id", "The "+name+" in the URL must be a positive number")
+		return 0, false
+	}
+	return id, true
+}
+
+// validReaction reports whether a reaction type is one the forum supports
+func validReaction(reaction string) bool {
+	return reaction == "like" || reaction == "dislike"
+}
+
+// LegacyPostsAPIHandler redirects the old /api/posts route, which rendered HTML, to the JSON API
+func (app *App) LegacyPostsAPIHandler(w http.ResponseWriter, r *http.Request) {
+	target := "/api/v1/posts"
+	if id := r.URL.Query().Get("id"); id != "" {
+		target += "/" + id
+	}
+	http.Redirect(w, r, target, http.StatusMovedPermanently)
+}
+
+// APINotFoundHandler answers unknown /api/v1 routes with a JSON error instead of the HTML 404 page
+func (app *App) APINotFoundHandler(w http.ResponseWriter, r *http.Request) {
+	writeAPIError(w, http.StatusNotFound, "not_found", "No API endpoint matches "+r.Method+" "+r.URL.Path)
+}
+
+// APICreateTokenHandler exchanges an email and password for a new API token.
+// The plain token is only returned once; only its hash is stored.
+func (app *App) APICreateTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		Email    string `json:"email"`
+		Password string `json:"password"`
+		Name     string `json:"name"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+
+	user, err := app.Store.GetUserByEmail(body.Email)
+	if err != nil || user == nil || !utils.CheckPasswordHash(body.Password, user.Password) {
+		writeAPIError(w, http.StatusUnauthorized, "invalid_credentials", "Invalid email or password")
+		return
+	}
+	if user.Banned {
+		writeAPIError(w, http.StatusForbidden, "banned", bannedMessage(user))
+		return
+	}
+
+	token := utils.GenerateSessionToken() + utils.GenerateSessionToken()
+	id, err := app.Store.CreateAPIToken(user.ID, utils.HashToken(token), strings.TrimSpace(body.Name))
+	if err != nil {
+		log.Println("APICreateTokenHandler: Error creating token:", err)
+		writeAPIServerError(w)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, viewmodels.TokenJSON{ID: id, Token: token, Name: strings.TrimSpace(body.Name)})
+}
+
+// APIDeleteTokenHandler revokes the bearer token used to make the request
+func (app *App) APIDeleteTokenHandler(w http.ResponseWriter, r *http.Request) {
+	token := utils.BearerToken(r)
+	if token == "" {
+		writeAPIError(w, http.StatusBadRequest, "missing_token", "Send the token to revoke in an 'Authorization: Bearer <token>' header")
+		return
+	}
+	if _, ok := app.requireAPIUser(w, r); !ok {
+		return
+	}
+
+	if err := app.Store.DeleteAPIToken(utils.HashToken(token)); err != nil {
+		writeAPIServerError(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIGetCurrentUserHandler returns the authenticated user's own profile, including private settings
+func (app *App) APIGetCurrentUserHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok {
+		return
+	}
+
+	user, err := app.Store.GetUserByID(sessionUser.ID)
+	if err != nil {
+		log.Println("APIGetCurrentUserHandler: Error fetching user:", err)
+		writeAPIServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, viewmodels.NewUserJSON(user, true))
+}
+
+// APIGetUserHandler returns a user's public profile
+func (app *App) APIGetUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	user, err := app.Store.GetUserByID(userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "User not found")
+		return
+	} else if err != nil {
+		log.Println("APIGetUserHandler: Error fetching user:", err)
+		writeAPIServerError(w)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, viewmodels.NewUserJSON(user, user.ID == app.apiViewerID(r)))
+}
+
+// APIListUserPostsHandler returns a page of the posts written by a user, newest first
+func (app *App) APIListUserPostsHandler(w http.ResponseWriter, r *http.Request) {
+	userID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	if _, err := app.Store.GetUserByID(userID); errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "User not found")
+		return
+	} else if err != nil {
+		writeAPIServerError(w)
+		return
+	}
+
+	app.writeAPIPostPage(w, r, repository.PostQuery{CreatedBy: userID, ViewerID: app.apiViewerID(r)})
+}
@@ -0,0 +1,197 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+)
+
+// setupTestAPI creates a file-backed test database (nested queries need a shared
+// database across connections) and returns an App using it along with its routes
+func setupTestAPI(t *testing.T) (*App, *http.ServeMux) {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "api.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize test DB: %v", err)
+	}
+	t.Cleanup(func() { conn.Conn.Close() })
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+
+	app := NewApp(repository.NewSQLStore(conn))
+	return app, app.Routes()
+}
+
+func apiRequest(t *testing.T, mux *http.ServeMux, method, path, token, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+
+	var decoded map[string]interface{}
+	if rr.Body.Len() > 0 {
+		if err := json.Unmarshal(rr.Body.Bytes(), &decoded); err != nil {
+			t.Fatalf("%s %s: response is not JSON: %v (%s)", method, path, err, rr.Body.String())
+		}
+	}
+	return rr, decoded
+}
+
+func createAPIUser(t *testing.T, app *App, mux *http.ServeMux, username, email string) string {
+	hashed, _ := utils.HashPassword("secret123")
+	if err := app.Store.CreateUser(username, email, hashed, "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	user, err := app.Store.GetUserByEmail(email)
+	if err != nil || app.Store.MarkEmailVerified(user.ID) != nil {
+		t.Fatalf("Failed to verify user: %v", err)
+	}
+
+	rr, body := apiRequest(t, mux, http.MethodPost, "/api/v1/tokens", "", `{"email":"`+email+`","password":"secret123","name":"test"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 creating token, got %d: %s", rr.Code, rr.Body.String())
+	}
+	return body["token"].(string)
+}
+
+func TestAPIPostLifecycle(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+	token := createAPIUser(t, app, mux, "ella", "ella@example.com")
+	otherToken := createAPIUser(t, app, mux, "other", "other@example.com")
+
+	// Anonymous users cannot create posts
+	rr, body := apiRequest(t, mux, http.MethodPost, "/api/v1/posts", "", `{"title":"Pram","content":"Folds flat"}`)
+	if rr.Code != http.StatusUnauthorized || body["error"].(map[string]interface{})["code"] != "unauthenticated" {
+		t.Fatalf("expected structured 401, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr, body = apiRequest(t, mux, http.MethodPost, "/api/v1/posts", token, `{"title":"Pram","content":"Folds flat","category":"Newborn"}`)
+	if rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if body["title"] != "Pram" || body["username"] != "ella" {
+		t.Errorf("unexpected post body: %v", body)
+	}
+	location := rr.Header().Get("Location")
+
+	// Only the author can update
+	rr, _ = apiRequest(t, mux, http.MethodPatch, location, otherToken, `{"title":"Mine now"}`)
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 updating someone else's post, got %d", rr.Code)
+	}
+	rr, body = apiRequest(t, mux, http.MethodPatch, location, token, `{"title":"Travel pram"}`)
+	if rr.Code != http.StatusOK || body["title"] != "Travel pram" || body["content"] != "Folds flat" {
+		t.Errorf("expected partial update, got %d: %v", rr.Code, body)
+	}
+
+	// Reacting twice with the same reaction toggles it off
+	rr, body = apiRequest(t, mux, http.MethodPost, location+"/reactions", otherToken, `{"reaction":"like"}`)
+	if rr.Code != http.StatusOK || body["likes"].(float64) != 1 {
+		t.Errorf("expected 1 like, got %d: %v", rr.Code, body)
+	}
+	_, body = apiRequest(t, mux, http.MethodPost, location+"/reactions", otherToken, `{"reaction":"like"}`)
+	if body["likes"].(float64) != 0 || body["user_reaction"] != "" {
+		t.Errorf("expected like to be toggled off, got %v", body)
+	}
+
+	rr, _ = apiRequest(t, mux, http.MethodPost, location+"/comments", otherToken, `{"content":"Great tip"}`)
+	if rr.Code != http.StatusCreated {
+		t.Errorf("expected 201 creating comment, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr, body = apiRequest(t, mux, http.MethodGet, "/api/v1/posts", "", "")
+	if rr.Code != http.StatusOK || len(body["posts"].([]interface{})) != 1 {
+		t.Fatalf("expected one post in list, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr, body = apiRequest(t, mux, http.MethodGet, location, "", "")
+	if rr.Code != http.StatusOK || body["comment_count"].(float64) != 1 {
+		t.Errorf("expected post with 1 comment, got %d: %v", rr.Code, body)
+	}
+
+	rr, _ = apiRequest(t, mux, http.MethodDelete, location, token, "")
+	if rr.Code != http.StatusNoContent {
+		t.Errorf("expected 204 deleting post, got %d", rr.Code)
+	}
+	rr, body = apiRequest(t, mux, http.MethodGet, location, "", "")
+	if rr.Code != http.StatusNotFound || body["error"].(map[string]interface{})["code"] != "not_found" {
+		t.Errorf("expected structured 404 after delete, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestAPIRejectsBadInput(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+	token := createAPIUser(t, app, mux, "ella", "ella@example.com")
+
+	rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts", token, `{"title":"Pram","colour":"red"}`)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for unknown field, got %d", rr.Code)
+	}
+	rr, _ = apiRequest(t, mux, http.MethodPost, "/api/v1/posts", token, `{"title":"  ","content":"x"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for blank title, got %d", rr.Code)
+	}
+	rr, _ = apiRequest(t, mux, http.MethodGet, "/api/v1/posts/abc", "", "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for non-numeric id, got %d", rr.Code)
+	}
+	rr, _ = apiRequest(t, mux, http.MethodGet, "/api/v1/nothing-here", "", "")
+	if rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for unknown route, got %d", rr.Code)
+	}
+	rr, _ = apiRequest(t, mux, http.MethodGet, "/api/v1/users/me", "not-a-real-token", "")
+	if rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 for invalid token, got %d", rr.Code)
+	}
+}
+
+func TestAPIPostsPagination(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+	if err := app.Store.CreateUser("ella", "ella@example.com", "hash", "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	for _, title := range []string{"Pram", "Cot", "Sling"} {
+		if err := app.Store.CreatePost(1, title, "content", "General", "", false, "no_location"); err != nil {
+			t.Fatalf("Failed to create post: %v", err)
+		}
+	}
+
+	rr, body := apiRequest(t, mux, http.MethodGet, "/api/v1/posts?limit=2", "", "")
+	if rr.Code != http.StatusOK || len(body["posts"].([]interface{})) != 2 || body["has_more"] != true {
+		t.Fatalf("expected first page of 2 posts, got %d: %s", rr.Code, rr.Body.String())
+	}
+	cursor, ok := body["next_cursor"].(string)
+	if !ok || cursor == "" {
+		t.Fatalf("expected a next_cursor, got %v", body["next_cursor"])
+	}
+
+	rr, body = apiRequest(t, mux, http.MethodGet, "/api/v1/posts?limit=2&cursor="+cursor, "", "")
+	posts := body["posts"].([]interface{})
+	if rr.Code != http.StatusOK || len(posts) != 1 || posts[0].(map[string]interface{})["title"] != "Pram" {
+		t.Fatalf("expected the oldest post on the last page, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if body["next_cursor"] != nil || body["has_more"] != false {
+		t.Errorf("expected no next_cursor on the last page, got %v", body["next_cursor"])
+	}
+
+	rr, _ = apiRequest(t, mux, http.MethodGet, "/api/v1/posts?cursor=bogus", "", "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a malformed cursor, got %d", rr.Code)
+	}
+	rr, _ = apiRequest(t, mux, http.MethodGet, "/api/v1/posts?limit=1000", "", "")
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an oversized limit, got %d", rr.Code)
+	}
+}
@@ -0,0 +1,326 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"ellas-corner/internal/authz"
+	"ellas-corner/internal/images"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+// postInput is the JSON body accepted when creating or updating a post.
+// Fields are pointers so that an update can change only the fields that are sent.
+type postInput struct {
+	Title      *string `json:"title"`
+	Content    *string `json:"content"`
+	Category   *string `json:"category"`
+	IsDonation *bool   `json:"is_donation"`
+}
+
+// loadAPIPost fetches a post with its reaction counts and the viewer's reaction,
+// writing a 404 or 500 response and returning nil if it cannot be loaded. Hidden posts
+// are only visible to moderators; viewer is nil for anonymous requests.
+func (app *App) loadAPIPost(w http.ResponseWriter, postID int, viewer *utils.SessionUser) *repository.Post {
+	viewerID := viewerIDOf(viewer)
+	post, err := app.Store.GetPostByID(strconv.Itoa(postID), viewerID)
+	if err != nil {
+		log.Println("loadAPIPost: Error fetching post:", err)
+		writeAPIServerError(w)
+		return nil
+	}
+	if post == nil || (post.Hidden && !authz.Can(viewer, authz.ViewHidden, 0)) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "Post not found")
+		return nil
+	}
+
+	post.Likes, post.Dislikes, err = app.Store.FetchReactionsCount(post.ID)
+	if err != nil {
+		writeAPIServerError(w)
+		return nil
+	}
+	if viewerID != 0 {
+		post.UserReaction, err = app.Store.FetchUserReaction(viewerID, post.ID)
+		if err != nil {
+			writeAPIServerError(w)
+			return nil
+		}
+	}
+	return post
+}
+
+// apiPostCategory returns the name of the category sent for a post by name or slug, writing
+// a 422 or 500 response and returning false when it can't be used
+func (app *App) apiPostCategory(w http.ResponseWriter, value string) (string, bool) {
+	name, known, err := app.postCategory(value)
+	if err != nil {
+		log.Println("apiPostCategory: Error looking up category:", err)
+		writeAPIServerError(w)
+		return "", false
+	}
+	if !known {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "category must be the name or slug of one of the categories")
+		return "", false
+	}
+	return name, true
+}
+
+// APIListCategoriesHandler returns every category in the order the site shows them. A post's
+// category can be given by name or slug.
+func (app *App) APIListCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	categories, err := app.Store.FetchCategories()
+	if err != nil {
+		log.Println("APIListCategoriesHandler: Error fetching categories:", err)
+		writeAPIServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{"categories": viewmodels.NewCategoriesJSON(categories)})
+}
+
+// writeAPIPostPage fetches one page of posts for q, paged by the request's ?limit=, ?cursor=
+// and ?page= parameters, and writes it with the cursor for the next page
+func (app *App) writeAPIPostPage(w http.ResponseWriter, r *http.Request, q repository.PostQuery) {
+	limit := repository.DefaultPageSize
+	if limitStr := r.URL.Query().Get("limit"); limitStr != "" {
+		var err error
+		limit, err = strconv.Atoi(limitStr)
+		if err != nil || limit < 1 || limit > maxAPIPageSize {
+			writeAPIError(w, http.StatusBadRequest, "invalid_limit", "limit must be between 1 and "+strconv.Itoa(maxAPIPageSize))
+			return
+		}
+	}
+
+	if _, err := applyPagination(r, &q, limit); err != nil {
+		writeAPIError(w, http.StatusBadRequest, "invalid_cursor", "cursor is malformed or cannot be used with this sort; use page instead")
+		return
+	}
+
+	result, err := app.Store.FetchPostPage(q)
+	if err != nil {
+		log.Println("writeAPIPostPage: Error fetching posts:", err)
+		writeAPIServerError(w)
+		return
+	}
+
+	var nextCursor *string
+	if result.NextCursor != "" {
+		nextCursor = &result.NextCursor
+	}
+	writeJSON(w, http.StatusOK, viewmodels.PostPageJSON{
+		Posts:      viewmodels.NewPostsJSON(result.Posts),
+		NextCursor: nextCursor,
+		HasMore:    result.HasMore,
+	})
+}
+
+// APIListPostsHandler returns a page of posts, newest first. It accepts the same filter and
+// sort query parameters as the filter page (see postQueryFromRequest), and ?q= to search,
+// in which case the best matches come first.
+func (app *App) APIListPostsHandler(w http.ResponseWriter, r *http.Request) {
+	query := postQueryFromRequest(r, app.apiViewerID(r))
+	query.Search = strings.TrimSpace(r.URL.Query().Get("q"))
+	app.writeAPIPostPage(w, r, query)
+}
+
+// APIGetPostHandler returns a single post with its comment tree
+func (app *App) APIGetPostHandler(w http.ResponseWriter, r *http.Request) {
+	postID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	post := app.loadAPIPost(w, postID, app.apiViewer(r))
+	if post == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, viewmodels.NewPostJSON(*post, true))
+}
+
+// APICreatePostHandler creates a post for the authenticated user.
+// Donations are tagged with the user's country, as on the create post page.
+func (app *App) APICreatePostHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok || !authorizeAPI(w, sessionUser, authz.CreateContent, 0, cannotPostMessage) {
+		return
+	}
+
+	var input postInput
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+
+	title, content, category := "", "", "General"
+	if input.Title != nil {
+		title = strings.TrimSpace(*input.Title)
+	}
+	if input.Content != nil {
+		content = *input.Content
+	}
+	if input.Category != nil && strings.TrimSpace(*input.Category) != "" {
+		category = strings.TrimSpace(*input.Category)
+	}
+	isDonation := input.IsDonation != nil && *input.IsDonation
+
+	if title == "" || strings.TrimSpace(content) == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "Post title and content cannot be empty or spaces only.")
+		return
+	}
+	if category, ok = app.apiPostCategory(w, category); !ok {
+		return
+	}
+
+	postID, err := app.Store.CreatePostReturningID(sessionUser.ID, title, content, category, images.PlaceholderImage, isDonation, sessionUser.Country)
+	if err != nil {
+		log.Println("APICreatePostHandler: Error creating post:", err)
+		writeAPIServerError(w)
+		return
+	}
+
+	post := app.loadAPIPost(w, postID, sessionUser)
+	if post == nil {
+		return
+	}
+	w.Header().Set("Location", "/api/v1/posts/"+strconv.Itoa(postID))
+	writeJSON(w, http.StatusCreated, viewmodels.NewPostJSON(*post, true))
+}
+
+// APIUpdatePostHandler changes the fields sent in the body. Only the author can update a post.
+func (app *App) APIUpdatePostHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	post := app.loadAPIPost(w, postID, sessionUser)
+	if post == nil {
+		return
+	}
+	if !authorizeAPI(w, sessionUser, authz.EditPost, post.UserID, "You can only edit your own posts") {
+		return
+	}
+
+	var input postInput
+	if !decodeJSON(w, r, &input) {
+		return
+	}
+
+	title, content, category, isDonation := post.Title, post.Content, post.Category, post.IsDonation
+	if input.Title != nil {
+		title = strings.TrimSpace(*input.Title)
+	}
+	if input.Content != nil {
+		content = *input.Content
+	}
+	if input.Category != nil {
+		category = strings.TrimSpace(*input.Category)
+	}
+	if input.IsDonation != nil {
+		isDonation = *input.IsDonation
+	}
+
+	if title == "" || strings.TrimSpace(content) == "" {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "Post title and content cannot be empty or spaces only.")
+		return
+	}
+	if category != post.Category {
+		if category, ok = app.apiPostCategory(w, category); !ok {
+			return
+		}
+	}
+
+	err := app.Store.UpdatePost(postID, title, content, category, isDonation)
+	if errors.Is(err, repository.ErrDonationUnavailable) {
+		writeAPIError(w, http.StatusConflict, "donation_unavailable", donationInUseMessage)
+		return
+	}
+	if err != nil {
+		log.Println("APIUpdatePostHandler: Error updating post:", err)
+		writeAPIServerError(w)
+		return
+	}
+
+	post = app.loadAPIPost(w, postID, sessionUser)
+	if post == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, viewmodels.NewPostJSON(*post, true))
+}
+
+// APIDeletePostHandler deletes a post. Authors can delete their own posts, and moderators any
+// post, optionally giving a ?reason= for the moderation log.
+func (app *App) APIDeletePostHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	post := app.loadAPIPost(w, postID, sessionUser)
+	if post == nil {
+		return
+	}
+	if !authorizeAPI(w, sessionUser, authz.DeletePost, post.UserID, "You can only delete your own posts") {
+		return
+	}
+
+	if err := app.deletePostAs(sessionUser, post, r.URL.Query().Get("reason")); err != nil {
+		log.Println("APIDeletePostHandler: Error deleting post:", err)
+		writeAPIServerError(w)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// APIPostReactionHandler toggles the user's reaction on a post: sending the same reaction
+// again removes it, and sending the other reaction switches to it
+func (app *App) APIPostReactionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok || !authorizeAPI(w, sessionUser, authz.CreateContent, 0, cannotPostMessage) {
+		return
+	}
+	postID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reaction string `json:"reaction"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	if !validReaction(body.Reaction) {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "reaction must be \"like\" or \"dislike\"")
+		return
+	}
+
+	if post := app.loadAPIPost(w, postID, sessionUser); post == nil {
+		return
+	} else if post.UserReaction == body.Reaction {
+		if err := app.Store.RemoveReaction(sessionUser.ID, postID); err != nil {
+			writeAPIServerError(w)
+			return
+		}
+	} else if err := app.Store.AddReaction(sessionUser.ID, postID, body.Reaction); err != nil {
+		writeAPIServerError(w)
+		return
+	}
+
+	post := app.loadAPIPost(w, postID, sessionUser)
+	if post == nil {
+		return
+	}
+	writeJSON(w, http.StatusOK, viewmodels.ReactionJSON{Likes: post.Likes, Dislikes: post.Dislikes, UserReaction: post.UserReaction})
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"ellas-corner/internal/config"
+	"ellas-corner/internal/mail"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/storage"
+	"time"
+)
+
+// App serves the site. Handlers are its methods and reach the database, mail and uploads
+// through it rather than package globals, so each test can build an App of its own.
+type App struct {
+	Store repository.Store
+	// Mailer sends the emails handlers trigger. Nothing is sent while it is nil.
+	Mailer mail.Mailer
+	// SiteURL is the address links in emails point to, without a trailing slash
+	SiteURL string
+	// Uploads is the largest upload and image accepted
+	Uploads config.Uploads
+	// PostImages and ProfilePictures keep uploaded images
+	PostImages      storage.BlobStore
+	ProfilePictures storage.BlobStore
+	// ImageURLExpiry, when set and the image stores can sign links, sends browsers to the
+	// store with a link that lasts this long instead of serving images through the site
+	ImageURLExpiry time.Duration
+}
+
+// NewApp returns an App backed by store, with the default site address and upload settings,
+// images in the default upload directories and no mailer
+func NewApp(store repository.Store) *App {
+	defaults := config.Default()
+	return &App{
+		Store:           store,
+		SiteURL:         defaults.Server.SiteURL,
+		Uploads:         defaults.Uploads,
+		PostImages:      storage.LocalStore{Dir: defaults.Uploads.PostDir},
+		ProfilePictures: storage.LocalStore{Dir: defaults.Uploads.ProfilePictureDir},
+	}
+}
@@ -1,24 +1,25 @@
 package handlers
 
 import (
+	"ellas-corner/internal/images"
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
-	"html/template"
 	"log"
 	"math/rand"
 	"net/http"
+	netmail "net/mail"
 	"strings"
 	"time"
 )
 
 // RegisterHandler renders the registration form on GET,
 // and handles user registration on POST.
-func RegisterHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) RegisterHandler(w http.ResponseWriter, r *http.Request) {
 	const registerTemplate = "web/templates/register.html"
 	const navbarTemplate = "web/templates/partials/navbar_register.html"
 
 	if r.Method == http.MethodGet {
-		tmpl, err := template.ParseFiles(registerTemplate, navbarTemplate)
+		tmpl, err := parseTemplates(r, registerTemplate, navbarTemplate)
 		if err != nil {
 			log.Println("RegisterHandler: Error parsing template:", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -35,7 +36,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		password := r.FormValue("password")
 
 		if username == "" || email == "" || password == "" {
-			tmpl, err := template.ParseFiles(registerTemplate, navbarTemplate)
+			tmpl, err := parseTemplates(r, registerTemplate, navbarTemplate)
 			if err == nil {
 				tmpl.Execute(w, map[string]interface{}{
 					"Error": "Please fill in all fields.",
@@ -44,6 +45,17 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		// A bare address only: no display name, and nothing the mail server would rewrite
+		if address, err := netmail.ParseAddress(email); err != nil || address.Address != email {
+			tmpl, err := parseTemplates(r, registerTemplate, navbarTemplate)
+			if err == nil {
+				tmpl.Execute(w, map[string]interface{}{
+					"Error": "Please enter a valid email address.",
+				})
+			}
+			return
+		}
+
 		hashedPassword, err := utils.HashPassword(password)
 		if err != nil {
 			w.WriteHeader(http.StatusInternalServerError)
@@ -51,13 +63,12 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		pictureOptions := []string{"1.png", "2.png", "3.png"}
-		randomPicture := pictureOptions[rand.Intn(len(pictureOptions))]
+		randomPicture := images.DefaultProfilePictures[rand.Intn(len(images.DefaultProfilePictures))]
 
-		err = repository.CreateUser(username, email, hashedPassword, randomPicture)
+		err = app.Store.CreateUser(username, email, hashedPassword, randomPicture)
 		if err != nil {
 			log.Println("Error creating user:", err)
-			tmpl, tmplErr := template.ParseFiles(registerTemplate, navbarTemplate)
+			tmpl, tmplErr := parseTemplates(r, registerTemplate, navbarTemplate)
 			if tmplErr == nil && strings.Contains(err.Error(), "UNIQUE constraint failed") {
 				tmpl.Execute(w, map[string]interface{}{
 					"Error": "Email or username already in use. Please try a different one.",
@@ -69,7 +80,16 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		http.Redirect(w, r, "/login?message=Thank+you+for+joining+Ella's+Corner!+Your+registration+was+successful,+please+log+in.", http.StatusSeeOther)
+		// The welcome email carries the link that confirms the address
+		user, err := app.Store.GetUserByEmail(email)
+		if err == nil && user != nil {
+			err = app.sendVerificationEmail(user.ID, username, email, true)
+		}
+		if err != nil {
+			log.Println("RegisterHandler: Error sending verification email:", err)
+		}
+
+		http.Redirect(w, r, "/login?message=Thank+you+for+joining+Ella's+Corner!+Please+confirm+your+email+address+with+the+link+we've+sent+you,+then+log+in.", http.StatusSeeOther)
 		return
 	}
 
@@ -78,7 +98,7 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 
 // LoginHandler renders the login form on GET,
 // and handles authentication on POST.
-func LoginHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) LoginHandler(w http.ResponseWriter, r *http.Request) {
 	const loginTemplate = "web/templates/login.html"
 	const navbarTemplate = "web/templates/partials/navbar_minimal.html"
 
@@ -90,7 +110,7 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 			data["Message"] = message
 		}
 
-		tmpl, err := template.ParseFiles(loginTemplate, navbarTemplate)
+		tmpl, err := parseTemplates(r, loginTemplate, navbarTemplate)
 		if err != nil {
 			log.Println("LoginHandler: Error parsing template:", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -106,34 +126,32 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		email := r.FormValue("email")
 		password := r.FormValue("password")
 
-		user, err := repository.GetUserByEmail(email)
+		user, err := app.Store.GetUserByEmail(email)
 		if err != nil || user == nil {
 			log.Println("LoginHandler: Invalid email or user not found")
-			renderLoginError(w, "Invalid email or password")
+			renderLoginError(w, r, "Invalid email or password")
 			return
 		}
 
 		if !utils.CheckPasswordHash(password, user.Password) {
 			log.Println("LoginHandler: Incorrect password for user:", user.Email)
-			renderLoginError(w, "Invalid email or password")
+			renderLoginError(w, r, "Invalid email or password")
 			return
 		}
 
-		sessionToken := utils.GenerateSessionToken()
-		if err := repository.SaveSessionToken(user.ID, sessionToken); err != nil {
-			log.Println("LoginHandler: Error saving session token:", err)
+		if user.Banned {
+			log.Println("LoginHandler: Banned user tried to log in:", user.Email)
+			renderLoginError(w, r, bannedMessage(user))
+			return
+		}
+
+		if err := utils.StartSession(app.Store, w, r, user.ID); err != nil {
+			log.Println("LoginHandler: Error starting session:", err)
 			w.WriteHeader(http.StatusInternalServerError)
 			utils.RenderServerErrorPage(w)
 			return
 		}
 
-		http.SetCookie(w, &http.Cookie{
-			Name:    "session_token",
-			Value:   sessionToken,
-			Expires: time.Now().Add(24 * time.Hour),
-			Path:    "/",
-		})
-
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 
 	default:
@@ -141,9 +159,17 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 	}
 }
 
+// bannedMessage tells a banned user why they can't log in
+func bannedMessage(user *repository.User) string {
+	if user.BanReason == "" {
+		return "This account has been banned."
+	}
+	return "This account has been banned: " + user.BanReason
+}
+
 // Helper to render login template with an error
-func renderLoginError(w http.ResponseWriter, errorMsg string) {
-	tmpl, err := template.ParseFiles("web/templates/login.html", "web/templates/partials/navbar_minimal.html")
+func renderLoginError(w http.ResponseWriter, r *http.Request, errorMsg string) {
+	tmpl, err := parseTemplates(r, "web/templates/login.html", "web/templates/partials/navbar_minimal.html")
 	if err != nil {
 		log.Println("renderLoginError: Error loading login template:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -158,9 +184,7 @@ func renderLoginError(w http.ResponseWriter, errorMsg string) {
 
 // AcceptCookiesHandler records user cookie consent,
 // either in the DB (if logged in) or as a browser cookie.
-func AcceptCookiesHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("AcceptCookiesHandler: Request received")
-
+func (app *App) AcceptCookiesHandler(w http.ResponseWriter, r *http.Request) {
 	cookie := &http.Cookie{
 		Name:    "consent_given",
 		Value:   "true",
@@ -168,24 +192,16 @@ func AcceptCookiesHandler(w http.ResponseWriter, r *http.Request) {
 		Path:    "/",
 	}
 
-	sessionCookie, err := r.Cookie("session_token")
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	if err == nil {
-		userID, err := repository.GetUserIDBySession(sessionCookie.Value)
-		if err == nil && userID != 0 {
-			if err := repository.SaveCookieConsent(userID, true); err != nil {
-				log.Println("AcceptCookiesHandler: Error saving consent to DB:", err)
-				w.WriteHeader(http.StatusInternalServerError)
-				utils.RenderServerErrorPage(w)
-				return
-			}
-			log.Println("Consent saved for logged-in user:", userID)
-		} else {
-			http.SetCookie(w, cookie)
-			log.Println("Consent cookie set for unauthenticated session token")
+		if err := app.Store.SaveCookieConsent(sessionUser.ID, true); err != nil {
+			log.Println("AcceptCookiesHandler: Error saving consent to DB:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			utils.RenderServerErrorPage(w)
+			return
 		}
 	} else {
 		http.SetCookie(w, cookie)
-		log.Println("Consent cookie set for user with no session token")
 	}
 
 	http.Redirect(w, r, "/", http.StatusSeeOther)
@@ -1,18 +1,36 @@
 package handlers
 
 import (
+	"ellas-corner/internal/config"
 	"ellas-corner/internal/db"
+	"ellas-corner/internal/mail"
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
 )
 
-func setupTestAuthDB(t *testing.T) {
-	conn, err := db.InitDB(":memory:")
+// TestMain hashes passwords at bcrypt's lowest cost. At the production cost each hash takes
+// about a second, and nearly every test here registers or logs in someone.
+func TestMain(m *testing.M) {
+	auth := config.Default().Auth
+	auth.BcryptCost = bcrypt.MinCost
+	utils.Configure(auth)
+	os.Exit(m.Run())
+}
+
+// setupTestAuthDB returns an App backed by a fresh database in a temporary file. It isn't
+// ":memory:" because every pooled connection would open its own empty in-memory database.
+func setupTestAuthDB(t *testing.T) *App {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "forum.db"))
 	if err != nil {
 		t.Fatalf("Failed to initialize test DB: %v", err)
 	}
@@ -20,11 +38,15 @@ func setupTestAuthDB(t *testing.T) {
 	if err != nil {
 		t.Fatalf("Failed to run migrations: %v", err)
 	}
-	repository.SetDatabase(conn)
+	t.Cleanup(func() { conn.Conn.Close() })
+	return NewApp(repository.NewSQLStore(conn))
 }
 
 func TestRegisterHandler_POST(t *testing.T) {
-	setupTestAuthDB(t)
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	outbox := &mail.OutboxMailer{}
+	app.Mailer, app.SiteURL = outbox, "https://ellas.example"
 
 	form := url.Values{}
 	form.Add("username", "testuser")
@@ -35,7 +57,7 @@ func TestRegisterHandler_POST(t *testing.T) {
 	req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
 
 	rr := httptest.NewRecorder()
-	RegisterHandler(rr, req)
+	app.RegisterHandler(rr, req)
 
 	if rr.Code != http.StatusSeeOther {
 		t.Errorf("expected redirect status, got %d", rr.Code)
@@ -46,7 +68,7 @@ func TestRegisterHandler_POST(t *testing.T) {
 	}
 
 	// Check DB entry exists
-	user, err := repository.GetUserByEmail("test@example.com")
+	user, err := app.Store.GetUserByEmail("test@example.com")
 	if err != nil || user == nil {
 		t.Fatalf("expected user to be created in DB, got err=%v", err)
 	}
@@ -56,17 +78,52 @@ func TestRegisterHandler_POST(t *testing.T) {
 	if user.Password == "secretpass" {
 		t.Errorf("expected hashed password, got plain-text")
 	}
+
+	sent := outbox.Sent()
+	if len(sent) != 1 || sent[0].To != "test@example.com" || !strings.Contains(sent[0].Text, "https://ellas.example/login") {
+		t.Fatalf("expected a registration email with a login link, got %+v", sent)
+	}
+	if !strings.Contains(sent[0].Text, "https://ellas.example/verify-email?token=") {
+		t.Errorf("expected the registration email to carry a verification link, got %q", sent[0].Text)
+	}
+	if user.EmailVerified {
+		t.Errorf("expected a new member's email address to be unconfirmed")
+	}
+}
+
+func TestRegisterHandler_InvalidEmail(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+
+	for _, email := range []string{"not-an-email", "Ella <ella@example.com>", "ella@example.com, other@example.com"} {
+		form := url.Values{}
+		form.Add("username", "ella")
+		form.Add("email", email)
+		form.Add("password", "secretpass")
+		req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(form.Encode()))
+		req.Header.Add("Content-Type", "application/x-www-form-urlencoded")
+		rr := httptest.NewRecorder()
+		app.RegisterHandler(rr, req)
+
+		if rr.Code == http.StatusSeeOther {
+			t.Errorf("expected %q to be rejected, got a redirect to %s", email, rr.Header().Get("Location"))
+		}
+		if user, _ := app.Store.GetUserByUsernameOrEmail("ella"); user != nil {
+			t.Fatalf("expected no account for %q", email)
+		}
+	}
 }
 
 func TestLoginHandler_POST(t *testing.T) {
-	setupTestAuthDB(t)
+	t.Parallel()
+	app := setupTestAuthDB(t)
 
 	// First, create a user
 	username := "loginuser"
 	email := "login@example.com"
 	password := "secret123"
 	hashed, _ := utils.HashPassword(password)
-	err := repository.CreateUser(username, email, hashed, "1.png")
+	err := app.Store.CreateUser(username, email, hashed, "1.png")
 	if err != nil {
 		t.Fatalf("Failed to create user: %v", err)
 	}
@@ -77,7 +134,7 @@ func TestLoginHandler_POST(t *testing.T) {
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	w := httptest.NewRecorder()
 
-	LoginHandler(w, req)
+	app.LoginHandler(w, req)
 
 	resp := w.Result()
 	defer resp.Body.Close()
@@ -97,3 +154,81 @@ func TestLoginHandler_POST(t *testing.T) {
 		t.Error("Expected session_token cookie to be set")
 	}
 }
+
+func loginAndGetCookie(t *testing.T, app *App, email, password, userAgent string) *http.Cookie {
+	form := url.Values{}
+	form.Set("email", email)
+	form.Set("password", password)
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", userAgent)
+	rr := httptest.NewRecorder()
+	app.LoginHandler(rr, req)
+
+	for _, c := range rr.Result().Cookies() {
+		if c.Name == utils.SessionCookieName {
+			return c
+		}
+	}
+	t.Fatal("Expected session_token cookie to be set")
+	return nil
+}
+
+func requestWithCookie(method, path string, cookie *http.Cookie) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	req.AddCookie(cookie)
+	return req
+}
+
+func TestSessionsPerDevice(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+
+	hashed, _ := utils.HashPassword("secret123")
+	if err := app.Store.CreateUser("multi", "multi@example.com", hashed, "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+
+	laptop := loginAndGetCookie(t, app, "multi@example.com", "secret123", "Laptop")
+	phone := loginAndGetCookie(t, app, "multi@example.com", "secret123", "Phone")
+	tablet := loginAndGetCookie(t, app, "multi@example.com", "secret123", "Tablet")
+
+	// Logging in on the phone must not log out the laptop
+	for _, c := range []*http.Cookie{laptop, phone, tablet} {
+		if _, err := utils.GetSessionUser(app.Store, requestWithCookie(http.MethodGet, "/", c)); err != nil {
+			t.Fatalf("expected every device to stay signed in, got %v", err)
+		}
+	}
+
+	session, err := app.Store.GetSessionByTokenHash(utils.HashToken(laptop.Value))
+	if err != nil || session == nil {
+		t.Fatalf("expected a stored session, got %v", err)
+	}
+	if session.TokenHash == laptop.Value {
+		t.Error("expected only the token hash to be stored")
+	}
+	if session.UserAgent != "Laptop" {
+		t.Errorf("expected user agent to be recorded, got %q", session.UserAgent)
+	}
+
+	// An expired session is rejected
+	if err := app.Store.TouchSession(session.ID, time.Now().Add(-48*time.Hour), time.Now().Add(-time.Hour)); err != nil {
+		t.Fatalf("Failed to expire session: %v", err)
+	}
+	if _, err := utils.GetSessionUser(app.Store, requestWithCookie(http.MethodGet, "/", laptop)); err == nil {
+		t.Error("expected expired session to be rejected")
+	}
+
+	// Logging out other devices from the phone keeps only the phone signed in
+	rr := httptest.NewRecorder()
+	app.LogoutOtherDevicesHandler(rr, requestWithCookie(http.MethodPost, "/logout-other-devices", phone))
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected redirect, got %d", rr.Code)
+	}
+	if _, err := utils.GetSessionUser(app.Store, requestWithCookie(http.MethodGet, "/", phone)); err != nil {
+		t.Errorf("expected current device to stay signed in, got %v", err)
+	}
+	if _, err := utils.GetSessionUser(app.Store, requestWithCookie(http.MethodGet, "/", tablet)); err == nil {
+		t.Error("expected other device to be signed out")
+	}
+}
@@ -0,0 +1,303 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"ellas-corner/internal/authz"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+const (
+	maxCategoryName        = 50
+	maxCategoryDescription = 300
+	// maxCategoryAge is the oldest age in months a category can be for, 18 years
+	maxCategoryAge     = 216
+	categoriesTemplate = "web/templates/categories.html"
+
+	unknownCategoryMessage = "Please choose one of the categories."
+)
+
+// slugPattern is what a category slug looks like: lower-case words joined by hyphens
+var slugPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// slugify turns a category name into a slug, such as "3-6 months" into "3-6-months"
+func slugify(name string) string {
+	var slug strings.Builder
+	hyphen := false
+	for _, r := range strings.ToLower(name) {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			if hyphen && slug.Len() > 0 {
+				slug.WriteByte('-')
+			}
+			slug.WriteRune(r)
+			hyphen = false
+		} else {
+			hyphen = true
+		}
+	}
+	return slug.String()
+}
+
+// postCategory returns the name of the category chosen for a post, given its name or slug.
+// known is false when there is no such category.
+func (app *App) postCategory(value string) (name string, known bool, err error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", false, nil
+	}
+	category, err := app.Store.FindCategory(value)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", false, nil
+	} else if err != nil {
+		return "", false, err
+	}
+	return category.Name, true, nil
+}
+
+// monthsField reads an optional age in months from the category form
+func monthsField(r *http.Request, field, label string) (*int, string) {
+	value := strings.TrimSpace(r.FormValue(field))
+	if value == "" {
+		return nil, ""
+	}
+	months, err := strconv.Atoi(value)
+	if err != nil || months < 0 || months > maxCategoryAge {
+		return nil, label + " must be a whole number of months from 0 to " + strconv.Itoa(maxCategoryAge)
+	}
+	return &months, ""
+}
+
+// categoryFromForm reads the add and edit category form and reports what's wrong with it,
+// if anything. An empty slug is made from the name.
+func categoryFromForm(r *http.Request) (repository.Category, string) {
+	category := repository.Category{
+		Name:        strings.TrimSpace(r.FormValue("name")),
+		Slug:        strings.ToLower(strings.TrimSpace(r.FormValue("slug"))),
+		Description: strings.TrimSpace(r.FormValue("description")),
+	}
+	if category.Slug == "" {
+		category.Slug = slugify(category.Name)
+	}
+
+	var problem string
+	category.MinAgeMonths, problem = monthsField(r, "min_age_months", "The youngest age")
+	if problem != "" {
+		return category, problem
+	}
+	category.MaxAgeMonths, problem = monthsField(r, "max_age_months", "The oldest age")
+	if problem != "" {
+		return category, problem
+	}
+
+	if sortOrder := strings.TrimSpace(r.FormValue("sort_order")); sortOrder != "" {
+		order, err := strconv.Atoi(sortOrder)
+		if err != nil {
+			return category, "The position must be a whole number"
+		}
+		category.SortOrder = order
+	}
+
+	switch {
+	case category.Name == "":
+		return category, "A category needs a name"
+	case utf8.RuneCountInString(category.Name) > maxCategoryName:
+		return category, "The name must be at most " + strconv.Itoa(maxCategoryName) + " characters"
+	case !slugPattern.MatchString(category.Slug) || len(category.Slug) > maxCategoryName:
+		return category, "The slug must be lower-case letters and numbers joined by hyphens, at most " + strconv.Itoa(maxCategoryName) + " characters"
+	case utf8.RuneCountInString(category.Description) > maxCategoryDescription:
+		return category, "The description must be at most " + strconv.Itoa(maxCategoryDescription) + " characters"
+	case category.MinAgeMonths != nil && category.MaxAgeMonths != nil && *category.MinAgeMonths > *category.MaxAgeMonths:
+		return category, "The youngest age can't be older than the oldest"
+	}
+	return category, ""
+}
+
+// requireCategoryManager returns the signed-in user if they may add, change and remove
+// categories
+func (app *App) requireCategoryManager(w http.ResponseWriter, r *http.Request) (*utils.SessionUser, bool) {
+	sessionUser, ok := app.requireModerator(w, r)
+	if !ok {
+		return nil, false
+	}
+	if !authz.Can(sessionUser, authz.ManageCategories, 0) {
+		log.Printf("requireCategoryManager: User %d may not manage categories\n", sessionUser.ID)
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return nil, false
+	}
+	return sessionUser, true
+}
+
+// renderCategories shows the category list with the add or edit form filled in from form
+func (app *App) renderCategories(w http.ResponseWriter, r *http.Request, sessionUser *utils.SessionUser, status int, form repository.Category, message string) {
+	categories, err := app.Store.FetchCategories()
+	if err != nil {
+		log.Println("renderCategories: Error fetching categories:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, categoriesTemplate, "web/templates/partials/navbar.html")
+	if err != nil {
+		log.Println("renderCategories: Error parsing template:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	data := viewmodels.CategoriesPageData{
+		IsLoggedIn:          true,
+		ProfilePicture:      sessionUser.ProfilePicture,
+		UnreadMessages:      app.unreadMessages(sessionUser.ID),
+		UnreadNotifications: app.unreadNotifications(sessionUser.ID),
+		Categories:          categories,
+		Form:                form,
+		Error:               message,
+	}
+	w.WriteHeader(status)
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("renderCategories: Error executing template:", err)
+	}
+}
+
+// AdminCategoriesHandler lists the categories with a form for adding one: GET /admin/categories
+func (app *App) AdminCategoriesHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireCategoryManager(w, r)
+	if !ok {
+		return
+	}
+	app.renderCategories(w, r, sessionUser, http.StatusOK, repository.Category{}, "")
+}
+
+// AdminCreateCategoryHandler adds a category: POST /admin/categories
+func (app *App) AdminCreateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireCategoryManager(w, r)
+	if !ok {
+		return
+	}
+
+	category, problem := categoryFromForm(r)
+	if problem != "" {
+		app.renderCategories(w, r, sessionUser, http.StatusBadRequest, category, problem)
+		return
+	}
+
+	if _, err := app.Store.CreateCategory(category); errors.Is(err, repository.ErrCategoryExists) {
+		app.renderCategories(w, r, sessionUser, http.StatusConflict, category, "There is already a category with this name or slug")
+		return
+	} else if err != nil {
+		log.Println("AdminCreateCategoryHandler: Error creating category:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// AdminEditCategoryHandler shows the form for changing a category: GET /admin/categories/{id}
+func (app *App) AdminEditCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireCategoryManager(w, r)
+	if !ok {
+		return
+	}
+	categoryID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	category, err := app.Store.GetCategory(categoryID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("AdminEditCategoryHandler: Error fetching category:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	app.renderCategories(w, r, sessionUser, http.StatusOK, *category, "")
+}
+
+// AdminUpdateCategoryHandler saves changes to a category: POST /admin/categories/{id}. A new
+// name is given to every post in the category too.
+func (app *App) AdminUpdateCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireCategoryManager(w, r)
+	if !ok {
+		return
+	}
+	categoryID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	category, problem := categoryFromForm(r)
+	category.ID = categoryID
+	if problem != "" {
+		app.renderCategories(w, r, sessionUser, http.StatusBadRequest, category, problem)
+		return
+	}
+
+	err = app.Store.UpdateCategory(category)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if errors.Is(err, repository.ErrCategoryExists) {
+		app.renderCategories(w, r, sessionUser, http.StatusConflict, category, "There is already a category with this name or slug")
+		return
+	} else if err != nil {
+		log.Println("AdminUpdateCategoryHandler: Error updating category:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
+
+// AdminDeleteCategoryHandler removes a category: POST /admin/categories/{id}/delete. A
+// category with posts is only removed when move_to names the category they should go to.
+func (app *App) AdminDeleteCategoryHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireCategoryManager(w, r)
+	if !ok {
+		return
+	}
+	categoryID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	moveToID, _ := strconv.Atoi(r.FormValue("move_to"))
+
+	err = app.Store.DeleteCategory(categoryID, moveToID)
+	if errors.Is(err, repository.ErrCategoryInUse) {
+		category, err := app.Store.GetCategory(categoryID)
+		if err != nil {
+			log.Println("AdminDeleteCategoryHandler: Error fetching category:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			utils.RenderServerErrorPage(w)
+			return
+		}
+		app.renderCategories(w, r, sessionUser, http.StatusConflict, *category,
+			"Choose another category for its posts before removing it")
+		return
+	} else if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("AdminDeleteCategoryHandler: Error deleting category:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	http.Redirect(w, r, "/admin/categories", http.StatusSeeOther)
+}
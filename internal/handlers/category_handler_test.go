@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+func TestCategoryFromForm(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		name    string
+		form    url.Values
+		slug    string
+		problem bool
+	}{
+		{"slug made from the name", url.Values{"name": {" Baby's health "}}, "baby-s-health", false},
+		{"slug given", url.Values{"name": {"Sleep"}, "slug": {"Sleep-Aids"}}, "sleep-aids", false},
+		{"age range", url.Values{"name": {"Toddlers"}, "min_age_months": {"12"}, "max_age_months": {"36"}}, "toddlers", false},
+		{"no name", url.Values{"slug": {"nameless"}}, "nameless", true},
+		{"bad slug", url.Values{"name": {"Sleep"}, "slug": {"sleep aids"}}, "sleep aids", true},
+		{"ages the wrong way round", url.Values{"name": {"Sleep"}, "min_age_months": {"6"}, "max_age_months": {"3"}}, "sleep", true},
+		{"negative age", url.Values{"name": {"Sleep"}, "min_age_months": {"-1"}}, "sleep", true},
+		{"position not a number", url.Values{"name": {"Sleep"}, "sort_order": {"first"}}, "sleep", true},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest(http.MethodPost, "/admin/categories", nil)
+		req.Form = tt.form
+		category, problem := categoryFromForm(req)
+		if (problem != "") != tt.problem {
+			t.Errorf("%s: got problem %q", tt.name, problem)
+		}
+		if category.Slug != tt.slug {
+			t.Errorf("%s: expected slug %q, got %q", tt.name, tt.slug, category.Slug)
+		}
+	}
+}
+
+func TestManageCategories(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+
+	memberToken := createAPIUser(t, app, mux, "member", "member@example.com")
+	createAPIUser(t, app, mux, "mod", "mod@example.com")
+	createAPIUser(t, app, mux, "admin", "admin@example.com")
+	if err := app.Store.SetUserRole(0, 2, repository.RoleModerator); err != nil {
+		t.Fatalf("SetUserRole failed: %v", err)
+	}
+	if err := app.Store.SetUserRole(0, 3, repository.RoleAdmin); err != nil {
+		t.Fatalf("SetUserRole failed: %v", err)
+	}
+	memberCookie := loginAndGetCookie(t, app, "member@example.com", "secret123", "test")
+	modCookie := loginAndGetCookie(t, app, "mod@example.com", "secret123", "test")
+	adminCookie := loginAndGetCookie(t, app, "admin@example.com", "secret123", "test")
+
+	sleep := url.Values{"name": {"Sleep"}, "min_age_months": {"0"}, "max_age_months": {"6"}, "description": {"Cots and sleeping bags"}}
+	if rr := moderationRequest(mux, "/admin/categories", modCookie, sleep); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 for a moderator adding a category, got %d", rr.Code)
+	}
+	if rr := moderationRequest(mux, "/admin/categories", adminCookie, sleep); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after adding a category, got %d: %s", rr.Code, rr.Body.String())
+	}
+	category, err := app.Store.FindCategory("sleep")
+	if err != nil || category.Name != "Sleep" || category.AgeRange() != "0–6 months" {
+		t.Fatalf("expected the new category, got %+v, %v", category, err)
+	}
+
+	// Names and slugs stay unique, and bad forms change nothing
+	if rr := moderationRequest(mux, "/admin/categories", adminCookie, url.Values{"name": {"newborn"}}); rr.Code == http.StatusSeeOther {
+		t.Error("expected a second Newborn to be refused")
+	}
+	if rr := moderationRequest(mux, "/admin/categories", adminCookie, url.Values{"name": {"Naps"}, "min_age_months": {"9"}, "max_age_months": {"3"}}); rr.Code == http.StatusSeeOther {
+		t.Error("expected an upside-down age range to be refused")
+	}
+	if _, err := app.Store.FindCategory("naps"); err == nil {
+		t.Error("expected the refused category not to be added")
+	}
+
+	// Posts must be filed under a category, given by name or slug
+	rr, body := apiRequest(t, mux, http.MethodPost, "/api/v1/posts", memberToken, `{"title":"Cot","content":"Sturdy","category":"Bedtime"}`)
+	if rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for an unknown category, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr, body = apiRequest(t, mux, http.MethodPost, "/api/v1/posts", memberToken, `{"title":"Cot","content":"Sturdy","category":"sleep"}`)
+	if rr.Code != http.StatusCreated || body["category"] != "Sleep" {
+		t.Fatalf("expected the post filed under Sleep, got %d: %v", rr.Code, body)
+	}
+	location := rr.Header().Get("Location")
+	if rr, _ := apiRequest(t, mux, http.MethodPatch, location, memberToken, `{"category":"Bedtime"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 moving a post to an unknown category, got %d", rr.Code)
+	}
+	form, contentType := multipartWithImages(t, url.Values{"title": {"Pram"}, "content": {"Folds flat"}, "category": {"Bedtime"}})
+	req := httptest.NewRequest(http.MethodPost, "/create-post", form)
+	req.Header.Set("Content-Type", contentType)
+	req.AddCookie(memberCookie)
+	rr = httptest.NewRecorder()
+	mux.ServeHTTP(rr, req)
+	if rr.Code == http.StatusSeeOther {
+		t.Error("expected the submit form to refuse an unknown category")
+	}
+
+	// Renaming moves the posts with it
+	path := "/admin/categories/" + strconv.Itoa(category.ID)
+	renamed := url.Values{"name": {"Bedtime"}, "slug": {"bedtime"}, "sort_order": {"5"},
+		"min_age_months": {"0"}, "max_age_months": {"6"}, "description": {"Cots and sleeping bags"}}
+	if rr := moderationRequest(mux, path, adminCookie, renamed); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after renaming, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, body := apiRequest(t, mux, http.MethodGet, location, "", ""); body["category"] != "Bedtime" {
+		t.Errorf("expected the post to follow the rename, got %v", body["category"])
+	}
+	rr, _ = apiRequest(t, mux, http.MethodGet, "/api/v1/posts?category=bedtime", "", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `"title":"Cot"`) {
+		t.Errorf("expected to filter by the new slug, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr, _ = apiRequest(t, mux, http.MethodGet, "/api/v1/categories", "", "")
+	if rr.Code != http.StatusOK || !strings.Contains(rr.Body.String(), `{"slug":"bedtime","name":"Bedtime","min_age_months":0,"max_age_months":6,"description":"Cots and sleeping bags","post_count":1}`) {
+		t.Errorf("expected the renamed category in the list, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Removing a category with posts needs somewhere to put them
+	if rr := moderationRequest(mux, path+"/delete", adminCookie, nil); rr.Code == http.StatusSeeOther {
+		t.Error("expected removing a category with posts to be refused")
+	}
+	general, err := app.Store.FindCategory("general")
+	if err != nil {
+		t.Fatalf("FindCategory failed: %v", err)
+	}
+	if rr := moderationRequest(mux, path+"/delete", adminCookie, url.Values{"move_to": {strconv.Itoa(general.ID)}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after removing, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, body := apiRequest(t, mux, http.MethodGet, location, "", ""); body["category"] != "General" {
+		t.Errorf("expected the post to move to General, got %v", body["category"])
+	}
+}
@@ -1,25 +1,31 @@
 package handlers
 
 import (
+	"ellas-corner/internal/authz"
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"html/template"
 	"log"
 	"net/http"
+	"strconv"
 	"strings"
 )
 
-// AddCommentHandler processes user-submitted comments.
-// Requires user to be logged in and content to be non-empty.
-func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
+// AddCommentHandler processes user-submitted comments and replies.
+// Requires user to be logged in and content to be non-empty. An optional
+// parent_comment_id makes the comment a reply to another comment on the same post.
+func (app *App) AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	sessionUser, err := utils.GetSessionUser(r)
-	if err != nil {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err == nil && !sessionUser.EmailVerified {
+		http.Error(w, "Please confirm your email address before commenting.", http.StatusForbidden)
+		return
+	}
+	if err != nil || !authz.Can(sessionUser, authz.CreateContent, 0) {
 		http.Error(w, "Unauthorized. Please log in to comment.", http.StatusUnauthorized)
 		return
 	}
@@ -27,8 +33,19 @@ func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 	postID := r.FormValue("post_id")
 	content := r.FormValue("content")
 
+	var parentCommentID *int
+	if parentIDStr := r.FormValue("parent_comment_id"); parentIDStr != "" {
+		parentID, err := strconv.Atoi(parentIDStr)
+		if err != nil {
+			log.Println("AddCommentHandler: Invalid parent comment ID:", err)
+			http.Error(w, "Invalid parent comment ID", http.StatusBadRequest)
+			return
+		}
+		parentCommentID = &parentID
+	}
+
 	if strings.TrimSpace(content) == "" {
-		post, err := repository.GetPostByID(postID, sessionUser.ID)
+		post, err := app.Store.GetPostByID(postID, sessionUser.ID)
 		if err != nil || post == nil {
 			log.Println("AddCommentHandler: Error fetching post:", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -36,13 +53,13 @@ func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
-		comments, err := repository.FetchCommentsForPost(post.ID, sessionUser.ID)
+		comments, err := app.Store.FetchCommentsForPost(post.ID, sessionUser.ID)
 		if err == nil {
 			post.Comments = comments
 		}
 
 		const indexTemplate = "web/templates/index.html"
-		tmpl, err := template.ParseFiles(indexTemplate)
+		tmpl, err := parseTemplates(r, indexTemplate)
 		if err != nil {
 			log.Println("AddCommentHandler: Error loading template:", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -65,7 +82,11 @@ func AddCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = repository.CreateComment(sessionUser.ID, postID, content)
+	err = app.Store.CreateComment(sessionUser.ID, postID, content, parentCommentID)
+	if err == repository.ErrInvalidParentComment {
+		http.Error(w, "The comment you are replying to no longer exists", http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		log.Println("AddCommentHandler: Error creating comment:", err)
 		w.WriteHeader(http.StatusInternalServerError)
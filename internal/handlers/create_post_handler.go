@@ -1,24 +1,27 @@
 package handlers
 
 import (
+	"ellas-corner/internal/authz"
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"html/template"
 	"log"
 	"net/http"
 	"strings"
 )
 
-func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 	const (
 		postTemplate   = "web/templates/create_post.html"
 		navbarTemplate = "web/templates/partials/navbar.html"
-		uploadDir      = "web/static/uploads"
 	)
 
-	sessionUser, err := utils.GetSessionUser(r)
-	if err != nil {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err == nil && !sessionUser.EmailVerified {
+		http.Redirect(w, r, "/verify-email", http.StatusSeeOther)
+		return
+	}
+	if err != nil || !authz.Can(sessionUser, authz.CreateContent, 0) {
 		http.Redirect(w, r, "/login?message=Please+log+in+to+create+a+post.", http.StatusSeeOther)
 		return
 	}
@@ -28,9 +31,17 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	categories, err := app.Store.FetchCategories()
+	if err != nil {
+		log.Println("CreatePostHandler: Error fetching categories:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
 	switch r.Method {
 	case http.MethodGet:
-		tmpl, err := template.ParseFiles(postTemplate, navbarTemplate)
+		tmpl, err := parseTemplates(r, postTemplate, navbarTemplate)
 		if err != nil {
 			log.Println("CreatePostHandler: Error parsing template:", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -39,8 +50,12 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		data := viewmodels.CreatePostPageData{
-			IsLoggedIn:     true,
-			ProfilePicture: sessionUser.ProfilePicture,
+			IsLoggedIn:          true,
+			ProfilePicture:      sessionUser.ProfilePicture,
+			UnreadMessages:      app.unreadMessages(sessionUser.ID),
+			UnreadNotifications: app.unreadNotifications(sessionUser.ID),
+			Categories:          categories,
+			MaxImages:           repository.MaxPostImages,
 		}
 
 		if err := tmpl.Execute(w, data); err != nil {
@@ -51,7 +66,8 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 
 	case http.MethodPost:
-		if err := r.ParseMultipartForm(10 << 20); err != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, app.postUploadLimit())
+		if err := r.ParseMultipartForm(maxFormMemory); err != nil {
 			log.Println("CreatePostHandler: Error parsing multipart form:", err)
 			utils.RenderServerErrorPage(w)
 			return
@@ -62,42 +78,68 @@ func CreatePostHandler(w http.ResponseWriter, r *http.Request) {
 		category := r.FormValue("category")
 		isDonation := r.FormValue("is_donation") == "on"
 
-		user, err := repository.GetUserByID(sessionUser.ID)
+		user, err := app.Store.GetUserByID(sessionUser.ID)
 		if err != nil {
 			log.Println("CreatePostHandler: Error fetching user:", err)
 			utils.RenderServerErrorPage(w)
 			return
 		}
 
-		var imageFilename string
-		file, header, err := r.FormFile("image")
-		if err == nil {
-			defer file.Close()
-			imageFilename, err = utils.SaveUploadedFile(file, header.Filename, uploadDir)
+		renderError := func(status int, message string) {
+			tmpl, err := parseTemplates(r, postTemplate, navbarTemplate)
 			if err != nil {
-				log.Println("CreatePostHandler: Error saving uploaded image:", err)
-				imageFilename = "placeholder.jpg"
+				log.Println("CreatePostHandler: Error parsing template:", err)
+				utils.RenderServerErrorPage(w)
+				return
+			}
+			data := viewmodels.CreatePostPageData{
+				Error:               message,
+				Title:               title,
+				Content:             content,
+				Category:            category,
+				ProfilePicture:      user.ProfilePicture,
+				UnreadMessages:      app.unreadMessages(user.ID),
+				UnreadNotifications: app.unreadNotifications(user.ID),
+				IsLoggedIn:          true,
+				Categories:          categories,
+				MaxImages:           repository.MaxPostImages,
+			}
+			w.WriteHeader(status)
+			if err := tmpl.Execute(w, data); err != nil {
+				log.Println("CreatePostHandler: Error executing template:", err)
 			}
-		} else {
-			log.Println("CreatePostHandler: No image uploaded; using placeholder.")
-			imageFilename = "placeholder.jpg"
 		}
 
 		if strings.TrimSpace(title) == "" || strings.TrimSpace(content) == "" {
-			tmpl, _ := template.ParseFiles(postTemplate, navbarTemplate)
-			data := viewmodels.CreatePostPageData{
-				Error:          "Post title and content cannot be empty or spaces only.",
-				Title:          title,
-				Content:        content,
-				Category:       category,
-				ProfilePicture: user.ProfilePicture,
-				IsLoggedIn:     true,
-			}
-			tmpl.Execute(w, data)
+			renderError(http.StatusOK, "Post title and content cannot be empty or spaces only.")
+			return
+		}
+
+		name, known, err := app.postCategory(category)
+		if err != nil {
+			log.Println("CreatePostHandler: Error looking up category:", err)
+			utils.RenderServerErrorPage(w)
+			return
+		}
+		if !known {
+			renderError(http.StatusBadRequest, unknownCategoryMessage)
+			return
+		}
+		category = name
+
+		gallery, err := app.uploadedPostImages(r, title, repository.MaxPostImages)
+		if message, refused := imageRefused(err); refused {
+			log.Println("CreatePostHandler: Rejected images:", err)
+			renderError(http.StatusBadRequest, message)
+			return
+		}
+		if err != nil {
+			log.Println("CreatePostHandler: Error saving uploaded images:", err)
+			utils.RenderServerErrorPage(w)
 			return
 		}
 
-		err = repository.CreatePost(user.ID, title, content, category, imageFilename, isDonation, user.Country)
+		_, err = app.Store.CreatePostWithImages(user.ID, title, content, category, isDonation, user.Country, gallery)
 		if err != nil {
 			log.Println("CreatePostHandler: Error creating post:", err)
 			utils.RenderServerErrorPage(w)
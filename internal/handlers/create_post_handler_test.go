@@ -1,15 +1,25 @@
 package handlers
 
 import (
+	"bytes"
+	"image"
+	"image/png"
 	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
+	"ellas-corner/internal/config"
 	"ellas-corner/internal/db"
+	"ellas-corner/internal/images"
+	"ellas-corner/internal/mail"
 	"ellas-corner/internal/repository"
+	"ellas-corner/internal/storage"
+	"ellas-corner/internal/utils"
 )
 
 func buildMultipartForm(t *testing.T, fields map[string]string) (*strings.Reader, string) {
@@ -31,15 +41,19 @@ func buildMultipartForm(t *testing.T, fields map[string]string) (*strings.Reader
 }
 
 func TestCreatePostHandler_POST(t *testing.T) {
-	// Step 1: Setup in-memory DB and run migrations
-	conn, err := db.InitDB(":memory:")
+	t.Parallel()
+	// Step 1: Setup a temporary DB and run migrations
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "forum.db"))
 	if err != nil {
 		t.Fatalf("Failed to init test DB: %v", err)
 	}
 	if err := conn.RunMigrations(); err != nil {
 		t.Fatalf("Failed to run migrations: %v", err)
 	}
-	repository.SetDatabase(conn)
+	t.Cleanup(func() { conn.Conn.Close() })
+	app := NewApp(repository.NewSQLStore(conn))
+	outbox := &mail.OutboxMailer{}
+	app.Mailer, app.SiteURL = outbox, "https://ellas.example"
 
 	// Step 2: Register user
 	registerForm := url.Values{}
@@ -50,7 +64,7 @@ func TestCreatePostHandler_POST(t *testing.T) {
 	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(registerForm.Encode()))
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	rr := httptest.NewRecorder()
-	RegisterHandler(rr, req)
+	app.RegisterHandler(rr, req)
 
 	// Step 3: Login
 	loginForm := url.Values{}
@@ -60,7 +74,7 @@ func TestCreatePostHandler_POST(t *testing.T) {
 	loginReq := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(loginForm.Encode()))
 	loginReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	loginRR := httptest.NewRecorder()
-	LoginHandler(loginRR, loginReq)
+	app.LoginHandler(loginRR, loginReq)
 
 	var sessionCookie *http.Cookie
 	for _, cookie := range loginRR.Result().Cookies() {
@@ -73,7 +87,22 @@ func TestCreatePostHandler_POST(t *testing.T) {
 		t.Fatal("Session token cookie was not set")
 	}
 
-	// Step 4: Create a new post
+	// Step 4: New members confirm their email address before they can post
+	getReq := httptest.NewRequest(http.MethodGet, "/create-post", nil)
+	getReq.AddCookie(sessionCookie)
+	getRR := httptest.NewRecorder()
+	app.CreatePostHandler(getRR, getReq)
+	if getRR.Code != http.StatusSeeOther || getRR.Header().Get("Location") != "/verify-email" {
+		t.Fatalf("expected an unverified member to be sent to /verify-email, got %d %q", getRR.Code, getRR.Header().Get("Location"))
+	}
+	sent := outbox.Sent()
+	if len(sent) != 1 {
+		t.Fatalf("expected a welcome email, got %d emails", len(sent))
+	}
+	verifyRR := httptest.NewRecorder()
+	app.VerifyEmailHandler(verifyRR, httptest.NewRequest(http.MethodGet, "/verify-email?token="+emailedToken(t, sent[0], "/verify-email"), nil))
+
+	// Step 5: Create a new post
 	fields := map[string]string{
 		"title":            "Test Integration Post",
 		"content":          "This post was created in a test.",
@@ -89,9 +118,9 @@ func TestCreatePostHandler_POST(t *testing.T) {
 	postReq.AddCookie(sessionCookie)
 	postRR := httptest.NewRecorder()
 
-	CreatePostHandler(postRR, postReq)
+	app.CreatePostHandler(postRR, postReq)
 
-	// Step 5: Check DB for inserted post
+	// Step 6: Check DB for inserted post
 	row := conn.Conn.QueryRow("SELECT title, content FROM posts WHERE title = ?", "Test Integration Post")
 	var title, content string
 	err = row.Scan(&title, &content)
@@ -102,3 +131,93 @@ func TestCreatePostHandler_POST(t *testing.T) {
 		t.Errorf("Unexpected values. Got title=%s, content=%s", title, content)
 	}
 }
+
+// multipartWithFile builds a form with one file field alongside the given fields
+func multipartWithFile(t *testing.T, fields map[string]string, fileField string, file []byte) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for key, val := range fields {
+		if err := w.WriteField(key, val); err != nil {
+			t.Fatalf("Error writing field %s: %v", key, err)
+		}
+	}
+	part, err := w.CreateFormFile(fileField, "../../evil.jpg")
+	if err != nil {
+		t.Fatalf("Error creating file field: %v", err)
+	}
+	part.Write(file)
+	if err := w.Close(); err != nil {
+		t.Fatalf("Error closing multipart writer: %v", err)
+	}
+	return &body, w.FormDataContentType()
+}
+
+func TestUploadedImages(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	app.Uploads = config.Uploads{MaxSizeMB: 1, MaxImageDimension: 500}
+	postDir := t.TempDir()
+	app.PostImages, app.ProfilePictures = storage.LocalStore{Dir: postDir}, storage.LocalStore{Dir: t.TempDir()}
+
+	hashed, _ := utils.HashPassword("secret123")
+	if err := app.Store.CreateUser("ella", "ella@example.com", hashed, "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := app.Store.MarkEmailVerified(1); err != nil {
+		t.Fatalf("Failed to verify user: %v", err)
+	}
+	cookie := loginAndGetCookie(t, app, "ella@example.com", "secret123", "Laptop")
+
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 64, 48))); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	post := func(fields map[string]string, file []byte) *httptest.ResponseRecorder {
+		body, contentType := multipartWithFile(t, fields, "images", file)
+		req := httptest.NewRequest(http.MethodPost, "/create-post", body)
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		app.CreatePostHandler(rr, req)
+		return rr
+	}
+
+	// A script with an image name is refused
+	rr := post(map[string]string{"title": "Pram", "content": "Folds flat", "category": "General"}, []byte("<script>alert(1)</script>"))
+	if rr.Code == http.StatusSeeOther {
+		t.Error("expected the post to be refused")
+	}
+	if files, _ := os.ReadDir(postDir); len(files) != 0 {
+		t.Errorf("expected nothing saved for a refused upload, got %d files", len(files))
+	}
+
+	// A real picture is stored under its content hash, whatever the browser called it
+	rr = post(map[string]string{"title": "Cot", "content": "Sturdy", "category": "General"}, picture.Bytes())
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after posting, got %d: %s", rr.Code, rr.Body.String())
+	}
+	posts, err := app.Store.FetchPostsByQuery(repository.PostQuery{})
+	if err != nil || len(posts) != 1 {
+		t.Fatalf("expected one post, got %d (err %v)", len(posts), err)
+	}
+	if image := posts[0].Image; image == "evil.jpg" || images.ThumbnailName(image, "small") == image {
+		t.Errorf("expected a content-hash file name, got %q", image)
+	}
+	if _, err := os.Stat(filepath.Join(postDir, images.ThumbnailName(posts[0].Image, "medium"))); err != nil {
+		t.Errorf("expected a thumbnail next to the image: %v", err)
+	}
+
+	// Profile pictures go through the same checks, so a file that only starts like a GIF is refused
+	body, contentType := multipartWithFile(t, nil, "profile_picture", []byte("GIF89a not really"))
+	req := httptest.NewRequest(http.MethodPost, "/upload-profile-picture", body)
+	req.Header.Set("Content-Type", contentType)
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	app.UploadProfilePictureHandler(rr, req)
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected a broken GIF to be refused, got %d", rr.Code)
+	}
+	if user, _ := app.Store.GetUserByID(1); user.ProfilePicture != "1.png" {
+		t.Errorf("expected the profile picture to be unchanged, got %q", user.ProfilePicture)
+	}
+}
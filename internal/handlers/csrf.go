@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"errors"
+	"log"
+	"mime"
+	"net/http"
+	"strings"
+
+	"ellas-corner/internal/utils"
+)
+
+// CSRFMiddleware rejects POST, PUT, PATCH and DELETE requests made with the login cookie
+// unless they carry the session's CSRF token. Pages get a 403 page and the JSON API gets a
+// 403 error. Requests without a session cookie can't act as anyone and are let through, as
+// are API requests using a bearer token, which another site's form can't send.
+func (app *App) CSRFMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if utils.CSRFToken(r) == "" || utils.BearerToken(r) != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		// Parse multipart forms here, with the same limit the route's handler uses, so reading
+		// the token doesn't lift it. The handlers reuse the parsed form.
+		if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" && r.Header.Get(utils.CSRFHeaderName) == "" {
+			r.Body = http.MaxBytesReader(w, r.Body, app.formUploadLimit(r.URL.Path))
+			if err := r.ParseMultipartForm(maxFormMemory); err != nil {
+				var maxBytesErr *http.MaxBytesError
+				if errors.As(err, &maxBytesErr) {
+					http.Error(w, "File too large", http.StatusRequestEntityTooLarge)
+					return
+				}
+				log.Println("CSRFMiddleware: Error parsing multipart form:", err)
+			}
+		}
+
+		if !utils.ValidCSRFToken(r) {
+			log.Printf("CSRFMiddleware: Rejected %s %s without a valid CSRF token\n", r.Method, r.URL.Path)
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				writeAPIError(w, http.StatusForbidden, "csrf_failed", "Send the "+utils.CSRFHeaderName+" header, or use an API token")
+				return
+			}
+			utils.RenderForbiddenPage(w)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"ellas-corner/internal/utils"
+)
+
+func TestCSRFMiddleware(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	hashed, _ := utils.HashPassword("secret123")
+	if err := app.Store.CreateUser("ella", "ella@example.com", hashed, "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	laptop := loginAndGetCookie(t, app, "ella@example.com", "secret123", "Laptop")
+	phone := loginAndGetCookie(t, app, "ella@example.com", "secret123", "Phone")
+	laptopToken := utils.CSRFToken(requestWithCookie(http.MethodGet, "/", laptop))
+	phoneToken := utils.CSRFToken(requestWithCookie(http.MethodGet, "/", phone))
+	if laptopToken == "" || laptopToken == phoneToken {
+		t.Fatalf("expected a different CSRF token for each session, got %q and %q", laptopToken, phoneToken)
+	}
+
+	var gotTitle string
+	handler := app.CSRFMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotTitle = r.FormValue("title")
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	send := func(req *http.Request) int {
+		gotTitle = ""
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	form := func(path string, cookie *http.Cookie, values url.Values) *http.Request {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(values.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		return req
+	}
+
+	tests := []struct {
+		name string
+		req  *http.Request
+		want int
+	}{
+		{"form without token", form("/delete-post", laptop, url.Values{"post_id": {"1"}}), http.StatusForbidden},
+		{"form with another session's token", form("/delete-post", laptop, url.Values{"csrf_token": {phoneToken}}), http.StatusForbidden},
+		{"form with token", form("/delete-post", laptop, url.Values{"csrf_token": {laptopToken}}), http.StatusNoContent},
+		{"signed out", form("/login", nil, url.Values{"email": {"ella@example.com"}}), http.StatusNoContent},
+		{"safe method", requestWithCookie(http.MethodGet, "/profile", laptop), http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		if got := send(tt.req); got != tt.want {
+			t.Errorf("%s: expected %d, got %d", tt.name, tt.want, got)
+		}
+	}
+
+	// The JSON API takes the token as a header, or a bearer token instead of the cookie
+	api := requestWithCookie(http.MethodDelete, "/api/v1/posts/1", laptop)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, api)
+	if rr.Code != http.StatusForbidden || !strings.Contains(rr.Body.String(), "csrf_failed") {
+		t.Errorf("expected a csrf_failed API error, got %d %s", rr.Code, rr.Body.String())
+	}
+	api = requestWithCookie(http.MethodDelete, "/api/v1/posts/1", laptop)
+	api.Header.Set(utils.CSRFHeaderName, laptopToken)
+	if got := send(api); got != http.StatusNoContent {
+		t.Errorf("expected the header to be accepted, got %d", got)
+	}
+	api = requestWithCookie(http.MethodDelete, "/api/v1/posts/1", laptop)
+	api.Header.Set("Authorization", "Bearer some-api-token")
+	if got := send(api); got != http.StatusNoContent {
+		t.Errorf("expected bearer token requests to skip the check, got %d", got)
+	}
+
+	// Uploads carry the token as a multipart field and the handler still sees the other fields
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("csrf_token", laptopToken)
+	mw.WriteField("title", "Pram")
+	mw.Close()
+	upload := httptest.NewRequest(http.MethodPost, "/create-post", &body)
+	upload.Header.Set("Content-Type", mw.FormDataContentType())
+	upload.AddCookie(laptop)
+	if got := send(upload); got != http.StatusNoContent || gotTitle != "Pram" {
+		t.Errorf("expected the upload to pass with its fields intact, got %d and title %q", got, gotTitle)
+	}
+}
+
+func TestLogoutRequiresPost(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	hashed, _ := utils.HashPassword("secret123")
+	if err := app.Store.CreateUser("ella", "ella@example.com", hashed, "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	cookie := loginAndGetCookie(t, app, "ella@example.com", "secret123", "Laptop")
+
+	rr := httptest.NewRecorder()
+	app.LogoutHandler(rr, requestWithCookie(http.MethodGet, "/logout", cookie))
+	if rr.Code != http.StatusMethodNotAllowed {
+		t.Errorf("expected 405 for GET /logout, got %d", rr.Code)
+	}
+	if _, err := utils.GetSessionUser(app.Store, requestWithCookie(http.MethodGet, "/", cookie)); err != nil {
+		t.Fatalf("expected GET /logout to leave the session alone, got %v", err)
+	}
+
+	rr = httptest.NewRecorder()
+	app.LogoutHandler(rr, requestWithCookie(http.MethodPost, "/logout", cookie))
+	if _, err := utils.GetSessionUser(app.Store, requestWithCookie(http.MethodGet, "/", cookie)); err == nil {
+		t.Error("expected POST /logout to end the session")
+	}
+}
+
+// Every form that posts must include csrfField, or CSRFMiddleware will reject it
+func TestEveryPostFormHasCSRFField(t *testing.T) {
+	t.Parallel()
+	postForm := regexp.MustCompile(`(?is)<form[^>]*method="post"[^>]*>(.*?)</form>`)
+	var checked int
+	err := filepath.Walk("../../web/templates", func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() || filepath.Ext(path) != ".html" {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		for _, form := range postForm.FindAllStringSubmatch(string(content), -1) {
+			checked++
+			if !strings.Contains(form[1], "{{ csrfField }}") {
+				t.Errorf("%s: form without {{ csrfField }}: %.80s", path, strings.TrimSpace(form[1]))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Error reading templates: %v", err)
+	}
+	if checked == 0 {
+		t.Fatal("expected to find forms in web/templates")
+	}
+}
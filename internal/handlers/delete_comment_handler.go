@@ -1,19 +1,37 @@
 package handlers
 
 import (
+	"ellas-corner/internal/authz"
 	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
 	"log"
 	"net/http"
 	"strconv"
 )
 
+// deleteCommentAs deletes a comment on behalf of user, who must be allowed to by
+// authz.DeleteComment. Deleting someone else's comment is recorded in the moderation log.
+func (app *App) deleteCommentAs(user *utils.SessionUser, comment *repository.Comment, reason string) error {
+	if comment.UserID == user.ID {
+		return app.Store.DeleteComment(comment.ID)
+	}
+	return app.Store.ModeratorDeleteComment(user.ID, comment.ID, reason)
+}
+
 // DeleteCommentHandler handles the deletion of a user comment from their profile page.
-func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+// Moderators and admins can also delete other people's comments.
+func (app *App) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	// Parse comment ID from form data
 	commentIDStr := r.FormValue("comment_id")
 	commentID, err := strconv.Atoi(commentIDStr)
@@ -23,13 +41,29 @@ func DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	comment, err := app.Store.GetCommentByID(commentID, sessionUser.ID)
+	if err != nil || comment == nil {
+		log.Println("DeleteCommentHandler: Error fetching comment:", err)
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+	if !authz.Can(sessionUser, authz.DeleteComment, comment.UserID) {
+		log.Printf("DeleteCommentHandler: User %d may not delete comment %d\n", sessionUser.ID, commentID)
+		http.Error(w, "You can only delete your own comments", http.StatusForbidden)
+		return
+	}
+
 	// Attempt to delete the comment
-	if err := repository.DeleteComment(commentID); err != nil {
+	if err := app.deleteCommentAs(sessionUser, comment, r.FormValue("reason")); err != nil {
 		log.Println("DeleteCommentHandler: Error deleting comment:", err)
 	} else {
 		log.Printf("DeleteCommentHandler: Comment %d deleted successfully\n", commentID)
 	}
 
+	if comment.UserID != sessionUser.ID {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
 	// Redirect user back to their profile page
 	http.Redirect(w, r, "/profile", http.StatusSeeOther)
 }
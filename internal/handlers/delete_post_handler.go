@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"ellas-corner/internal/authz"
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"log"
@@ -8,13 +9,29 @@ import (
 	"strconv"
 )
 
-// DeletePostHandler deletes a post based on its ID (requires POST method)
-func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
+// deletePostAs deletes a post on behalf of user, who must be allowed to by authz.DeletePost.
+// Deleting someone else's post is a moderation action and is recorded in the moderation log.
+func (app *App) deletePostAs(user *utils.SessionUser, post *repository.Post, reason string) error {
+	if post.UserID == user.ID {
+		return app.Store.DeletePost(post.ID)
+	}
+	return app.Store.ModeratorDeletePost(user.ID, post.ID, reason)
+}
+
+// DeletePostHandler deletes a post based on its ID (requires POST method).
+// Authors can delete their own posts; moderators and admins can delete any post.
+func (app *App) DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
 	postIDStr := r.FormValue("post_id")
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
@@ -23,7 +40,24 @@ func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if err := repository.DeletePost(postID); err != nil {
+	post, err := app.Store.GetPostByID(postIDStr, sessionUser.ID)
+	if err != nil {
+		log.Println("DeletePostHandler: Error fetching post:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	if post == nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if !authz.Can(sessionUser, authz.DeletePost, post.UserID) {
+		log.Printf("DeletePostHandler: User %d may not delete post %d\n", sessionUser.ID, postID)
+		http.Error(w, "You can only delete your own posts", http.StatusForbidden)
+		return
+	}
+
+	if err := app.deletePostAs(sessionUser, post, r.FormValue("reason")); err != nil {
 		log.Println("DeletePostHandler: Error deleting post:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RenderServerErrorPage(w)
@@ -31,5 +65,9 @@ func DeletePostHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	log.Printf("DeletePostHandler: Post %d deleted successfully\n", postID)
+	if post.UserID != sessionUser.ID {
+		http.Redirect(w, r, "/admin", http.StatusSeeOther)
+		return
+	}
 	http.Redirect(w, r, "/profile", http.StatusSeeOther)
 }
@@ -0,0 +1,264 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ellas-corner/internal/authz"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+// maxDonationMessage caps the message sent with a request and the note on other changes
+const maxDonationMessage = 1000
+
+// donationInUseMessage explains why an edit can't stop a post being a donation
+const donationInUseMessage = "Members are waiting on this item, or it has been handed over, so it stays a donation. Withdraw it on its donation page if it is no longer on offer."
+
+var (
+	errUnknownDonationAction = errors.New("unknown donation action")
+	errDonationForbidden     = errors.New("not allowed to change this donation")
+)
+
+// loadDonation fetches a donated post and its lifecycle. It returns sql.ErrNoRows if the post
+// does not exist, is not a donation, or is hidden from viewer (nil when signed out).
+func (app *App) loadDonation(postID int, viewer *utils.SessionUser) (*repository.Post, *repository.Donation, error) {
+	post, err := app.Store.GetPostByID(strconv.Itoa(postID), viewerIDOf(viewer))
+	if err != nil {
+		return nil, nil, err
+	}
+	if post == nil || (post.Hidden && !authz.Can(viewer, authz.ViewHidden, 0)) {
+		return nil, nil, sql.ErrNoRows
+	}
+	donation, err := app.Store.GetDonation(postID)
+	if err != nil {
+		return nil, nil, err
+	}
+	return post, donation, nil
+}
+
+// applyDonationAction changes a donation on behalf of user. Members can request an item and
+// cancel their request; the donor reserves it for one request, hands it over, withdraws or
+// relists it; the donor or the recipient can release a reservation. text is the request
+// message or a note for the history.
+func (app *App) applyDonationAction(user *utils.SessionUser, donation *repository.Donation, action string, requestID int, text string) error {
+	postID := donation.PostID
+
+	switch action {
+	case "request", "cancel-request":
+		if !authz.Can(user, authz.RequestDonation, donation.DonorID) {
+			return errDonationForbidden
+		}
+		if action == "request" {
+			return app.Store.RequestDonation(postID, user.ID, text)
+		}
+		return app.Store.CancelDonationRequest(postID, user.ID)
+	case "release":
+		if !authz.Can(user, authz.ManageDonation, donation.DonorID) && user.ID != donation.RecipientID {
+			return errDonationForbidden
+		}
+		return app.Store.ReleaseDonation(postID, user.ID, text)
+	case "reserve", "hand-over", "withdraw", "relist":
+		if !authz.Can(user, authz.ManageDonation, donation.DonorID) {
+			return errDonationForbidden
+		}
+	default:
+		return errUnknownDonationAction
+	}
+
+	switch action {
+	case "reserve":
+		return app.Store.ReserveDonation(postID, user.ID, requestID, text)
+	case "hand-over":
+		return app.Store.CompleteDonation(postID, user.ID, text)
+	case "withdraw":
+		return app.Store.WithdrawDonation(postID, user.ID, text)
+	default:
+		return app.Store.RelistDonation(postID, user.ID, text)
+	}
+}
+
+// DonationHandler renders the donation page for a post: its status, the requests made for
+// it, the forms to move it along and its history: GET /donations/{id}
+func (app *App) DonationHandler(w http.ResponseWriter, r *http.Request) {
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Signed-out visitors can see the page; sessionUser is nil for them
+	sessionUser, _ := utils.GetSessionUser(app.Store, r)
+
+	post, donation, err := app.loadDonation(postID, sessionUser)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("DonationHandler: Error fetching donation:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	data := viewmodels.DonationPageData{
+		Post:     *post,
+		Donation: *donation,
+		Message:  r.URL.Query().Get("message"),
+	}
+	if sessionUser != nil {
+		data.IsLoggedIn = true
+		data.ProfilePicture = sessionUser.ProfilePicture
+		data.UnreadMessages = app.unreadMessages(sessionUser.ID)
+		data.UnreadNotifications = app.unreadNotifications(sessionUser.ID)
+		data.IsDonor = authz.Can(sessionUser, authz.ManageDonation, donation.DonorID)
+		data.IsRecipient = sessionUser.ID == donation.RecipientID
+		data.CanRequest = authz.Can(sessionUser, authz.RequestDonation, donation.DonorID) && donation.Status.Open()
+		data.MyRequest = donation.RequestBy(sessionUser.ID)
+	}
+
+	tmpl, err := parseTemplates(r, "web/templates/donation.html", "web/templates/partials/navbar.html")
+	if err != nil {
+		log.Println("DonationHandler: Error parsing template:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("DonationHandler: Error executing template:", err)
+	}
+}
+
+// DonationActionHandler applies a form on the donation page: POST /donations/{id}/{action}.
+// Changes the item's state no longer allows, such as reserving an item someone else was
+// just promised, send the user back to the page with an explanation.
+func (app *App) DonationActionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+ask+for+donations.", http.StatusSeeOther)
+		return
+	}
+	postID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	text := strings.TrimSpace(r.FormValue("message"))
+	if len(text) > maxDonationMessage {
+		http.Error(w, "Message is too long", http.StatusBadRequest)
+		return
+	}
+	requestID, _ := strconv.Atoi(r.FormValue("request_id"))
+
+	_, donation, err := app.loadDonation(postID, sessionUser)
+	if err == nil {
+		err = app.applyDonationAction(sessionUser, donation, r.PathValue("action"), requestID, text)
+	}
+
+	page := "/donations/" + strconv.Itoa(postID)
+	switch {
+	case err == nil:
+		log.Printf("DonationActionHandler: User %d applied %s to donation %d\n", sessionUser.ID, r.PathValue("action"), postID)
+		http.Redirect(w, r, page, http.StatusSeeOther)
+	case errors.Is(err, repository.ErrDonationUnavailable):
+		http.Redirect(w, r, page+"?message="+url.QueryEscape("This item has changed in the meantime, so that is no longer possible."), http.StatusSeeOther)
+	case errors.Is(err, repository.ErrAlreadyRequested):
+		http.Redirect(w, r, page+"?message="+url.QueryEscape("You have already asked for this item."), http.StatusSeeOther)
+	case errors.Is(err, sql.ErrNoRows), errors.Is(err, errUnknownDonationAction):
+		http.NotFound(w, r)
+	case errors.Is(err, errDonationForbidden):
+		http.Error(w, "Forbidden", http.StatusForbidden)
+	default:
+		log.Println("DonationActionHandler: Error changing donation:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+	}
+}
+
+// APIGetDonationHandler returns the lifecycle of a donated post
+func (app *App) APIGetDonationHandler(w http.ResponseWriter, r *http.Request) {
+	postID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+	viewer := app.apiViewer(r)
+
+	_, donation, err := app.loadDonation(postID, viewer)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "No donation with that post ID")
+		return
+	} else if err != nil {
+		log.Println("APIGetDonationHandler: Error fetching donation:", err)
+		writeAPIServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, viewmodels.NewDonationJSON(*donation, viewerIDOf(viewer)))
+}
+
+// APIDonationActionHandler moves a donation along with an optional {"request_id", "message"}
+// body: POST /api/v1/posts/{id}/donation/{action}, where action is request, cancel-request,
+// reserve, release, hand-over, withdraw or relist. Returns the updated donation.
+func (app *App) APIDonationActionHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok {
+		return
+	}
+	postID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		RequestID int    `json:"request_id"`
+		Message   string `json:"message"`
+	}
+	if r.ContentLength != 0 && !decodeJSON(w, r, &body) {
+		return
+	}
+	text := strings.TrimSpace(body.Message)
+	if len(text) > maxDonationMessage {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "message must be at most "+strconv.Itoa(maxDonationMessage)+" characters")
+		return
+	}
+
+	_, donation, err := app.loadDonation(postID, sessionUser)
+	if err == nil {
+		err = app.applyDonationAction(sessionUser, donation, r.PathValue("action"), body.RequestID, text)
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, errUnknownDonationAction):
+		writeAPIError(w, http.StatusNotFound, "not_found", "No API endpoint matches "+r.Method+" "+r.URL.Path)
+		return
+	case errors.Is(err, sql.ErrNoRows):
+		writeAPIError(w, http.StatusNotFound, "not_found", "No matching donation or request")
+		return
+	case errors.Is(err, errDonationForbidden):
+		writeAPIError(w, http.StatusForbidden, "forbidden", "You can't do that with this donation")
+		return
+	case errors.Is(err, repository.ErrDonationUnavailable):
+		writeAPIError(w, http.StatusConflict, "donation_unavailable", "The donation has changed in the meantime and no longer allows that")
+		return
+	case errors.Is(err, repository.ErrAlreadyRequested):
+		writeAPIError(w, http.StatusConflict, "already_requested", "You have already asked for this item")
+		return
+	default:
+		log.Println("APIDonationActionHandler: Error changing donation:", err)
+		writeAPIServerError(w)
+		return
+	}
+
+	donation, err = app.Store.GetDonation(postID)
+	if err != nil {
+		writeAPIServerError(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, viewmodels.NewDonationJSON(*donation, sessionUser.ID))
+}
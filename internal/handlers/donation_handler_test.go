@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+)
+
+func TestAPIDonations(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+
+	donorToken := createAPIUser(t, app, mux, "donor", "donor@example.com")
+	firstToken := createAPIUser(t, app, mux, "first", "first@example.com")
+	secondToken := createAPIUser(t, app, mux, "second", "second@example.com")
+
+	rr, body := apiRequest(t, mux, http.MethodPost, "/api/v1/posts", donorToken, `{"title":"Pram","content":"Folds flat","is_donation":true}`)
+	if rr.Code != http.StatusCreated || body["donation_status"] != "available" {
+		t.Fatalf("expected an available donation, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/request", donorToken, ""); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 requesting your own donation, got %d", rr.Code)
+	}
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/request", "", ""); rr.Code != http.StatusUnauthorized {
+		t.Errorf("expected 401 requesting anonymously, got %d", rr.Code)
+	}
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/give-away", donorToken, ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for an unknown action, got %d", rr.Code)
+	}
+
+	for _, token := range []string{firstToken, secondToken} {
+		if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/request", token, `{"message":"For my daughter"}`); rr.Code != http.StatusOK {
+			t.Fatalf("expected 200 requesting, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	rr, body = apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/request", firstToken, "")
+	if rr.Code != http.StatusConflict || body["error"].(map[string]interface{})["code"] != "already_requested" {
+		t.Errorf("expected 409 already_requested, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	// Requesters only see their own request; the donor sees them all
+	_, body = apiRequest(t, mux, http.MethodGet, "/api/v1/posts/1/donation", secondToken, "")
+	if body["requests"] != nil || body["my_request"] == nil {
+		t.Errorf("expected only the viewer's own request, got %v", body)
+	}
+	_, body = apiRequest(t, mux, http.MethodGet, "/api/v1/posts/1/donation", donorToken, "")
+	requests, _ := body["requests"].([]interface{})
+	if len(requests) != 2 || body["status"] != "requested" {
+		t.Fatalf("expected two requests for the donor, got %v", body)
+	}
+	firstRequest := requests[0].(map[string]interface{})["id"].(float64)
+
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/reserve", secondToken, `{"request_id":1}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 reserving someone else's donation, got %d", rr.Code)
+	}
+	rr, body = apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/reserve", donorToken, `{"request_id":`+strconv.Itoa(int(firstRequest))+`}`)
+	if rr.Code != http.StatusOK || body["status"] != "reserved" || body["recipient_name"] != "first" {
+		t.Fatalf("expected the pram reserved for first, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr, body = apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/reserve", donorToken, `{"request_id":2}`)
+	if rr.Code != http.StatusConflict || body["error"].(map[string]interface{})["code"] != "donation_unavailable" {
+		t.Errorf("expected 409 reserving an already reserved item, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr, body = apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/hand-over", donorToken, `{"message":"Collected"}`)
+	if rr.Code != http.StatusOK || body["status"] != "handed_over" {
+		t.Fatalf("expected handed_over, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if _, body := apiRequest(t, mux, http.MethodGet, "/api/v1/posts/1", "", ""); body["donation_status"] != "handed_over" {
+		t.Errorf("expected the post to show the new status, got %v", body["donation_status"])
+	}
+}
+
+func TestEditingDonationFlag(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+
+	donorToken := createAPIUser(t, app, mux, "donor", "donor@example.com")
+	requesterToken := createAPIUser(t, app, mux, "requester", "requester@example.com")
+	cookie := loginAndGetCookie(t, app, "donor@example.com", "secret123", "test")
+
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts", donorToken, `{"title":"Pram","content":"Folds flat","is_donation":true}`); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/request", requesterToken, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 requesting, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	editForm := func(fields url.Values) *httptest.ResponseRecorder {
+		form, contentType := multipartWithImages(t, fields)
+		req := httptest.NewRequest(http.MethodPost, "/edit-post", form)
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Neither the form nor the API can untick an item someone has asked for
+	if rr := editForm(url.Values{"id": {"1"}, "title": {"Pram"}, "content": {"Folds flat"}, "category": {"General"}}); rr.Code == http.StatusSeeOther {
+		t.Error("expected the form to refuse unticking a requested donation")
+	}
+	rr, body := apiRequest(t, mux, http.MethodPatch, "/api/v1/posts/1", donorToken, `{"title":"Old pram","is_donation":false}`)
+	if rr.Code != http.StatusConflict || body["error"].(map[string]interface{})["code"] != "donation_unavailable" {
+		t.Errorf("expected 409 donation_unavailable, got %d: %s", rr.Code, rr.Body.String())
+	}
+	_, body = apiRequest(t, mux, http.MethodGet, "/api/v1/posts/1/donation", donorToken, "")
+	if body["status"] != "requested" || len(body["requests"].([]interface{})) != 1 {
+		t.Fatalf("expected the request to stand, got %v", body)
+	}
+	if _, body := apiRequest(t, mux, http.MethodGet, "/api/v1/posts/1", "", ""); body["title"] != "Pram" {
+		t.Errorf("expected the refused edit to change nothing, got title %v", body["title"])
+	}
+
+	// Once nobody is waiting, unticking withdraws the item with an entry in its history
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/donation/cancel-request", requesterToken, ""); rr.Code != http.StatusOK {
+		t.Fatalf("expected 200 cancelling, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if rr := editForm(url.Values{"id": {"1"}, "title": {"Pram"}, "content": {"Folds flat"}, "category": {"General"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after unticking, got %d: %s", rr.Code, rr.Body.String())
+	}
+	_, body = apiRequest(t, mux, http.MethodGet, "/api/v1/posts/1/donation", donorToken, "")
+	if body["status"] != "withdrawn" {
+		t.Errorf("expected the item withdrawn, got %v", body)
+	}
+
+	// Ticking it again through the API relists it
+	rr, body = apiRequest(t, mux, http.MethodPatch, "/api/v1/posts/1", donorToken, `{"is_donation":true}`)
+	if rr.Code != http.StatusOK || body["is_donation"] != true || body["donation_status"] != "available" {
+		t.Errorf("expected the item on offer again, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
@@ -1,16 +1,18 @@
 package handlers
 
 import (
+	"ellas-corner/internal/authz"
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"html/template"
+	"errors"
 	"log"
 	"net/http"
 	"strconv"
 )
 
-func EditPostHandler(w http.ResponseWriter, r *http.Request) {
+// EditPostHandler shows the edit form for a post (GET) and saves changes (POST). Only the author can edit a post.
+func (app *App) EditPostHandler(w http.ResponseWriter, r *http.Request) {
 	postIDStr := r.FormValue("id")
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
@@ -19,22 +21,31 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionUser, err := utils.GetSessionUser(r)
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	if err != nil {
 		log.Println("EditPostHandler: User not logged in")
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
 
-	post, err := repository.GetPostByID(postIDStr, sessionUser.ID)
+	post, err := app.Store.GetPostByID(postIDStr, sessionUser.ID)
 	if err != nil {
 		log.Println("EditPostHandler: Error fetching post:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RenderServerErrorPage(w)
 		return
 	}
+	if post == nil {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+	if !authz.Can(sessionUser, authz.EditPost, post.UserID) {
+		log.Printf("EditPostHandler: User %d may not edit post %d\n", sessionUser.ID, postID)
+		http.Error(w, "You can only edit your own posts", http.StatusForbidden)
+		return
+	}
 
-	categories, err := repository.FetchCategories()
+	categories, err := app.Store.FetchCategories()
 	if err != nil {
 		log.Println("EditPostHandler: Error fetching categories:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -42,11 +53,9 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if r.Method == http.MethodGet {
-		isLoggedIn := true
-		profilePicture := sessionUser.ProfilePicture
-
-		tmpl, err := template.ParseFiles("web/templates/edit_post.html", "web/templates/partials/navbar.html")
+	// renderForm shows the edit form, with a message when the last attempt was refused
+	renderForm := func(status int, message string) {
+		tmpl, err := parseTemplates(r, "web/templates/edit_post.html", "web/templates/partials/navbar.html")
 		if err != nil {
 			log.Println("EditPostHandler: Error parsing template:", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -55,22 +64,30 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 		}
 
 		data := viewmodels.EditPostPageData{
-			IsLoggedIn:     isLoggedIn,
-			ProfilePicture: profilePicture,
-			Post:           *post,
-			Categories:     categories,
+			IsLoggedIn:          true,
+			ProfilePicture:      sessionUser.ProfilePicture,
+			UnreadMessages:      app.unreadMessages(sessionUser.ID),
+			UnreadNotifications: app.unreadNotifications(sessionUser.ID),
+			Post:                *post,
+			Categories:          categories,
+			Error:               message,
+			MaxImages:           repository.MaxPostImages,
 		}
 
+		w.WriteHeader(status)
 		if err := tmpl.Execute(w, data); err != nil {
 			log.Println("EditPostHandler: Error executing template:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			utils.RenderServerErrorPage(w)
 		}
+	}
+
+	if r.Method == http.MethodGet {
+		renderForm(http.StatusOK, "")
 		return
 	}
 
 	if r.Method == http.MethodPost {
-		err := r.ParseMultipartForm(10 << 20)
+		r.Body = http.MaxBytesReader(w, r.Body, app.postUploadLimit())
+		err := r.ParseMultipartForm(maxFormMemory)
 		if err != nil {
 			log.Println("EditPostHandler: Error parsing form:", err)
 			w.WriteHeader(http.StatusInternalServerError)
@@ -81,24 +98,47 @@ func EditPostHandler(w http.ResponseWriter, r *http.Request) {
 		title := r.FormValue("title")
 		content := r.FormValue("content")
 		category := r.FormValue("category")
-		isDonation := r.FormValue("is_donation") != "on"
+		isDonation := r.FormValue("is_donation") == "on"
 
-		var imagePath string
-		file, header, err := r.FormFile("image")
-		if err == nil && header.Size > 0 {
-			defer file.Close()
-			imagePath, err = repository.SaveImageFile(file, header)
+		// Posts filed before categories were managed keep theirs until it's changed
+		if category != post.Category {
+			name, known, err := app.postCategory(category)
 			if err != nil {
-				log.Println("EditPostHandler: Failed to save image:", err)
+				log.Println("EditPostHandler: Error looking up category:", err)
 				w.WriteHeader(http.StatusInternalServerError)
 				utils.RenderServerErrorPage(w)
 				return
 			}
-		} else {
-			imagePath = post.Image
+			if !known {
+				post.Title, post.Content, post.IsDonation = title, content, isDonation
+				renderForm(http.StatusBadRequest, unknownCategoryMessage)
+				return
+			}
+			category = name
 		}
 
-		err = repository.UpdatePostWithImage(postID, title, content, category, isDonation, imagePath)
+		// Photos already on the post come first, in their new order, then any new uploads
+		gallery := editedGallery(r, post.Images, title)
+		uploaded, err := app.uploadedPostImages(r, title, repository.MaxPostImages-len(gallery))
+		if message, refused := imageRefused(err); refused {
+			log.Println("EditPostHandler: Rejected images:", err)
+			post.Title, post.Content, post.Category, post.IsDonation = title, content, category, isDonation
+			renderForm(http.StatusBadRequest, message)
+			return
+		}
+		if err != nil {
+			log.Println("EditPostHandler: Failed to save images:", err)
+			w.WriteHeader(http.StatusInternalServerError)
+			utils.RenderServerErrorPage(w)
+			return
+		}
+
+		err = app.Store.UpdatePostWithImages(postID, title, content, category, isDonation, append(gallery, uploaded...))
+		if errors.Is(err, repository.ErrDonationUnavailable) {
+			post.Title, post.Content, post.Category = title, content, category
+			renderForm(http.StatusConflict, donationInUseMessage)
+			return
+		}
 		if err != nil {
 			log.Println("EditPostHandler: Error updating post:", err)
 			w.WriteHeader(http.StatusInternalServerError)
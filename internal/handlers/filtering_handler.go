@@ -4,16 +4,77 @@ import (
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"html/template"
 	"log"
 	"net/http"
+	"strings"
+	"time"
 )
 
-func FilterHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("FilterHandler: Request received")
+// postQueryFromRequest reads the shared listing filters from the URL, so the home, filter and
+// search pages all accept the same parameters:
+//
+//	category (repeatable), start_date, end_date (YYYY-MM-DD), author, country,
+//	donations_only=true, created_posts=true, liked_posts=true, sort
+//
+// created_posts and liked_posts only apply to logged-in users.
+func postQueryFromRequest(r *http.Request, viewerID int) repository.PostQuery {
+	values := r.URL.Query()
 
+	query := repository.PostQuery{
+		Author:        strings.TrimSpace(values.Get("author")),
+		Country:       strings.TrimSpace(values.Get("country")),
+		DonationsOnly: values.Get("donations_only") == "true",
+		Sort:          repository.PostSort(values.Get("sort")),
+		ViewerID:      viewerID,
+	}
+
+	for _, category := range values["category"] {
+		if category = strings.TrimSpace(category); category != "" {
+			query.Categories = append(query.Categories, category)
+		}
+	}
+
+	if startDate, err := time.Parse("2006-01-02", values.Get("start_date")); err == nil {
+		query.StartDate = startDate
+	} else if values.Get("start_date") != "" {
+		log.Println("postQueryFromRequest: Ignoring invalid start_date:", values.Get("start_date"))
+	}
+	if endDate, err := time.Parse("2006-01-02", values.Get("end_date")); err == nil {
+		query.EndDate = endDate
+	} else if values.Get("end_date") != "" {
+		log.Println("postQueryFromRequest: Ignoring invalid end_date:", values.Get("end_date"))
+	}
+
+	if viewerID != 0 {
+		if values.Get("created_posts") == "true" {
+			query.CreatedBy = viewerID
+		}
+		if values.Get("liked_posts") == "true" {
+			query.LikedBy = viewerID
+		}
+	}
+
+	return query
+}
+
+// applyDonationLabels decides which donation posts show the "I have one to donate!" label,
+// honouring the logged-in user's "only show donations from my country" preference. Items
+// that are reserved, handed over or withdrawn never show it.
+func applyDonationLabels(posts []repository.Post, isLoggedIn bool, currentUser repository.User) {
+	for i := range posts {
+		if posts[i].DonationStatus.Open() {
+			if isLoggedIn && currentUser.ShowDonationsInCountryOnly {
+				posts[i].ShowDonatedLabel = posts[i].DonationCountry == currentUser.Country
+			} else {
+				posts[i].ShowDonatedLabel = true
+			}
+		}
+	}
+}
+
+func (app *App) FilterHandler(w http.ResponseWriter, r *http.Request) {
 	// Check session to determine login state
-	sessionUser, err := utils.GetSessionUser(r)
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	isLoggedIn := err == nil
 	userID := 0
 	profilePicture := ""
@@ -23,7 +84,7 @@ func FilterHandler(w http.ResponseWriter, r *http.Request) {
 		userID = sessionUser.ID
 		profilePicture = sessionUser.ProfilePicture
 
-		currentUser, err = repository.GetUserByID(userID)
+		currentUser, err = app.Store.GetUserByID(userID)
 		if err != nil {
 			log.Println("FilterHandler: Error fetching full user profile:", err)
 			utils.RenderServerErrorPage(w)
@@ -31,34 +92,27 @@ func FilterHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Read query parameters used for filtering
-	category := r.URL.Query().Get("category")
-	createdPosts := r.URL.Query().Get("created_posts")
-	likedPosts := r.URL.Query().Get("liked_posts")
-	startDate := r.URL.Query().Get("start_date")
-	endDate := r.URL.Query().Get("end_date")
+	// Read query parameters used for filtering and paging
+	query := postQueryFromRequest(r, userID)
+	page, err := applyPagination(r, &query, postsPerPage)
+	if err != nil {
+		log.Println("FilterHandler: Ignoring invalid cursor; showing the first page")
+	}
 
-	posts, err := repository.FetchFilteredPosts(category, createdPosts, likedPosts, startDate, endDate, userID, isLoggedIn)
+	result, err := app.Store.FetchPostPage(query)
 	if err != nil {
 		log.Println("FilterHandler: Error fetching filtered posts:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RenderServerErrorPage(w)
 		return
 	}
+	posts := result.Posts
 
 	// Set donation label visibility on filtered posts
-	for i := range posts {
-		if posts[i].IsDonation {
-			if isLoggedIn && currentUser.ShowDonationsInCountryOnly {
-				posts[i].ShowDonatedLabel = posts[i].DonationCountry == currentUser.Country
-			} else {
-				posts[i].ShowDonatedLabel = true
-			}
-		}
-	}
+	applyDonationLabels(posts, isLoggedIn, currentUser)
 
 	// Fetch available categories for filter options
-	categories, err := repository.FetchCategories()
+	categories, err := app.Store.FetchCategories()
 	if err != nil {
 		log.Println("FilterHandler: Error fetching categories:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -66,10 +120,11 @@ func FilterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	tmpl, err := template.ParseFiles(
+	tmpl, err := parseTemplates(r,
 		"web/templates/filter_results.html",
 		"web/templates/partials/navbar.html",
 		"web/templates/partials/post.html",
+		"web/templates/partials/pagination.html",
 	)
 	if err != nil {
 		log.Println("FilterHandler: Error parsing template:", err)
@@ -77,12 +132,28 @@ func FilterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Keep the old single-category heading when exactly one category is selected, now with
+	// its age range and description
+	var category *repository.Category
+	if len(query.Categories) == 1 {
+		for i := range categories {
+			if query.HasCategory(categories[i]) {
+				category = &categories[i]
+				break
+			}
+		}
+	}
+
 	data := viewmodels.FilterPageData{
-		IsLoggedIn:     isLoggedIn,
-		ProfilePicture: profilePicture,
-		Posts:          posts,
-		Categories:     categories,
-		Category:       category,
+		IsLoggedIn:          isLoggedIn,
+		ProfilePicture:      profilePicture,
+		UnreadMessages:      app.unreadMessages(userID),
+		UnreadNotifications: app.unreadNotifications(userID),
+		Posts:               posts,
+		Categories:          categories,
+		Category:            category,
+		Query:               query,
+		Pagination:          paginationLinks(r, page, result),
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
@@ -91,6 +162,4 @@ func FilterHandler(w http.ResponseWriter, r *http.Request) {
 		utils.RenderServerErrorPage(w)
 		return
 	}
-
-	log.Println("FilterHandler: Template executed successfully")
 }
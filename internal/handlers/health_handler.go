@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"context"
+	"ellas-corner/internal/storage"
+	"ellas-corner/internal/viewmodels"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+// healthCheckTimeout bounds each check so a stuck database can't hang the probe
+const healthCheckTimeout = 2 * time.Second
+
+// HealthzHandler reports whether the server is alive and can still reach the database
+func (app *App) HealthzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]error{"database": app.checkDatabase(r.Context())}
+	writeHealth(w, "HealthzHandler", checks)
+}
+
+// ReadyzHandler reports whether the server is ready for traffic: the database answers, every
+// migration has been applied and uploaded images can be saved
+func (app *App) ReadyzHandler(w http.ResponseWriter, r *http.Request) {
+	checks := map[string]error{
+		"database":         app.checkDatabase(r.Context()),
+		"migrations":       app.checkMigrations(),
+		"uploads":          checkBlobStore(r.Context(), app.PostImages),
+		"profile_pictures": checkBlobStore(r.Context(), app.ProfilePictures),
+	}
+	writeHealth(w, "ReadyzHandler", checks)
+}
+
+// writeHealth responds 200 when every check passed and 503 otherwise. Failures are only
+// described in the log, since the endpoints are public.
+func writeHealth(w http.ResponseWriter, handler string, checks map[string]error) {
+	body := viewmodels.HealthJSON{Status: "ok", Checks: make(map[string]string, len(checks))}
+	status := http.StatusOK
+	for name, err := range checks {
+		body.Checks[name] = "ok"
+		if err != nil {
+			log.Printf("%s: %s check failed: %v", handler, name, err)
+			body.Checks[name] = "failed"
+			body.Status = "unavailable"
+			status = http.StatusServiceUnavailable
+		}
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSON(w, status, body)
+}
+
+func (app *App) checkDatabase(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	return app.Store.Ping(ctx)
+}
+
+func (app *App) checkMigrations() error {
+	pending, err := app.Store.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("%d pending, starting with %04d_%s", len(pending), pending[0].Version, pending[0].Name)
+	}
+	return nil
+}
+
+// checkBlobStore makes sure images can be saved, whether the store is a directory or a bucket
+func checkBlobStore(ctx context.Context, store storage.BlobStore) error {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+	return store.Check(ctx)
+}
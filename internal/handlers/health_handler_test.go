@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/storage"
+	"ellas-corner/internal/viewmodels"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func getHealth(t *testing.T, handler http.HandlerFunc, path string) (int, viewmodels.HealthJSON) {
+	t.Helper()
+	rr := httptest.NewRecorder()
+	handler(rr, httptest.NewRequest(http.MethodGet, path, nil))
+
+	var body viewmodels.HealthJSON
+	if err := json.Unmarshal(rr.Body.Bytes(), &body); err != nil {
+		t.Fatalf("expected a JSON body, got %q: %v", rr.Body.String(), err)
+	}
+	return rr.Code, body
+}
+
+func TestHealthAndReadiness(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	app.PostImages, app.ProfilePictures = storage.LocalStore{Dir: t.TempDir()}, storage.LocalStore{Dir: t.TempDir()}
+
+	if code, body := getHealth(t, app.HealthzHandler, "/healthz"); code != http.StatusOK || body.Checks["database"] != "ok" {
+		t.Errorf("expected /healthz to pass, got %d %+v", code, body)
+	}
+	code, body := getHealth(t, app.ReadyzHandler, "/readyz")
+	if code != http.StatusOK || body.Status != "ok" {
+		t.Fatalf("expected /readyz to pass, got %d %+v", code, body)
+	}
+	for _, check := range []string{"database", "migrations", "uploads", "profile_pictures"} {
+		if body.Checks[check] != "ok" {
+			t.Errorf("expected the %s check to pass, got %q", check, body.Checks[check])
+		}
+	}
+
+	// An upload directory that has gone missing makes the server unready, but still alive
+	app.PostImages = storage.LocalStore{Dir: filepath.Join(t.TempDir(), "missing")}
+	code, body = getHealth(t, app.ReadyzHandler, "/readyz")
+	if code != http.StatusServiceUnavailable || body.Status != "unavailable" || body.Checks["uploads"] != "failed" {
+		t.Errorf("expected a missing upload directory to fail readiness, got %d %+v", code, body)
+	}
+	if code, _ := getHealth(t, app.HealthzHandler, "/healthz"); code != http.StatusOK {
+		t.Errorf("expected /healthz to ignore upload directories, got %d", code)
+	}
+}
+
+func TestReadinessNeedsMigrationsAndDatabase(t *testing.T) {
+	t.Parallel()
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize test DB: %v", err)
+	}
+	app := NewApp(repository.NewSQLStore(conn))
+	app.PostImages, app.ProfilePictures = storage.LocalStore{Dir: t.TempDir()}, storage.LocalStore{Dir: t.TempDir()}
+
+	code, body := getHealth(t, app.ReadyzHandler, "/readyz")
+	if code != http.StatusServiceUnavailable || body.Checks["migrations"] != "failed" {
+		t.Errorf("expected pending migrations to fail readiness, got %d %+v", code, body)
+	}
+
+	conn.Conn.Close()
+	code, body = getHealth(t, app.HealthzHandler, "/healthz")
+	if code != http.StatusServiceUnavailable || body.Checks["database"] != "failed" {
+		t.Errorf("expected a closed database to fail /healthz, got %d %+v", code, body)
+	}
+}
@@ -4,19 +4,16 @@ import (
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"html/template"
 	"log"
 	"net/http"
 	"strconv"
 	"time"
 )
 
-func HomeHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("HomeHandler: Request received")
-
+func (app *App) HomeHandler(w http.ResponseWriter, r *http.Request) {
 	// Handle only root path
 	if r.URL.Path != "/" {
-		tmpl, err := template.ParseFiles("web/templates/404.html")
+		tmpl, err := parseTemplates(r, "web/templates/404.html")
 		if err != nil {
 			log.Println("HomeHandler: Error loading 404 template:", err)
 			utils.RenderServerErrorPage(w)
@@ -38,23 +35,22 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	var profilePicture string
 
 	// Step 1: Check for existing session token or create guest session
-	sessionCookie, err := r.Cookie("session_token")
+	_, err := r.Cookie(utils.SessionCookieName)
 	if err != nil {
 		sessionToken := utils.GenerateSessionToken()
 		http.SetCookie(w, &http.Cookie{
-			Name:    "session_token",
+			Name:    utils.SessionCookieName,
 			Value:   sessionToken,
-			Expires: time.Now().Add(24 * time.Hour),
+			Expires: time.Now().Add(utils.SessionIdleTimeout),
 			Path:    "/",
 		})
-		log.Println("HomeHandler: Generated session token for guest")
 	} else {
-		userID, err = repository.GetUserIDBySession(sessionCookie.Value)
-		if err == nil && userID != 0 {
+		sessionUser, err := utils.GetSessionUser(app.Store, r)
+		if err == nil {
 			isLoggedIn = true
-			log.Printf("HomeHandler: Logged-in user ID: %d", userID)
+			userID = sessionUser.ID
 
-			consentGiven, err := repository.CheckCookieConsent(userID)
+			consentGiven, err := app.Store.CheckCookieConsent(userID)
 			if err == nil && consentGiven {
 				showConsentBanner = false
 			}
@@ -72,7 +68,7 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 
 	// Step 3: Load current user (if logged in)
 	if isLoggedIn {
-		user, err := repository.GetUserByID(userID)
+		user, err := app.Store.GetUserByID(userID)
 		if err != nil {
 			log.Println("HomeHandler: Error fetching user profile:", err)
 		} else {
@@ -85,90 +81,62 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 	showCommentFormForPostStr := r.URL.Query().Get("showCommentFormForPost")
 	showCommentFormForPost, _ := strconv.Atoi(showCommentFormForPostStr)
 
-	// Step 4: Fetch all posts
-	posts, err := repository.FetchPosts(userID)
+	// Step 4: Fetch a page of posts, honouring any listing filters or sort in the URL
+	query := postQueryFromRequest(r, userID)
+	page, err := applyPagination(r, &query, postsPerPage)
+	if err != nil {
+		log.Println("HomeHandler: Ignoring invalid cursor; showing the first page")
+	}
+
+	result, err := app.Store.FetchPostPage(query)
 	if err != nil {
 		log.Println("HomeHandler: Error fetching posts:", err)
 		utils.RenderServerErrorPage(w)
 		return
 	}
-	log.Println("HomeHandler: Posts fetched")
+	posts := result.Posts
 
 	// Step 5: Fetch top liked posts
-	topPosts, err := repository.FetchTopPostsByLikes(5)
+	topPosts, err := app.Store.FetchTopPostsByLikes(5, userID)
 	if err != nil {
 		log.Println("HomeHandler: Error fetching top liked posts:", err)
 		topPosts = []repository.Post{}
-	} else {
-		for i := range topPosts {
-			topPosts[i].Likes, topPosts[i].Dislikes, _ = repository.FetchReactionsCount(topPosts[i].ID)
-			if isLoggedIn {
-				topPosts[i].UserReaction, _ = repository.FetchUserReaction(userID, topPosts[i].ID)
-			}
-		}
 	}
 
 	// Step 6: Fetch categories
-	categories, err := repository.FetchCategories()
+	categories, err := app.Store.FetchCategories()
 	if err != nil {
 		log.Println("HomeHandler: Error fetching categories:", err)
 		utils.RenderServerErrorPage(w)
 		return
 	}
-	log.Println("HomeHandler: Categories fetched")
-
-	// Step 7: Populate reaction and donation visibility for each post
-	for i := range posts {
-		likes, dislikes, err := repository.FetchReactionsCount(posts[i].ID)
-		if err != nil {
-			log.Println("HomeHandler: Error fetching reactions for post", posts[i].ID, ":", err)
-		}
-		posts[i].Likes = likes
-		posts[i].Dislikes = dislikes
 
-		if isLoggedIn {
-			userReaction, err := repository.FetchUserReaction(userID, posts[i].ID)
-			if err != nil {
-				log.Println("HomeHandler: Error fetching user reaction for post", posts[i].ID, ":", err)
-			}
-			posts[i].UserReaction = userReaction
-
-			// Donation visibility filtering for logged-in users
-			if posts[i].IsDonation {
-				if currentUser.ShowDonationsInCountryOnly {
-					posts[i].ShowDonatedLabel = (posts[i].DonationCountry == currentUser.Country)
-				} else {
-					posts[i].ShowDonatedLabel = true
-				}
-			}
-		} else {
-			// For guests, show donation label if post is a donation
-			if posts[i].IsDonation {
-				posts[i].ShowDonatedLabel = true
-			}
-		}
-	}
+	// Step 7: Populate donation visibility for each post
+	applyDonationLabels(posts, isLoggedIn, currentUser)
 
 	// Step 8: Render the homepage
-	tmpl, err := template.ParseFiles(
+	tmpl, err := parseTemplates(r,
 		"web/templates/index.html",
 		"web/templates/partials/navbar.html",
 		"web/templates/partials/post.html",
+		"web/templates/partials/pagination.html",
 	)
 	if err != nil {
 		log.Println("HomeHandler: Error parsing template:", err)
 		utils.RenderServerErrorPage(w)
 		return
 	}
-	log.Println("HomeHandler: Templates parsed successfully")
 
 	data := viewmodels.HomePageData{
 		IsLoggedIn:             isLoggedIn,
 		ProfilePicture:         profilePicture,
+		UnreadMessages:         app.unreadMessages(userID),
+		UnreadNotifications:    app.unreadNotifications(userID),
 		ShowConsentBanner:      showConsentBanner,
 		TopPosts:               topPosts,
 		Posts:                  posts,
 		Categories:             categories,
+		Pagination:             paginationLinks(r, page, result),
 		ShowCommentFormForPost: showCommentFormForPost,
 		ShowEditControls:       false,
 		ErrorMessage:           "",
@@ -179,5 +147,4 @@ func HomeHandler(w http.ResponseWriter, r *http.Request) {
 		utils.RenderServerErrorPage(w)
 		return
 	}
-	log.Println("HomeHandler: Page rendered successfully")
 }
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"ellas-corner/internal/images"
+	"ellas-corner/internal/storage"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// imageHandler serves the images in store by name. Images saved under a content hash never
+// change, so browsers may keep them for a year. Older pictures, such as the defaults, are
+// cached for an hour. When ImageURLExpiry is set and store can sign links, browsers are
+// redirected to the store instead.
+func (app *App) imageHandler(store storage.BlobStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		name := r.PathValue("name")
+		if name == "" || strings.HasPrefix(name, ".") {
+			http.NotFound(w, r)
+			return
+		}
+
+		if images.ContentAddressed(name) {
+			etag := `"` + name + `"`
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "public, max-age=31536000, immutable")
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		} else {
+			w.Header().Set("Cache-Control", "public, max-age=3600")
+		}
+
+		if signer, ok := store.(storage.URLSigner); ok && app.ImageURLExpiry > 0 {
+			link, err := signer.SignedURL(name, app.ImageURLExpiry)
+			if errors.Is(err, storage.ErrInvalidKey) {
+				http.NotFound(w, r)
+				return
+			}
+			if err != nil {
+				log.Println("imageHandler: Error signing URL:", err)
+				http.Error(w, "Image unavailable", http.StatusInternalServerError)
+				return
+			}
+			// Browsers may reuse the redirect for half the link's life, so it never points at an expired link
+			w.Header().Del("ETag")
+			w.Header().Set("Cache-Control", fmt.Sprintf("private, max-age=%d", int(app.ImageURLExpiry.Seconds())/2))
+			http.Redirect(w, r, link, http.StatusFound)
+			return
+		}
+
+		body, info, err := store.Open(r.Context(), name)
+		// A name the store can't hold, such as "..", names no image
+		if errors.Is(err, storage.ErrNotFound) || errors.Is(err, storage.ErrInvalidKey) {
+			http.NotFound(w, r)
+			return
+		}
+		if err != nil {
+			log.Println("imageHandler: Error opening image:", err)
+			http.Error(w, "Image unavailable", http.StatusInternalServerError)
+			return
+		}
+		defer body.Close()
+
+		if info.ContentType != "" {
+			w.Header().Set("Content-Type", info.ContentType)
+		}
+		// Files on disk can answer range and If-Modified-Since requests
+		if seeker, ok := body.(io.ReadSeeker); ok {
+			http.ServeContent(w, r, name, info.ModTime, seeker)
+			return
+		}
+		if info.Size > 0 {
+			w.Header().Set("Content-Length", strconv.FormatInt(info.Size, 10))
+		}
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(w, body); err != nil {
+			log.Println("imageHandler: Error sending image:", err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"ellas-corner/internal/storage"
+)
+
+// signingStore is a local store that also hands out links, like a bucket would
+type signingStore struct {
+	storage.LocalStore
+}
+
+func (s signingStore) SignedURL(key string, expiry time.Duration) (string, error) {
+	return "https://bucket.example/uploads/" + key + "?expires=" + expiry.String(), nil
+}
+
+func TestImageHandler(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	store := storage.LocalStore{Dir: t.TempDir()}
+	app.PostImages, app.ProfilePictures = store, storage.LocalStore{Dir: t.TempDir()}
+	const saved = "0123456789abcdef0123456789abcdef_small.jpg"
+	for _, name := range []string{saved, "placeholder.jpg"} {
+		if err := store.Put(context.Background(), name, []byte("jpeg bytes"), "image/jpeg"); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+	}
+	mux := app.Routes()
+	get := func(path string, header http.Header) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path, nil)
+		for name, values := range header {
+			req.Header[name] = values
+		}
+		rr := httptest.NewRecorder()
+		mux.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Saved images are cached for good and revalidate by name
+	rr := get("/static/uploads/"+saved, nil)
+	if rr.Code != http.StatusOK || rr.Body.String() != "jpeg bytes" || rr.Header().Get("Content-Type") != "image/jpeg" {
+		t.Fatalf("expected the image, got %d %q", rr.Code, rr.Body.String())
+	}
+	if rr.Header().Get("Cache-Control") != "public, max-age=31536000, immutable" {
+		t.Errorf("expected a long-lived cache header, got %q", rr.Header().Get("Cache-Control"))
+	}
+	if rr := get("/static/uploads/"+saved, http.Header{"If-None-Match": {rr.Header().Get("ETag")}}); rr.Code != http.StatusNotModified {
+		t.Errorf("expected 304 for a matching ETag, got %d", rr.Code)
+	}
+
+	// Older pictures can be replaced, so they are only cached briefly
+	if rr := get("/static/uploads/placeholder.jpg", nil); rr.Code != http.StatusOK || rr.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Errorf("expected the placeholder with a short cache, got %d %q", rr.Code, rr.Header().Get("Cache-Control"))
+	}
+
+	for _, path := range []string{"/static/uploads/missing.jpg", "/static/uploads/", "/static/uploads/.upload-123", "/static/uploads/a%2f..%2f..%2fsecret.jpg", "/static/profile_pictures/" + saved} {
+		if rr := get(path, nil); rr.Code != http.StatusNotFound {
+			t.Errorf("%s: expected 404, got %d", path, rr.Code)
+		}
+	}
+
+	// A store that signs links sends the browser there instead
+	app.PostImages, app.ImageURLExpiry = signingStore{store}, 10*time.Minute
+	mux = app.Routes()
+	rr = get("/static/uploads/"+saved, nil)
+	if rr.Code != http.StatusFound || rr.Header().Get("Location") != "https://bucket.example/uploads/"+saved+"?expires=10m0s" {
+		t.Errorf("expected a redirect to the signed link, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr.Header().Get("Cache-Control") != "private, max-age=300" {
+		t.Errorf("expected the redirect to be cached for half the link's life, got %q", rr.Header().Get("Cache-Control"))
+	}
+}
@@ -2,24 +2,22 @@ package handlers
 
 import (
 	"ellas-corner/internal/db"
-	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"html/template"
 	"log"
 	"net/http"
 )
 
 // LikedPostsHandler shows posts the user has liked, and curated baby box items
-func LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
-	sessionUser, err := utils.GetSessionUser(r)
+func (app *App) LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	if err != nil {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
 
 	// Fetch posts liked by the current user
-	likedPosts, err := repository.FetchLikedPostsByUser(sessionUser.ID)
+	likedPosts, err := app.Store.FetchLikedPostsByUser(sessionUser.ID)
 	if err != nil {
 		log.Println("LikedPostsHandler: Error fetching liked posts:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -37,7 +35,7 @@ func LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Parse the template
-	tmpl, err := template.ParseFiles(
+	tmpl, err := parseTemplates(r,
 		"web/templates/liked_posts.html",
 		"web/templates/partials/navbar.html",
 	)
@@ -49,11 +47,13 @@ func LikedPostsHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	data := viewmodels.LikedPostsPageData{
-		IsLoggedIn:     true,
-		ProfilePicture: sessionUser.ProfilePicture,
-		Username:       sessionUser.Username,
-		LikedPosts:     likedPosts,
-		CuratedItems:   curatedItems,
+		IsLoggedIn:          true,
+		ProfilePicture:      sessionUser.ProfilePicture,
+		UnreadMessages:      app.unreadMessages(sessionUser.ID),
+		UnreadNotifications: app.unreadNotifications(sessionUser.ID),
+		Username:            sessionUser.Username,
+		LikedPosts:          likedPosts,
+		CuratedItems:        curatedItems,
 	}
 
 	if err := tmpl.Execute(w, data); err != nil {
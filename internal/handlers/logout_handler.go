@@ -1,40 +1,82 @@
 package handlers
 
 import (
-	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"log"
 	"net/http"
-	"time"
+	"strconv"
 )
 
-// LogoutHandler logs the user out by clearing the session cookie and deleting the session from the database
-func LogoutHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("LogoutHandler: Request received")
-
-	// Only attempt session deletion if cookie is present
-	cookie, err := r.Cookie("session_token")
-	if err == nil {
-		// Try deleting session from DB
-		if err := repository.DeleteSession(cookie.Value); err != nil {
-			log.Println("LogoutHandler: Error deleting session from DB:", err)
-			w.WriteHeader(http.StatusInternalServerError)
-			utils.RenderServerErrorPage(w)
-			return
-		}
-		log.Println("LogoutHandler: Session deleted from DB")
-	} else {
-		log.Println("LogoutHandler: No session token found; user may already be logged out")
-	}
-
-	// Clear the cookie regardless
-	http.SetCookie(w, &http.Cookie{
-		Name:    "session_token",
-		Value:   "",
-		Path:    "/",             // Applies site-wide
-		Expires: time.Unix(0, 0), // Expire it immediately
-	})
-
-	log.Println("LogoutHandler: Session cookie cleared; redirecting to home")
+// LogoutHandler logs the user out by clearing the session cookie and deleting the session from the database.
+// It only accepts POST, so a link or image on another site can't log anyone out.
+func (app *App) LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	// Delete this device's session and clear the cookie; other devices stay signed in
+	if err := utils.EndSession(app.Store, w, r); err != nil {
+		log.Println("LogoutHandler: Error deleting session from DB:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
+
+// LogoutOtherDevicesHandler signs the user out of every session except the one making the request
+func (app *App) LogoutOtherDevicesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	removed, err := app.Store.DeleteOtherSessions(sessionUser.ID, utils.CurrentSessionHash(r))
+	if err != nil {
+		log.Println("LogoutOtherDevicesHandler: Error deleting sessions:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	log.Printf("LogoutOtherDevicesHandler: Signed user %d out of %d other sessions", sessionUser.ID, removed)
+	http.Redirect(w, r, "/profile#sessions", http.StatusSeeOther)
+}
+
+// RevokeSessionHandler signs out a single one of the user's sessions from the profile page
+func (app *App) RevokeSessionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Redirect(w, r, "/profile", http.StatusSeeOther)
+		return
+	}
+
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	sessionID, err := strconv.Atoi(r.FormValue("session_id"))
+	if err != nil {
+		log.Println("RevokeSessionHandler: Invalid session ID:", err)
+		http.Redirect(w, r, "/profile#sessions", http.StatusSeeOther)
+		return
+	}
+
+	if err := app.Store.DeleteSessionByID(sessionUser.ID, sessionID); err != nil {
+		log.Println("RevokeSessionHandler: Error revoking session:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	http.Redirect(w, r, "/profile#sessions", http.StatusSeeOther)
+}
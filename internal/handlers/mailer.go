@@ -0,0 +1,23 @@
+package handlers
+
+import (
+	"log"
+
+	"ellas-corner/internal/mail"
+)
+
+// sendMail renders one of the mail package's templates and sends it. Email is a side effect
+// of the request, so failures are logged rather than shown to the user.
+func (app *App) sendMail(to, name string, data interface{}) {
+	if app.Mailer == nil {
+		return
+	}
+	msg, err := mail.Render(to, name, data)
+	if err != nil {
+		log.Printf("sendMail: Error rendering %s email: %v", name, err)
+		return
+	}
+	if err := app.Mailer.Send(msg); err != nil {
+		log.Printf("sendMail: Error sending %s email: %v", name, err)
+	}
+}
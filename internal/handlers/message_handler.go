@@ -0,0 +1,307 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ellas-corner/internal/authz"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+// maxMessageLength caps a direct message, the same as a comment
+const maxMessageLength = 2000
+
+// unreadMessages returns the unread message count shown in the navbar, or 0 for a signed-out
+// visitor (userID 0)
+func (app *App) unreadMessages(userID int) int {
+	if userID == 0 {
+		return 0
+	}
+	unread, err := app.Store.CountUnreadMessages(userID)
+	if err != nil {
+		log.Println("unreadMessages: Error counting unread messages:", err)
+	}
+	return unread
+}
+
+// validMessage trims a message body and reports why it can't be sent, if it can't
+func validMessage(body string) (string, string) {
+	body = strings.TrimSpace(body)
+	if body == "" {
+		return "", "Message cannot be empty or only spaces"
+	}
+	if len(body) > maxMessageLength {
+		return "", "Message must be at most " + strconv.Itoa(maxMessageLength) + " characters"
+	}
+	return body, ""
+}
+
+// MessagesHandler renders the signed-in user's inbox and the members they have blocked
+func (app *App) MessagesHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+read+your+messages.", http.StatusSeeOther)
+		return
+	}
+
+	conversations, err := app.Store.FetchConversations(sessionUser.ID)
+	if err != nil {
+		log.Println("MessagesHandler: Error fetching conversations:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	blocked, err := app.Store.FetchBlockedUsers(sessionUser.ID)
+	if err != nil {
+		log.Println("MessagesHandler: Error fetching blocked users:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "web/templates/messages.html", "web/templates/partials/navbar.html")
+	if err != nil {
+		log.Println("MessagesHandler: Error parsing template:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	data := viewmodels.MessagesPageData{
+		IsLoggedIn:          true,
+		ProfilePicture:      sessionUser.ProfilePicture,
+		UnreadMessages:      app.unreadMessages(sessionUser.ID),
+		UnreadNotifications: app.unreadNotifications(sessionUser.ID),
+		Conversations:       conversations,
+		BlockedUsers:        blocked,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("MessagesHandler: Error executing template:", err)
+	}
+}
+
+// ConversationHandler renders a conversation and marks it read: GET /messages/{id}
+func (app *App) ConversationHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+read+your+messages.", http.StatusSeeOther)
+		return
+	}
+	conversationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	// Other people's conversations are reported as missing rather than forbidden
+	conversation, err := app.Store.GetConversation(conversationID, sessionUser.ID)
+	if errors.Is(err, repository.ErrNotConversationMember) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("ConversationHandler: Error fetching conversation:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	if err := app.Store.MarkConversationRead(conversationID, sessionUser.ID); err != nil {
+		log.Println("ConversationHandler: Error marking conversation read:", err)
+	}
+
+	tmpl, err := parseTemplates(r, "web/templates/conversation.html", "web/templates/partials/navbar.html")
+	if err != nil {
+		log.Println("ConversationHandler: Error parsing template:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	data := viewmodels.ConversationPageData{
+		IsLoggedIn:          true,
+		ProfilePicture:      sessionUser.ProfilePicture,
+		UnreadMessages:      app.unreadMessages(sessionUser.ID),
+		UnreadNotifications: app.unreadNotifications(sessionUser.ID),
+		ViewerID:            sessionUser.ID,
+		Conversation:        *conversation,
+		Error:               r.URL.Query().Get("error"),
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("ConversationHandler: Error executing template:", err)
+	}
+}
+
+// SendMessageHandler replies in a conversation: POST /messages/{id}
+func (app *App) SendMessageHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+send+messages.", http.StatusSeeOther)
+		return
+	}
+	if !authz.Can(sessionUser, authz.CreateContent, 0) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+	conversationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	page := "/messages/" + strconv.Itoa(conversationID)
+
+	body, problem := validMessage(r.FormValue("body"))
+	if problem != "" {
+		http.Redirect(w, r, page+"?error="+url.QueryEscape(problem), http.StatusSeeOther)
+		return
+	}
+
+	err = app.Store.SendMessage(conversationID, sessionUser.ID, body)
+	switch {
+	case err == nil:
+		http.Redirect(w, r, page, http.StatusSeeOther)
+	case errors.Is(err, repository.ErrNotConversationMember):
+		http.NotFound(w, r)
+	case errors.Is(err, repository.ErrBlocked):
+		http.Redirect(w, r, page+"?error="+url.QueryEscape("You can't message this member."), http.StatusSeeOther)
+	default:
+		log.Println("SendMessageHandler: Error sending message:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+	}
+}
+
+// StartConversationHandler sends a first message about a post and opens the conversation:
+// POST /messages/start with post_id, body and optionally user_id. Without user_id the message
+// goes to the post's author; the author can message anyone, such as someone asking for
+// their donation.
+func (app *App) StartConversationHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+send+messages.", http.StatusSeeOther)
+		return
+	}
+	if !authz.Can(sessionUser, authz.CreateContent, 0) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return
+	}
+
+	postIDStr := r.FormValue("post_id")
+	post, err := app.Store.GetPostByID(postIDStr, sessionUser.ID)
+	if err != nil {
+		log.Println("StartConversationHandler: Error fetching post:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	if post == nil || (post.Hidden && !authz.Can(sessionUser, authz.ViewHidden, 0)) {
+		http.Error(w, "Post not found", http.StatusNotFound)
+		return
+	}
+
+	recipientID := post.UserID
+	if userID := r.FormValue("user_id"); userID != "" {
+		recipientID, err = strconv.Atoi(userID)
+		if err != nil {
+			http.Error(w, "Invalid user ID", http.StatusBadRequest)
+			return
+		}
+	}
+	// Conversations are between the post's author and one other member
+	if recipientID == sessionUser.ID || (sessionUser.ID != post.UserID && recipientID != post.UserID) {
+		http.Error(w, "You can only message the author of this post", http.StatusBadRequest)
+		return
+	}
+	if _, err := app.Store.GetUserByID(recipientID); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("StartConversationHandler: Error fetching recipient:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	body, problem := validMessage(r.FormValue("body"))
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	conversationID, err := app.Store.StartConversation(post.ID, sessionUser.ID, recipientID, body)
+	if errors.Is(err, repository.ErrBlocked) {
+		http.Error(w, "You can't message this member", http.StatusForbidden)
+		return
+	} else if err != nil {
+		log.Println("StartConversationHandler: Error starting conversation:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	http.Redirect(w, r, "/messages/"+strconv.Itoa(conversationID), http.StatusSeeOther)
+}
+
+// blockedUserID reads the {id} of the member being blocked or unblocked
+func (app *App) blockedUserID(w http.ResponseWriter, r *http.Request) (*utils.SessionUser, int, bool) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+manage+blocked+members.", http.StatusSeeOther)
+		return nil, 0, false
+	}
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, 0, false
+	}
+	if userID == sessionUser.ID {
+		http.Error(w, "You can't block yourself", http.StatusBadRequest)
+		return nil, 0, false
+	}
+	return sessionUser, userID, true
+}
+
+// BlockUserHandler stops a member messaging the signed-in user, and the other way round:
+// POST /users/{id}/block
+func (app *App) BlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, userID, ok := app.blockedUserID(w, r)
+	if !ok {
+		return
+	}
+	if _, err := app.Store.GetUserByID(userID); errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("BlockUserHandler: Error fetching user:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	if err := app.Store.BlockUser(sessionUser.ID, userID); err != nil {
+		log.Println("BlockUserHandler: Error blocking user:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	log.Printf("BlockUserHandler: User %d blocked user %d\n", sessionUser.ID, userID)
+	http.Redirect(w, r, sameSiteReferer(r, "/messages"), http.StatusSeeOther)
+}
+
+// UnblockUserHandler lifts a block: POST /users/{id}/unblock
+func (app *App) UnblockUserHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, userID, ok := app.blockedUserID(w, r)
+	if !ok {
+		return
+	}
+	if err := app.Store.UnblockUser(sessionUser.ID, userID); err != nil {
+		log.Println("UnblockUserHandler: Error unblocking user:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	http.Redirect(w, r, sameSiteReferer(r, "/messages"), http.StatusSeeOther)
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"ellas-corner/internal/utils"
+)
+
+func TestMessages(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+
+	donorToken := createAPIUser(t, app, mux, "donor", "donor@example.com")
+	createAPIUser(t, app, mux, "asker", "asker@example.com")
+	createAPIUser(t, app, mux, "other", "other@example.com")
+	donor := loginAndGetCookie(t, app, "donor@example.com", "secret123", "test")
+	asker := loginAndGetCookie(t, app, "asker@example.com", "secret123", "test")
+	other := loginAndGetCookie(t, app, "other@example.com", "secret123", "test")
+
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts", donorToken, `{"title":"Pram","content":"Folds flat","is_donation":true}`); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 creating the post, got %d: %s", rr.Code, rr.Body.String())
+	}
+
+	rr := moderationRequest(mux, "/messages/start", asker, url.Values{"post_id": {"1"}, "body": {"Is it still free?"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/messages/1" {
+		t.Fatalf("expected a redirect to the new conversation, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if got := app.unreadMessages(1); got != 1 {
+		t.Errorf("expected the donor to have 1 unread message, got %d", got)
+	}
+
+	// Members who aren't the author can only message the author
+	rr = moderationRequest(mux, "/messages/start", asker, url.Values{"post_id": {"1"}, "user_id": {"3"}, "body": {"Hi"}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 messaging a third member about the post, got %d", rr.Code)
+	}
+	rr = moderationRequest(mux, "/messages/start", asker, url.Values{"post_id": {"1"}, "body": {"   "}})
+	if rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an empty message, got %d", rr.Code)
+	}
+	if rr := moderationRequest(mux, "/messages/1", other, url.Values{"body": {"Hi"}}); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 writing to someone else's conversation, got %d", rr.Code)
+	}
+
+	// Members who haven't confirmed their email can't write messages, replies included
+	hashed, _ := utils.HashPassword("secret123")
+	if err := app.Store.CreateUser("newcomer", "newcomer@example.com", hashed, "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	newcomer := loginAndGetCookie(t, app, "newcomer@example.com", "secret123", "test")
+	rr = moderationRequest(mux, "/messages/start", donor, url.Values{"post_id": {"1"}, "user_id": {"4"}, "body": {"Still interested?"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/messages/2" {
+		t.Fatalf("expected the author to message the newcomer, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if rr := moderationRequest(mux, "/messages/2", newcomer, url.Values{"body": {"Yes please"}}); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 replying without a verified email, got %d", rr.Code)
+	}
+
+	rr = moderationRequest(mux, "/messages/1", donor, url.Values{"body": {"Yes, come by Saturday"}})
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/messages/1" {
+		t.Fatalf("expected the reply to redirect back, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+
+	if rr := moderationRequest(mux, "/users/2/block", donor, nil); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected blocking to redirect, got %d: %s", rr.Code, rr.Body.String())
+	}
+	rr = moderationRequest(mux, "/messages/start", asker, url.Values{"post_id": {"1"}, "body": {"Hello?"}})
+	if rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 messaging a member who blocked you, got %d", rr.Code)
+	}
+	rr = moderationRequest(mux, "/messages/1", asker, url.Values{"body": {"Hello?"}})
+	if location := rr.Header().Get("Location"); !strings.HasPrefix(location, "/messages/1?error=") {
+		t.Errorf("expected an error redirect replying to a blocked conversation, got %q", location)
+	}
+}
@@ -0,0 +1,140 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+// notificationPageSize is how many notifications the notifications page shows
+const notificationPageSize = 50
+
+// unreadNotifications returns the unread notification count shown in the navbar, or 0 for a
+// signed-out visitor
+func (app *App) unreadNotifications(userID int) int {
+	if userID == 0 {
+		return 0
+	}
+	unread, err := app.Store.CountUnreadNotifications(userID)
+	if err != nil {
+		log.Println("unreadNotifications: Error counting unread notifications:", err)
+	}
+	return unread
+}
+
+// NotificationsHandler lists the signed-in user's latest notifications: GET /notifications
+func (app *App) NotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+see+your+notifications.", http.StatusSeeOther)
+		return
+	}
+
+	notifications, err := app.Store.FetchNotifications(sessionUser.ID, notificationPageSize)
+	if err != nil {
+		log.Println("NotificationsHandler: Error fetching notifications:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "web/templates/notifications.html", "web/templates/partials/navbar.html")
+	if err != nil {
+		log.Println("NotificationsHandler: Error parsing template:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	data := viewmodels.NotificationsPageData{
+		IsLoggedIn:          true,
+		ProfilePicture:      sessionUser.ProfilePicture,
+		UnreadMessages:      app.unreadMessages(sessionUser.ID),
+		UnreadNotifications: app.unreadNotifications(sessionUser.ID),
+		Notifications:       notifications,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("NotificationsHandler: Error executing template:", err)
+	}
+}
+
+// OpenNotificationHandler marks a notification read and follows it to the post, comment or
+// donation it is about: POST /notifications/{id}/read. It is a POST so that link prefetching
+// can't mark notifications read, and so it is covered by the CSRF check.
+func (app *App) OpenNotificationHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+see+your+notifications.", http.StatusSeeOther)
+		return
+	}
+	notificationID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	notification, err := app.Store.ReadNotification(notificationID, sessionUser.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.NotFound(w, r)
+		return
+	} else if err != nil {
+		log.Println("OpenNotificationHandler: Error reading notification:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	http.Redirect(w, r, notification.Link(), http.StatusSeeOther)
+}
+
+// ReadAllNotificationsHandler marks every notification read: POST /notifications/read-all
+func (app *App) ReadAllNotificationsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := app.Store.MarkAllNotificationsRead(sessionUser.ID); err != nil {
+		log.Println("ReadAllNotificationsHandler: Error marking notifications read:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	http.Redirect(w, r, "/notifications", http.StatusSeeOther)
+}
+
+// UpdateNotificationSettingsHandler saves which notification types the user wants and whether
+// they get email digests, from the checkboxes on their profile: POST /notifications/settings
+func (app *App) UpdateNotificationSettingsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Invalid form", http.StatusBadRequest)
+		return
+	}
+
+	var enabled []repository.NotificationType
+	for _, value := range r.Form["notify"] {
+		t := repository.NotificationType(value)
+		if !repository.ValidNotificationType(t) {
+			http.Error(w, "Unknown notification type", http.StatusBadRequest)
+			return
+		}
+		enabled = append(enabled, t)
+	}
+
+	if err := app.Store.UpdateNotificationSettings(sessionUser.ID, enabled, r.FormValue("email_digest") == "on"); err != nil {
+		log.Println("UpdateNotificationSettingsHandler: Error saving settings:", err)
+		http.Error(w, "Could not save notification settings", http.StatusInternalServerError)
+		return
+	}
+	http.Redirect(w, r, "/profile", http.StatusSeeOther)
+}
@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+func TestNotifications(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+
+	authorToken := createAPIUser(t, app, mux, "author", "author@example.com")
+	readerToken := createAPIUser(t, app, mux, "reader", "reader@example.com")
+	author := loginAndGetCookie(t, app, "author@example.com", "secret123", "test")
+	reader := loginAndGetCookie(t, app, "reader@example.com", "secret123", "test")
+
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts", authorToken, `{"title":"Sling","content":"Very comfy"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 creating the post, got %d: %s", rr.Code, rr.Body.String())
+	}
+	for _, content := range []string{"Which brand?", "Thanks!"} {
+		if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/comments", readerToken, `{"content":"`+content+`"}`); rr.Code != http.StatusCreated {
+			t.Fatalf("expected 201 commenting, got %d: %s", rr.Code, rr.Body.String())
+		}
+	}
+	if got := app.unreadNotifications(1); got != 2 {
+		t.Fatalf("expected 2 unread notifications for the author, got %d", got)
+	}
+
+	// Following a link, or a browser prefetching it, doesn't mark a notification read
+	rr := httptest.NewRecorder()
+	mux.ServeHTTP(rr, requestWithCookie(http.MethodGet, "/notifications/1/read", author))
+	if rr.Code == http.StatusSeeOther || app.unreadNotifications(1) != 2 {
+		t.Errorf("expected a GET to read nothing, got %d with %d unread", rr.Code, app.unreadNotifications(1))
+	}
+
+	// Notifications can only be opened by the member they were sent to
+	if rr := moderationRequest(mux, "/notifications/1/read", reader, nil); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 opening someone else's notification, got %d", rr.Code)
+	}
+	rr = moderationRequest(mux, "/notifications/1/read", author, nil)
+	if rr.Code != http.StatusSeeOther || rr.Header().Get("Location") != "/profile#post-1" {
+		t.Fatalf("expected a redirect to the post, got %d %q", rr.Code, rr.Header().Get("Location"))
+	}
+	if got := app.unreadNotifications(1); got != 1 {
+		t.Errorf("expected 1 unread notification after opening one, got %d", got)
+	}
+	if rr := moderationRequest(mux, "/notifications/read-all", author, nil); rr.Code != http.StatusSeeOther || app.unreadNotifications(1) != 0 {
+		t.Errorf("expected every notification read, got %d with %d unread", rr.Code, app.unreadNotifications(1))
+	}
+
+	if rr := moderationRequest(mux, "/notifications/settings", author, url.Values{"notify": {"nonsense"}}); rr.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for an unknown type, got %d", rr.Code)
+	}
+	if rr := moderationRequest(mux, "/notifications/settings", author, url.Values{"notify": {"reply", "donation"}}); rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected saving settings to redirect, got %d: %s", rr.Code, rr.Body.String())
+	}
+	settings, err := app.Store.FetchNotificationSettings(1)
+	if err != nil {
+		t.Fatalf("FetchNotificationSettings failed: %v", err)
+	}
+	for _, setting := range settings {
+		want := setting.Type == repository.NotificationReply || setting.Type == repository.NotificationDonation
+		if setting.Enabled != want {
+			t.Errorf("expected %s enabled=%v, got %v", setting.Type, want, setting.Enabled)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/viewmodels"
+	"net/http"
+	"net/url"
+	"strconv"
+)
+
+// postsPerPage is the page size for the home, filter and search pages
+const postsPerPage = 20
+
+// maxAPIPageSize caps the ?limit= accepted by the JSON API
+const maxAPIPageSize = 100
+
+// applyPagination reads ?cursor= or ?page= into q and returns the page number, which is
+// 0 when the listing continues from a cursor. A cursor takes precedence over a page and
+// is only accepted for sorts that support one.
+func applyPagination(r *http.Request, q *repository.PostQuery, limit int) (int, error) {
+	q.Limit = limit
+
+	if token := r.URL.Query().Get("cursor"); token != "" {
+		cursor, err := repository.ParsePostCursor(token)
+		if err != nil || !q.SupportsCursor() {
+			return 1, repository.ErrInvalidCursor
+		}
+		q.After = &cursor
+		return 0, nil
+	}
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+	q.Offset = (page - 1) * limit
+	return page, nil
+}
+
+// paginationLinks builds the previous/next links for a page of posts, keeping the
+// request's other query parameters so filters carry over between pages
+func paginationLinks(r *http.Request, page int, result repository.PostPage) viewmodels.Pagination {
+	links := viewmodels.Pagination{Page: page}
+
+	if page == 0 {
+		// Continuing from a cursor: older pages are reached by following cursors, so
+		// offer a way back to the start instead of a previous page
+		links.FirstURL = pageURL(r, "page", "1")
+	} else if page > 1 {
+		links.PrevURL = pageURL(r, "page", strconv.Itoa(page-1))
+	}
+
+	if result.HasMore {
+		if page == 0 && result.NextCursor != "" {
+			links.NextURL = pageURL(r, "cursor", result.NextCursor)
+		} else if page > 0 {
+			links.NextURL = pageURL(r, "page", strconv.Itoa(page+1))
+		}
+	}
+	return links
+}
+
+// pageURL returns the request URL with the paging parameters replaced by key=value
+func pageURL(r *http.Request, key, value string) string {
+	values := url.Values{}
+	for k, v := range r.URL.Query() {
+		if k != "page" && k != "cursor" {
+			values[k] = v
+		}
+	}
+	values.Set(key, value)
+	return r.URL.Path + "?" + values.Encode()
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"ellas-corner/internal/images"
+	"ellas-corner/internal/repository"
+)
+
+// maxAltText is the longest description kept for a photo, in characters
+const maxAltText = 200
+
+// errTooManyImages is returned when a post would end up with more than MaxPostImages photos
+var errTooManyImages = fmt.Errorf("a post can have up to %d photos", repository.MaxPostImages)
+
+// maxFormMemory is how much of a multipart form is held in memory while it is parsed. Files
+// beyond it are spooled to disk; the size of the whole request is capped separately.
+const maxFormMemory = 32 << 20
+
+// Uploads.MaxBytes limits each photo on its own, which uploadedPostImages checks.
+// postUploadLimit limits the whole create or edit request: a full set of photos plus a
+// little room for the text fields.
+func (app *App) postUploadLimit() int64 {
+	return app.Uploads.MaxBytes()*repository.MaxPostImages + 1<<20
+}
+
+// formUploadLimit is the largest multipart request accepted at path. Only the post forms
+// take several photos; every other form takes one file at most.
+func (app *App) formUploadLimit(path string) int64 {
+	switch path {
+	case "/create-post", "/edit-post":
+		return app.postUploadLimit()
+	}
+	return app.Uploads.MaxBytes()
+}
+
+// altText trims a photo description to maxAltText characters, using fallback when it's empty
+func altText(text, fallback string) string {
+	text = strings.TrimSpace(text)
+	if text == "" {
+		text = fallback
+	}
+	if runes := []rune(text); len(runes) > maxAltText {
+		text = string(runes[:maxAltText])
+	}
+	return text
+}
+
+// uploadedPostImages saves the photos chosen in the "images" field, in the order they were
+// sent, with the description typed for each in the matching "image_alt" field. Photos without
+// a description are described by fallbackAlt. room is how many more photos the post can take.
+func (app *App) uploadedPostImages(r *http.Request, fallbackAlt string, room int) ([]repository.PostImage, error) {
+	if r.MultipartForm == nil {
+		return nil, nil
+	}
+	alts := r.MultipartForm.Value["image_alt"]
+
+	// Browsers send an empty part when no file was chosen. The whole set is checked before
+	// any of it is saved.
+	var files []*multipart.FileHeader
+	for _, header := range r.MultipartForm.File["images"] {
+		if header.Size == 0 && header.Filename == "" {
+			continue
+		}
+		if header.Size > app.Uploads.MaxBytes() {
+			return nil, fmt.Errorf("%w: each photo can be up to %d MB", images.ErrTooLarge, app.Uploads.MaxSizeMB)
+		}
+		files = append(files, header)
+	}
+	if len(files) > room {
+		return nil, errTooManyImages
+	}
+
+	var gallery []repository.PostImage
+	for i, header := range files {
+		file, err := header.Open()
+		if err != nil {
+			return nil, err
+		}
+		name, err := app.saveImage(r.Context(), file, app.PostImages, repository.PostImageUploads)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		alt := ""
+		if i < len(alts) {
+			alt = alts[i]
+		}
+		gallery = append(gallery, repository.PostImage{Image: name, AltText: altText(alt, fallbackAlt)})
+	}
+	return gallery, nil
+}
+
+// editedGallery applies the edit form to a post's photos: each can be removed, moved with its
+// "position_<id>" field or described with its "alt_<id>" field. Photos given the same
+// position keep their old order.
+func editedGallery(r *http.Request, current []repository.PostImage, fallbackAlt string) []repository.PostImage {
+	type placed struct {
+		image    repository.PostImage
+		position int
+	}
+	var kept []placed
+	for i, image := range current {
+		id := strconv.Itoa(image.ID)
+		if r.FormValue("remove_image_"+id) == "on" {
+			continue
+		}
+		position, err := strconv.Atoi(r.FormValue("position_" + id))
+		if err != nil {
+			position = i + 1
+		}
+		if alt, ok := r.Form["alt_"+id]; ok && len(alt) > 0 {
+			image.AltText = altText(alt[0], fallbackAlt)
+		}
+		kept = append(kept, placed{image, position})
+	}
+	sort.SliceStable(kept, func(i, j int) bool { return kept[i].position < kept[j].position })
+
+	gallery := make([]repository.PostImage, len(kept))
+	for i, p := range kept {
+		gallery[i] = p.image
+	}
+	return gallery
+}
+
+// imageRefused reports whether err is the member's upload being refused rather than the
+// server failing, and the message to show them
+func imageRefused(err error) (string, bool) {
+	if errors.Is(err, errTooManyImages) {
+		return "You can add up to " + strconv.Itoa(repository.MaxPostImages) + " photos to a post.", true
+	}
+	if images.Rejected(err) {
+		return "Image not accepted: " + err.Error() + ".", true
+	}
+	return "", false
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"math/rand"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"ellas-corner/internal/config"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/storage"
+	"ellas-corner/internal/utils"
+)
+
+// multipartWithImages builds a form with the given fields and one "images" part per picture
+func multipartWithImages(t *testing.T, fields url.Values, pictures ...[]byte) (*bytes.Buffer, string) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for key, values := range fields {
+		for _, val := range values {
+			if err := w.WriteField(key, val); err != nil {
+				t.Fatalf("Error writing field %s: %v", key, err)
+			}
+		}
+	}
+	for i, picture := range pictures {
+		part, err := w.CreateFormFile("images", "photo"+strconv.Itoa(i)+".png")
+		if err != nil {
+			t.Fatalf("Error creating file field: %v", err)
+		}
+		part.Write(picture)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("Error closing multipart writer: %v", err)
+	}
+	return &body, w.FormDataContentType()
+}
+
+// testPNG is a blank picture; different widths give different content hashes
+func testPNG(t *testing.T, width int) []byte {
+	t.Helper()
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, width, 20))); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	return picture.Bytes()
+}
+
+func TestPostGalleryForms(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	app.Uploads = config.Uploads{MaxSizeMB: 1, MaxImageDimension: 500}
+	postImages := storage.LocalStore{Dir: t.TempDir()}
+	app.PostImages, app.ProfilePictures = postImages, storage.LocalStore{Dir: t.TempDir()}
+
+	hashed, _ := utils.HashPassword("secret123")
+	if err := app.Store.CreateUser("ella", "ella@example.com", hashed, "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := app.Store.MarkEmailVerified(1); err != nil {
+		t.Fatalf("Failed to verify user: %v", err)
+	}
+	cookie := loginAndGetCookie(t, app, "ella@example.com", "secret123", "Laptop")
+
+	send := func(handler http.HandlerFunc, path string, fields url.Values, pictures ...[]byte) *httptest.ResponseRecorder {
+		body, contentType := multipartWithImages(t, fields, pictures...)
+		req := httptest.NewRequest(http.MethodPost, path, body)
+		req.Header.Set("Content-Type", contentType)
+		req.AddCookie(cookie)
+		rr := httptest.NewRecorder()
+		handler(rr, req)
+		return rr
+	}
+	gallery := func() *repository.Post {
+		t.Helper()
+		posts, err := app.Store.FetchPostsByQuery(repository.PostQuery{})
+		if err != nil || len(posts) != 1 {
+			t.Fatalf("expected one post, got %d (err %v)", len(posts), err)
+		}
+		return &posts[0]
+	}
+
+	// Three photos in one go, the last without a description
+	fields := url.Values{"title": {"Pram"}, "content": {"Folds flat"}, "category": {"General"},
+		"image_alt": {"Folded", "Unfolded"}}
+	rr := send(app.CreatePostHandler, "/create-post", fields, testPNG(t, 10), testPNG(t, 11), testPNG(t, 12))
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after posting, got %d: %s", rr.Code, rr.Body.String())
+	}
+	post := gallery()
+	if len(post.Images) != 3 || post.Image != post.Images[0].Image {
+		t.Fatalf("expected three photos with the first as the cover, got %+v (cover %q)", post.Images, post.Image)
+	}
+	for i, want := range []string{"Folded", "Unfolded", "Pram"} {
+		if post.Images[i].AltText != want {
+			t.Errorf("photo %d: expected the description %q, got %q", i, want, post.Images[i].AltText)
+		}
+	}
+	// The uploads are recorded for the sweeper, which may find them stored already
+	uploaded, err := app.Store.RecentUploads(repository.PostImageUploads, time.Now().Add(-time.Minute))
+	if err != nil || len(uploaded) != 3 {
+		t.Errorf("expected the three uploads to be recorded, got %v (err %v)", uploaded, err)
+	}
+	first, second, third := post.Images[0], post.Images[1], post.Images[2]
+
+	// Moving the last photo to the front, removing the middle one and adding one more
+	id := func(image repository.PostImage) string { return strconv.Itoa(image.ID) }
+	fields = url.Values{"id": {strconv.Itoa(post.ID)}, "title": {"Pram"}, "content": {"Folds flat"}, "category": {"General"},
+		"position_" + id(first): {"2"}, "position_" + id(second): {"3"}, "position_" + id(third): {"1"},
+		"remove_image_" + id(second): {"on"}, "alt_" + id(third): {"The care label"}, "image_alt": {"In the car"}}
+	rr = send(app.EditPostHandler, "/edit-post", fields, testPNG(t, 13))
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after editing, got %d: %s", rr.Code, rr.Body.String())
+	}
+	post = gallery()
+	if len(post.Images) != 3 || post.Images[0].Image != third.Image || post.Images[1].Image != first.Image || post.Images[2].AltText != "In the car" {
+		t.Fatalf("unexpected gallery after editing %+v", post.Images)
+	}
+	if post.Image != third.Image || post.Images[0].AltText != "The care label" {
+		t.Errorf("expected the moved photo to be the cover with its new description, got %q %q", post.Image, post.Images[0].AltText)
+	}
+
+	// A post can't go over the limit, and nothing changes or is saved when it would
+	saved, _ := postImages.List(context.Background())
+	var tooMany [][]byte
+	for i := 0; i < repository.MaxPostImages; i++ {
+		tooMany = append(tooMany, testPNG(t, 20+i))
+	}
+	fields = url.Values{"id": {strconv.Itoa(post.ID)}, "title": {"Pram"}, "content": {"Folds flat"}, "category": {"General"}}
+	if rr := send(app.EditPostHandler, "/edit-post", fields, tooMany...); rr.Code == http.StatusSeeOther {
+		t.Error("expected too many photos to be refused")
+	}
+	if after := gallery(); len(after.Images) != 3 {
+		t.Errorf("expected the gallery to be unchanged, got %d photos", len(after.Images))
+	}
+	if after, _ := postImages.List(context.Background()); len(after) != len(saved) {
+		t.Errorf("expected no photos to be saved, got %d new files", len(after)-len(saved))
+	}
+}
+
+// noisyPNG is a picture of random pixels, which PNG can't compress, so it is about
+// 4*side*side bytes
+func noisyPNG(t *testing.T, side int, seed int64) []byte {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, side, side))
+	rand.New(rand.NewSource(seed)).Read(img.Pix)
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, img); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	return picture.Bytes()
+}
+
+func TestPostFormPhotosPassCSRFCheck(t *testing.T) {
+	t.Parallel()
+	app := setupTestAuthDB(t)
+	app.Uploads = config.Uploads{MaxSizeMB: 1, MaxImageDimension: 500}
+	app.PostImages, app.ProfilePictures = storage.LocalStore{Dir: t.TempDir()}, storage.LocalStore{Dir: t.TempDir()}
+	handler := app.CSRFMiddleware(app.Routes())
+
+	hashed, _ := utils.HashPassword("secret123")
+	if err := app.Store.CreateUser("ella", "ella@example.com", hashed, "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := app.Store.MarkEmailVerified(1); err != nil {
+		t.Fatalf("Failed to verify user: %v", err)
+	}
+	cookie := loginAndGetCookie(t, app, "ella@example.com", "secret123", "Laptop")
+	token := utils.CSRFToken(requestWithCookie(http.MethodGet, "/", cookie))
+
+	// Each photo is within the limit, but together they are well over it
+	photos := [][]byte{noisyPNG(t, 400, 1), noisyPNG(t, 400, 2), noisyPNG(t, 400, 3)}
+	var total int
+	for _, photo := range photos {
+		if int64(len(photo)) > app.Uploads.MaxBytes() {
+			t.Fatalf("expected each photo to be within the limit, got %d bytes", len(photo))
+		}
+		total += len(photo)
+	}
+	if int64(total) <= app.Uploads.MaxBytes() {
+		t.Fatalf("expected the photos to add up to more than the limit, got %d bytes", total)
+	}
+
+	fields := url.Values{"csrf_token": {token}, "title": {"Pram"}, "content": {"Folds flat"}, "category": {"General"}}
+	body, contentType := multipartWithImages(t, fields, photos...)
+	req := httptest.NewRequest(http.MethodPost, "/create-post", body)
+	req.Header.Set("Content-Type", contentType)
+	req.AddCookie(cookie)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusSeeOther {
+		t.Fatalf("expected a redirect after posting, got %d: %s", rr.Code, rr.Body.String())
+	}
+	posts, err := app.Store.FetchPostsByQuery(repository.PostQuery{})
+	if err != nil || len(posts) != 1 || len(posts[0].Images) != 3 {
+		t.Fatalf("expected one post with three photos, got %+v (err %v)", posts, err)
+	}
+
+	// Other forms still take one photo's worth
+	body, contentType = multipartWithImages(t, url.Values{"csrf_token": {token}}, photos...)
+	req = httptest.NewRequest(http.MethodPost, "/upload-profile-picture", body)
+	req.Header.Set("Content-Type", contentType)
+	req.AddCookie(cookie)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	if rr.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("expected 413 for a profile picture form over the limit, got %d", rr.Code)
+	}
+}
@@ -1,40 +1,26 @@
 package handlers
 
 import (
+	"ellas-corner/internal/authz"
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"fmt"
-	"html/template"
 	"log"
 	"net/http"
 )
 
-func ProfileHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("ProfileHandler: Request received")
-
+func (app *App) ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	// Check if the user is logged in by checking the session
-	sessionCookie, err := r.Cookie("session_token")
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	if err != nil {
-		log.Println("ProfileHandler: No session token found, redirecting to login")
-		// Redirect to the login page with a custom message
-		http.Redirect(w, r, "/login?message=Please+log+in+to+view+your+profile.", http.StatusSeeOther)
-		return
-	}
-
-	// Fetch user ID from session
-	userID, err := repository.GetUserIDBySession(sessionCookie.Value)
-	if err != nil || userID == 0 {
-		log.Println("ProfileHandler: Invalid session or user ID not found, redirecting to login")
 		// Redirect to the login page with a custom message
 		http.Redirect(w, r, "/login?message=Please+log+in+to+view+your+profile.", http.StatusSeeOther)
 		return
 	}
-
-	log.Printf("ProfileHandler: Logged in user ID: %d\n", userID)
+	userID := sessionUser.ID
 
 	// Fetch user details (username, email, profile picture)
-	user, err := repository.GetUserByID(userID)
+	user, err := app.Store.GetUserByID(userID)
 	if err != nil {
 		log.Println("ProfileHandler: Error fetching user data:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -43,7 +29,7 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Fetch the user's posts, comments, liked posts, and disliked posts
-	posts, err := repository.FetchPostsByUser(userID)
+	posts, err := app.Store.FetchPostsByUser(userID)
 	if err != nil {
 		log.Println("ProfileHandler: Error fetching user's posts:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -51,7 +37,7 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	comments, err := repository.FetchCommentsByUser(userID)
+	comments, err := app.Store.FetchCommentsByUser(userID)
 	if err != nil {
 		log.Println("ProfileHandler: Error fetching user's comments:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -59,7 +45,7 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	likedPosts, err := repository.FetchLikedPostsByUser(userID)
+	likedPosts, err := app.Store.FetchLikedPostsByUser(userID)
 	if err != nil {
 		log.Println("ProfileHandler: Error fetching liked posts:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -67,7 +53,7 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	dislikedPosts, err := repository.FetchDislikedPostsByUser(userID)
+	dislikedPosts, err := app.Store.FetchDislikedPostsByUser(userID)
 	if err != nil {
 		log.Println("ProfileHandler: Error fetching disliked posts:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -75,11 +61,41 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	// Signed-in devices, with the one making this request marked as current
+	sessions, err := app.Store.FetchSessionsForUser(userID)
+	if err != nil {
+		log.Println("ProfileHandler: Error fetching sessions:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	currentSessionHash := utils.CurrentSessionHash(r)
+	for i := range sessions {
+		sessions[i].IsCurrent = sessions[i].TokenHash == currentSessionHash
+	}
+
+	// Warnings from moderators about reported posts and comments
+	warnings, err := app.Store.FetchWarningsForUser(userID)
+	if err != nil {
+		log.Println("ProfileHandler: Error fetching warnings:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	notificationSettings, err := app.Store.FetchNotificationSettings(userID)
+	if err != nil {
+		log.Println("ProfileHandler: Error fetching notification settings:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
 	// Apply donation visibility logic
 	allPostGroups := [][]repository.Post{posts, likedPosts, dislikedPosts}
 	for _, postGroup := range allPostGroups {
 		for i := range postGroup {
-			if postGroup[i].IsDonation {
+			if postGroup[i].DonationStatus.Open() {
 				if user.ShowDonationsInCountryOnly {
 					postGroup[i].ShowDonatedLabel = postGroup[i].DonationCountry == user.Country
 				} else {
@@ -89,25 +105,7 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	log.Println("ProfileHandler: Successfully fetched all data")
-	funcMap := template.FuncMap{
-		"dict": func(values ...interface{}) (map[string]interface{}, error) {
-			if len(values)%2 != 0 {
-				return nil, fmt.Errorf("dict expects even number of arguments")
-			}
-			dict := make(map[string]interface{}, len(values)/2)
-			for i := 0; i < len(values); i += 2 {
-				key, ok := values[i].(string)
-				if !ok {
-					return nil, fmt.Errorf("dict keys must be strings")
-				}
-				dict[key] = values[i+1]
-			}
-			return dict, nil
-		},
-	}
-
-	tmpl, err := template.New("profile.html").Funcs(funcMap).ParseFiles(
+	tmpl, err := parseTemplates(r,
 		"web/templates/profile.html",
 		"web/templates/partials/navbar.html",
 		"web/templates/partials/post.html",
@@ -119,12 +117,12 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	log.Println("ProfileHandler: Template loaded successfully")
-
 	data := viewmodels.ProfilePageData{
 		Username:                   user.Username,
 		Email:                      user.Email,
 		ProfilePicture:             user.ProfilePicture,
+		UnreadMessages:             app.unreadMessages(userID),
+		UnreadNotifications:        app.unreadNotifications(userID),
 		Country:                    user.Country,
 		ShowDonationsInCountryOnly: user.ShowDonationsInCountryOnly,
 		IsLoggedIn:                 true,
@@ -132,6 +130,12 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		Comments:                   comments,
 		LikedPosts:                 likedPosts,
 		DislikedPosts:              dislikedPosts,
+		Sessions:                   sessions,
+		Warnings:                   warnings,
+		NotificationSettings:       notificationSettings,
+		EmailDigest:                user.EmailDigest,
+		EmailVerified:              user.EmailVerified,
+		CanModerate:                authz.Can(sessionUser, authz.Moderate, 0),
 	}
 
 	// Execute the template
@@ -142,29 +146,22 @@ func ProfileHandler(w http.ResponseWriter, r *http.Request) {
 		utils.RenderServerErrorPage(w)
 		return
 	}
-
-	log.Println("ProfileHandler: Template executed successfully")
 }
 
-func UpdateProfileSettingsHandler(w http.ResponseWriter, r *http.Request) {
+func (app *App) UpdateProfileSettingsHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Redirect(w, r, "/profile", http.StatusSeeOther)
 		return
 	}
 
-	sessionCookie, err := r.Cookie("session_token")
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	if err != nil {
 		http.Redirect(w, r, "/login", http.StatusSeeOther)
 		return
 	}
+	userID := sessionUser.ID
 
-	userID, err := repository.GetUserIDBySession(sessionCookie.Value)
-	if err != nil || userID == 0 {
-		http.Redirect(w, r, "/login", http.StatusSeeOther)
-		return
-	}
-
-	currentUser, err := repository.GetUserByID(userID)
+	currentUser, err := app.Store.GetUserByID(userID)
 	if err != nil {
 		log.Println("Error fetching current user:", err)
 		utils.RenderServerErrorPage(w)
@@ -177,14 +174,14 @@ func UpdateProfileSettingsHandler(w http.ResponseWriter, r *http.Request) {
 
 	// After updating the user, update old donation posts if country has changed
 	if country != "" && country != currentUser.Country {
-		err := repository.UpdateDonationCountryForUser(userID, country)
+		err := app.Store.UpdateDonationCountryForUser(userID, country)
 		if err != nil {
 			log.Println("Error updating donation posts with new country:", err)
 		}
 	}
 
 	// Update user preferences in the DB
-	err = repository.UpdateUserPreferences(userID, country, showDonations)
+	err = app.Store.UpdateUserPreferences(userID, country, showDonations)
 	if err != nil {
 		log.Println("UpdateProfileSettingsHandler: Failed to update preferences:", err)
 		http.Error(w, "Could not save preferences", http.StatusInternalServerError)
@@ -1,28 +1,28 @@
 package handlers
 
 import (
-	"ellas-corner/internal/repository"
+	"ellas-corner/internal/authz"
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"html/template"
 	"log"
 	"net/http"
 	"strconv"
 )
 
-func ReactionHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("ReactionHandler: Request received")
-
+func (app *App) ReactionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
 	userID := 0
-	sessionUser, err := utils.GetSessionUser(r)
-	if err != nil {
-		log.Println("User not logged in or invalid session")
-		renderHomeWithError(w, "You must be logged in to react.", userID)
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err == nil && !sessionUser.EmailVerified {
+		app.renderHomeWithError(w, r, "Please confirm your email address before reacting.", sessionUser.ID)
+		return
+	}
+	if err != nil || !authz.Can(sessionUser, authz.CreateContent, 0) {
+		app.renderHomeWithError(w, r, "You must be logged in to react.", userID)
 		return
 	}
 	userID = sessionUser.ID
@@ -30,7 +30,6 @@ func ReactionHandler(w http.ResponseWriter, r *http.Request) {
 	// Get form values
 	postIDStr := r.FormValue("post_id")
 	reaction := r.FormValue("reaction")
-	log.Printf("ReactionHandler: Post ID: %s, Reaction: %s", postIDStr, reaction)
 
 	// Convert postIDStr to int
 	postID, err := strconv.Atoi(postIDStr)
@@ -41,7 +40,7 @@ func ReactionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add the reaction to the database
-	err = repository.AddReaction(userID, postID, reaction)
+	err = app.Store.AddReaction(userID, postID, reaction)
 	if err != nil {
 		log.Println("Error adding reaction:", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -54,15 +53,15 @@ func ReactionHandler(w http.ResponseWriter, r *http.Request) {
 }
 
 // Helper function to render the home page with an error message (without r *http.Request)
-func renderHomeWithError(w http.ResponseWriter, errorMessage string, userID int) {
-	posts, err := repository.FetchPosts(userID)
+func (app *App) renderHomeWithError(w http.ResponseWriter, r *http.Request, errorMessage string, userID int) {
+	posts, err := app.Store.FetchPosts(userID)
 	if err != nil {
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RenderServerErrorPage(w)
 		return
 	}
 
-	tmpl, err := template.ParseFiles(
+	tmpl, err := parseTemplates(r,
 		"web/templates/index.html",
 		"web/templates/partials/post.html",
 		"web/templates/partials/navbar.html",
@@ -87,28 +86,27 @@ func renderHomeWithError(w http.ResponseWriter, errorMessage string, userID int)
 	}
 }
 
-func CommentReactionHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("CommentReactionHandler: Request received")
-
+func (app *App) CommentReactionHandler(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	sessionUser, err := utils.GetSessionUser(r)
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	userID := 0
-	if err == nil {
+	if err == nil && authz.Can(sessionUser, authz.CreateContent, 0) {
 		userID = sessionUser.ID
+	} else if err == nil && !sessionUser.EmailVerified {
+		app.renderHomeWithError(w, r, "Please confirm your email address before reacting.", sessionUser.ID)
+		return
 	} else {
-		log.Println("User not logged in or invalid session")
-		renderHomeWithError(w, "You must be logged in to react.", userID)
+		app.renderHomeWithError(w, r, "You must be logged in to react.", userID)
 		return
 	}
 
 	// Get form values
 	commentIDStr := r.FormValue("comment_id")
 	reaction := r.FormValue("reaction")
-	log.Printf("CommentReactionHandler: Comment ID: %s, Reaction: %s", commentIDStr, reaction)
 
 	commentID, err := strconv.Atoi(commentIDStr)
 	if err != nil {
@@ -118,7 +116,7 @@ func CommentReactionHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Add the reaction to the comment in the database
-	err = repository.AddCommentReaction(userID, commentID, reaction)
+	err = app.Store.AddCommentReaction(userID, commentID, reaction)
 	if err != nil {
 		log.Println("Error adding reaction to comment:", err)
 		w.WriteHeader(http.StatusInternalServerError)
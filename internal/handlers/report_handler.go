@@ -0,0 +1,244 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"ellas-corner/internal/authz"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+	"ellas-corner/internal/viewmodels"
+)
+
+// maxReportDetails caps the free text sent with a report
+const maxReportDetails = 1000
+
+// reportResolutions maps the action in a review queue URL to how the reports are resolved
+var reportResolutions = map[string]repository.ReportResolution{
+	"dismiss": repository.ResolutionDismiss,
+	"hide":    repository.ResolutionHide,
+	"warn":    repository.ResolutionWarn,
+}
+
+// reportedContentOwner returns the author of the post or comment being reported,
+// or sql.ErrNoRows if it does not exist
+func (app *App) reportedContentOwner(targetType string, targetID, viewerID int) (int, error) {
+	switch targetType {
+	case "post":
+		post, err := app.Store.GetPostByID(strconv.Itoa(targetID), viewerID)
+		if err != nil {
+			return 0, err
+		} else if post == nil {
+			return 0, sql.ErrNoRows
+		}
+		return post.UserID, nil
+	case "comment":
+		comment, err := app.Store.GetCommentByID(targetID, viewerID)
+		if err != nil {
+			return 0, err
+		} else if comment == nil {
+			return 0, sql.ErrNoRows
+		}
+		return comment.UserID, nil
+	}
+	return 0, sql.ErrNoRows
+}
+
+// sameSiteReferer returns the path of the page the request came from, so a form can send the
+// user back to it, or fallback if there is none. Only the path is kept, never another host.
+func sameSiteReferer(r *http.Request, fallback string) string {
+	referer, err := url.Parse(r.Referer())
+	if err != nil || referer.Path == "" || !strings.HasPrefix(referer.Path, "/") {
+		return fallback
+	}
+	if referer.RawQuery != "" {
+		return referer.Path + "?" + referer.RawQuery
+	}
+	return referer.Path
+}
+
+// ReportHandler records a report about a post or comment from the report form under each
+// post and comment, then sends the user back to the page they were on
+func (app *App) ReportHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
+	if err != nil {
+		http.Redirect(w, r, "/login?message=Please+log+in+to+report+content.", http.StatusSeeOther)
+		return
+	}
+
+	targetType := r.FormValue("target_type")
+	targetID, err := strconv.Atoi(r.FormValue("target_id"))
+	reason := repository.ReportReason(r.FormValue("reason"))
+	details := strings.TrimSpace(r.FormValue("details"))
+	if err != nil || !repository.ValidReportTarget(targetType) || !repository.ValidReportReason(reason) || len(details) > maxReportDetails {
+		http.Error(w, "Invalid report", http.StatusBadRequest)
+		return
+	}
+
+	ownerID, err := app.reportedContentOwner(targetType, targetID, sessionUser.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("ReportHandler: Error fetching reported content:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	if !authz.Can(sessionUser, authz.ReportContent, ownerID) {
+		http.Error(w, "You can't report your own "+targetType, http.StatusForbidden)
+		return
+	}
+
+	// Reporting something twice is not an error for the user; the first report stands
+	_, err = app.Store.CreateReport(sessionUser.ID, targetType, targetID, reason, details)
+	if err != nil && !errors.Is(err, repository.ErrAlreadyReported) {
+		log.Println("ReportHandler: Error creating report:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	log.Printf("ReportHandler: User %d reported %s %d (%s)\n", sessionUser.ID, targetType, targetID, reason)
+	http.Redirect(w, r, sameSiteReferer(r, "/"), http.StatusSeeOther)
+}
+
+// apiReport records a report about the post or comment in the URL, for APIReportPostHandler
+// and APIReportCommentHandler
+func (app *App) apiReport(w http.ResponseWriter, r *http.Request, targetType string) {
+	sessionUser, ok := app.requireAPIUser(w, r)
+	if !ok {
+		return
+	}
+	targetID, ok := pathID(w, r, "id")
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Reason  string `json:"reason"`
+		Details string `json:"details"`
+	}
+	if !decodeJSON(w, r, &body) {
+		return
+	}
+	reason := repository.ReportReason(body.Reason)
+	details := strings.TrimSpace(body.Details)
+	if !repository.ValidReportReason(reason) {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "reason must be one of recalled, unsafe, spam, abusive or other")
+		return
+	}
+	if len(details) > maxReportDetails {
+		writeAPIError(w, http.StatusUnprocessableEntity, "validation_failed", "details must be at most "+strconv.Itoa(maxReportDetails)+" characters")
+		return
+	}
+
+	ownerID, err := app.reportedContentOwner(targetType, targetID, sessionUser.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		writeAPIError(w, http.StatusNotFound, "not_found", "No "+targetType+" with that ID")
+		return
+	} else if err != nil {
+		writeAPIServerError(w)
+		return
+	}
+	if !authorizeAPI(w, sessionUser, authz.ReportContent, ownerID, "You can't report your own "+targetType) {
+		return
+	}
+
+	hidden, err := app.Store.CreateReport(sessionUser.ID, targetType, targetID, reason, details)
+	if errors.Is(err, repository.ErrAlreadyReported) {
+		writeAPIError(w, http.StatusConflict, "already_reported", "You have already reported this "+targetType)
+		return
+	} else if err != nil {
+		log.Println("apiReport: Error creating report:", err)
+		writeAPIServerError(w)
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, viewmodels.ReportJSON{TargetType: targetType, TargetID: targetID, Reason: string(reason), Hidden: hidden})
+}
+
+// APIReportPostHandler reports a post to the moderators with {"reason", "details"}
+func (app *App) APIReportPostHandler(w http.ResponseWriter, r *http.Request) {
+	app.apiReport(w, r, "post")
+}
+
+// APIReportCommentHandler reports a comment to the moderators with {"reason", "details"}
+func (app *App) APIReportCommentHandler(w http.ResponseWriter, r *http.Request) {
+	app.apiReport(w, r, "comment")
+}
+
+// AdminReportsHandler renders the review queue of posts and comments with open reports
+func (app *App) AdminReportsHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	queue, err := app.Store.FetchReportQueue()
+	if err != nil {
+		log.Println("AdminReportsHandler: Error fetching report queue:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	tmpl, err := parseTemplates(r, "web/templates/reports.html", "web/templates/partials/navbar.html")
+	if err != nil {
+		log.Println("AdminReportsHandler: Error parsing template:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+
+	data := viewmodels.ReportQueuePageData{
+		IsLoggedIn:          true,
+		ProfilePicture:      sessionUser.ProfilePicture,
+		UnreadMessages:      app.unreadMessages(sessionUser.ID),
+		UnreadNotifications: app.unreadNotifications(sessionUser.ID),
+		Items:               queue,
+		ReportThreshold:     repository.ReportThreshold,
+	}
+	if err := tmpl.Execute(w, data); err != nil {
+		log.Println("AdminReportsHandler: Error executing template:", err)
+	}
+}
+
+// AdminResolveReportHandler closes the open reports on an item by dismissing them, hiding
+// the item or warning its author: POST /admin/reports/{type}/{id}/{resolution}
+func (app *App) AdminResolveReportHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, ok := app.requireModerator(w, r)
+	if !ok {
+		return
+	}
+
+	targetType := r.PathValue("type")
+	targetID, err := strconv.Atoi(r.PathValue("id"))
+	resolution, known := reportResolutions[r.PathValue("resolution")]
+	if err != nil || !repository.ValidReportTarget(targetType) || !known {
+		http.NotFound(w, r)
+		return
+	}
+
+	err = app.Store.ResolveReports(sessionUser.ID, targetType, targetID, resolution, strings.TrimSpace(r.FormValue("note")))
+	if errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "There are no open reports on this "+targetType, http.StatusNotFound)
+		return
+	} else if err != nil {
+		log.Println("AdminResolveReportHandler: Error resolving reports:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
+	}
+	http.Redirect(w, r, "/admin/reports", http.StatusSeeOther)
+}
@@ -0,0 +1,54 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+func TestAPIReports(t *testing.T) {
+	t.Parallel()
+	app, mux := setupTestAPI(t)
+
+	authorToken := createAPIUser(t, app, mux, "author", "author@example.com")
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts", authorToken, `{"title":"Car seat","content":"Barely used"}`); rr.Code != http.StatusCreated {
+		t.Fatalf("expected 201 creating post, got %d", rr.Code)
+	}
+
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/reports", authorToken, `{"reason":"spam"}`); rr.Code != http.StatusForbidden {
+		t.Errorf("expected 403 reporting your own post, got %d", rr.Code)
+	}
+
+	var tokens []string
+	for i := 1; i <= repository.ReportThreshold; i++ {
+		n := strconv.Itoa(i)
+		tokens = append(tokens, createAPIUser(t, app, mux, "parent"+n, "parent"+n+"@example.com"))
+	}
+
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/reports", tokens[0], `{"reason":"bogus"}`); rr.Code != http.StatusUnprocessableEntity {
+		t.Errorf("expected 422 for an unknown reason, got %d", rr.Code)
+	}
+	if rr, _ := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/9/reports", tokens[0], `{"reason":"spam"}`); rr.Code != http.StatusNotFound {
+		t.Errorf("expected 404 reporting a missing post, got %d", rr.Code)
+	}
+
+	for i, token := range tokens {
+		rr, body := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/reports", token, `{"reason":"recalled","details":"On the recall list"}`)
+		if rr.Code != http.StatusCreated {
+			t.Fatalf("report %d: expected 201, got %d: %s", i+1, rr.Code, rr.Body.String())
+		}
+		if wantHidden := i+1 == repository.ReportThreshold; body["hidden"] != wantHidden {
+			t.Errorf("report %d: expected hidden=%v, got %v", i+1, wantHidden, body["hidden"])
+		}
+	}
+
+	rr, body := apiRequest(t, mux, http.MethodPost, "/api/v1/posts/1/reports", tokens[0], `{"reason":"spam"}`)
+	if rr.Code != http.StatusConflict || body["error"].(map[string]interface{})["code"] != "already_reported" {
+		t.Errorf("expected 409 already_reported, got %d", rr.Code)
+	}
+	if rr, _ := apiRequest(t, mux, http.MethodGet, "/api/v1/posts/1", tokens[0], ""); rr.Code != http.StatusNotFound {
+		t.Errorf("expected the reported post to be hidden, got %d", rr.Code)
+	}
+}
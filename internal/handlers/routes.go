@@ -0,0 +1,121 @@
+package handlers
+
+import "net/http"
+
+// Routes returns the site's router: static files, uploads, pages and the JSON API
+func (app *App) Routes() *http.ServeMux {
+	mux := http.NewServeMux()
+
+	// Serve static files from "web/static" when requested at "/static/..." (web added to keep frontend assets in one place)
+	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
+	// Uploaded images come from their blob stores, never straight from web/static
+	mux.Handle("GET /static/uploads/{name}", app.imageHandler(app.PostImages))
+	mux.Handle("GET /static/profile_pictures/{name}", app.imageHandler(app.ProfilePictures))
+	mux.Handle("/static/uploads/", http.NotFoundHandler())
+	mux.Handle("/static/profile_pictures/", http.NotFoundHandler())
+
+	// Set up route handlers
+
+	// Liveness and readiness probes
+	mux.HandleFunc("GET /healthz", app.HealthzHandler)
+	mux.HandleFunc("GET /readyz", app.ReadyzHandler)
+
+	// Home page and about page
+	mux.HandleFunc("/", app.HomeHandler)
+	mux.HandleFunc("/about", app.AboutHandler)
+
+	// Posts
+	mux.HandleFunc("/create-post", app.CreatePostHandler)
+	mux.HandleFunc("/delete-post", app.DeletePostHandler)
+	mux.HandleFunc("/edit-post", app.EditPostHandler)
+
+	// Authentication
+	mux.HandleFunc("/register", app.RegisterHandler)
+	mux.HandleFunc("/login", app.LoginHandler)
+	mux.HandleFunc("/logout", app.LogoutHandler)
+	mux.HandleFunc("/logout-other-devices", app.LogoutOtherDevicesHandler)
+	mux.HandleFunc("/revoke-session", app.RevokeSessionHandler)
+	mux.HandleFunc("/forgot-password", app.ForgotPasswordHandler)
+	mux.HandleFunc("/reset-password", app.ResetPasswordHandler)
+	mux.HandleFunc("/verify-email", app.VerifyEmailHandler)
+
+	// User
+	mux.HandleFunc("/accept-cookies", app.AcceptCookiesHandler)
+	mux.HandleFunc("/profile", app.ProfileHandler)
+	mux.HandleFunc("/upload-profile-picture", app.UploadProfilePictureHandler)
+	mux.HandleFunc("/liked-posts", app.LikedPostsHandler)
+	mux.HandleFunc("/update-profile-settings", app.UpdateProfileSettingsHandler)
+
+	//Comments and reactions
+	mux.HandleFunc("/add-comment", app.AddCommentHandler)
+	mux.HandleFunc("/react", app.ReactionHandler)
+	mux.HandleFunc("/react-comment", app.CommentReactionHandler)
+	mux.HandleFunc("/delete-comment", app.DeleteCommentHandler)
+	mux.HandleFunc("/report", app.ReportHandler)
+	mux.HandleFunc("GET /donations/{id}", app.DonationHandler)
+	mux.HandleFunc("POST /donations/{id}/{action}", app.DonationActionHandler)
+
+	// Private messages and blocking
+	mux.HandleFunc("GET /messages", app.MessagesHandler)
+	mux.HandleFunc("POST /messages/start", app.StartConversationHandler)
+	mux.HandleFunc("GET /messages/{id}", app.ConversationHandler)
+	mux.HandleFunc("POST /messages/{id}", app.SendMessageHandler)
+	mux.HandleFunc("POST /users/{id}/block", app.BlockUserHandler)
+	mux.HandleFunc("POST /users/{id}/unblock", app.UnblockUserHandler)
+
+	// Notifications
+	mux.HandleFunc("GET /notifications", app.NotificationsHandler)
+	mux.HandleFunc("POST /notifications/{id}/read", app.OpenNotificationHandler)
+	mux.HandleFunc("POST /notifications/read-all", app.ReadAllNotificationsHandler)
+	mux.HandleFunc("POST /notifications/settings", app.UpdateNotificationSettingsHandler)
+
+	// Moderation dashboard (moderators and admins) and categories (admins)
+	mux.HandleFunc("GET /admin", app.AdminHandler)
+	mux.HandleFunc("POST /admin/posts/{id}/{action}", app.AdminPostActionHandler)
+	mux.HandleFunc("POST /admin/comments/{id}/{action}", app.AdminCommentActionHandler)
+	mux.HandleFunc("POST /admin/users/{id}/{action}", app.AdminUserActionHandler)
+	mux.HandleFunc("GET /admin/reports", app.AdminReportsHandler)
+	mux.HandleFunc("POST /admin/reports/{type}/{id}/{resolution}", app.AdminResolveReportHandler)
+	mux.HandleFunc("GET /admin/categories", app.AdminCategoriesHandler)
+	mux.HandleFunc("POST /admin/categories", app.AdminCreateCategoryHandler)
+	mux.HandleFunc("GET /admin/categories/{id}", app.AdminEditCategoryHandler)
+	mux.HandleFunc("POST /admin/categories/{id}", app.AdminUpdateCategoryHandler)
+	mux.HandleFunc("POST /admin/categories/{id}/delete", app.AdminDeleteCategoryHandler)
+
+	//Filtering and search
+	mux.HandleFunc("/filter", app.FilterHandler)
+	mux.HandleFunc("/search", app.SearchHandler)
+
+	// JSON API (v1). The old /api/posts route redirects here.
+	mux.HandleFunc("/api/posts", app.LegacyPostsAPIHandler)
+	mux.HandleFunc("/api/v1/", app.APINotFoundHandler)
+	mux.HandleFunc("POST /api/v1/tokens", app.APICreateTokenHandler)
+	mux.HandleFunc("DELETE /api/v1/tokens/current", app.APIDeleteTokenHandler)
+
+	mux.HandleFunc("GET /api/v1/categories", app.APIListCategoriesHandler)
+	mux.HandleFunc("GET /api/v1/posts", app.APIListPostsHandler)
+	mux.HandleFunc("POST /api/v1/posts", app.APICreatePostHandler)
+	mux.HandleFunc("GET /api/v1/posts/{id}", app.APIGetPostHandler)
+	mux.HandleFunc("PATCH /api/v1/posts/{id}", app.APIUpdatePostHandler)
+	mux.HandleFunc("PUT /api/v1/posts/{id}", app.APIUpdatePostHandler)
+	mux.HandleFunc("DELETE /api/v1/posts/{id}", app.APIDeletePostHandler)
+	mux.HandleFunc("POST /api/v1/posts/{id}/reactions", app.APIPostReactionHandler)
+	mux.HandleFunc("POST /api/v1/posts/{id}/reports", app.APIReportPostHandler)
+	mux.HandleFunc("GET /api/v1/posts/{id}/donation", app.APIGetDonationHandler)
+	mux.HandleFunc("POST /api/v1/posts/{id}/donation/{action}", app.APIDonationActionHandler)
+
+	mux.HandleFunc("GET /api/v1/posts/{id}/comments", app.APIListCommentsHandler)
+	mux.HandleFunc("POST /api/v1/posts/{id}/comments", app.APICreateCommentHandler)
+	mux.HandleFunc("GET /api/v1/comments/{id}", app.APIGetCommentHandler)
+	mux.HandleFunc("PATCH /api/v1/comments/{id}", app.APIUpdateCommentHandler)
+	mux.HandleFunc("PUT /api/v1/comments/{id}", app.APIUpdateCommentHandler)
+	mux.HandleFunc("DELETE /api/v1/comments/{id}", app.APIDeleteCommentHandler)
+	mux.HandleFunc("POST /api/v1/comments/{id}/reactions", app.APICommentReactionHandler)
+	mux.HandleFunc("POST /api/v1/comments/{id}/reports", app.APIReportCommentHandler)
+
+	mux.HandleFunc("GET /api/v1/users/me", app.APIGetCurrentUserHandler)
+	mux.HandleFunc("GET /api/v1/users/{id}", app.APIGetUserHandler)
+	mux.HandleFunc("GET /api/v1/users/{id}/posts", app.APIListUserPostsHandler)
+
+	return mux
+}
@@ -4,14 +4,11 @@ import (
 	"ellas-corner/internal/repository"
 	"ellas-corner/internal/utils"
 	"ellas-corner/internal/viewmodels"
-	"html/template"
 	"log"
 	"net/http"
 )
 
-func SearchHandler(w http.ResponseWriter, r *http.Request) {
-	log.Println("SearchHandler: Request received")
-
+func (app *App) SearchHandler(w http.ResponseWriter, r *http.Request) {
 	// Get the search query
 	searchQuery := r.URL.Query().Get("q")
 	if searchQuery == "" {
@@ -19,7 +16,7 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	sessionUser, err := utils.GetSessionUser(r)
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	isLoggedIn := false
 	var userID int
 	var profilePicture string
@@ -30,7 +27,7 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		userID = sessionUser.ID
 		profilePicture = sessionUser.ProfilePicture
 
-		currentUser, err = repository.GetUserByID(userID)
+		currentUser, err = app.Store.GetUserByID(userID)
 		if err != nil {
 			log.Println("SearchHandler: Error fetching full user profile:", err)
 			utils.RenderServerErrorPage(w)
@@ -38,36 +35,36 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	// Fetch posts matching the query
-	posts, err := repository.SearchPosts(searchQuery, userID, isLoggedIn)
+	// Fetch posts matching the query, narrowed by any of the shared listing filters
+	query := postQueryFromRequest(r, userID)
+	query.Search = searchQuery
+	page, err := applyPagination(r, &query, postsPerPage)
+	if err != nil {
+		log.Println("SearchHandler: Ignoring invalid cursor; showing the first page")
+	}
+
+	result, err := app.Store.FetchPostPage(query)
 	if err != nil {
 		log.Println("Error searching posts:", err)
 		w.WriteHeader(http.StatusInternalServerError)
 		utils.RenderServerErrorPage(w)
 		return
 	}
+	posts := result.Posts
 
-	for i := range posts {
-		if posts[i].IsDonation {
-			if isLoggedIn && currentUser.ShowDonationsInCountryOnly {
-				posts[i].ShowDonatedLabel = posts[i].DonationCountry == currentUser.Country
-			} else {
-				posts[i].ShowDonatedLabel = true
-			}
-		}
-	}
+	applyDonationLabels(posts, isLoggedIn, currentUser)
 
-	for i := range posts {
-		comments, err := repository.FetchCommentsForPost(posts[i].ID, userID)
-		if err != nil {
-			log.Println("Error fetching comments for post ID", posts[i].ID, ":", err)
-			continue // skip adding comments if there's an error
-		}
-		posts[i].Comments = comments
+	// Fetch categories for the filter options
+	categories, err := app.Store.FetchCategories()
+	if err != nil {
+		log.Println("SearchHandler: Error fetching categories:", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		utils.RenderServerErrorPage(w)
+		return
 	}
 
 	// Parse the search results template and navbar
-	tmpl, err := template.ParseFiles("web/templates/search_results.html", "web/templates/partials/navbar.html", "web/templates/partials/post.html")
+	tmpl, err := parseTemplates(r, "web/templates/search_results.html", "web/templates/partials/navbar.html", "web/templates/partials/post.html", "web/templates/partials/pagination.html")
 	if err != nil {
 		log.Println("SearchHandler: Error parsing template", err)
 		w.WriteHeader(http.StatusInternalServerError)
@@ -78,8 +75,13 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 	data := viewmodels.SearchPageData{
 		IsLoggedIn:             isLoggedIn,
 		ProfilePicture:         profilePicture,
+		UnreadMessages:         app.unreadMessages(userID),
+		UnreadNotifications:    app.unreadNotifications(userID),
 		SearchQuery:            searchQuery,
 		Posts:                  posts,
+		Categories:             categories,
+		Query:                  query,
+		Pagination:             paginationLinks(r, page, result),
 		ShowEditControls:       false,
 		ShowCommentFormForPost: 0,
 	}
@@ -91,6 +93,4 @@ func SearchHandler(w http.ResponseWriter, r *http.Request) {
 		utils.RenderServerErrorPage(w)
 		return
 	}
-
-	log.Println("SearchHandler: Template executed successfully")
 }
@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"path/filepath"
+
+	"ellas-corner/internal/images"
+	"ellas-corner/internal/utils"
+)
+
+// templateFuncs are the functions every page template can use. csrfField is added to each
+// form that posts, so CSRFMiddleware accepts it. thumbnail names a smaller copy of an
+// uploaded image, as in {{ thumbnail .Image "medium" }}.
+func templateFuncs(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"csrfField": func() template.HTML {
+			return template.HTML(`<input type="hidden" name="` + utils.CSRFFieldName + `" value="` +
+				template.HTMLEscapeString(utils.CSRFToken(r)) + `">`)
+		},
+		"dict":      dict,
+		"thumbnail": images.ThumbnailName,
+	}
+}
+
+// dict builds a map from key and value pairs, for passing several values to a partial
+func dict(values ...interface{}) (map[string]interface{}, error) {
+	if len(values)%2 != 0 {
+		return nil, fmt.Errorf("dict expects even number of arguments")
+	}
+	dict := make(map[string]interface{}, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		key, ok := values[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict keys must be strings")
+		}
+		dict[key] = values[i+1]
+	}
+	return dict, nil
+}
+
+// parseTemplates parses a page and its partials with templateFuncs for this request. The
+// first file is the page that Execute renders.
+func parseTemplates(r *http.Request, files ...string) (*template.Template, error) {
+	return template.New(filepath.Base(files[0])).Funcs(templateFuncs(r)).ParseFiles(files...)
+}
@@ -1,28 +1,40 @@
 package handlers
 
 import (
+	"context"
+	"ellas-corner/internal/images"
 	"ellas-corner/internal/repository"
+	"ellas-corner/internal/storage"
 	"ellas-corner/internal/utils"
-	"fmt"
 	"io"
 	"log"
 	"net/http"
-	"os"
-	"path/filepath"
 	"time"
 )
 
-func UploadProfilePictureHandler(w http.ResponseWriter, r *http.Request) {
-	const maxUploadSize = 10 << 20 // 10MB
+// saveImage checks an uploaded image and saves it, with its thumbnails, in store. It returns
+// the name to keep in the database. The upload is recorded under uploadStore, so the sweeper
+// leaves the picture alone even if it was already stored as an orphan.
+func (app *App) saveImage(ctx context.Context, file io.Reader, store storage.BlobStore, uploadStore string) (string, error) {
+	name, err := images.Service{MaxDimension: app.Uploads.MaxImageDimension}.Save(ctx, file, store)
+	if err != nil {
+		return "", err
+	}
+	if err := app.Store.RecordUpload(uploadStore, name, time.Now()); err != nil {
+		return "", err
+	}
+	return name, nil
+}
 
-	sessionUser, err := utils.GetSessionUser(r)
+func (app *App) UploadProfilePictureHandler(w http.ResponseWriter, r *http.Request) {
+	sessionUser, err := utils.GetSessionUser(app.Store, r)
 	if err != nil {
 		http.Error(w, "Please log in to upload a profile picture", http.StatusUnauthorized)
 		return
 	}
-	userID := sessionUser.ID
 
 	// Enforce file size limit before reading body
+	maxUploadSize := app.Uploads.MaxBytes()
 	r.Body = http.MaxBytesReader(w, r.Body, maxUploadSize)
 
 	// Parse the multipart form
@@ -42,58 +54,20 @@ func UploadProfilePictureHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	defer file.Close()
 
-	// Check MIME type by reading first 512 bytes
-	buffer := make([]byte, 512)
-	_, err = file.Read(buffer)
-	if err != nil {
-		log.Println("UploadProfilePictureHandler: Error reading file:", err)
-		http.Error(w, "Unable to read file", http.StatusBadRequest)
+	filename, err := app.saveImage(r.Context(), file, app.ProfilePictures, repository.ProfilePictureUploads)
+	if images.Rejected(err) {
+		log.Println("UploadProfilePictureHandler: Rejected image:", err)
+		http.Error(w, "Image not accepted: "+err.Error(), http.StatusBadRequest)
 		return
 	}
-	filetype := http.DetectContentType(buffer)
-	_, err = file.Seek(0, 0) // reset file pointer
-	if err != nil {
-		log.Println("UploadProfilePictureHandler: Error resetting file pointer:", err)
-		http.Error(w, "Failed to process file", http.StatusInternalServerError)
-		return
-	}
-
-	// Allow only valid image types
-	allowedTypes := map[string]string{
-		"image/jpeg": ".jpg",
-		"image/png":  ".png",
-		"image/gif":  ".gif",
-	}
-	ext, ok := allowedTypes[filetype]
-	if !ok {
-		log.Printf("UploadProfilePictureHandler: Rejected file type: %s", filetype)
-		http.Error(w, "Only image files are allowed (jpg, png, gif)", http.StatusBadRequest)
-		return
-	}
-
-	// Generate unique filename with timestamp to avoid overwrite
-	filename := fmt.Sprintf("user_%d_%d%s", userID, time.Now().Unix(), ext)
-	filePath := filepath.Join("web/static/profile_pictures", filename)
-
-	// Create destination file
-	out, err := os.Create(filePath)
-	if err != nil {
-		log.Println("UploadProfilePictureHandler: Error creating file:", err)
-		utils.RenderServerErrorPage(w)
-		return
-	}
-	defer out.Close()
-
-	// Copy uploaded data to server file
-	_, err = io.Copy(out, file)
 	if err != nil {
-		log.Println("UploadProfilePictureHandler: Error saving file:", err)
+		log.Println("UploadProfilePictureHandler: Error saving image:", err)
 		utils.RenderServerErrorPage(w)
 		return
 	}
 
 	// Update user record with new filename
-	err = repository.UpdateProfilePicture(userID, filename)
+	err = app.Store.UpdateProfilePicture(sessionUser.ID, filename)
 	if err != nil {
 		log.Println("UploadProfilePictureHandler: Failed to update user profile:", err)
 		utils.RenderServerErrorPage(w)
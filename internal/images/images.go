@@ -0,0 +1,175 @@
+// Package images checks and stores uploaded pictures. Every upload is decoded and
+// re-encoded, which drops EXIF data such as GPS coordinates, and is saved under a name
+// derived from its content along with a few smaller copies for the pages that show it.
+package images
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"ellas-corner/internal/storage"
+)
+
+var (
+	ErrUnsupportedType = errors.New("only JPEG, PNG and GIF images are allowed")
+	ErrTooLarge        = errors.New("the image is too large")
+	ErrInvalidImage    = errors.New("the file is not a readable image")
+)
+
+// Rejected reports whether err means the upload itself was refused, as opposed to the
+// server failing to store it
+func Rejected(err error) bool {
+	return errors.Is(err, ErrUnsupportedType) || errors.Is(err, ErrTooLarge) || errors.Is(err, ErrInvalidImage)
+}
+
+// PlaceholderImage is the picture given to posts created without one
+const PlaceholderImage = "placeholder.jpg"
+
+// DefaultProfilePictures are the pictures new accounts are given one of at random
+var DefaultProfilePictures = []string{"1.png", "2.png", "3.png"}
+
+// MaxStoredSide is the longest side of the full-size copy kept of an upload. Bigger
+// pictures are scaled down to it.
+const MaxStoredSide = 2048
+
+// Size is a thumbnail that fits in a MaxSide by MaxSide square
+type Size struct {
+	Name    string
+	MaxSide int
+}
+
+// Thumbnails are the smaller copies saved next to every upload
+var Thumbnails = []Size{
+	{Name: "small", MaxSide: 160},
+	{Name: "medium", MaxSide: 480},
+	{Name: "large", MaxSide: 1024},
+}
+
+// decoders are the accepted content types, as sniffed by http.DetectContentType
+var decoders = map[string]func(io.Reader) (image.Image, error){
+	"image/jpeg": jpeg.Decode,
+	"image/png":  png.Decode,
+	"image/gif":  gif.Decode, // Only the first frame of an animation is kept
+}
+
+const jpegQuality = 85
+
+// Service stores uploaded images
+type Service struct {
+	// MaxDimension is the widest or tallest image accepted, in pixels. It stops small
+	// files that decode into huge images from exhausting memory.
+	MaxDimension int
+}
+
+// Save checks the image read from r and saves it, with its thumbnails, in store. It returns
+// the file name of the full-size copy. Identical pictures get the same name, so uploading
+// one twice stores it once.
+func (s Service) Save(ctx context.Context, r io.Reader, store storage.BlobStore) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	contentType := http.DetectContentType(data)
+	decode, ok := decoders[contentType]
+	if !ok {
+		return "", ErrUnsupportedType
+	}
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrInvalidImage
+	}
+	if config.Width <= 0 || config.Height <= 0 {
+		return "", ErrInvalidImage
+	}
+	if config.Width > s.MaxDimension || config.Height > s.MaxDimension {
+		return "", ErrTooLarge
+	}
+	src, err := decode(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrInvalidImage
+	}
+
+	// Re-encoding loses the EXIF orientation, so turn photos the right way up first
+	full := orient(resize(src, MaxStoredSide), exifOrientation(data))
+
+	// JPEGs stay JPEGs. PNGs and GIFs become PNGs, which keeps their transparency.
+	ext, storedType, encode := ".png", "image/png", encodePNG
+	if contentType == "image/jpeg" {
+		ext, storedType, encode = ".jpg", "image/jpeg", encodeJPEG
+	}
+
+	encoded, err := encode(full)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(encoded)
+	name := hex.EncodeToString(sum[:16]) + ext
+
+	if _, err := store.Stat(ctx, name); err == nil {
+		return name, nil
+	} else if err != storage.ErrNotFound {
+		return "", err
+	}
+
+	// The full-size file goes last, so its presence means the thumbnails are there too
+	for _, size := range Thumbnails {
+		thumb, err := encode(resize(full, size.MaxSide))
+		if err != nil {
+			return "", err
+		}
+		if err := store.Put(ctx, ThumbnailName(name, size.Name), thumb, storedType); err != nil {
+			return "", err
+		}
+	}
+	if err := store.Put(ctx, name, encoded, storedType); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+func encodeJPEG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, img, &jpeg.Options{Quality: jpegQuality})
+	return buf.Bytes(), err
+}
+
+func encodePNG(img image.Image) ([]byte, error) {
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	return buf.Bytes(), err
+}
+
+var (
+	storedName  = regexp.MustCompile(`^[0-9a-f]{32}\.(jpg|png)$`)
+	storedImage = regexp.MustCompile(`^[0-9a-f]{32}(_[a-z]+)?\.(jpg|png)$`)
+)
+
+// ContentAddressed reports whether name is an image or thumbnail saved by Save. Its name
+// comes from its content, so what it refers to never changes.
+func ContentAddressed(name string) bool {
+	return storedImage.MatchString(name)
+}
+
+// ThumbnailName returns the file name of the named thumbnail of a saved image. Images
+// stored before thumbnails existed, such as the default pictures, have none, and their
+// own name is returned.
+func ThumbnailName(name, size string) string {
+	if !storedName.MatchString(name) {
+		return name
+	}
+	ext := filepath.Ext(name)
+	return strings.TrimSuffix(name, ext) + "_" + size + ext
+}
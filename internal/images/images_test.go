@@ -0,0 +1,207 @@
+package images_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ellas-corner/internal/images"
+	"ellas-corner/internal/storage"
+)
+
+// testPicture is a w by h picture, red on the left half and blue on the right
+func testPicture(w, h int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			c := color.RGBA{R: 255, A: 255}
+			if x >= w/2 {
+				c = color.RGBA{B: 255, A: 255}
+			}
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+// phonePhoto encodes img as a JPEG with an EXIF block holding an orientation tag and a
+// GPS marker, like a photo straight off a phone
+func phonePhoto(t *testing.T, img image.Image, orientation uint16) []byte {
+	t.Helper()
+	var encoded bytes.Buffer
+	if err := jpeg.Encode(&encoded, img, nil); err != nil {
+		t.Fatalf("jpeg.Encode failed: %v", err)
+	}
+
+	// A little-endian TIFF header with one directory entry, followed by a fake GPS block
+	tiff := []byte("II*\x00\x08\x00\x00\x00\x01\x00")
+	entry := make([]byte, 12)
+	binary.LittleEndian.PutUint16(entry[0:], 0x0112)
+	binary.LittleEndian.PutUint16(entry[2:], 3)
+	binary.LittleEndian.PutUint32(entry[4:], 1)
+	binary.LittleEndian.PutUint16(entry[8:], orientation)
+	tiff = append(tiff, entry...)
+	tiff = append(tiff, []byte("\x00\x00\x00\x00GPS 59.437N 24.753E")...)
+
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	app1 := []byte{0xFF, 0xE1, 0, 0}
+	binary.BigEndian.PutUint16(app1[2:], uint16(len(segment)+2))
+
+	data := encoded.Bytes()
+	photo := append([]byte{}, data[:2]...)
+	photo = append(photo, app1...)
+	photo = append(photo, segment...)
+	return append(photo, data[2:]...)
+}
+
+func decodeFile(t *testing.T, path string) image.Image {
+	t.Helper()
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer f.Close()
+	img, _, err := image.Decode(f)
+	if err != nil {
+		t.Fatalf("Decode %s failed: %v", path, err)
+	}
+	return img
+}
+
+func TestSaveStripsMetadataAndTurnsPhotosUpright(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store, ctx := storage.LocalStore{Dir: dir}, context.Background()
+	service := images.Service{MaxDimension: 4000}
+
+	// A 3000 by 1000 picture that the camera says needs a quarter turn clockwise
+	photo := phonePhoto(t, testPicture(3000, 1000), 6)
+	name, err := service.Save(ctx, bytes.NewReader(photo), store)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if filepath.Ext(name) != ".jpg" || len(name) != 36 {
+		t.Errorf("expected a content-hash .jpg name, got %q", name)
+	}
+
+	saved, err := os.ReadFile(filepath.Join(dir, name))
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	if bytes.Contains(saved, []byte("Exif")) || bytes.Contains(saved, []byte("GPS")) {
+		t.Error("expected the EXIF block to be gone from the saved image")
+	}
+
+	// Scaled down to fit MaxStoredSide, and turned so the red half is on top
+	full := decodeFile(t, filepath.Join(dir, name))
+	if b := full.Bounds(); b.Dx() != 682 || b.Dy() != images.MaxStoredSide {
+		t.Errorf("expected a 682x%d upright image, got %v", images.MaxStoredSide, b.Size())
+	}
+	if r, _, b, _ := full.At(341, 100).RGBA(); r < b {
+		t.Error("expected the red half at the top after turning the photo")
+	}
+
+	for _, size := range images.Thumbnails {
+		thumb := decodeFile(t, filepath.Join(dir, images.ThumbnailName(name, size.Name)))
+		if b := thumb.Bounds(); b.Dy() != size.MaxSide || b.Dx() > size.MaxSide {
+			t.Errorf("%s thumbnail: expected it to fit %d pixels, got %v", size.Name, size.MaxSide, b.Size())
+		}
+	}
+
+	// The same picture is stored once
+	again, err := service.Save(ctx, bytes.NewReader(photo), store)
+	if err != nil || again != name {
+		t.Errorf("expected the same name for the same picture, got %q (err %v)", again, err)
+	}
+	files, _ := os.ReadDir(dir)
+	if len(files) != 1+len(images.Thumbnails) {
+		t.Errorf("expected one image and its thumbnails, got %d files", len(files))
+	}
+}
+
+func TestSaveFormats(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	store, ctx := storage.LocalStore{Dir: dir}, context.Background()
+	service := images.Service{MaxDimension: 100}
+
+	var pngData, gifData bytes.Buffer
+	if err := png.Encode(&pngData, testPicture(40, 20)); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	if err := gif.Encode(&gifData, testPicture(40, 20), nil); err != nil {
+		t.Fatalf("gif.Encode failed: %v", err)
+	}
+
+	for format, data := range map[string][]byte{"png": pngData.Bytes(), "gif": gifData.Bytes()} {
+		name, err := service.Save(ctx, bytes.NewReader(data), store)
+		if err != nil {
+			t.Fatalf("%s: Save failed: %v", format, err)
+		}
+		if filepath.Ext(name) != ".png" {
+			t.Errorf("%s: expected a PNG to be stored, got %q", format, name)
+		}
+		// Small pictures keep their size
+		if b := decodeFile(t, filepath.Join(dir, images.ThumbnailName(name, "large"))).Bounds(); b.Dx() != 40 || b.Dy() != 20 {
+			t.Errorf("%s: expected a small picture not to be enlarged, got %v", format, b.Size())
+		}
+	}
+}
+
+func TestSaveRejects(t *testing.T) {
+	t.Parallel()
+	var tooBig, truncated bytes.Buffer
+	if err := png.Encode(&tooBig, testPicture(120, 10)); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	if err := png.Encode(&truncated, testPicture(50, 50)); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{"html", []byte("<html><script>alert(1)</script></html>"), images.ErrUnsupportedType},
+		{"svg", []byte(`<?xml version="1.0"?><svg xmlns="http://www.w3.org/2000/svg"></svg>`), images.ErrUnsupportedType},
+		{"too wide", tooBig.Bytes(), images.ErrTooLarge},
+		{"truncated", truncated.Bytes()[:truncated.Len()/2], images.ErrInvalidImage},
+	}
+	for _, tt := range tests {
+		dir := t.TempDir()
+		_, err := images.Service{MaxDimension: 100}.Save(context.Background(), bytes.NewReader(tt.data), storage.LocalStore{Dir: dir})
+		if !errors.Is(err, tt.want) || !images.Rejected(err) {
+			t.Errorf("%s: expected %v, got %v", tt.name, tt.want, err)
+		}
+		if files, _ := os.ReadDir(dir); len(files) != 0 {
+			t.Errorf("%s: expected nothing to be written, got %d files", tt.name, len(files))
+		}
+	}
+}
+
+func TestThumbnailName(t *testing.T) {
+	t.Parallel()
+	name := "0123456789abcdef0123456789abcdef.jpg"
+	if got := images.ThumbnailName(name, "small"); got != "0123456789abcdef0123456789abcdef_small.jpg" {
+		t.Errorf("unexpected thumbnail name %q", got)
+	}
+	if !images.ContentAddressed(name) || !images.ContentAddressed(images.ThumbnailName(name, "small")) {
+		t.Error("expected saved images and their thumbnails to be recognised")
+	}
+	// Pictures from before thumbnails existed are shown as they are
+	for _, legacy := range []string{"placeholder.jpg", "1.png", "user_12_1751581579.jpg"} {
+		if got := images.ThumbnailName(legacy, "small"); got != legacy || images.ContentAddressed(legacy) {
+			t.Errorf("expected %q to be left alone, got %q", legacy, got)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package images
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+)
+
+// resize scales src down to fit in a maxSide by maxSide square, keeping its shape. Each new
+// pixel is the average of the pixels it covers. Smaller images keep their size.
+func resize(src image.Image, maxSide int) *image.RGBA {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	dw, dh := sw, sh
+	if sw > maxSide || sh > maxSide {
+		if sw >= sh {
+			dw, dh = maxSide, max(1, sh*maxSide/sw)
+		} else {
+			dw, dh = max(1, sw*maxSide/sh), maxSide
+		}
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+
+	// Source rows are read one at a time, so only the output is held in full
+	row := image.NewRGBA(image.Rect(0, 0, sw, 1))
+	sums := make([]uint64, dw*4)
+	counts := make([]uint64, dw)
+	flush := func(dy int) {
+		out := dst.Pix[dy*dst.Stride:]
+		for dx := 0; dx < dw; dx++ {
+			for c := 0; c < 4; c++ {
+				out[dx*4+c] = uint8(sums[dx*4+c] / counts[dx])
+				sums[dx*4+c] = 0
+			}
+			counts[dx] = 0
+		}
+	}
+
+	current := 0
+	for sy := 0; sy < sh; sy++ {
+		if dy := sy * dh / sh; dy != current {
+			flush(current)
+			current = dy
+		}
+		draw.Draw(row, row.Bounds(), src, image.Pt(b.Min.X, b.Min.Y+sy), draw.Src)
+		for sx := 0; sx < sw; sx++ {
+			dx := sx * dw / sw
+			for c := 0; c < 4; c++ {
+				sums[dx*4+c] += uint64(row.Pix[sx*4+c])
+			}
+			counts[dx]++
+		}
+	}
+	flush(current)
+	return dst
+}
+
+// orient turns img the way the EXIF orientation tag asks: 2 to 8 mirror and rotate it, and
+// anything else leaves it as it is
+func orient(img *image.RGBA, orientation int) *image.RGBA {
+	if orientation < 2 || orientation > 8 {
+		return img
+	}
+	w, h := img.Rect.Dx(), img.Rect.Dy()
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // Mirrored
+				dx, dy = w-1-x, y
+			case 3: // Upside down
+				dx, dy = w-1-x, h-1-y
+			case 4: // Mirrored upside down
+				dx, dy = x, h-1-y
+			case 5: // Mirrored across the diagonal from the top left
+				dx, dy = y, x
+			case 6: // Needs a quarter turn clockwise
+				dx, dy = h-1-y, x
+			case 7: // Mirrored across the diagonal from the top right
+				dx, dy = h-1-y, w-1-x
+			case 8: // Needs a quarter turn anticlockwise
+				dx, dy = y, w-1-x
+			}
+			copy(dst.Pix[dy*dst.Stride+dx*4:dy*dst.Stride+dx*4+4], img.Pix[y*img.Stride+x*4:y*img.Stride+x*4+4])
+		}
+	}
+	return dst
+}
+
+// exifOrientation reads the orientation tag from a JPEG's EXIF block. It returns 1, upright,
+// when there is no tag or the data can't be read.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+		marker := data[i+1]
+		if marker == 0xDA || marker == 0xD9 { // The image data starts, so there are no more headers
+			return 1
+		}
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return tiffOrientation(segment[6:])
+		}
+		i += 2 + length
+	}
+	return 1
+}
+
+// tiffOrientation finds tag 0x0112 in the first directory of an EXIF TIFF block
+func tiffOrientation(tiff []byte) int {
+	if len(tiff) < 8 {
+		return 1
+	}
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+	offset := int(order.Uint32(tiff[4:]))
+	if offset < 8 || offset+2 > len(tiff) {
+		return 1
+	}
+	entries := int(order.Uint16(tiff[offset:]))
+	for e := 0; e < entries; e++ {
+		entry := offset + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			return int(order.Uint16(tiff[entry+8:]))
+		}
+	}
+	return 1
+}
@@ -0,0 +1,76 @@
+package mail
+
+import (
+	"log"
+	"time"
+
+	"ellas-corner/internal/repository"
+)
+
+// SendDigests emails each member who wants digests a list of the unread notifications they
+// haven't been emailed about, and returns how many emails were sent. A member whose email
+// fails is tried again next time; the last error is returned once everyone has been tried.
+func SendDigests(store repository.NotificationStore, m Mailer, siteURL string) (int, error) {
+	digests, err := store.FetchPendingDigests()
+	if err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	var lastErr error
+	for _, digest := range digests {
+		msg, err := Render(digest.Email, "digest", DigestData{
+			Username:      digest.Username,
+			SiteURL:       siteURL,
+			Notifications: digest.Notifications,
+		})
+		if err == nil {
+			err = m.Send(msg)
+		}
+		if err != nil {
+			log.Printf("Error sending digest to user %d: %v", digest.UserID, err)
+			lastErr = err
+			continue
+		}
+		sent++
+
+		last := digest.Notifications[len(digest.Notifications)-1].ID
+		if err := store.MarkDigestSent(digest.UserID, last); err != nil {
+			log.Printf("Error marking digest sent for user %d: %v", digest.UserID, err)
+			lastErr = err
+		}
+	}
+	return sent, lastErr
+}
+
+// StartDigestSender sends digests every interval in the background. Call the returned
+// function to stop it; it waits for a send that is under way to finish.
+func StartDigestSender(store repository.NotificationStore, m Mailer, siteURL string, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				sent, err := SendDigests(store, m, siteURL)
+				if err != nil {
+					log.Println("Digest sender: Error sending digests:", err)
+				}
+				if sent > 0 {
+					log.Printf("Digest sender: Sent %d digests", sent)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
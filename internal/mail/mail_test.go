@@ -0,0 +1,183 @@
+package mail_test
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/mail"
+	"ellas-corner/internal/repository"
+)
+
+func TestRenderTemplates(t *testing.T) {
+	msg, err := mail.Render("ella@example.com", "registration", mail.RegistrationData{Username: "Ella <3", SiteURL: "https://ellas.example"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if msg.To != "ella@example.com" || msg.Subject != "Welcome to Ella's Corner, Ella <3" {
+		t.Errorf("unexpected headers: %+v", msg)
+	}
+	// The plain-text body is left alone; the HTML body is escaped
+	if !strings.Contains(msg.Text, "Hi Ella <3,") || !strings.Contains(msg.HTML, "Hi Ella &lt;3,") {
+		t.Errorf("expected the username in both bodies, got %q and %q", msg.Text, msg.HTML)
+	}
+
+	msg, err = mail.Render("ella@example.com", "password_reset", mail.PasswordResetData{Username: "ella", ResetURL: "https://ellas.example/reset?token=abc", ExpiresIn: "1 hour"})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if !strings.Contains(msg.Text, "https://ellas.example/reset?token=abc") || !strings.Contains(msg.HTML, "expires in 1 hour") {
+		t.Errorf("expected the reset link and expiry, got %+v", msg)
+	}
+
+	if _, err := mail.Render("ella@example.com", "no_such_email", nil); err == nil {
+		t.Error("expected an error for a missing template")
+	}
+}
+
+func TestOutboxMailer(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "outbox")
+	outbox, err := mail.NewOutboxMailer(dir, "Ella's Corner <no-reply@example.com>")
+	if err != nil {
+		t.Fatalf("NewOutboxMailer failed: %v", err)
+	}
+	if err := outbox.Send(mail.Message{To: "ella@example.com", Subject: "Hello", Text: "plain", HTML: "<p>rich</p>"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+	if sent := outbox.Sent(); len(sent) != 1 || sent[0].Subject != "Hello" {
+		t.Errorf("expected the message to be kept, got %+v", sent)
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("expected one .eml file, got %v (err %v)", files, err)
+	}
+	email, err := os.ReadFile(files[0])
+	if err != nil {
+		t.Fatalf("ReadFile failed: %v", err)
+	}
+	for _, want := range []string{"To: ella@example.com", "Content-Type: multipart/alternative", "text/plain", "plain", "text/html", "<p>rich</p>"} {
+		if !strings.Contains(string(email), want) {
+			t.Errorf("expected the email to contain %q:\n%s", want, email)
+		}
+	}
+}
+
+// fakeSMTPServer accepts one SMTP conversation and returns the message data it received
+func fakeSMTPServer(t *testing.T) (addr string, received <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	data := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		text := textproto.NewConn(conn)
+		text.PrintfLine("220 localhost ready")
+		for {
+			line, err := text.ReadLine()
+			if err != nil {
+				return
+			}
+			switch command := strings.ToUpper(strings.Fields(line + " ")[0]); command {
+			case "EHLO", "HELO", "MAIL", "RCPT":
+				text.PrintfLine("250 OK")
+			case "DATA":
+				text.PrintfLine("354 Go ahead")
+				body, _ := text.ReadDotBytes()
+				data <- string(body)
+				text.PrintfLine("250 Queued")
+			case "QUIT":
+				text.PrintfLine("221 Bye")
+				return
+			default:
+				text.PrintfLine("502 Not implemented")
+			}
+		}
+	}()
+	return listener.Addr().String(), data
+}
+
+func TestSMTPMailer(t *testing.T) {
+	addr, received := fakeSMTPServer(t)
+	mailer := mail.SMTPMailer{Addr: addr, From: "no-reply@example.com"}
+	if err := mailer.Send(mail.Message{To: "ella@example.com", Subject: "Über", Text: "plain", HTML: "<p>rich</p>"}); err != nil {
+		t.Fatalf("Send failed: %v", err)
+	}
+
+	email := <-received
+	headers, err := textproto.NewReader(bufio.NewReader(strings.NewReader(email))).ReadMIMEHeader()
+	if err != nil {
+		t.Fatalf("could not read the headers: %v", err)
+	}
+	if headers.Get("To") != "ella@example.com" || headers.Get("From") != "no-reply@example.com" {
+		t.Errorf("unexpected headers: %v", headers)
+	}
+	// Non-ASCII subjects are encoded
+	if subject := headers.Get("Subject"); !strings.HasPrefix(subject, "=?utf-8?") {
+		t.Errorf("expected an encoded subject, got %q", subject)
+	}
+}
+
+func TestSendDigests(t *testing.T) {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "digest.db"))
+	if err != nil {
+		t.Fatalf("InitDB failed: %v", err)
+	}
+	t.Cleanup(func() { conn.Conn.Close() })
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("RunMigrations failed: %v", err)
+	}
+	store := repository.NewSQLStore(conn)
+
+	for _, name := range []string{"donor", "asker", "quiet"} {
+		if err := store.CreateUser(name, name+"@example.com", "hash", "1.png"); err != nil {
+			t.Fatalf("CreateUser failed: %v", err)
+		}
+	}
+	if _, err := conn.Conn.Exec("INSERT INTO posts (user_id, title, content, category) VALUES (1, 'Pram', 'Folds flat', 'General'), (3, 'Cot', 'Sturdy', 'General')"); err != nil {
+		t.Fatalf("seeding posts failed: %v", err)
+	}
+	if err := store.UpdateNotificationSettings(3, repository.NotificationTypes, false); err != nil {
+		t.Fatalf("UpdateNotificationSettings failed: %v", err)
+	}
+	for _, postID := range []int{1, 1, 2} {
+		if _, err := store.CreateCommentReturningID(2, postID, "Is it still available?", nil); err != nil {
+			t.Fatalf("CreateCommentReturningID failed: %v", err)
+		}
+	}
+
+	// Only the donor wants digests
+	outbox := &mail.OutboxMailer{}
+	sent, err := mail.SendDigests(store, outbox, "https://ellas.example")
+	if err != nil || sent != 1 {
+		t.Fatalf("expected one digest, got %d (err %v)", sent, err)
+	}
+	msg := outbox.Sent()[0]
+	if msg.To != "donor@example.com" || msg.Subject != "2 new notifications on Ella's Corner" {
+		t.Errorf("unexpected digest: %+v", msg)
+	}
+	if !strings.Contains(msg.Text, `asker commented on your post "Pram"`) {
+		t.Errorf("expected the comment in the digest, got %q", msg.Text)
+	}
+	if !strings.Contains(msg.HTML, `href="https://ellas.example/profile#post-1"`) {
+		t.Errorf("expected the digest to link straight to the post, got %q", msg.HTML)
+	}
+
+	// Each notification is only emailed once
+	if sent, err := mail.SendDigests(store, outbox, "https://ellas.example"); err != nil || sent != 0 {
+		t.Errorf("expected no digests the second time, got %d (err %v)", sent, err)
+	}
+}
@@ -0,0 +1,53 @@
+package mail
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// OutboxMailer keeps every message it is given instead of sending it. When Dir is set each
+// message is also written there as an .eml file, which most mail clients can open.
+type OutboxMailer struct {
+	Dir  string
+	From string
+
+	mu   sync.Mutex
+	sent []Message
+}
+
+// NewOutboxMailer returns an outbox that writes messages to dir, creating it if needed
+func NewOutboxMailer(dir, from string) (*OutboxMailer, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+	return &OutboxMailer{Dir: dir, From: from}, nil
+}
+
+// Send records the message and writes it to the outbox directory
+func (m *OutboxMailer) Send(msg Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	if m.Dir == "" {
+		return nil
+	}
+
+	email, err := msg.encode(m.From)
+	if err != nil {
+		return err
+	}
+	recipient := strings.NewReplacer("@", "_at_", "/", "_", "\\", "_").Replace(msg.To)
+	name := fmt.Sprintf("%s-%03d-%s.eml", time.Now().Format("20060102-150405"), len(m.sent), recipient)
+	return os.WriteFile(filepath.Join(m.Dir, name), email, 0o644)
+}
+
+// Sent returns the messages sent so far, oldest first
+func (m *OutboxMailer) Sent() []Message {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
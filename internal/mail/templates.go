@@ -0,0 +1,61 @@
+package mail
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+
+	"ellas-corner/internal/repository"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// Render builds a message to one recipient from the templates called name.
+// name.txt.tmpl defines the "subject" and holds the plain-text body, and name.html.tmpl
+// defines the "content" of the HTML body, which is wrapped in layout.html.tmpl.
+func Render(to, name string, data interface{}) (Message, error) {
+	text, err := texttemplate.ParseFS(templateFS, "templates/"+name+".txt.tmpl")
+	if err != nil {
+		return Message{}, err
+	}
+	html, err := htmltemplate.ParseFS(templateFS, "templates/layout.html.tmpl", "templates/"+name+".html.tmpl")
+	if err != nil {
+		return Message{}, err
+	}
+
+	var subject, textBody, htmlBody bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := text.Execute(&textBody, data); err != nil {
+		return Message{}, err
+	}
+	if err := html.ExecuteTemplate(&htmlBody, "layout", data); err != nil {
+		return Message{}, err
+	}
+	return Message{To: to, Subject: subject.String(), Text: textBody.String(), HTML: htmlBody.String()}, nil
+}
+
+// RegistrationData fills the "registration" templates, sent when someone joins, and the
+// "verify_email" templates, sent when they ask for a new link
+type RegistrationData struct {
+	Username  string
+	SiteURL   string
+	VerifyURL string
+}
+
+// PasswordResetData fills the "password_reset" templates
+type PasswordResetData struct {
+	Username  string
+	ResetURL  string
+	ExpiresIn string // How long the link works for, such as "1 hour"
+}
+
+// DigestData fills the "digest" templates, a summary of unread notifications
+type DigestData struct {
+	Username      string
+	SiteURL       string
+	Notifications []repository.Notification
+}
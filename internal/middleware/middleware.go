@@ -0,0 +1,17 @@
+// Package middleware wraps the router with the behaviour every request shares: request IDs,
+// request logs, panic recovery and security headers.
+package middleware
+
+import "net/http"
+
+// Middleware wraps a handler with extra behaviour
+type Middleware func(http.Handler) http.Handler
+
+// Chain wraps h in middlewares. The first one listed is the outermost, so it sees the request
+// first and the response last.
+func Chain(h http.Handler, middlewares ...Middleware) http.Handler {
+	for i := len(middlewares) - 1; i >= 0; i-- {
+		h = middlewares[i](h)
+	}
+	return h
+}
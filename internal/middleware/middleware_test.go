@@ -0,0 +1,142 @@
+package middleware_test
+
+import (
+	"bytes"
+	"crypto/tls"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/middleware"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/utils"
+)
+
+func TestChainOrder(t *testing.T) {
+	var order []string
+	tag := func(name string) middleware.Middleware {
+		return func(next http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				next.ServeHTTP(w, r)
+			})
+		}
+	}
+	h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		order = append(order, "handler")
+	}), tag("first"), tag("second"))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	if strings.Join(order, ",") != "first,second,handler" {
+		t.Errorf("expected middlewares to run in the order listed, got %v", order)
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	h := middleware.RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = middleware.RequestIDFrom(r.Context())
+	}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if seen == "" || rr.Header().Get(middleware.RequestIDHeader) != seen {
+		t.Fatalf("expected a generated ID in the context and the response, got %q and %q", seen, rr.Header().Get(middleware.RequestIDHeader))
+	}
+
+	// IDs from a proxy are kept when they are safe to log, and replaced otherwise
+	for id, keep := range map[string]bool{"abc-123": true, "bad id\nwith newline": false} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.Header.Set(middleware.RequestIDHeader, id)
+		h.ServeHTTP(httptest.NewRecorder(), req)
+		if (seen == id) != keep {
+			t.Errorf("request ID %q: expected kept=%v, got %q", id, keep, seen)
+		}
+	}
+}
+
+func TestRecover(t *testing.T) {
+	h := middleware.Recover(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("something broke")
+	}))
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	if rr.Code != http.StatusInternalServerError {
+		t.Errorf("expected a panic to become a 500, got %d", rr.Code)
+	}
+}
+
+func TestSecurityHeaders(t *testing.T) {
+	h := middleware.SecurityHeaders(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	for _, header := range []string{"Content-Security-Policy", "X-Frame-Options", "X-Content-Type-Options", "Referrer-Policy"} {
+		if rr.Header().Get(header) == "" {
+			t.Errorf("expected %s to be set", header)
+		}
+	}
+	if rr.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("expected no HSTS over plain HTTP")
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, req)
+	if rr.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("expected HSTS over TLS")
+	}
+}
+
+func TestSecurityHeadersWithImagesFrom(t *testing.T) {
+	h := middleware.SecurityHeadersWithImagesFrom("https://ellas.s3.amazonaws.com")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rr := httptest.NewRecorder()
+	h.ServeHTTP(rr, httptest.NewRequest(http.MethodGet, "/", nil))
+	policy := rr.Header().Get("Content-Security-Policy")
+	if !strings.Contains(policy, "img-src 'self' data: https://ellas.s3.amazonaws.com;") || !strings.Contains(policy, "frame-ancestors 'none'") {
+		t.Errorf("expected the bucket to be added to img-src only, got %q", policy)
+	}
+}
+
+func TestLogger(t *testing.T) {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatalf("Failed to initialize test DB: %v", err)
+	}
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("Failed to run migrations: %v", err)
+	}
+	store := repository.NewSQLStore(conn)
+	if err := store.CreateUser("ella", "ella@example.com", "hash", "1.png"); err != nil {
+		t.Fatalf("Failed to create user: %v", err)
+	}
+	if err := store.CreateSession(1, utils.HashToken("ella-session"), "Laptop", "127.0.0.1", time.Now().Add(time.Hour)); err != nil {
+		t.Fatalf("Failed to create session: %v", err)
+	}
+
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, nil))
+	h := middleware.Chain(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		utils.GetSessionUser(store, r)
+		http.Error(w, "Post not found", http.StatusNotFound)
+	}), middleware.RequestID, middleware.Logger(logger))
+
+	req := httptest.NewRequest(http.MethodGet, "/posts/9", nil)
+	req.AddCookie(&http.Cookie{Name: utils.SessionCookieName, Value: "ella-session"})
+	req.Header.Set(middleware.RequestIDHeader, "req-1")
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	line := logs.String()
+	for _, want := range []string{"msg=request", "request_id=req-1", "method=GET", "path=/posts/9", "status=404", "user_id=1", "duration="} {
+		if !strings.Contains(line, want) {
+			t.Errorf("expected %q in the request log, got %q", want, line)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"log"
+	"net/http"
+	"runtime/debug"
+
+	"ellas-corner/internal/utils"
+)
+
+// Recover turns a panic in a handler into the 500 page, logging it with the request ID and a
+// stack trace, instead of dropping the connection
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			err := recover()
+			if err == nil {
+				return
+			}
+			// The server uses this panic to abort a response on purpose
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			log.Printf("Recover: panic serving %s %s (request %s): %v\n%s", r.Method, r.URL.Path, RequestIDFrom(r.Context()), err, debug.Stack())
+			utils.RenderServerErrorPage(w)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,45 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+)
+
+// CreateAPIToken stores the hash of a new API token for the user and returns its ID
+func (store *SQLStore) CreateAPIToken(userID int, tokenHash, name string) (int64, error) {
+	query := "INSERT INTO api_tokens (user_id, token_hash, name) VALUES (?, ?, ?)"
+	result, err := store.db.Conn.Exec(query, userID, tokenHash, name)
+	if err != nil {
+		log.Println("Error creating API token:", err)
+		return 0, err
+	}
+	return result.LastInsertId()
+}
+
+// GetUserIDByAPIToken returns the user that owns the token hash (0 if none) and records when it was last used
+func (store *SQLStore) GetUserIDByAPIToken(tokenHash string) (int, error) {
+	var userID int
+	query := "SELECT user_id FROM api_tokens WHERE token_hash = ?"
+	err := store.db.Conn.QueryRow(query, tokenHash).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	} else if err != nil {
+		log.Println("Error retrieving user ID by API token:", err)
+		return 0, err
+	}
+
+	_, err = store.db.Conn.Exec("UPDATE api_tokens SET last_used_at = CURRENT_TIMESTAMP WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		log.Println("Error updating API token last use:", err)
+	}
+	return userID, nil
+}
+
+// DeleteAPIToken revokes an API token by its hash
+func (store *SQLStore) DeleteAPIToken(tokenHash string) error {
+	_, err := store.db.Conn.Exec("DELETE FROM api_tokens WHERE token_hash = ?", tokenHash)
+	if err != nil {
+		log.Println("Error deleting API token:", err)
+	}
+	return err
+}
@@ -0,0 +1,224 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strconv"
+)
+
+var (
+	// ErrCategoryExists is returned when another category already has the name or slug
+	ErrCategoryExists = errors.New("a category with this name or slug already exists")
+	// ErrCategoryInUse is returned when deleting a category that still has posts, without
+	// saying where they should go
+	ErrCategoryInUse = errors.New("category still has posts")
+)
+
+// Category is an age or stage that posts are filed under, such as Newborn or Parents
+type Category struct {
+	ID           int
+	Slug         string
+	Name         string
+	SortOrder    int
+	MinAgeMonths *int // nil when there's no lower limit, or the category isn't about an age
+	MaxAgeMonths *int // nil when there's no upper limit
+	Description  string
+	Posts        int // How many posts are filed under it
+}
+
+// AgeRange describes the ages the category is for, such as "3–6 months" or "12 months and
+// up", or is empty when it has no age range
+func (c Category) AgeRange() string {
+	switch {
+	case c.MinAgeMonths != nil && c.MaxAgeMonths != nil:
+		return strconv.Itoa(*c.MinAgeMonths) + "–" + strconv.Itoa(*c.MaxAgeMonths) + " months"
+	case c.MinAgeMonths != nil:
+		return strconv.Itoa(*c.MinAgeMonths) + " months and up"
+	case c.MaxAgeMonths != nil:
+		return "up to " + strconv.Itoa(*c.MaxAgeMonths) + " months"
+	}
+	return ""
+}
+
+const categoryColumns = `
+	categories.id, categories.slug, categories.name, categories.sort_order,
+	categories.min_age_months, categories.max_age_months, categories.description,
+	(SELECT COUNT(*) FROM posts WHERE posts.category = categories.name)`
+
+// scanCategory reads a row selected with categoryColumns
+func scanCategory(row interface{ Scan(...interface{}) error }) (Category, error) {
+	var c Category
+	var minAge, maxAge sql.NullInt64
+	err := row.Scan(&c.ID, &c.Slug, &c.Name, &c.SortOrder, &minAge, &maxAge, &c.Description, &c.Posts)
+	if minAge.Valid {
+		months := int(minAge.Int64)
+		c.MinAgeMonths = &months
+	}
+	if maxAge.Valid {
+		months := int(maxAge.Int64)
+		c.MaxAgeMonths = &months
+	}
+	return c, err
+}
+
+// FetchCategories lists every category in the order they are offered on forms
+func (store *SQLStore) FetchCategories() ([]Category, error) {
+	rows, err := store.db.Conn.Query(`SELECT ` + categoryColumns + ` FROM categories ORDER BY sort_order, name`)
+	if err != nil {
+		log.Println("Error fetching categories from DB:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []Category
+	for rows.Next() {
+		category, err := scanCategory(rows)
+		if err != nil {
+			log.Println("Error scanning category row:", err)
+			return nil, err
+		}
+		categories = append(categories, category)
+	}
+	return categories, rows.Err()
+}
+
+// GetCategory returns a category by ID, or sql.ErrNoRows
+func (store *SQLStore) GetCategory(categoryID int) (*Category, error) {
+	category, err := scanCategory(store.db.Conn.QueryRow(`SELECT `+categoryColumns+` FROM categories WHERE id = ?`, categoryID))
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// FindCategory returns the category with this name or slug, ignoring case, or sql.ErrNoRows
+func (store *SQLStore) FindCategory(nameOrSlug string) (*Category, error) {
+	category, err := scanCategory(store.db.Conn.QueryRow(`SELECT `+categoryColumns+` FROM categories WHERE name = ? OR slug = ?`,
+		nameOrSlug, nameOrSlug))
+	if err != nil {
+		return nil, err
+	}
+	return &category, nil
+}
+
+// nullableMonths stores a missing age limit as NULL
+func nullableMonths(months *int) sql.NullInt64 {
+	if months == nil {
+		return sql.NullInt64{}
+	}
+	return sql.NullInt64{Int64: int64(*months), Valid: true}
+}
+
+// checkCategoryUnique returns ErrCategoryExists if a category other than c has its name or slug
+func checkCategoryUnique(tx *sql.Tx, c Category) error {
+	var taken int
+	err := tx.QueryRow("SELECT COUNT(*) FROM categories WHERE (name = ? OR slug = ?) AND id != ?", c.Name, c.Slug, c.ID).Scan(&taken)
+	if err != nil {
+		return err
+	}
+	if taken > 0 {
+		return ErrCategoryExists
+	}
+	return nil
+}
+
+// CreateCategory adds a category and returns its ID, or ErrCategoryExists
+func (store *SQLStore) CreateCategory(c Category) (int, error) {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	c.ID = 0
+	if err := checkCategoryUnique(tx, c); err != nil {
+		return 0, err
+	}
+	result, err := tx.Exec(`
+		INSERT INTO categories (slug, name, sort_order, min_age_months, max_age_months, description)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		c.Slug, c.Name, c.SortOrder, nullableMonths(c.MinAgeMonths), nullableMonths(c.MaxAgeMonths), c.Description)
+	if err != nil {
+		log.Println("Error creating category:", err)
+		return 0, err
+	}
+	categoryID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	return int(categoryID), tx.Commit()
+}
+
+// UpdateCategory saves changes to a category. A new name is given to its posts as well.
+// Returns sql.ErrNoRows if there's no such category, or ErrCategoryExists.
+func (store *SQLStore) UpdateCategory(c Category) error {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldName string
+	if err := tx.QueryRow("SELECT name FROM categories WHERE id = ?", c.ID).Scan(&oldName); err != nil {
+		return err
+	}
+	if err := checkCategoryUnique(tx, c); err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE categories
+		SET slug = ?, name = ?, sort_order = ?, min_age_months = ?, max_age_months = ?, description = ?
+		WHERE id = ?`,
+		c.Slug, c.Name, c.SortOrder, nullableMonths(c.MinAgeMonths), nullableMonths(c.MaxAgeMonths), c.Description, c.ID)
+	if err != nil {
+		log.Println("Error updating category:", err)
+		return err
+	}
+	if oldName != c.Name {
+		if _, err := tx.Exec("UPDATE posts SET category = ? WHERE category = ?", c.Name, oldName); err != nil {
+			log.Println("Error renaming category on posts:", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// DeleteCategory removes a category. Its posts move to the category moveToID, which lets an
+// admin merge a duplicate into another; with moveToID 0 a category that still has posts is
+// kept and ErrCategoryInUse returned. Returns sql.ErrNoRows if either category doesn't exist.
+func (store *SQLStore) DeleteCategory(categoryID, moveToID int) error {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var name string
+	var posts int
+	err = tx.QueryRow("SELECT name, (SELECT COUNT(*) FROM posts WHERE posts.category = categories.name) FROM categories WHERE id = ?",
+		categoryID).Scan(&name, &posts)
+	if err != nil {
+		return err
+	}
+
+	if posts > 0 {
+		if moveToID == 0 || moveToID == categoryID {
+			return ErrCategoryInUse
+		}
+		var moveTo string
+		if err := tx.QueryRow("SELECT name FROM categories WHERE id = ?", moveToID).Scan(&moveTo); err != nil {
+			return err
+		}
+		if _, err := tx.Exec("UPDATE posts SET category = ? WHERE category = ?", moveTo, name); err != nil {
+			log.Println("Error moving posts to another category:", err)
+			return err
+		}
+	}
+
+	if _, err := tx.Exec("DELETE FROM categories WHERE id = ?", categoryID); err != nil {
+		log.Println("Error deleting category:", err)
+		return err
+	}
+	return tx.Commit()
+}
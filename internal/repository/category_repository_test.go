@@ -0,0 +1,151 @@
+package repository_test
+
+import (
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/repository"
+	"ellas-corner/migrations"
+)
+
+func TestCategories(t *testing.T) {
+	t.Parallel()
+	store, conn := seedFeed(t, 2, 2, 0)
+
+	categories, err := store.FetchCategories()
+	if err != nil {
+		t.Fatalf("FetchCategories failed: %v", err)
+	}
+	if len(categories) == 0 || categories[0].Name != "Newborn" || categories[0].AgeRange() != "0–3 months" {
+		t.Fatalf("expected the seeded categories in order starting with Newborn, got %+v", categories)
+	}
+	for _, c := range categories {
+		if c.Name == "General" && c.Posts != 2 {
+			t.Errorf("expected General to count its 2 posts, got %d", c.Posts)
+		}
+	}
+
+	// Posts can be filed by name or slug, ignoring case
+	found, err := store.FindCategory("OVER-12-months")
+	if err != nil || found.Name != "Over 12 months" || found.AgeRange() != "12 months and up" {
+		t.Errorf("expected to find Over 12 months by its slug, got %+v, %v", found, err)
+	}
+	if _, err := store.FindCategory("Sleep"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows for an unknown category, got %v", err)
+	}
+
+	six := 6
+	sleepID, err := store.CreateCategory(repository.Category{Slug: "sleep", Name: "Sleep", SortOrder: 5, MaxAgeMonths: &six})
+	if err != nil {
+		t.Fatalf("CreateCategory failed: %v", err)
+	}
+	if _, err := store.CreateCategory(repository.Category{Slug: "naps", Name: "sleep"}); !errors.Is(err, repository.ErrCategoryExists) {
+		t.Errorf("expected ErrCategoryExists for a name differing only by case, got %v", err)
+	}
+	if _, err := store.CreateCategory(repository.Category{Slug: "newborn", Name: "Tiny"}); !errors.Is(err, repository.ErrCategoryExists) {
+		t.Errorf("expected ErrCategoryExists for a taken slug, got %v", err)
+	}
+
+	// Renaming a category renames it on its posts, and the filter finds them by slug
+	if _, err := conn.Conn.Exec("UPDATE posts SET category = 'Sleep' WHERE id = 1"); err != nil {
+		t.Fatalf("failed to file a post under Sleep: %v", err)
+	}
+	sleep, err := store.GetCategory(sleepID)
+	if err != nil || sleep.AgeRange() != "up to 6 months" || sleep.Posts != 1 {
+		t.Fatalf("GetCategory returned %+v, %v", sleep, err)
+	}
+	sleep.Name, sleep.Slug = "Sleeping", "sleeping"
+	if err := store.UpdateCategory(*sleep); err != nil {
+		t.Fatalf("UpdateCategory failed: %v", err)
+	}
+	posts, err := store.FetchPostsByQuery(repository.PostQuery{Categories: []string{"sleeping"}})
+	if err != nil || len(posts) != 1 || posts[0].Category != "Sleeping" {
+		t.Errorf("expected the renamed category on its post and found by slug, got %+v, %v", posts, err)
+	}
+	sleep.Name = "Newborn"
+	if err := store.UpdateCategory(*sleep); !errors.Is(err, repository.ErrCategoryExists) {
+		t.Errorf("expected ErrCategoryExists renaming onto another category, got %v", err)
+	}
+	if err := store.UpdateCategory(repository.Category{ID: 999, Slug: "gone", Name: "Gone"}); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected sql.ErrNoRows updating a missing category, got %v", err)
+	}
+
+	// A category with posts is only removed once they have somewhere to go
+	if err := store.DeleteCategory(sleepID, 0); !errors.Is(err, repository.ErrCategoryInUse) {
+		t.Errorf("expected ErrCategoryInUse, got %v", err)
+	}
+	general, err := store.FindCategory("general")
+	if err != nil {
+		t.Fatalf("FindCategory failed: %v", err)
+	}
+	if err := store.DeleteCategory(sleepID, general.ID); err != nil {
+		t.Fatalf("DeleteCategory failed: %v", err)
+	}
+	if _, err := store.GetCategory(sleepID); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("expected the category to be gone, got %v", err)
+	}
+	if general, _ = store.GetCategory(general.ID); general.Posts != 2 {
+		t.Errorf("expected the post to move to General, which now has %d", general.Posts)
+	}
+}
+
+func TestCategoryMigrationFilesFreeText(t *testing.T) {
+	t.Parallel()
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "categories.db"))
+	if err != nil {
+		t.Fatalf("failed to open test DB: %v", err)
+	}
+	defer conn.Conn.Close()
+
+	all, err := db.LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("LoadMigrations failed: %v", err)
+	}
+	var before []db.Migration
+	for _, m := range all {
+		if m.Version < 13 {
+			before = append(before, m)
+		}
+	}
+	if _, err := conn.MigrateUp(before); err != nil {
+		t.Fatalf("MigrateUp to before categories failed: %v", err)
+	}
+
+	// What the form and the API let through before categories were managed
+	free := []string{"Newborn", "newborn ", "3–6 months", "over-12-months", "", "Sleep", "sleep", "Baby's health"}
+	for i, category := range free {
+		if _, err := conn.Conn.Exec("INSERT INTO posts (user_id, title, content, category) VALUES (1, ?, 'content', ?)",
+			"Post "+strconv.Itoa(i), category); err != nil {
+			t.Fatalf("failed to insert post: %v", err)
+		}
+	}
+	if _, err := conn.MigrateUp(all); err != nil {
+		t.Fatalf("MigrateUp failed: %v", err)
+	}
+
+	want := []string{"Newborn", "Newborn", "3-6 months", "Over 12 months", "General", "Sleep", "Sleep", "Baby's health"}
+	for i, category := range want {
+		var got string
+		if err := conn.Conn.QueryRow("SELECT category FROM posts WHERE title = ?", "Post "+strconv.Itoa(i)).Scan(&got); err != nil {
+			t.Fatalf("failed to read post: %v", err)
+		}
+		if got != category {
+			t.Errorf("%q: expected to be filed under %q, got %q", free[i], category, got)
+		}
+	}
+
+	store := repository.NewSQLStore(conn)
+	for _, name := range []string{"Sleep", "Baby's health"} {
+		if _, err := store.FindCategory(name); err != nil {
+			t.Errorf("expected %q to become a category, got %v", name, err)
+		}
+	}
+	var orphans int
+	if err := conn.Conn.QueryRow("SELECT COUNT(*) FROM posts WHERE category NOT IN (SELECT name FROM categories)").Scan(&orphans); err != nil || orphans != 0 {
+		t.Errorf("expected every post to be in a category, %d aren't (%v)", orphans, err)
+	}
+}
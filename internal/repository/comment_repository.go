@@ -2,11 +2,20 @@ package repository
 
 import (
 	"database/sql"
+	"errors"
 	"log"
 	"strconv"
+	"strings"
 	"time"
 )
 
+// MaxCommentDepth is how deeply replies can nest under a top-level comment (which is depth 0).
+// Replies to a comment already at this depth are attached to its parent instead, so long
+// back-and-forth threads stay readable.
+const MaxCommentDepth = 3
+
+var ErrInvalidParentComment = errors.New("parent comment does not exist on this post")
+
 type Comment struct {
 	ID                 int
 	PostID             int
@@ -21,62 +30,233 @@ type Comment struct {
 	Dislikes           int
 	UserReaction       string
 	ParentCommentID    *int
+	Replies            []Comment
+	Depth              int
+	ReplyCount         int  // Total number of replies in this comment's branch
+	CanReply           bool // Set when the viewer is logged in
+	Hidden             bool // Hidden by a moderator
 }
 
-// FetchCommentsForPost retrieves comments for a specific post, including the user's profile picture and their reaction if logged in.
-func FetchCommentsForPost(postID int, userID int) ([]Comment, error) {
-	query := `
-		SELECT comments.id, comments.post_id, comments.user_id, comments.content, comments.created_at, users.username, users.profile_picture
-		FROM comments
-		JOIN users ON comments.user_id = users.id
-		WHERE comments.post_id = ?
-		ORDER BY comments.created_at ASC`
-
-	rows, err := database.Conn.Query(query, postID)
+// FetchCommentsForPost retrieves comments for a specific post as a reply tree, including the user's profile picture and their reaction if logged in.
+// Top-level comments are returned in order, with replies nested under their parent comment.
+func (store *SQLStore) FetchCommentsForPost(postID int, userID int) ([]Comment, error) {
+	comments, err := store.FetchCommentsForPosts([]int{postID}, userID)
 	if err != nil {
-		log.Println("Error fetching comments for post:", err)
 		return nil, err
 	}
-	defer rows.Close()
+	return comments[postID], nil
+}
 
-	var comments []Comment
-	for rows.Next() {
-		var comment Comment
-		if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Content, &comment.CreatedAt, &comment.Username, &comment.ProfilePicture); err != nil {
-			log.Println("Error scanning comment:", err)
-			return nil, err
+// commentBatchSize caps how many post IDs go into one IN (...) list, keeping well under
+// SQLite's limit on bound parameters
+const commentBatchSize = 500
+
+// FetchCommentsForPosts loads the comment trees for many posts at once, keyed by post ID.
+// Reaction counts and the user's own reactions are joined in, so a whole feed's comments
+// take one query per commentBatchSize posts rather than several queries per comment.
+func (store *SQLStore) FetchCommentsForPosts(postIDs []int, userID int) (map[int][]Comment, error) {
+	flat := make(map[int][]Comment, len(postIDs))
+
+	for start := 0; start < len(postIDs); start += commentBatchSize {
+		end := start + commentBatchSize
+		if end > len(postIDs) {
+			end = len(postIDs)
+		}
+		batch := postIDs[start:end]
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+		query := `
+			SELECT comments.id, comments.post_id, comments.user_id, comments.parent_comment_id, comments.content, comments.created_at,
+			       users.username, users.profile_picture,
+			       COALESCE(reaction_counts.likes, 0), COALESCE(reaction_counts.dislikes, 0),
+			       COALESCE(viewer_reaction.reaction_type, ''),
+			       comments.hidden_at IS NOT NULL
+			FROM comments
+			JOIN users ON comments.user_id = users.id
+			LEFT JOIN (
+				SELECT comment_id,
+				       SUM(CASE WHEN reaction_type = 'like' THEN 1 ELSE 0 END) AS likes,
+				       SUM(CASE WHEN reaction_type = 'dislike' THEN 1 ELSE 0 END) AS dislikes
+				FROM comment_reactions
+				GROUP BY comment_id
+			) AS reaction_counts ON reaction_counts.comment_id = comments.id
+			LEFT JOIN comment_reactions AS viewer_reaction
+			       ON viewer_reaction.comment_id = comments.id AND viewer_reaction.user_id = ?
+			WHERE comments.post_id IN (` + placeholders + `)
+			ORDER BY comments.created_at ASC, comments.id ASC`
+
+		args := make([]interface{}, 0, len(batch)+1)
+		args = append(args, userID)
+		for _, id := range batch {
+			args = append(args, id)
 		}
 
-		// Parse and format the CreatedAt string
-		parsedTime, err := time.Parse(time.RFC3339, comment.CreatedAt)
+		rows, err := store.db.Conn.Query(query, args...)
 		if err != nil {
-			log.Println("Error parsing CreatedAt for comment:", comment.ID, ":", err)
-			comment.FormattedCreatedAt = comment.CreatedAt
+			log.Println("Error fetching comments for posts:", err)
+			return nil, err
+		}
+
+		for rows.Next() {
+			var comment Comment
+			var parentID sql.NullInt64
+			if err := rows.Scan(&comment.ID, &comment.PostID, &comment.UserID, &parentID, &comment.Content, &comment.CreatedAt,
+				&comment.Username, &comment.ProfilePicture, &comment.Likes, &comment.Dislikes, &comment.UserReaction, &comment.Hidden); err != nil {
+				rows.Close()
+				log.Println("Error scanning comment:", err)
+				return nil, err
+			}
+			if parentID.Valid {
+				id := int(parentID.Int64)
+				comment.ParentCommentID = &id
+			}
+
+			// Parse and format the CreatedAt string
+			parsedTime, err := time.Parse(time.RFC3339, comment.CreatedAt)
+			if err != nil {
+				log.Println("Error parsing CreatedAt for comment:", comment.ID, ":", err)
+				comment.FormattedCreatedAt = comment.CreatedAt
+			} else {
+				comment.FormattedCreatedAt = parsedTime.Format("02 Jan 2006, 15:04")
+			}
+
+			comment.CanReply = userID != 0
+			flat[comment.PostID] = append(flat[comment.PostID], comment)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, err
+		}
+	}
+
+	trees := make(map[int][]Comment, len(flat))
+	for postID, comments := range flat {
+		trees[postID] = BuildCommentTree(withoutHiddenComments(comments))
+	}
+	return trees, nil
+}
+
+// withoutHiddenComments drops comments hidden by moderators along with every reply beneath
+// them. Comments are in creation order, so a parent is always seen before its replies.
+func withoutHiddenComments(flat []Comment) []Comment {
+	hidden := map[int]bool{}
+	visible := make([]Comment, 0, len(flat))
+	for _, c := range flat {
+		if c.Hidden || (c.ParentCommentID != nil && hidden[*c.ParentCommentID]) {
+			hidden[c.ID] = true
+			continue
+		}
+		visible = append(visible, c)
+	}
+	return visible
+}
+
+// BuildCommentTree nests a flat, chronologically ordered list of comments under their parents.
+// Comments whose parent no longer exists or belongs to another post are shown as top-level
+// comments, and anything nested deeper than MaxCommentDepth is lifted up to sit alongside its
+// ancestor at that depth. Replies that form a cycle have no top-level ancestor, so the
+// earliest of them is shown at the top level and the problem is logged.
+func BuildCommentTree(flat []Comment) []Comment {
+	index := make(map[int]int, len(flat))
+	for i, c := range flat {
+		index[c.ID] = i
+	}
+
+	children := map[int][]int{}
+	var roots []int
+	for i, c := range flat {
+		parent, ok := 0, false
+		if c.ParentCommentID != nil && *c.ParentCommentID != c.ID {
+			parent, ok = index[*c.ParentCommentID]
+		}
+		if ok && flat[parent].PostID == c.PostID {
+			children[flat[parent].ID] = append(children[flat[parent].ID], i)
 		} else {
-			comment.FormattedCreatedAt = parsedTime.Format("02 Jan 2006, 15:04")
+			roots = append(roots, i)
 		}
+	}
 
-		// Fetch likes and dislikes
-		likes, dislikes, err := FetchCommentReactionsCount(comment.ID)
-		if err == nil {
-			comment.Likes = likes
-			comment.Dislikes = dislikes
+	// build returns the comment at index i with its replies attached. At the maximum depth
+	// the comment's descendants are returned after it as siblings instead of being nested.
+	visited := make([]bool, len(flat))
+	var build func(i, depth int) []Comment
+	build = func(i, depth int) []Comment {
+		if visited[i] {
+			return nil
 		}
+		visited[i] = true
+		comment := flat[i]
+		comment.Depth = depth
+		comment.Replies = nil
+		comment.ReplyCount = 0
 
-		// Fetch user's reaction if logged in
-		if userID != 0 {
-			reaction, err := FetchUserCommentReaction(userID, comment.ID)
-			if err == nil {
-				comment.UserReaction = reaction
+		if depth >= MaxCommentDepth {
+			result := []Comment{comment}
+			for _, child := range children[comment.ID] {
+				result = append(result, build(child, depth)...)
 			}
+			return result
+		}
+
+		for _, child := range children[comment.ID] {
+			comment.Replies = append(comment.Replies, build(child, depth+1)...)
 		}
+		for _, reply := range comment.Replies {
+			comment.ReplyCount += 1 + reply.ReplyCount
+		}
+		return []Comment{comment}
+	}
+
+	var tree []Comment
+	for _, i := range roots {
+		tree = append(tree, build(i, 0)...)
+	}
+	for i, c := range flat {
+		if !visited[i] {
+			log.Printf("Comment %d on post %d is part of a reply cycle, showing it as a top-level comment", c.ID, c.PostID)
+			tree = append(tree, build(i, 0)...)
+		}
+	}
+	return tree
+}
 
-		comments = append(comments, comment)
+// CountComments returns the number of comments in a reply tree, including all nested replies
+func CountComments(comments []Comment) int {
+	total := 0
+	for _, c := range comments {
+		total += 1 + c.ReplyCount
 	}
-	return comments, nil
+	return total
 }
 
-func CreateComment(userID int, postIDStr string, content string) error {
+// commentDepth returns how many ancestors a comment has, and the post it belongs to
+func (store *SQLStore) commentDepth(commentID int) (depth int, postID int, err error) {
+	query := `
+		WITH RECURSIVE ancestors(id, parent_comment_id, depth) AS (
+			SELECT id, parent_comment_id, 0 FROM comments WHERE id = ?
+			UNION ALL
+			SELECT comments.id, comments.parent_comment_id, ancestors.depth + 1
+			FROM comments
+			JOIN ancestors ON comments.id = ancestors.parent_comment_id
+			WHERE ancestors.depth < 100
+		)
+		SELECT MAX(depth), (SELECT post_id FROM comments WHERE id = ?) FROM ancestors`
+
+	var maxDepth, post sql.NullInt64
+	err = store.db.Conn.QueryRow(query, commentID, commentID).Scan(&maxDepth, &post)
+	if err != nil {
+		return 0, 0, err
+	}
+	if !maxDepth.Valid || !post.Valid {
+		return 0, 0, sql.ErrNoRows
+	}
+	return int(maxDepth.Int64), int(post.Int64), nil
+}
+
+// CreateComment adds a comment to a post. When parentCommentID is set the comment is a reply;
+// the parent must belong to the same post, and replies beyond MaxCommentDepth are attached
+// to the parent's own parent instead.
+func (store *SQLStore) CreateComment(userID int, postIDStr string, content string, parentCommentID *int) error {
 	// Convert postIDStr to an integer
 	postID, err := strconv.Atoi(postIDStr)
 	if err != nil {
@@ -84,27 +264,61 @@ func CreateComment(userID int, postIDStr string, content string) error {
 		return err
 	}
 
+	_, err = store.CreateCommentReturningID(userID, postID, content, parentCommentID)
+	return err
+}
+
+// CreateCommentReturningID inserts a comment or reply and returns the new comment's ID
+func (store *SQLStore) CreateCommentReturningID(userID int, postID int, content string, parentCommentID *int) (int, error) {
+	var parentID sql.NullInt64
+	if parentCommentID != nil {
+		depth, parentPostID, err := store.commentDepth(*parentCommentID)
+		if err == sql.ErrNoRows || (err == nil && parentPostID != postID) {
+			return 0, ErrInvalidParentComment
+		} else if err != nil {
+			log.Println("Error looking up parent comment:", err)
+			return 0, err
+		}
+
+		parentID = sql.NullInt64{Int64: int64(*parentCommentID), Valid: true}
+		if depth >= MaxCommentDepth {
+			query := "SELECT parent_comment_id FROM comments WHERE id = ?"
+			if err := store.db.Conn.QueryRow(query, *parentCommentID).Scan(&parentID); err != nil {
+				log.Println("Error looking up grandparent comment:", err)
+				return 0, err
+			}
+		}
+	}
+
 	// Insert the comment into the database
-	query := "INSERT INTO comments (user_id, post_id, content) VALUES (?, ?, ?)"
-	_, err = database.Conn.Exec(query, userID, postID, content)
+	query := "INSERT INTO comments (user_id, post_id, parent_comment_id, content) VALUES (?, ?, ?, ?)"
+	result, err := store.db.Conn.Exec(query, userID, postID, parentID, content)
 	if err != nil {
 		log.Println("Error creating comment:", err)
-		return err
+		return 0, err
 	}
-	return nil
+	commentID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	store.notifyComment(userID, postID, parentID)
+	return int(commentID), nil
 }
 
-func AddCommentReaction(userID int, commentID int, reactionType string) error {
+func (store *SQLStore) AddCommentReaction(userID int, commentID int, reactionType string) error {
 	// First, check if the user already reacted to this comment
 	query := `SELECT reaction_type FROM comment_reactions WHERE comment_id = ? AND user_id = ?`
 	var existingReaction string
-	err := database.Conn.QueryRow(query, commentID, userID).Scan(&existingReaction)
+	err := store.db.Conn.QueryRow(query, commentID, userID).Scan(&existingReaction)
 
 	if err == sql.ErrNoRows {
 		// No previous reaction, insert a new one
 		insertQuery := `INSERT INTO comment_reactions (comment_id, user_id, reaction_type) VALUES (?, ?, ?)`
-		_, err := database.Conn.Exec(insertQuery, commentID, userID, reactionType)
-		return err
+		if _, err := store.db.Conn.Exec(insertQuery, commentID, userID, reactionType); err != nil {
+			return err
+		}
+		store.notifyCommentReaction(userID, commentID, reactionType)
+		return nil
 	} else if err != nil {
 		return err
 	}
@@ -112,31 +326,33 @@ func AddCommentReaction(userID int, commentID int, reactionType string) error {
 	// If the user has already reacted, update the reaction
 	if existingReaction != reactionType {
 		updateQuery := `UPDATE comment_reactions SET reaction_type = ? WHERE comment_id = ? AND user_id = ?`
-		_, err = database.Conn.Exec(updateQuery, reactionType, commentID, userID)
-		return err
+		if _, err = store.db.Conn.Exec(updateQuery, reactionType, commentID, userID); err != nil {
+			return err
+		}
+		store.notifyCommentReaction(userID, commentID, reactionType)
 	}
 
 	// If the user has already reacted with the same type, no action is needed
 	return nil
 }
 
-func FetchCommentReactionsCount(commentID int) (likes int, dislikes int, err error) {
+func (store *SQLStore) FetchCommentReactionsCount(commentID int) (likes int, dislikes int, err error) {
 	query := `
 		SELECT 
 			COALESCE(SUM(CASE WHEN reaction_type = 'like' THEN 1 ELSE 0 END), 0) AS likes,
 			COALESCE(SUM(CASE WHEN reaction_type = 'dislike' THEN 1 ELSE 0 END), 0) AS dislikes
 		FROM comment_reactions WHERE comment_id = ?`
-	err = database.Conn.QueryRow(query, commentID).Scan(&likes, &dislikes)
+	err = store.db.Conn.QueryRow(query, commentID).Scan(&likes, &dislikes)
 	return likes, dislikes, err
 }
 
 // FetchUserCommentReaction retrieves the reaction ("like" or "dislike") for a specific comment by a specific user
-func FetchUserCommentReaction(userID int, commentID int) (string, error) {
+func (store *SQLStore) FetchUserCommentReaction(userID int, commentID int) (string, error) {
 	var reaction string
 
 	query := `SELECT reaction_type FROM comment_reactions WHERE user_id = ? AND comment_id = ?`
 
-	err := database.Conn.QueryRow(query, userID, commentID).Scan(&reaction)
+	err := store.db.Conn.QueryRow(query, userID, commentID).Scan(&reaction)
 	if err == sql.ErrNoRows {
 		// No reaction found, return an empty string
 		return "", nil
@@ -147,11 +363,75 @@ func FetchUserCommentReaction(userID int, commentID int) (string, error) {
 	return reaction, nil
 }
 
-func DeleteComment(commentID int) error {
+func (store *SQLStore) DeleteComment(commentID int) error {
 	query := "DELETE FROM comments WHERE id = ?"
-	_, err := database.Conn.Exec(query, commentID)
+	_, err := store.db.Conn.Exec(query, commentID)
 	if err != nil {
 		log.Println("Error deleting comment:", err)
 	}
 	return err
 }
+
+// GetCommentByID fetches a single comment with its author and reaction counts. Returns nil if it does not exist.
+func (store *SQLStore) GetCommentByID(commentID int, userID int) (*Comment, error) {
+	query := `
+		SELECT comments.id, comments.post_id, comments.user_id, comments.parent_comment_id, comments.content, comments.created_at, users.username, users.profile_picture,
+		       comments.hidden_at IS NOT NULL
+		FROM comments
+		JOIN users ON comments.user_id = users.id
+		WHERE comments.id = ?`
+
+	var comment Comment
+	var parentID sql.NullInt64
+	err := store.db.Conn.QueryRow(query, commentID).Scan(&comment.ID, &comment.PostID, &comment.UserID, &parentID, &comment.Content, &comment.CreatedAt, &comment.Username, &comment.ProfilePicture,
+		&comment.Hidden)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println("Error fetching comment by ID:", err)
+		return nil, err
+	}
+	if parentID.Valid {
+		id := int(parentID.Int64)
+		comment.ParentCommentID = &id
+	}
+
+	parsedTime, err := time.Parse(time.RFC3339, comment.CreatedAt)
+	if err != nil {
+		comment.FormattedCreatedAt = comment.CreatedAt
+	} else {
+		comment.FormattedCreatedAt = parsedTime.Format("02 Jan 2006, 15:04")
+	}
+
+	comment.Likes, comment.Dislikes, err = store.FetchCommentReactionsCount(comment.ID)
+	if err != nil {
+		return nil, err
+	}
+	if userID != 0 {
+		comment.CanReply = true
+		comment.UserReaction, err = store.FetchUserCommentReaction(userID, comment.ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &comment, nil
+}
+
+// UpdateComment changes the text of a comment
+func (store *SQLStore) UpdateComment(commentID int, content string) error {
+	_, err := store.db.Conn.Exec("UPDATE comments SET content = ? WHERE id = ?", content, commentID)
+	if err != nil {
+		log.Println("Error updating comment:", err)
+	}
+	return err
+}
+
+// RemoveCommentReaction clears the user's like or dislike on a comment
+func (store *SQLStore) RemoveCommentReaction(userID int, commentID int) error {
+	_, err := store.db.Conn.Exec("DELETE FROM comment_reactions WHERE comment_id = ? AND user_id = ?", commentID, userID)
+	if err != nil {
+		log.Println("Error removing comment reaction:", err)
+	}
+	return err
+}
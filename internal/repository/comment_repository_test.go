@@ -0,0 +1,137 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/repository"
+)
+
+// Sets up a database in a temporary file with the full migrated schema. An in-memory
+// database would be private to each pooled connection, so tables could go missing.
+func setupMigratedDB(t *testing.T) (*repository.SQLStore, *db.Database) {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatalf("failed to open test DB: %v", err)
+	}
+	t.Cleanup(func() { conn.Conn.Close() })
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+	return repository.NewSQLStore(conn), conn
+}
+
+func TestCommentReplies(t *testing.T) {
+	t.Parallel()
+	store, conn := setupMigratedDB(t)
+	defer conn.Conn.Close()
+
+	if err := store.CreateUser("ella", "ella@example.com", "hash", "1.png"); err != nil {
+		t.Fatalf("failed to create user: %v", err)
+	}
+	if err := store.CreatePost(1, "Pram", "Folds flat", "Newborn", "", false, "no_location"); err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	if err := store.CreatePost(1, "Cot", "Sturdy", "Newborn", "", false, "no_location"); err != nil {
+		t.Fatalf("failed to create second post: %v", err)
+	}
+
+	// Build a chain of replies deeper than MaxCommentDepth: 1 <- 2 <- 3 <- 4 <- 5
+	if err := store.CreateComment(1, "1", "top", nil); err != nil {
+		t.Fatalf("CreateComment failed: %v", err)
+	}
+	for parent := 1; parent <= repository.MaxCommentDepth+1; parent++ {
+		parentID := parent
+		if err := store.CreateComment(1, "1", "reply", &parentID); err != nil {
+			t.Fatalf("CreateComment reply to %d failed: %v", parent, err)
+		}
+	}
+	if err := store.CreateComment(1, "1", "second top", nil); err != nil {
+		t.Fatalf("CreateComment failed: %v", err)
+	}
+
+	comments, err := store.FetchCommentsForPost(1, 1)
+	if err != nil {
+		t.Fatalf("FetchCommentsForPost failed: %v", err)
+	}
+	if len(comments) != 2 {
+		t.Fatalf("expected 2 top-level comments, got %d", len(comments))
+	}
+	if got := repository.CountComments(comments); got != 6 {
+		t.Errorf("expected 6 comments in total, got %d", got)
+	}
+	if comments[0].ReplyCount != 4 {
+		t.Errorf("expected 4 replies in the first branch, got %d", comments[0].ReplyCount)
+	}
+	if !comments[0].CanReply {
+		t.Error("expected logged-in viewer to be able to reply")
+	}
+
+	// Walk down to the deepest level; the reply to the comment at max depth becomes its sibling
+	level := comments[0]
+	for level.Depth < repository.MaxCommentDepth-1 {
+		if len(level.Replies) != 1 {
+			t.Fatalf("expected exactly one reply at depth %d, got %d", level.Depth+1, len(level.Replies))
+		}
+		level = level.Replies[0]
+	}
+	if len(level.Replies) != 2 {
+		t.Fatalf("expected 2 replies at max depth, got %d", len(level.Replies))
+	}
+	for _, reply := range level.Replies {
+		if reply.Depth != repository.MaxCommentDepth || len(reply.Replies) != 0 {
+			t.Errorf("expected reply %d at depth %d with no nested replies", reply.ID, repository.MaxCommentDepth)
+		}
+	}
+
+	// Replying to a comment on a different post is rejected
+	parentID := 1
+	if err := store.CreateComment(1, "2", "wrong post", &parentID); err != repository.ErrInvalidParentComment {
+		t.Errorf("expected ErrInvalidParentComment, got %v", err)
+	}
+}
+
+func TestBuildCommentTreeOrphans(t *testing.T) {
+	t.Parallel()
+	missing := 99
+	flat := []repository.Comment{
+		{ID: 1},
+		{ID: 2, ParentCommentID: &missing},
+	}
+
+	tree := repository.BuildCommentTree(flat)
+	if len(tree) != 2 {
+		t.Fatalf("expected replies to deleted comments to become top-level, got %d roots", len(tree))
+	}
+}
+
+func TestBuildCommentTreeKeepsBrokenChains(t *testing.T) {
+	t.Parallel()
+	one, two, four := 1, 2, 4
+	flat := []repository.Comment{
+		{ID: 1, PostID: 7, ParentCommentID: &two},
+		{ID: 2, PostID: 7, ParentCommentID: &one},
+		{ID: 3, PostID: 7},
+		{ID: 4, PostID: 8},
+		{ID: 5, PostID: 7, ParentCommentID: &four},
+	}
+
+	// The reply pointing at another post's comment is top-level, and the cycle is broken at
+	// its earliest comment
+	tree := repository.BuildCommentTree(flat)
+	if repository.CountComments(tree) != len(flat) {
+		t.Fatalf("expected every comment to be shown, got %d of %d", repository.CountComments(tree), len(flat))
+	}
+	var roots []int
+	for _, c := range tree {
+		roots = append(roots, c.ID)
+	}
+	if !slices.Equal(roots, []int{3, 4, 5, 1}) {
+		t.Errorf("expected comments 3, 4, 5 and 1 at the top level, got %v", roots)
+	}
+	if cycle := tree[3]; len(cycle.Replies) != 1 || cycle.Replies[0].ID != 2 || len(cycle.Replies[0].Replies) != 0 {
+		t.Errorf("expected comment 2 to reply to comment 1 and nothing more, got %+v", cycle)
+	}
+}
@@ -1,11 +1,27 @@
 package repository
 
 import (
+	"context"
+
 	"ellas-corner/internal/db"
 )
 
-var database *db.Database
+// SQLStore is the Store backed by the SQLite database
+type SQLStore struct {
+	db *db.Database
+}
+
+// NewSQLStore returns a Store that reads and writes d
+func NewSQLStore(d *db.Database) *SQLStore {
+	return &SQLStore{db: d}
+}
+
+// Ping checks that the database can still be reached
+func (store *SQLStore) Ping(ctx context.Context) error {
+	return store.db.Conn.PingContext(ctx)
+}
 
-func SetDatabase(d *db.Database) {
-	database = d
+// PendingMigrations lists the schema migrations the database is still missing
+func (store *SQLStore) PendingMigrations() ([]db.Migration, error) {
+	return store.db.PendingMigrations()
 }
@@ -0,0 +1,432 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// DonationStatus is where a donated item is in its lifecycle. Posts that aren't donations
+// have an empty status.
+type DonationStatus string
+
+const (
+	DonationAvailable  DonationStatus = "available"   // Nobody has asked for it yet
+	DonationRequested  DonationStatus = "requested"   // At least one member has asked for it
+	DonationReserved   DonationStatus = "reserved"    // The donor has promised it to one member
+	DonationHandedOver DonationStatus = "handed_over" // The recipient has it
+	DonationWithdrawn  DonationStatus = "withdrawn"   // The donor took it off offer
+)
+
+var donationStatusLabels = map[DonationStatus]string{
+	DonationAvailable:  "Available",
+	DonationRequested:  "Requested",
+	DonationReserved:   "Reserved",
+	DonationHandedOver: "Handed over",
+	DonationWithdrawn:  "Withdrawn",
+}
+
+// Label is the status as shown to users
+func (s DonationStatus) Label() string {
+	return donationStatusLabels[s]
+}
+
+// Open reports whether the item can still be requested
+func (s DonationStatus) Open() bool {
+	return s == DonationAvailable || s == DonationRequested
+}
+
+// DonationRequestStatus is the state of one member's request for a donated item
+type DonationRequestStatus string
+
+const (
+	RequestPending   DonationRequestStatus = "pending"
+	RequestAccepted  DonationRequestStatus = "accepted"  // The item is reserved for, or was handed to, this member
+	RequestDeclined  DonationRequestStatus = "declined"  // The donor chose someone else or withdrew the item
+	RequestCancelled DonationRequestStatus = "cancelled" // The member no longer wants it
+)
+
+// Events recorded in the donation history
+const (
+	DonationEventRequested       = "requested"
+	DonationEventRequestCanceled = "request_cancelled"
+	DonationEventReserved        = "reserved"
+	DonationEventReleased        = "released"
+	DonationEventHandedOver      = "handed_over"
+	DonationEventWithdrawn       = "withdrawn"
+	DonationEventRelisted        = "relisted"
+)
+
+var (
+	// ErrDonationUnavailable is returned when a donation is not in a state that allows the
+	// change, for example reserving an item that was just promised to someone else
+	ErrDonationUnavailable = errors.New("donation is not available")
+	// ErrAlreadyRequested is returned when a member asks for an item they have already asked for
+	ErrAlreadyRequested = errors.New("already requested")
+)
+
+// DonationRequest is one member's request for a donated item
+type DonationRequest struct {
+	ID                 int
+	PostID             int
+	RequesterID        int
+	RequesterName      string
+	Message            string
+	Status             DonationRequestStatus
+	CreatedAt          time.Time
+	FormattedCreatedAt string
+}
+
+// DonationEvent is one entry in a donation's history
+type DonationEvent struct {
+	ID                 int
+	ActorID            int
+	ActorName          string
+	Event              string
+	FromStatus         DonationStatus
+	ToStatus           DonationStatus
+	RecipientID        int
+	RecipientName      string
+	Note               string
+	CreatedAt          time.Time
+	FormattedCreatedAt string
+}
+
+// Donation is the lifecycle of a donated item: its status, who it is promised to, the
+// requests made for it and its history, oldest first
+type Donation struct {
+	PostID        int
+	DonorID       int
+	Status        DonationStatus
+	RecipientID   int // 0 unless the item is reserved or handed over
+	RecipientName string
+	Requests      []DonationRequest
+	History       []DonationEvent
+}
+
+// RequestBy returns userID's request for the item, or nil if they haven't made one
+func (d Donation) RequestBy(userID int) *DonationRequest {
+	for i := range d.Requests {
+		if d.Requests[i].RequesterID == userID {
+			return &d.Requests[i]
+		}
+	}
+	return nil
+}
+
+// donationState is a donation's status and recipient as read at the start of a change
+type donationState struct {
+	status      DonationStatus
+	recipientID int
+}
+
+// updateDonation changes a donation and records it in donation_history in one transaction.
+// It returns sql.ErrNoRows if the post is not a donation and ErrDonationUnavailable unless
+// the current status is one of from. apply makes any changes to requests and returns the new
+// status and recipient. The status is only written if nobody changed it in the meantime, so
+// two members can never both be promised the same item.
+func (store *SQLStore) updateDonation(postID, actorID int, event, note string, from []DonationStatus,
+	apply func(tx *sql.Tx, current donationState) (DonationStatus, int, error)) error {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := changeDonation(tx, postID, actorID, event, note, from, apply); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// changeDonation is updateDonation inside a transaction the caller commits
+func changeDonation(tx *sql.Tx, postID, actorID int, event, note string, from []DonationStatus,
+	apply func(tx *sql.Tx, current donationState) (DonationStatus, int, error)) error {
+	var status sql.NullString
+	var donorID, recipientID sql.NullInt64
+	err := tx.QueryRow("SELECT user_id, donation_status, donation_recipient_id FROM posts WHERE id = ?", postID).Scan(&donorID, &status, &recipientID)
+	if err != nil {
+		return err
+	}
+	if !status.Valid {
+		return sql.ErrNoRows
+	}
+	current := donationState{status: DonationStatus(status.String), recipientID: int(recipientID.Int64)}
+
+	allowed := false
+	for _, s := range from {
+		allowed = allowed || s == current.status
+	}
+	if !allowed {
+		return ErrDonationUnavailable
+	}
+
+	to, newRecipientID, err := apply(tx, current)
+	if err != nil {
+		return err
+	}
+
+	// Recipient 0 is stored as NULL
+	var recipient interface{}
+	if newRecipientID != 0 {
+		recipient = newRecipientID
+	}
+	result, err := tx.Exec("UPDATE posts SET donation_status = ?, donation_recipient_id = ? WHERE id = ? AND donation_status = ?",
+		to, recipient, postID, current.status)
+	if err != nil {
+		log.Printf("Error updating donation %d: %v", postID, err)
+		return err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return ErrDonationUnavailable
+	}
+
+	_, err = tx.Exec(`INSERT INTO donation_history (post_id, actor_id, event, from_status, to_status, recipient_id, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, postID, actorID, event, current.status, to, recipient, note)
+	if err != nil {
+		log.Println("Error writing donation history:", err)
+		return err
+	}
+
+	// Requesters' changes go to the donor; the donor's go to whoever the item is, or was, promised to
+	notifyID := int(donorID.Int64)
+	if actorID == notifyID {
+		notifyID = newRecipientID
+		if notifyID == 0 {
+			notifyID = current.recipientID
+		}
+	}
+	notify(tx, notifyID, actorID, NotificationDonation, postID, 0, event)
+	return nil
+}
+
+// openStatus is requested while the item has pending requests and available otherwise
+func openStatus(tx *sql.Tx, postID int) (DonationStatus, error) {
+	var pending bool
+	err := tx.QueryRow("SELECT EXISTS (SELECT 1 FROM donation_requests WHERE post_id = ? AND status = 'pending')", postID).Scan(&pending)
+	if pending {
+		return DonationRequested, err
+	}
+	return DonationAvailable, err
+}
+
+// RequestDonation asks the donor for an item on behalf of requesterID. Returns
+// ErrAlreadyRequested if the member has a pending or accepted request for it already. The
+// message is only shown to the donor, so it is kept out of the public history.
+func (store *SQLStore) RequestDonation(postID, requesterID int, message string) error {
+	return store.updateDonation(postID, requesterID, DonationEventRequested, "", []DonationStatus{DonationAvailable, DonationRequested},
+		func(tx *sql.Tx, current donationState) (DonationStatus, int, error) {
+			result, err := tx.Exec(`
+				INSERT INTO donation_requests (post_id, requester_id, message) VALUES (?, ?, ?)
+				ON CONFLICT (post_id, requester_id) DO UPDATE
+				SET status = 'pending', message = excluded.message, created_at = CURRENT_TIMESTAMP
+				WHERE donation_requests.status IN ('declined', 'cancelled')`,
+				postID, requesterID, message)
+			if err != nil {
+				return "", 0, err
+			}
+			if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+				return "", 0, ErrAlreadyRequested
+			}
+			return DonationRequested, 0, nil
+		})
+}
+
+// CancelDonationRequest withdraws requesterID's pending request. Returns sql.ErrNoRows if
+// they have none; a member the item is reserved for releases it with ReleaseDonation instead.
+func (store *SQLStore) CancelDonationRequest(postID, requesterID int) error {
+	return store.updateDonation(postID, requesterID, DonationEventRequestCanceled, "", []DonationStatus{DonationAvailable, DonationRequested},
+		func(tx *sql.Tx, current donationState) (DonationStatus, int, error) {
+			result, err := tx.Exec("UPDATE donation_requests SET status = 'cancelled' WHERE post_id = ? AND requester_id = ? AND status = 'pending'",
+				postID, requesterID)
+			if err != nil {
+				return "", 0, err
+			}
+			if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+				return "", 0, sql.ErrNoRows
+			}
+			status, err := openStatus(tx, postID)
+			return status, 0, err
+		})
+}
+
+// ReserveDonation promises an item to the member who made requestID. The other requests stay
+// pending in case the reservation is released. Returns sql.ErrNoRows if requestID is not a
+// pending request for this item.
+func (store *SQLStore) ReserveDonation(postID, donorID, requestID int, note string) error {
+	return store.updateDonation(postID, donorID, DonationEventReserved, note, []DonationStatus{DonationRequested},
+		func(tx *sql.Tx, current donationState) (DonationStatus, int, error) {
+			var requesterID int
+			err := tx.QueryRow("SELECT requester_id FROM donation_requests WHERE id = ? AND post_id = ? AND status = 'pending'",
+				requestID, postID).Scan(&requesterID)
+			if err != nil {
+				return "", 0, err
+			}
+			if _, err := tx.Exec("UPDATE donation_requests SET status = 'accepted' WHERE id = ?", requestID); err != nil {
+				return "", 0, err
+			}
+			return DonationReserved, requesterID, nil
+		})
+}
+
+// ReleaseDonation cancels a reservation, either by the donor or by the recipient backing
+// out, and offers the item to the remaining requests again
+func (store *SQLStore) ReleaseDonation(postID, actorID int, note string) error {
+	return store.updateDonation(postID, actorID, DonationEventReleased, note, []DonationStatus{DonationReserved},
+		func(tx *sql.Tx, current donationState) (DonationStatus, int, error) {
+			requestStatus := RequestDeclined
+			if actorID == current.recipientID {
+				requestStatus = RequestCancelled
+			}
+			_, err := tx.Exec("UPDATE donation_requests SET status = ? WHERE post_id = ? AND requester_id = ? AND status = 'accepted'",
+				requestStatus, postID, current.recipientID)
+			if err != nil {
+				return "", 0, err
+			}
+			status, err := openStatus(tx, postID)
+			return status, 0, err
+		})
+}
+
+// CompleteDonation marks a reserved item as handed over to its recipient and declines
+// every other request
+func (store *SQLStore) CompleteDonation(postID, donorID int, note string) error {
+	return store.updateDonation(postID, donorID, DonationEventHandedOver, note, []DonationStatus{DonationReserved},
+		func(tx *sql.Tx, current donationState) (DonationStatus, int, error) {
+			_, err := tx.Exec("UPDATE donation_requests SET status = 'declined' WHERE post_id = ? AND status = 'pending'", postID)
+			return DonationHandedOver, current.recipientID, err
+		})
+}
+
+// WithdrawDonation takes an item off offer, declining every open request including a reservation
+func (store *SQLStore) WithdrawDonation(postID, donorID int, note string) error {
+	return store.updateDonation(postID, donorID, DonationEventWithdrawn, note, []DonationStatus{DonationAvailable, DonationRequested, DonationReserved},
+		func(tx *sql.Tx, current donationState) (DonationStatus, int, error) {
+			return withdraw(tx, postID)
+		})
+}
+
+// withdraw declines every open request for an item as it is taken off offer
+func withdraw(tx *sql.Tx, postID int) (DonationStatus, int, error) {
+	_, err := tx.Exec("UPDATE donation_requests SET status = 'declined' WHERE post_id = ? AND status IN ('pending', 'accepted')", postID)
+	return DonationWithdrawn, 0, err
+}
+
+// RelistDonation offers a withdrawn item again. Members whose requests were declined can ask again.
+func (store *SQLStore) RelistDonation(postID, donorID int, note string) error {
+	return store.updateDonation(postID, donorID, DonationEventRelisted, note, []DonationStatus{DonationWithdrawn}, relist)
+}
+
+// relist puts a withdrawn item back on offer
+func relist(tx *sql.Tx, current donationState) (DonationStatus, int, error) {
+	return DonationAvailable, 0, nil
+}
+
+// setDonationFlag applies the donation checkbox of an edited post through the lifecycle.
+// Ticking it offers the item, or relists one that was withdrawn; unticking it withdraws an
+// item nobody has asked for. Returns ErrDonationUnavailable while the item is requested,
+// reserved or handed over, as members are waiting on it: the donor withdraws it from the
+// donation page instead, which tells them.
+func setDonationFlag(tx *sql.Tx, postID int, isDonation bool) error {
+	var wasDonation bool
+	var status sql.NullString
+	var donorID int
+	err := tx.QueryRow("SELECT COALESCE(is_donation, 0), donation_status, user_id FROM posts WHERE id = ?", postID).
+		Scan(&wasDonation, &status, &donorID)
+	if err != nil || wasDonation == isDonation {
+		return err
+	}
+
+	switch current := DonationStatus(status.String); {
+	case !isDonation && current == DonationAvailable:
+		err = changeDonation(tx, postID, donorID, DonationEventWithdrawn, "", []DonationStatus{DonationAvailable},
+			func(tx *sql.Tx, current donationState) (DonationStatus, int, error) {
+				return withdraw(tx, postID)
+			})
+	case !isDonation && current != "" && current != DonationWithdrawn:
+		return ErrDonationUnavailable
+	case isDonation && current == DonationWithdrawn:
+		err = changeDonation(tx, postID, donorID, DonationEventRelisted, "", []DonationStatus{DonationWithdrawn}, relist)
+	case isDonation && current == "":
+		// A new donation starts with nothing left open from an earlier one
+		_, err = tx.Exec("UPDATE donation_requests SET status = 'declined' WHERE post_id = ? AND status IN ('pending', 'accepted')", postID)
+		if err == nil {
+			_, err = tx.Exec("UPDATE posts SET donation_status = 'available', donation_recipient_id = NULL WHERE id = ?", postID)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE posts SET is_donation = ? WHERE id = ?", isDonation, postID)
+	return err
+}
+
+// GetDonation returns the lifecycle of a donated item, or sql.ErrNoRows if the post does not
+// exist or is not a donation
+func (store *SQLStore) GetDonation(postID int) (*Donation, error) {
+	donation := Donation{PostID: postID}
+	var status sql.NullString
+	err := store.db.Conn.QueryRow(`
+		SELECT posts.user_id, posts.donation_status, COALESCE(posts.donation_recipient_id, 0), COALESCE(recipients.username, '')
+		FROM posts
+		LEFT JOIN users recipients ON recipients.id = posts.donation_recipient_id
+		WHERE posts.id = ?`, postID).Scan(&donation.DonorID, &status, &donation.RecipientID, &donation.RecipientName)
+	if err != nil {
+		return nil, err
+	}
+	if !status.Valid {
+		return nil, sql.ErrNoRows
+	}
+	donation.Status = DonationStatus(status.String)
+
+	rows, err := store.db.Conn.Query(`
+		SELECT donation_requests.id, donation_requests.requester_id, users.username, donation_requests.message,
+		       donation_requests.status, donation_requests.created_at
+		FROM donation_requests
+		JOIN users ON users.id = donation_requests.requester_id
+		WHERE donation_requests.post_id = ?
+		ORDER BY donation_requests.created_at, donation_requests.id`, postID)
+	if err != nil {
+		log.Println("Error fetching donation requests:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		request := DonationRequest{PostID: postID}
+		if err := rows.Scan(&request.ID, &request.RequesterID, &request.RequesterName, &request.Message, &request.Status, &request.CreatedAt); err != nil {
+			return nil, err
+		}
+		request.FormattedCreatedAt = request.CreatedAt.Format("02 Jan 2006, 15:04")
+		donation.Requests = append(donation.Requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	history, err := store.db.Conn.Query(`
+		SELECT donation_history.id, donation_history.actor_id, actors.username, donation_history.event,
+		       donation_history.from_status, donation_history.to_status,
+		       COALESCE(donation_history.recipient_id, 0), COALESCE(recipients.username, ''),
+		       donation_history.note, donation_history.created_at
+		FROM donation_history
+		JOIN users actors ON actors.id = donation_history.actor_id
+		LEFT JOIN users recipients ON recipients.id = donation_history.recipient_id
+		WHERE donation_history.post_id = ?
+		ORDER BY donation_history.id`, postID)
+	if err != nil {
+		log.Println("Error fetching donation history:", err)
+		return nil, err
+	}
+	defer history.Close()
+	for history.Next() {
+		var event DonationEvent
+		if err := history.Scan(&event.ID, &event.ActorID, &event.ActorName, &event.Event, &event.FromStatus, &event.ToStatus,
+			&event.RecipientID, &event.RecipientName, &event.Note, &event.CreatedAt); err != nil {
+			return nil, err
+		}
+		event.FormattedCreatedAt = event.CreatedAt.Format("02 Jan 2006, 15:04")
+		donation.History = append(donation.History, event)
+	}
+	return &donation, history.Err()
+}
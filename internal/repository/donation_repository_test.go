@@ -0,0 +1,178 @@
+package repository_test
+
+import (
+	"database/sql"
+	"errors"
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+// donationStatus loads a donation's status, failing the test if it can't be loaded
+func donationStatus(t *testing.T, store repository.Store, postID int) repository.DonationStatus {
+	t.Helper()
+	donation, err := store.GetDonation(postID)
+	if err != nil {
+		t.Fatalf("GetDonation failed: %v", err)
+	}
+	return donation.Status
+}
+
+func TestDonationLifecycle(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 4, 1, 0)
+	const postID, donorID = 1, 2
+
+	if _, err := store.GetDonation(postID); err != sql.ErrNoRows {
+		t.Fatalf("expected sql.ErrNoRows for a post that isn't a donation, got %v", err)
+	}
+	if err := store.UpdatePost(postID, "Pram", "Folds flat", "General", true); err != nil {
+		t.Fatalf("UpdatePost failed: %v", err)
+	}
+	if status := donationStatus(t, store, postID); status != repository.DonationAvailable {
+		t.Fatalf("expected a new donation to be available, got %q", status)
+	}
+
+	for _, requester := range []int{1, 3} {
+		if err := store.RequestDonation(postID, requester, "for my twins"); err != nil {
+			t.Fatalf("RequestDonation(%d) failed: %v", requester, err)
+		}
+	}
+	if err := store.RequestDonation(postID, 1, "again"); err != repository.ErrAlreadyRequested {
+		t.Errorf("expected ErrAlreadyRequested for a second request, got %v", err)
+	}
+	if status := donationStatus(t, store, postID); status != repository.DonationRequested {
+		t.Fatalf("expected requested, got %q", status)
+	}
+
+	donation, err := store.GetDonation(postID)
+	if err != nil || len(donation.Requests) != 2 {
+		t.Fatalf("expected two requests, got %+v (err %v)", donation, err)
+	}
+	first, second := donation.Requests[0].ID, donation.Requests[1].ID
+
+	// Once reserved for one member, the item can't be promised to anyone else
+	if err := store.ReserveDonation(postID, donorID, first, "collect Saturday"); err != nil {
+		t.Fatalf("ReserveDonation failed: %v", err)
+	}
+	if err := store.ReserveDonation(postID, donorID, second, ""); err != repository.ErrDonationUnavailable {
+		t.Errorf("expected ErrDonationUnavailable reserving twice, got %v", err)
+	}
+	if err := store.RequestDonation(postID, 4, ""); err != repository.ErrDonationUnavailable {
+		t.Errorf("expected ErrDonationUnavailable requesting a reserved item, got %v", err)
+	}
+
+	// The recipient backs out and the remaining request is offered the item
+	if err := store.ReleaseDonation(postID, 1, "moved away"); err != nil {
+		t.Fatalf("ReleaseDonation failed: %v", err)
+	}
+	if status := donationStatus(t, store, postID); status != repository.DonationRequested {
+		t.Fatalf("expected requested after release, got %q", status)
+	}
+	if err := store.ReserveDonation(postID, donorID, first, ""); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows reserving a cancelled request, got %v", err)
+	}
+	if err := store.ReserveDonation(postID, donorID, second, ""); err != nil {
+		t.Fatalf("ReserveDonation failed: %v", err)
+	}
+	if err := store.CompleteDonation(postID, donorID, ""); err != nil {
+		t.Fatalf("CompleteDonation failed: %v", err)
+	}
+
+	donation, err = store.GetDonation(postID)
+	if err != nil {
+		t.Fatalf("GetDonation failed: %v", err)
+	}
+	if donation.Status != repository.DonationHandedOver || donation.RecipientID != 3 || donation.RecipientName != "user3" {
+		t.Errorf("expected the item handed over to user3, got %+v", donation)
+	}
+	if request := donation.RequestBy(3); request == nil || request.Status != repository.RequestAccepted {
+		t.Errorf("expected user3's request to be accepted, got %+v", request)
+	}
+	if err := store.WithdrawDonation(postID, donorID, ""); err != repository.ErrDonationUnavailable {
+		t.Errorf("expected ErrDonationUnavailable withdrawing a handed over item, got %v", err)
+	}
+
+	events := []string{
+		repository.DonationEventRequested, repository.DonationEventRequested, repository.DonationEventReserved,
+		repository.DonationEventReleased, repository.DonationEventReserved, repository.DonationEventHandedOver,
+	}
+	if len(donation.History) != len(events) {
+		t.Fatalf("expected %d history entries, got %+v", len(events), donation.History)
+	}
+	for i, event := range events {
+		if donation.History[i].Event != event {
+			t.Errorf("history[%d]: expected %s, got %s", i, event, donation.History[i].Event)
+		}
+	}
+}
+
+func TestWithdrawAndRelistDonation(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 3, 1, 0)
+	const postID, donorID = 1, 2
+
+	if err := store.UpdatePost(postID, "Cot", "Barely used", "General", true); err != nil {
+		t.Fatalf("UpdatePost failed: %v", err)
+	}
+	if err := store.RequestDonation(postID, 1, ""); err != nil {
+		t.Fatalf("RequestDonation failed: %v", err)
+	}
+	if err := store.CancelDonationRequest(postID, 1); err != nil {
+		t.Fatalf("CancelDonationRequest failed: %v", err)
+	}
+	if status := donationStatus(t, store, postID); status != repository.DonationAvailable {
+		t.Fatalf("expected available once the only request is cancelled, got %q", status)
+	}
+	if err := store.CancelDonationRequest(postID, 1); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows cancelling twice, got %v", err)
+	}
+
+	if err := store.RequestDonation(postID, 3, ""); err != nil {
+		t.Fatalf("RequestDonation failed: %v", err)
+	}
+	if err := store.WithdrawDonation(postID, donorID, "sold it"); err != nil {
+		t.Fatalf("WithdrawDonation failed: %v", err)
+	}
+	if err := store.RelistDonation(postID, donorID, ""); err != nil {
+		t.Fatalf("RelistDonation failed: %v", err)
+	}
+
+	// Declined members can ask again once the item is back on offer
+	if err := store.RequestDonation(postID, 3, "still need it"); err != nil {
+		t.Fatalf("RequestDonation after relisting failed: %v", err)
+	}
+	if status := donationStatus(t, store, postID); status != repository.DonationRequested {
+		t.Errorf("expected requested, got %q", status)
+	}
+
+	// Editing can't drop an item someone has asked for without telling them
+	if err := store.UpdatePost(postID, "Cot", "Barely used", "General", false); !errors.Is(err, repository.ErrDonationUnavailable) {
+		t.Fatalf("expected ErrDonationUnavailable unticking a requested item, got %v", err)
+	}
+	if status := donationStatus(t, store, postID); status != repository.DonationRequested {
+		t.Errorf("expected the refused edit to leave the item requested, got %q", status)
+	}
+
+	// Once nobody is waiting on it, unticking withdraws the item and ticking relists it
+	if err := store.CancelDonationRequest(postID, 3); err != nil {
+		t.Fatalf("CancelDonationRequest failed: %v", err)
+	}
+	if err := store.UpdatePost(postID, "Cot", "Barely used", "General", false); err != nil {
+		t.Fatalf("UpdatePost failed: %v", err)
+	}
+	if status := donationStatus(t, store, postID); status != repository.DonationWithdrawn {
+		t.Errorf("expected unticking to withdraw the item, got %q", status)
+	}
+	if err := store.UpdatePost(postID, "Cot", "Barely used", "General", true); err != nil {
+		t.Fatalf("UpdatePost failed: %v", err)
+	}
+	donation, err := store.GetDonation(postID)
+	if err != nil {
+		t.Fatalf("GetDonation failed: %v", err)
+	}
+	last := donation.History[len(donation.History)-2:]
+	if donation.Status != repository.DonationAvailable || last[0].Event != repository.DonationEventWithdrawn || last[1].Event != repository.DonationEventRelisted {
+		t.Errorf("expected the edits in the history and the item available again, got %s with %+v", donation.Status, last)
+	}
+}
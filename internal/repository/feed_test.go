@@ -0,0 +1,150 @@
+package repository_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/repository"
+)
+
+// seedFeed creates a file-backed database with users, posts, comments and reactions on
+// every post, shaped like a busy home page
+func seedFeed(tb testing.TB, users, posts, commentsPerPost int) (*repository.SQLStore, *db.Database) {
+	conn, err := db.InitDB(filepath.Join(tb.TempDir(), "feed.db"))
+	if err != nil {
+		tb.Fatalf("failed to open test DB: %v", err)
+	}
+	tb.Cleanup(func() { conn.Conn.Close() })
+	if err := conn.RunMigrations(); err != nil {
+		tb.Fatalf("failed to run migrations: %v", err)
+	}
+
+	tx, err := conn.Conn.Begin()
+	if err != nil {
+		tb.Fatalf("failed to begin seed transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	exec := func(query string, args ...interface{}) {
+		if _, err := tx.Exec(query, args...); err != nil {
+			tb.Fatalf("seed query failed: %v", err)
+		}
+	}
+
+	for u := 1; u <= users; u++ {
+		exec("INSERT INTO users (username, email, password, profile_picture) VALUES (?, ?, 'hash', '1.png')",
+			fmt.Sprintf("user%d", u), fmt.Sprintf("user%d@example.com", u))
+	}
+	commentID := 0
+	for p := 1; p <= posts; p++ {
+		author := p%users + 1
+		exec("INSERT INTO posts (user_id, title, content, category) VALUES (?, ?, 'content', 'General')", author, "Post "+strconv.Itoa(p))
+		exec("INSERT INTO post_reactions (post_id, user_id, reaction_type) VALUES (?, ?, 'like')", p, (p+1)%users+1)
+		exec("INSERT INTO post_reactions (post_id, user_id, reaction_type) VALUES (?, ?, 'dislike')", p, (p+2)%users+1)
+
+		for c := 0; c < commentsPerPost; c++ {
+			commentID++
+			var parent interface{}
+			if c > 0 {
+				parent = commentID - 1
+			}
+			exec("INSERT INTO comments (post_id, user_id, parent_comment_id, content) VALUES (?, ?, ?, 'comment')", p, (p+c)%users+1, parent)
+			exec("INSERT INTO comment_reactions (comment_id, user_id, reaction_type) VALUES (?, 1, 'like')", commentID)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		tb.Fatalf("failed to commit seed data: %v", err)
+	}
+	return repository.NewSQLStore(conn), conn
+}
+
+// fetchFeedPerPost loads the feed the way the home page used to: the post list, then the
+// reaction counts, the viewer's reaction and the comments one post at a time
+func fetchFeedPerPost(store repository.Store, viewerID int) ([]repository.Post, error) {
+	posts, err := store.FetchPostsByQuery(repository.PostQuery{ViewerID: viewerID})
+	if err != nil {
+		return nil, err
+	}
+	for i := range posts {
+		posts[i].Likes, posts[i].Dislikes, err = store.FetchReactionsCount(posts[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		posts[i].UserReaction, err = store.FetchUserReaction(viewerID, posts[i].ID)
+		if err != nil {
+			return nil, err
+		}
+		posts[i].Comments, err = store.FetchCommentsForPost(posts[i].ID, viewerID)
+		if err != nil {
+			return nil, err
+		}
+		for j := range posts[i].Comments {
+			c := &posts[i].Comments[j]
+			if c.Likes, c.Dislikes, err = store.FetchCommentReactionsCount(c.ID); err != nil {
+				return nil, err
+			}
+			if c.UserReaction, err = store.FetchUserCommentReaction(viewerID, c.ID); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return posts, nil
+}
+
+func TestFetchPostsByQueryLoadsCommentsInBatch(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 4, 30, 3)
+
+	posts, err := store.FetchPostsByQuery(repository.PostQuery{ViewerID: 1})
+	if err != nil {
+		t.Fatalf("FetchPostsByQuery failed: %v", err)
+	}
+	if len(posts) != 30 {
+		t.Fatalf("expected 30 posts, got %d", len(posts))
+	}
+
+	for _, post := range posts {
+		if post.Likes != 1 || post.Dislikes != 1 {
+			t.Errorf("post %d: expected 1 like and 1 dislike, got %d/%d", post.ID, post.Likes, post.Dislikes)
+		}
+		if len(post.Comments) != 1 || repository.CountComments(post.Comments) != 3 {
+			t.Fatalf("post %d: expected a single thread of 3 comments, got %d", post.ID, repository.CountComments(post.Comments))
+		}
+		for c := &post.Comments[0]; ; c = &c.Replies[0] {
+			if c.PostID != post.ID {
+				t.Errorf("comment %d attached to post %d but belongs to %d", c.ID, post.ID, c.PostID)
+			}
+			if c.Likes != 1 || c.UserReaction != "like" || !c.CanReply {
+				t.Errorf("comment %d: expected the viewer's like, got likes=%d reaction=%q", c.ID, c.Likes, c.UserReaction)
+			}
+			if len(c.Replies) == 0 {
+				break
+			}
+		}
+	}
+}
+
+// BenchmarkFeed compares loading a 300 post home feed one post at a time with the batched loader
+func BenchmarkFeed(b *testing.B) {
+	store, _ := seedFeed(b, 20, 300, 5)
+
+	b.Run("per-post", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := fetchFeedPerPost(store, 1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			if _, err := store.FetchPostsByQuery(repository.PostQuery{ViewerID: 1}); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,308 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+var (
+	// ErrBlocked is returned when either member has blocked the other
+	ErrBlocked = errors.New("one of the members has blocked the other")
+	// ErrNotConversationMember is returned when a user opens or writes to a conversation they are not part of
+	ErrNotConversationMember = errors.New("not a member of the conversation")
+)
+
+// Message is one message in a conversation
+type Message struct {
+	ID                 int
+	SenderID           int
+	SenderName         string
+	Body               string
+	CreatedAt          time.Time
+	FormattedCreatedAt string
+}
+
+// ConversationSummary is a conversation as listed in a member's inbox
+type ConversationSummary struct {
+	ID                  int
+	PostID              int
+	PostTitle           string
+	OtherUserID         int
+	OtherUsername       string
+	OtherProfilePicture string
+	LastMessage         string
+	UpdatedAt           time.Time
+	FormattedUpdatedAt  string
+	Unread              int
+}
+
+// Conversation is a conversation with every message in it, oldest first, as seen by one member
+type Conversation struct {
+	ConversationSummary
+	Messages    []Message
+	Blocked     bool // Either member has blocked the other, so no more messages can be sent
+	BlockedByMe bool // The viewing member made the block and can lift it
+}
+
+// IsBlocked reports whether either user has blocked the other
+func (store *SQLStore) IsBlocked(userID, otherID int) (bool, error) {
+	var blocked bool
+	err := store.db.Conn.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM user_blocks
+		               WHERE (blocker_id = ? AND blocked_id = ?) OR (blocker_id = ? AND blocked_id = ?))`,
+		userID, otherID, otherID, userID).Scan(&blocked)
+	return blocked, err
+}
+
+// addMessage inserts a message, moves the conversation to the top of both inboxes and marks
+// it read for the sender
+func addMessage(tx *sql.Tx, conversationID, senderID int, body string) error {
+	result, err := tx.Exec("INSERT INTO messages (conversation_id, sender_id, body) VALUES (?, ?, ?)", conversationID, senderID, body)
+	if err != nil {
+		log.Println("Error inserting message:", err)
+		return err
+	}
+	messageID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE conversations SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", conversationID); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE conversation_members SET last_read_message_id = ? WHERE conversation_id = ? AND user_id = ?",
+		messageID, conversationID, senderID)
+	return err
+}
+
+// StartConversation sends the first message about a post from senderID to recipientID, or
+// adds it to their existing conversation about that post, and returns the conversation ID.
+// Returns ErrBlocked if either has blocked the other.
+func (store *SQLStore) StartConversation(postID, senderID, recipientID int, body string) (int, error) {
+	if blocked, err := store.IsBlocked(senderID, recipientID); err != nil {
+		return 0, err
+	} else if blocked {
+		return 0, ErrBlocked
+	}
+
+	userA, userB := senderID, recipientID
+	if userA > userB {
+		userA, userB = userB, userA
+	}
+
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`INSERT INTO conversations (post_id, user_a_id, user_b_id) VALUES (?, ?, ?)
+		ON CONFLICT (post_id, user_a_id, user_b_id) DO NOTHING`, postID, userA, userB)
+	if err != nil {
+		log.Println("Error creating conversation:", err)
+		return 0, err
+	}
+	var conversationID int
+	err = tx.QueryRow("SELECT id FROM conversations WHERE post_id = ? AND user_a_id = ? AND user_b_id = ?", postID, userA, userB).Scan(&conversationID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = tx.Exec(`INSERT INTO conversation_members (conversation_id, user_id) VALUES (?, ?), (?, ?)
+		ON CONFLICT (conversation_id, user_id) DO NOTHING`, conversationID, userA, conversationID, userB)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := addMessage(tx, conversationID, senderID, body); err != nil {
+		return 0, err
+	}
+	return conversationID, tx.Commit()
+}
+
+// otherMember returns the other member of a conversation, or ErrNotConversationMember if
+// userID is not in it
+func (store *SQLStore) otherMember(conversationID, userID int) (int, error) {
+	var otherID int
+	err := store.db.Conn.QueryRow(`
+		SELECT them.user_id
+		FROM conversation_members me
+		JOIN conversation_members them ON them.conversation_id = me.conversation_id AND them.user_id != me.user_id
+		WHERE me.conversation_id = ? AND me.user_id = ?`, conversationID, userID).Scan(&otherID)
+	if err == sql.ErrNoRows {
+		return 0, ErrNotConversationMember
+	}
+	return otherID, err
+}
+
+// SendMessage adds a message to a conversation. Returns ErrNotConversationMember if the
+// sender is not in it and ErrBlocked if either member has blocked the other.
+func (store *SQLStore) SendMessage(conversationID, senderID int, body string) error {
+	otherID, err := store.otherMember(conversationID, senderID)
+	if err != nil {
+		return err
+	}
+	if blocked, err := store.IsBlocked(senderID, otherID); err != nil {
+		return err
+	} else if blocked {
+		return ErrBlocked
+	}
+
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := addMessage(tx, conversationID, senderID, body); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// conversationSummaryQuery selects a member's conversations with the other member, the
+// latest message and the number of messages they haven't read
+const conversationSummaryQuery = `
+	SELECT conversations.id, conversations.post_id, COALESCE(posts.title, 'a deleted post'),
+	       others.id, others.username, COALESCE(others.profile_picture, ''),
+	       COALESCE(latest.body, ''), conversations.updated_at,
+	       (SELECT COUNT(*) FROM messages
+	        WHERE messages.conversation_id = conversations.id
+	          AND messages.id > me.last_read_message_id AND messages.sender_id != me.user_id)
+	FROM conversation_members me
+	JOIN conversations ON conversations.id = me.conversation_id
+	JOIN conversation_members them ON them.conversation_id = me.conversation_id AND them.user_id != me.user_id
+	JOIN users others ON others.id = them.user_id
+	LEFT JOIN posts ON posts.id = conversations.post_id
+	LEFT JOIN messages latest ON latest.id = (SELECT MAX(id) FROM messages WHERE conversation_id = conversations.id)
+	WHERE me.user_id = ?`
+
+func scanConversationSummary(scanner interface{ Scan(...interface{}) error }) (ConversationSummary, error) {
+	var c ConversationSummary
+	err := scanner.Scan(&c.ID, &c.PostID, &c.PostTitle, &c.OtherUserID, &c.OtherUsername, &c.OtherProfilePicture,
+		&c.LastMessage, &c.UpdatedAt, &c.Unread)
+	c.FormattedUpdatedAt = c.UpdatedAt.Format("02 Jan 2006, 15:04")
+	return c, err
+}
+
+// FetchConversations returns a member's inbox, most recently active first
+func (store *SQLStore) FetchConversations(userID int) ([]ConversationSummary, error) {
+	rows, err := store.db.Conn.Query(conversationSummaryQuery+`
+	ORDER BY conversations.updated_at DESC, conversations.id DESC`, userID)
+	if err != nil {
+		log.Println("Error fetching conversations:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var conversations []ConversationSummary
+	for rows.Next() {
+		c, err := scanConversationSummary(rows)
+		if err != nil {
+			return nil, err
+		}
+		conversations = append(conversations, c)
+	}
+	return conversations, rows.Err()
+}
+
+// GetConversation returns a conversation and its messages as seen by userID. Returns
+// ErrNotConversationMember if the conversation does not exist or userID is not in it.
+func (store *SQLStore) GetConversation(conversationID, userID int) (*Conversation, error) {
+	summary, err := scanConversationSummary(store.db.Conn.QueryRow(conversationSummaryQuery+`
+	  AND conversations.id = ?`, userID, conversationID))
+	if err == sql.ErrNoRows {
+		return nil, ErrNotConversationMember
+	} else if err != nil {
+		return nil, err
+	}
+	conversation := Conversation{ConversationSummary: summary}
+
+	var blockedMe bool
+	err = store.db.Conn.QueryRow(`
+		SELECT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?),
+		       EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?)`,
+		userID, summary.OtherUserID, summary.OtherUserID, userID).Scan(&conversation.BlockedByMe, &blockedMe)
+	if err != nil {
+		return nil, err
+	}
+	conversation.Blocked = conversation.BlockedByMe || blockedMe
+
+	rows, err := store.db.Conn.Query(`
+		SELECT messages.id, messages.sender_id, users.username, messages.body, messages.created_at
+		FROM messages
+		JOIN users ON users.id = messages.sender_id
+		WHERE messages.conversation_id = ?
+		ORDER BY messages.id`, conversationID)
+	if err != nil {
+		log.Println("Error fetching messages:", err)
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var m Message
+		if err := rows.Scan(&m.ID, &m.SenderID, &m.SenderName, &m.Body, &m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.FormattedCreatedAt = m.CreatedAt.Format("02 Jan 2006, 15:04")
+		conversation.Messages = append(conversation.Messages, m)
+	}
+	return &conversation, rows.Err()
+}
+
+// MarkConversationRead marks every message in a conversation as read for userID
+func (store *SQLStore) MarkConversationRead(conversationID, userID int) error {
+	_, err := store.db.Conn.Exec(`
+		UPDATE conversation_members
+		SET last_read_message_id = COALESCE((SELECT MAX(id) FROM messages WHERE conversation_id = ?), 0)
+		WHERE conversation_id = ? AND user_id = ?`, conversationID, conversationID, userID)
+	return err
+}
+
+// CountUnreadMessages returns how many messages sent to userID they haven't read yet
+func (store *SQLStore) CountUnreadMessages(userID int) (int, error) {
+	var unread int
+	err := store.db.Conn.QueryRow(`
+		SELECT COUNT(*)
+		FROM conversation_members me
+		JOIN messages ON messages.conversation_id = me.conversation_id
+		WHERE me.user_id = ? AND messages.id > me.last_read_message_id AND messages.sender_id != me.user_id`, userID).Scan(&unread)
+	return unread, err
+}
+
+// BlockUser stops blockedID and blockerID messaging each other. Blocking twice is not an error.
+func (store *SQLStore) BlockUser(blockerID, blockedID int) error {
+	_, err := store.db.Conn.Exec(`INSERT INTO user_blocks (blocker_id, blocked_id) VALUES (?, ?)
+		ON CONFLICT (blocker_id, blocked_id) DO NOTHING`, blockerID, blockedID)
+	return err
+}
+
+// UnblockUser lifts a block made by blockerID
+func (store *SQLStore) UnblockUser(blockerID, blockedID int) error {
+	_, err := store.db.Conn.Exec("DELETE FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?", blockerID, blockedID)
+	return err
+}
+
+// FetchBlockedUsers returns the members userID has blocked, by username
+func (store *SQLStore) FetchBlockedUsers(userID int) ([]User, error) {
+	rows, err := store.db.Conn.Query(`
+		SELECT users.id, users.username, COALESCE(users.profile_picture, '')
+		FROM user_blocks
+		JOIN users ON users.id = user_blocks.blocked_id
+		WHERE user_blocks.blocker_id = ?
+		ORDER BY users.username`, userID)
+	if err != nil {
+		log.Println("Error fetching blocked users:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.ProfilePicture); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
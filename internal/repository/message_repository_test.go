@@ -0,0 +1,125 @@
+package repository_test
+
+import (
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+// unread counts a member's unread messages, failing the test if it can't
+func unread(t *testing.T, store repository.Store, userID int) int {
+	t.Helper()
+	count, err := store.CountUnreadMessages(userID)
+	if err != nil {
+		t.Fatalf("CountUnreadMessages failed: %v", err)
+	}
+	return count
+}
+
+func TestConversations(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 3, 2, 0)
+	const donorID, askerID = 2, 1 // Post 1 is by user2
+
+	conversationID, err := store.StartConversation(1, askerID, donorID, "Is the pram still available?")
+	if err != nil {
+		t.Fatalf("StartConversation failed: %v", err)
+	}
+	// Writing again about the same post reuses the conversation, whoever starts it
+	again, err := store.StartConversation(1, donorID, askerID, "Yes, it is")
+	if err != nil || again != conversationID {
+		t.Fatalf("expected conversation %d to be reused, got %d (err %v)", conversationID, again, err)
+	}
+	if other, err := store.StartConversation(2, askerID, 3, "Hello"); err != nil || other == conversationID {
+		t.Fatalf("expected a new conversation for another post, got %d (err %v)", other, err)
+	}
+
+	if got := unread(t, store, askerID); got != 1 {
+		t.Errorf("expected 1 unread message for the asker, got %d", got)
+	}
+	// Replying counts as having read the conversation
+	if got := unread(t, store, donorID); got != 0 {
+		t.Errorf("expected no unread messages for the donor after replying, got %d", got)
+	}
+
+	inbox, err := store.FetchConversations(askerID)
+	if err != nil {
+		t.Fatalf("FetchConversations failed: %v", err)
+	}
+	if len(inbox) != 2 {
+		t.Fatalf("expected two conversations in the inbox, got %+v", inbox)
+	}
+
+	conversation, err := store.GetConversation(conversationID, askerID)
+	if err != nil {
+		t.Fatalf("GetConversation failed: %v", err)
+	}
+	if conversation.OtherUsername != "user2" || conversation.PostTitle != "Post 1" || len(conversation.Messages) != 2 {
+		t.Errorf("unexpected conversation: %+v", conversation)
+	}
+	if conversation.Unread != 1 || conversation.LastMessage != "Yes, it is" {
+		t.Errorf("expected one unread reply, got %+v", conversation.ConversationSummary)
+	}
+
+	if err := store.MarkConversationRead(conversationID, askerID); err != nil {
+		t.Fatalf("MarkConversationRead failed: %v", err)
+	}
+	if got := unread(t, store, askerID); got != 0 {
+		t.Errorf("expected no unread messages after reading, got %d", got)
+	}
+
+	// Only the two members can read or write to a conversation
+	if _, err := store.GetConversation(conversationID, 3); err != repository.ErrNotConversationMember {
+		t.Errorf("expected ErrNotConversationMember reading, got %v", err)
+	}
+	if err := store.SendMessage(conversationID, 3, "hi"); err != repository.ErrNotConversationMember {
+		t.Errorf("expected ErrNotConversationMember writing, got %v", err)
+	}
+}
+
+func TestBlockedMembersCannotMessage(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 3, 1, 0)
+	const donorID, askerID = 2, 1
+
+	conversationID, err := store.StartConversation(1, askerID, donorID, "Hi")
+	if err != nil {
+		t.Fatalf("StartConversation failed: %v", err)
+	}
+	if err := store.BlockUser(donorID, askerID); err != nil {
+		t.Fatalf("BlockUser failed: %v", err)
+	}
+	if err := store.BlockUser(donorID, askerID); err != nil {
+		t.Errorf("expected blocking twice to succeed, got %v", err)
+	}
+
+	// The block works in both directions
+	if err := store.SendMessage(conversationID, askerID, "Hello?"); err != repository.ErrBlocked {
+		t.Errorf("expected ErrBlocked for the blocked member, got %v", err)
+	}
+	if err := store.SendMessage(conversationID, donorID, "Bye"); err != repository.ErrBlocked {
+		t.Errorf("expected ErrBlocked for the blocker, got %v", err)
+	}
+	if _, err := store.StartConversation(1, askerID, donorID, "Hi again"); err != repository.ErrBlocked {
+		t.Errorf("expected ErrBlocked starting a conversation, got %v", err)
+	}
+
+	conversation, err := store.GetConversation(conversationID, askerID)
+	if err != nil {
+		t.Fatalf("GetConversation failed: %v", err)
+	}
+	if !conversation.Blocked || conversation.BlockedByMe {
+		t.Errorf("expected the asker to see a block they can't lift, got %+v", conversation)
+	}
+	blocked, err := store.FetchBlockedUsers(donorID)
+	if err != nil || len(blocked) != 1 || blocked[0].ID != askerID {
+		t.Fatalf("expected the donor to have blocked the asker, got %+v (err %v)", blocked, err)
+	}
+
+	if err := store.UnblockUser(donorID, askerID); err != nil {
+		t.Fatalf("UnblockUser failed: %v", err)
+	}
+	if err := store.SendMessage(conversationID, askerID, "Hello?"); err != nil {
+		t.Errorf("expected messages to flow again after unblocking, got %v", err)
+	}
+}
@@ -0,0 +1,227 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Moderation actions recorded in the moderation log
+const (
+	ActionHidePost      = "hide_post"
+	ActionUnhidePost    = "unhide_post"
+	ActionDeletePost    = "delete_post"
+	ActionHideComment   = "hide_comment"
+	ActionUnhideComment = "unhide_comment"
+	ActionDeleteComment = "delete_comment"
+	ActionBanUser       = "ban_user"
+	ActionUnbanUser     = "unban_user"
+	ActionSetRole       = "set_role"
+)
+
+// ModerationLogEntry is one action taken by a moderator or admin
+type ModerationLogEntry struct {
+	ID                 int
+	ModeratorID        int // 0 for changes made from the command line
+	ModeratorName      string
+	Action             string
+	TargetType         string // "post", "comment" or "user"
+	TargetID           int
+	Reason             string
+	CreatedAt          time.Time
+	FormattedCreatedAt string
+}
+
+// moderationChange is one statement run as part of a moderation action
+type moderationChange struct {
+	query string
+	args  []interface{}
+}
+
+func change(query string, args ...interface{}) moderationChange {
+	return moderationChange{query: query, args: args}
+}
+
+// moderate applies a moderation action and records it in the moderation log in one
+// transaction, so the log always matches what was done. The first change must update the
+// target; sql.ErrNoRows is returned if the target does not exist.
+func (store *SQLStore) moderate(moderatorID int, action, targetType string, targetID int, reason string, changes ...moderationChange) error {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i, c := range changes {
+		result, err := tx.Exec(c.query, c.args...)
+		if err != nil {
+			log.Printf("Error applying moderation action %s to %s %d: %v", action, targetType, targetID, err)
+			return err
+		}
+		if i == 0 {
+			if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+				return sql.ErrNoRows
+			}
+		}
+	}
+
+	// Moderator 0 is the command line, which is logged without a moderator
+	var moderator interface{}
+	if moderatorID != 0 {
+		moderator = moderatorID
+	}
+	_, err = tx.Exec(`INSERT INTO moderation_log (moderator_id, action, target_type, target_id, reason) VALUES (?, ?, ?, ?, ?)`,
+		moderator, action, targetType, targetID, reason)
+	if err != nil {
+		log.Println("Error writing moderation log:", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetPostHidden hides a post from every listing, or shows it again. Returns sql.ErrNoRows if the post does not exist.
+func (store *SQLStore) SetPostHidden(moderatorID, postID int, hidden bool, reason string) error {
+	if hidden {
+		return store.moderate(moderatorID, ActionHidePost, "post", postID, reason, change("UPDATE posts SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", postID))
+	}
+	return store.moderate(moderatorID, ActionUnhidePost, "post", postID, reason, change("UPDATE posts SET hidden_at = NULL WHERE id = ?", postID))
+}
+
+// SetCommentHidden hides a comment and the replies beneath it, or shows them again
+func (store *SQLStore) SetCommentHidden(moderatorID, commentID int, hidden bool, reason string) error {
+	if hidden {
+		return store.moderate(moderatorID, ActionHideComment, "comment", commentID, reason, change("UPDATE comments SET hidden_at = CURRENT_TIMESTAMP WHERE id = ?", commentID))
+	}
+	return store.moderate(moderatorID, ActionUnhideComment, "comment", commentID, reason, change("UPDATE comments SET hidden_at = NULL WHERE id = ?", commentID))
+}
+
+// ModeratorDeletePost deletes someone else's post and records it in the moderation log
+func (store *SQLStore) ModeratorDeletePost(moderatorID, postID int, reason string) error {
+	return store.moderate(moderatorID, ActionDeletePost, "post", postID, reason, change("DELETE FROM posts WHERE id = ?", postID))
+}
+
+// ModeratorDeleteComment deletes someone else's comment and records it in the moderation log
+func (store *SQLStore) ModeratorDeleteComment(moderatorID, commentID int, reason string) error {
+	return store.moderate(moderatorID, ActionDeleteComment, "comment", commentID, reason, change("DELETE FROM comments WHERE id = ?", commentID))
+}
+
+// BanUser stops a user from signing in and signs them out everywhere, including API tokens
+func (store *SQLStore) BanUser(moderatorID, userID int, reason string) error {
+	return store.moderate(moderatorID, ActionBanUser, "user", userID, reason,
+		change("UPDATE users SET banned_at = CURRENT_TIMESTAMP, ban_reason = ? WHERE id = ?", reason, userID),
+		change("DELETE FROM sessions WHERE user_id = ?", userID),
+		change("DELETE FROM api_tokens WHERE user_id = ?", userID))
+}
+
+// UnbanUser lets a banned user sign in again
+func (store *SQLStore) UnbanUser(moderatorID, userID int, reason string) error {
+	return store.moderate(moderatorID, ActionUnbanUser, "user", userID, reason, change("UPDATE users SET banned_at = NULL, ban_reason = '' WHERE id = ?", userID))
+}
+
+// SetUserRole changes a user's role. The new role is recorded as the reason in the log.
+func (store *SQLStore) SetUserRole(moderatorID, userID int, role Role) error {
+	return store.moderate(moderatorID, ActionSetRole, "user", userID, string(role), change("UPDATE users SET role = ? WHERE id = ?", role, userID))
+}
+
+// FetchModerationLog returns the most recent moderation actions, newest first
+func (store *SQLStore) FetchModerationLog(limit int) ([]ModerationLogEntry, error) {
+	query := `
+		SELECT moderation_log.id, COALESCE(moderation_log.moderator_id, 0), COALESCE(users.username, ''), moderation_log.action,
+		       moderation_log.target_type, moderation_log.target_id, moderation_log.reason, moderation_log.created_at
+		FROM moderation_log
+		LEFT JOIN users ON moderation_log.moderator_id = users.id
+		ORDER BY moderation_log.created_at DESC, moderation_log.id DESC
+		LIMIT ?`
+
+	rows, err := store.db.Conn.Query(query, limit)
+	if err != nil {
+		log.Println("Error fetching moderation log:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []ModerationLogEntry
+	for rows.Next() {
+		var e ModerationLogEntry
+		if err := rows.Scan(&e.ID, &e.ModeratorID, &e.ModeratorName, &e.Action, &e.TargetType, &e.TargetID, &e.Reason, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.FormattedCreatedAt = e.CreatedAt.Format("02 Jan 2006, 15:04")
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// FetchRecentComments returns the newest comments across all posts, including hidden ones, for moderators
+func (store *SQLStore) FetchRecentComments(limit int) ([]Comment, error) {
+	query := `
+		SELECT comments.id, comments.post_id, comments.user_id, comments.content, comments.created_at,
+		       users.username, posts.title, comments.hidden_at IS NOT NULL
+		FROM comments
+		JOIN users ON comments.user_id = users.id
+		JOIN posts ON comments.post_id = posts.id
+		ORDER BY comments.created_at DESC, comments.id DESC
+		LIMIT ?`
+
+	rows, err := store.db.Conn.Query(query, limit)
+	if err != nil {
+		log.Println("Error fetching recent comments:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []Comment
+	for rows.Next() {
+		var c Comment
+		var createdAt time.Time
+		if err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &createdAt, &c.Username, &c.PostTitle, &c.Hidden); err != nil {
+			return nil, err
+		}
+		c.CreatedAt = createdAt.Format(time.RFC3339)
+		c.FormattedCreatedAt = createdAt.Format("02 Jan 2006, 15:04")
+		comments = append(comments, c)
+	}
+	return comments, rows.Err()
+}
+
+// FetchUsers lists every user with their role and ban status, for the admin dashboard
+func (store *SQLStore) FetchUsers() ([]User, error) {
+	query := `
+		SELECT id, username, email, COALESCE(profile_picture, ''), role, banned_at IS NOT NULL, ban_reason
+		FROM users
+		ORDER BY username`
+
+	rows, err := store.db.Conn.Query(query)
+	if err != nil {
+		log.Println("Error fetching users:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var u User
+		if err := rows.Scan(&u.ID, &u.Username, &u.Email, &u.ProfilePicture, &u.Role, &u.Banned, &u.BanReason); err != nil {
+			return nil, err
+		}
+		users = append(users, u)
+	}
+	return users, rows.Err()
+}
+
+// GetUserByUsernameOrEmail finds a user for the admin command line. Returns nil if there is none.
+func (store *SQLStore) GetUserByUsernameOrEmail(identifier string) (*User, error) {
+	var userID int
+	err := store.db.Conn.QueryRow("SELECT id FROM users WHERE username = ? OR email = ?", identifier, identifier).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	user, err := store.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
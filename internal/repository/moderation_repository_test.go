@@ -0,0 +1,93 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+func TestHiddenContentIsLeftOut(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 3, 3, 2)
+	const moderatorID = 1
+
+	if err := store.SetPostHidden(moderatorID, 1, true, "spam"); err != nil {
+		t.Fatalf("SetPostHidden failed: %v", err)
+	}
+	posts, err := store.FetchPostsByQuery(repository.PostQuery{})
+	if err != nil {
+		t.Fatalf("FetchPostsByQuery failed: %v", err)
+	}
+	if len(posts) != 2 {
+		t.Errorf("expected the hidden post to be left out, got %v", postTitles(posts))
+	}
+
+	posts, err = store.FetchPostsByQuery(repository.PostQuery{IncludeHidden: true, Sort: repository.SortOldest})
+	if err != nil {
+		t.Fatalf("FetchPostsByQuery failed: %v", err)
+	}
+	if len(posts) != 3 || !posts[0].Hidden || posts[1].Hidden {
+		t.Errorf("expected all posts with only the first hidden, got %v", posts)
+	}
+
+	// Hiding a comment also hides the replies beneath it. Post 2's comments are 3 and its reply 4.
+	if err := store.SetCommentHidden(moderatorID, 3, true, ""); err != nil {
+		t.Fatalf("SetCommentHidden failed: %v", err)
+	}
+	comments, err := store.FetchCommentsForPost(2, 0)
+	if err != nil {
+		t.Fatalf("FetchCommentsForPost failed: %v", err)
+	}
+	if len(comments) != 0 {
+		t.Errorf("expected the hidden comment thread to be left out, got %d comments", repository.CountComments(comments))
+	}
+
+	if err := store.SetPostHidden(moderatorID, 1, false, ""); err != nil {
+		t.Fatalf("unhiding failed: %v", err)
+	}
+	if err := store.SetPostHidden(moderatorID, 404, true, ""); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows hiding a missing post, got %v", err)
+	}
+
+	entries, err := store.FetchModerationLog(10)
+	if err != nil {
+		t.Fatalf("FetchModerationLog failed: %v", err)
+	}
+	if len(entries) != 3 || entries[0].Action != repository.ActionUnhidePost || entries[2].Reason != "spam" {
+		t.Errorf("expected three logged actions, newest first, got %+v", entries)
+	}
+	if entries[0].ModeratorName != "user1" {
+		t.Errorf("expected the moderator's name in the log, got %q", entries[0].ModeratorName)
+	}
+}
+
+func TestBanUserSignsOutEverywhere(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 2, 0, 0)
+
+	if _, err := store.CreateAPIToken(2, "token-hash", "cli"); err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+	if err := store.BanUser(1, 2, "abuse"); err != nil {
+		t.Fatalf("BanUser failed: %v", err)
+	}
+
+	user, err := store.GetUserByID(2)
+	if err != nil {
+		t.Fatalf("GetUserByID failed: %v", err)
+	}
+	if !user.Banned || user.BanReason != "abuse" {
+		t.Errorf("expected user to be banned for abuse, got banned=%v reason=%q", user.Banned, user.BanReason)
+	}
+	if id, _ := store.GetUserIDByAPIToken("token-hash"); id != 0 {
+		t.Error("expected the banned user's API token to be revoked")
+	}
+
+	if err := store.UnbanUser(1, 2, ""); err != nil {
+		t.Fatalf("UnbanUser failed: %v", err)
+	}
+	if user, _ := store.GetUserByID(2); user.Banned {
+		t.Error("expected user to be unbanned")
+	}
+}
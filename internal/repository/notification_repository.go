@@ -0,0 +1,354 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+	"strconv"
+	"time"
+)
+
+// NotificationType is a kind of notification. Members can turn each type off.
+type NotificationType string
+
+const (
+	NotificationComment  NotificationType = "comment"  // Someone commented on the member's post
+	NotificationReply    NotificationType = "reply"    // Someone replied to the member's comment
+	NotificationReaction NotificationType = "reaction" // Someone liked or disliked the member's post or comment
+	NotificationDonation NotificationType = "donation" // Something happened to a donation the member gives or asked for
+)
+
+// NotificationTypes lists every type in the order the settings show them
+var NotificationTypes = []NotificationType{NotificationComment, NotificationReply, NotificationReaction, NotificationDonation}
+
+var notificationTypeLabels = map[NotificationType]string{
+	NotificationComment:  "Comments on my posts",
+	NotificationReply:    "Replies to my comments",
+	NotificationReaction: "Likes and dislikes",
+	NotificationDonation: "Donation requests and updates",
+}
+
+// Label is the type as shown in the notification settings
+func (t NotificationType) Label() string {
+	return notificationTypeLabels[t]
+}
+
+// ValidNotificationType reports whether t is a known notification type
+func ValidNotificationType(t NotificationType) bool {
+	_, ok := notificationTypeLabels[t]
+	return ok
+}
+
+// Notification tells a member that someone else commented, reacted or changed a donation
+type Notification struct {
+	ID                 int
+	Type               NotificationType
+	ActorID            int
+	ActorName          string
+	PostID             int
+	PostTitle          string
+	CommentID          int    // The member's comment this is about, or 0 if it is about their post
+	Detail             string // The reaction type, or the donation event
+	Read               bool
+	CreatedAt          time.Time
+	FormattedCreatedAt string
+}
+
+var donationEventActions = map[string]string{
+	DonationEventRequested:       "asked for",
+	DonationEventRequestCanceled: "cancelled their request for",
+	DonationEventReserved:        "reserved for you",
+	DonationEventReleased:        "released the reservation on",
+	DonationEventHandedOver:      "marked as handed over to you",
+	DonationEventWithdrawn:       "withdrew",
+	DonationEventRelisted:        "offered again",
+}
+
+// Action is what the actor did, written to go between their name and the post's title
+func (n Notification) Action() string {
+	switch n.Type {
+	case NotificationComment:
+		return "commented on your post"
+	case NotificationReply:
+		return "replied to your comment on"
+	case NotificationReaction:
+		verb := "liked"
+		if n.Detail == "dislike" {
+			verb = "disliked"
+		}
+		if n.CommentID != 0 {
+			return verb + " your comment on"
+		}
+		return verb + " your post"
+	}
+	if action, ok := donationEventActions[n.Detail]; ok {
+		return action
+	}
+	return "updated"
+}
+
+// Link is where the notification takes the member: the donation page, or their own post or
+// comment on their profile
+func (n Notification) Link() string {
+	switch {
+	case n.Type == NotificationDonation:
+		return "/donations/" + strconv.Itoa(n.PostID)
+	case n.CommentID != 0:
+		return "/profile#my-comment-" + strconv.Itoa(n.CommentID)
+	default:
+		return "/profile#post-" + strconv.Itoa(n.PostID)
+	}
+}
+
+// NotificationSetting is whether a member gets one type of notification
+type NotificationSetting struct {
+	Type    NotificationType
+	Enabled bool
+}
+
+// execer runs a statement on the database or inside a transaction
+type execer interface {
+	Exec(query string, args ...interface{}) (sql.Result, error)
+}
+
+// notify records a notification for userID. Nothing is recorded when the member caused it
+// themselves, has turned the type off or has blocked the actor.
+func notify(exec execer, userID, actorID int, t NotificationType, postID, commentID int, detail string) {
+	if userID == 0 {
+		return
+	}
+	var comment interface{}
+	if commentID != 0 {
+		comment = commentID
+	}
+	_, err := exec.Exec(`
+		INSERT INTO notifications (user_id, actor_id, type, post_id, comment_id, detail)
+		SELECT ?, ?, ?, ?, ?, ?
+		WHERE ? != ?
+		  AND NOT EXISTS (SELECT 1 FROM notification_opt_outs WHERE user_id = ? AND type = ?)
+		  AND NOT EXISTS (SELECT 1 FROM user_blocks WHERE blocker_id = ? AND blocked_id = ?)`,
+		userID, actorID, t, postID, comment, detail,
+		userID, actorID,
+		userID, t,
+		userID, actorID)
+	// A lost notification shouldn't undo the comment, reaction or donation change behind it
+	if err != nil {
+		log.Printf("Error notifying user %d of %s on post %d: %v", userID, t, postID, err)
+	}
+}
+
+// contentAuthor returns the author of a post or comment, or 0 if it can't be found
+func (store *SQLStore) contentAuthor(table string, id int) int {
+	var authorID sql.NullInt64
+	if err := store.db.Conn.QueryRow("SELECT user_id FROM "+table+" WHERE id = ?", id).Scan(&authorID); err != nil && err != sql.ErrNoRows {
+		log.Printf("Error looking up the author of %s %d: %v", table, id, err)
+	}
+	return int(authorID.Int64)
+}
+
+// notifyComment tells the post's author about a new comment, and the parent comment's author
+// about a reply. Someone who wrote both only hears about the reply.
+func (store *SQLStore) notifyComment(actorID, postID int, parentID sql.NullInt64) {
+	postAuthor := store.contentAuthor("posts", postID)
+	if parentID.Valid {
+		parentAuthor := store.contentAuthor("comments", int(parentID.Int64))
+		notify(store.db.Conn, parentAuthor, actorID, NotificationReply, postID, int(parentID.Int64), "")
+		if parentAuthor == postAuthor {
+			return
+		}
+	}
+	notify(store.db.Conn, postAuthor, actorID, NotificationComment, postID, 0, "")
+}
+
+// notifyCommentReaction tells a comment's author that someone liked or disliked it
+func (store *SQLStore) notifyCommentReaction(actorID, commentID int, reactionType string) {
+	var authorID, postID sql.NullInt64
+	err := store.db.Conn.QueryRow("SELECT user_id, post_id FROM comments WHERE id = ?", commentID).Scan(&authorID, &postID)
+	if err != nil {
+		log.Printf("Error looking up comment %d to notify its author: %v", commentID, err)
+		return
+	}
+	notify(store.db.Conn, int(authorID.Int64), actorID, NotificationReaction, int(postID.Int64), commentID, reactionType)
+}
+
+// FetchNotifications returns a member's most recent notifications, newest first
+func (store *SQLStore) FetchNotifications(userID, limit int) ([]Notification, error) {
+	rows, err := store.db.Conn.Query(`
+		SELECT notifications.id, notifications.type, notifications.actor_id, users.username,
+		       notifications.post_id, posts.title, COALESCE(notifications.comment_id, 0), notifications.detail,
+		       notifications.read_at IS NOT NULL, notifications.created_at
+		FROM notifications
+		JOIN users ON users.id = notifications.actor_id
+		JOIN posts ON posts.id = notifications.post_id
+		WHERE notifications.user_id = ?
+		ORDER BY notifications.id DESC
+		LIMIT ?`, userID, limit)
+	if err != nil {
+		log.Println("Error fetching notifications:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var notifications []Notification
+	for rows.Next() {
+		var n Notification
+		if err := rows.Scan(&n.ID, &n.Type, &n.ActorID, &n.ActorName, &n.PostID, &n.PostTitle, &n.CommentID, &n.Detail,
+			&n.Read, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.FormattedCreatedAt = n.CreatedAt.Format("02 Jan 2006, 15:04")
+		notifications = append(notifications, n)
+	}
+	return notifications, rows.Err()
+}
+
+// CountUnreadNotifications returns how many of a member's notifications they haven't opened
+func (store *SQLStore) CountUnreadNotifications(userID int) (int, error) {
+	var unread int
+	err := store.db.Conn.QueryRow(`
+		SELECT COUNT(*)
+		FROM notifications
+		JOIN posts ON posts.id = notifications.post_id
+		WHERE notifications.user_id = ? AND notifications.read_at IS NULL`, userID).Scan(&unread)
+	return unread, err
+}
+
+// ReadNotification marks one of a member's notifications read and returns it. Returns
+// sql.ErrNoRows if it doesn't exist or belongs to someone else.
+func (store *SQLStore) ReadNotification(notificationID, userID int) (*Notification, error) {
+	var n Notification
+	err := store.db.Conn.QueryRow(`
+		SELECT id, type, post_id, COALESCE(comment_id, 0)
+		FROM notifications
+		WHERE id = ? AND user_id = ?`, notificationID, userID).Scan(&n.ID, &n.Type, &n.PostID, &n.CommentID)
+	if err != nil {
+		return nil, err
+	}
+	_, err = store.db.Conn.Exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE id = ? AND read_at IS NULL", notificationID)
+	if err != nil {
+		return nil, err
+	}
+	n.Read = true
+	return &n, nil
+}
+
+// MarkAllNotificationsRead marks every notification a member has as read
+func (store *SQLStore) MarkAllNotificationsRead(userID int) error {
+	_, err := store.db.Conn.Exec("UPDATE notifications SET read_at = CURRENT_TIMESTAMP WHERE user_id = ? AND read_at IS NULL", userID)
+	return err
+}
+
+// FetchNotificationSettings returns whether a member gets each type of notification, in
+// the order of NotificationTypes
+func (store *SQLStore) FetchNotificationSettings(userID int) ([]NotificationSetting, error) {
+	rows, err := store.db.Conn.Query("SELECT type FROM notification_opt_outs WHERE user_id = ?", userID)
+	if err != nil {
+		log.Println("Error fetching notification settings:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	optedOut := map[NotificationType]bool{}
+	for rows.Next() {
+		var t NotificationType
+		if err := rows.Scan(&t); err != nil {
+			return nil, err
+		}
+		optedOut[t] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	settings := make([]NotificationSetting, len(NotificationTypes))
+	for i, t := range NotificationTypes {
+		settings[i] = NotificationSetting{Type: t, Enabled: !optedOut[t]}
+	}
+	return settings, nil
+}
+
+// UpdateNotificationSettings turns on the given notification types for a member, turns every
+// other type off and sets whether they get email digests
+func (store *SQLStore) UpdateNotificationSettings(userID int, enabled []NotificationType, emailDigest bool) error {
+	on := map[NotificationType]bool{}
+	for _, t := range enabled {
+		on[t] = true
+	}
+
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE users SET email_digest = ? WHERE id = ?", emailDigest, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM notification_opt_outs WHERE user_id = ?", userID); err != nil {
+		return err
+	}
+	for _, t := range NotificationTypes {
+		if on[t] {
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO notification_opt_outs (user_id, type) VALUES (?, ?)", userID, t); err != nil {
+			log.Println("Error saving notification settings:", err)
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// Digest is the notifications one member hasn't read or been emailed about yet, oldest first
+type Digest struct {
+	UserID        int
+	Username      string
+	Email         string
+	Notifications []Notification
+}
+
+// FetchPendingDigests returns a digest for every member who wants them and has unread
+// notifications that weren't in an earlier digest
+func (store *SQLStore) FetchPendingDigests() ([]Digest, error) {
+	rows, err := store.db.Conn.Query(`
+		SELECT recipients.id, recipients.username, recipients.email,
+		       notifications.id, notifications.type, notifications.actor_id, actors.username,
+		       notifications.post_id, posts.title, COALESCE(notifications.comment_id, 0), notifications.detail,
+		       notifications.created_at
+		FROM notifications
+		JOIN users recipients ON recipients.id = notifications.user_id
+		JOIN users actors ON actors.id = notifications.actor_id
+		JOIN posts ON posts.id = notifications.post_id
+		WHERE notifications.read_at IS NULL AND notifications.emailed_at IS NULL
+		  AND recipients.email_digest AND recipients.banned_at IS NULL
+		ORDER BY recipients.id, notifications.id`)
+	if err != nil {
+		log.Println("Error fetching pending digests:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var digests []Digest
+	for rows.Next() {
+		var d Digest
+		var n Notification
+		if err := rows.Scan(&d.UserID, &d.Username, &d.Email,
+			&n.ID, &n.Type, &n.ActorID, &n.ActorName, &n.PostID, &n.PostTitle, &n.CommentID, &n.Detail, &n.CreatedAt); err != nil {
+			return nil, err
+		}
+		n.FormattedCreatedAt = n.CreatedAt.Format("02 Jan 2006, 15:04")
+		if len(digests) == 0 || digests[len(digests)-1].UserID != d.UserID {
+			digests = append(digests, d)
+		}
+		last := &digests[len(digests)-1]
+		last.Notifications = append(last.Notifications, n)
+	}
+	return digests, rows.Err()
+}
+
+// MarkDigestSent records that a member was emailed about their notifications up to and
+// including lastNotificationID
+func (store *SQLStore) MarkDigestSent(userID, lastNotificationID int) error {
+	_, err := store.db.Conn.Exec(`UPDATE notifications SET emailed_at = CURRENT_TIMESTAMP
+		WHERE user_id = ? AND id <= ? AND emailed_at IS NULL`, userID, lastNotificationID)
+	return err
+}
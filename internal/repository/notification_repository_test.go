@@ -0,0 +1,150 @@
+package repository_test
+
+import (
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+// notifications loads a member's notifications, failing the test if they can't be loaded
+func notifications(t *testing.T, store repository.Store, userID int) []repository.Notification {
+	t.Helper()
+	list, err := store.FetchNotifications(userID, 50)
+	if err != nil {
+		t.Fatalf("FetchNotifications failed: %v", err)
+	}
+	return list
+}
+
+func TestCommentAndReactionNotifications(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 3, 1, 0)
+	const postID, authorID = 1, 2 // Post 1 is by user2
+
+	commentID, err := store.CreateCommentReturningID(1, postID, "Where did you buy it?", nil)
+	if err != nil {
+		t.Fatalf("CreateCommentReturningID failed: %v", err)
+	}
+	// Replying to a comment notifies its author, and the post's author separately
+	if _, err := store.CreateCommentReturningID(3, postID, "Same question", &commentID); err != nil {
+		t.Fatalf("CreateCommentReturningID failed: %v", err)
+	}
+	// Nobody hears about their own activity
+	if _, err := store.CreateCommentReturningID(authorID, postID, "At the market", &commentID); err != nil {
+		t.Fatalf("CreateCommentReturningID failed: %v", err)
+	}
+	if err := store.AddCommentReaction(3, commentID, "like"); err != nil {
+		t.Fatalf("AddCommentReaction failed: %v", err)
+	}
+
+	got := notifications(t, store, authorID)
+	if len(got) != 2 || got[0].Type != repository.NotificationComment || got[0].ActorName != "user3" || got[0].PostTitle != "Post 1" {
+		t.Fatalf("expected two comment notifications for the post's author, newest first, got %+v", got)
+	}
+	got = notifications(t, store, 1)
+	if len(got) != 3 {
+		t.Fatalf("expected two replies and a reaction for the commenter, got %+v", got)
+	}
+	if got[0].Type != repository.NotificationReaction || got[0].Detail != "like" || got[0].CommentID != commentID {
+		t.Errorf("expected a like on the comment, got %+v", got[0])
+	}
+	if got[1].Type != repository.NotificationReply || got[1].Link() != "/profile#my-comment-1" {
+		t.Errorf("expected a reply linking to the comment, got %+v", got[1])
+	}
+
+	// user3 already likes the post. Switching a reaction notifies again; repeating it doesn't.
+	for _, reaction := range []string{"dislike", "like", "like"} {
+		if err := store.AddReaction(3, postID, reaction); err != nil {
+			t.Fatalf("AddReaction failed: %v", err)
+		}
+	}
+	if unread, err := store.CountUnreadNotifications(authorID); err != nil || unread != 4 {
+		t.Errorf("expected 4 unread notifications, got %d (err %v)", unread, err)
+	}
+}
+
+func TestNotificationSettingsAndReadState(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 3, 1, 0)
+	const postID, authorID = 1, 2
+
+	if err := store.UpdateNotificationSettings(authorID, []repository.NotificationType{repository.NotificationReply}, true); err != nil {
+		t.Fatalf("UpdateNotificationSettings failed: %v", err)
+	}
+	settings, err := store.FetchNotificationSettings(authorID)
+	if err != nil || len(settings) != len(repository.NotificationTypes) {
+		t.Fatalf("expected a setting for every type, got %+v (err %v)", settings, err)
+	}
+	for _, setting := range settings {
+		if setting.Enabled != (setting.Type == repository.NotificationReply) {
+			t.Errorf("expected only replies enabled, got %+v", setting)
+		}
+	}
+	if _, err := store.CreateCommentReturningID(1, postID, "Lovely", nil); err != nil {
+		t.Fatalf("CreateCommentReturningID failed: %v", err)
+	}
+	if got := notifications(t, store, authorID); len(got) != 0 {
+		t.Fatalf("expected no notifications for a type that's turned off, got %+v", got)
+	}
+
+	// Turn everything back on, but block user3
+	if err := store.UpdateNotificationSettings(authorID, repository.NotificationTypes, true); err != nil {
+		t.Fatalf("UpdateNotificationSettings failed: %v", err)
+	}
+	if err := store.BlockUser(authorID, 3); err != nil {
+		t.Fatalf("BlockUser failed: %v", err)
+	}
+	if _, err := store.CreateCommentReturningID(3, postID, "Hello", nil); err != nil {
+		t.Fatalf("CreateCommentReturningID failed: %v", err)
+	}
+	if _, err := store.CreateCommentReturningID(1, postID, "Still lovely", nil); err != nil {
+		t.Fatalf("CreateCommentReturningID failed: %v", err)
+	}
+	got := notifications(t, store, authorID)
+	if len(got) != 1 || got[0].ActorID != 1 {
+		t.Fatalf("expected only user1's comment, got %+v", got)
+	}
+
+	if _, err := store.ReadNotification(got[0].ID, 1); err == nil {
+		t.Errorf("expected an error reading someone else's notification")
+	}
+	read, err := store.ReadNotification(got[0].ID, authorID)
+	if err != nil || !read.Read || read.Link() != "/profile#post-1" {
+		t.Fatalf("expected the notification read and linking to the post, got %+v (err %v)", read, err)
+	}
+	if unread, _ := store.CountUnreadNotifications(authorID); unread != 0 {
+		t.Errorf("expected no unread notifications, got %d", unread)
+	}
+}
+
+func TestDonationNotifications(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 3, 1, 0)
+	const postID, donorID = 1, 2
+
+	if err := store.UpdatePost(postID, "Pram", "Folds flat", "General", true); err != nil {
+		t.Fatalf("UpdatePost failed: %v", err)
+	}
+	if err := store.RequestDonation(postID, 3, "please"); err != nil {
+		t.Fatalf("RequestDonation failed: %v", err)
+	}
+	donation, err := store.GetDonation(postID)
+	if err != nil {
+		t.Fatalf("GetDonation failed: %v", err)
+	}
+	if err := store.ReserveDonation(postID, donorID, donation.Requests[0].ID, ""); err != nil {
+		t.Fatalf("ReserveDonation failed: %v", err)
+	}
+	if err := store.ReleaseDonation(postID, donorID, ""); err != nil {
+		t.Fatalf("ReleaseDonation failed: %v", err)
+	}
+
+	got := notifications(t, store, donorID)
+	if len(got) != 1 || got[0].Detail != repository.DonationEventRequested || got[0].Link() != "/donations/1" {
+		t.Errorf("expected the donor to hear about the request, got %+v", got)
+	}
+	got = notifications(t, store, 3)
+	if len(got) != 2 || got[0].Detail != repository.DonationEventReleased || got[1].Detail != repository.DonationEventReserved {
+		t.Errorf("expected the requester to hear about the reservation and its release, got %+v", got)
+	}
+}
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+	"strings"
+
+	"ellas-corner/internal/images"
+)
+
+// MaxPostImages is how many photos a post's gallery can hold
+const MaxPostImages = 8
+
+// PostImage is one photo in a post's gallery
+type PostImage struct {
+	ID       int
+	PostID   int
+	Image    string
+	AltText  string
+	Position int
+}
+
+// Number is the photo's place in the gallery counting from one, as members see it
+func (i PostImage) Number() int {
+	return i.Position + 1
+}
+
+// createPostQuery inserts a post, making donations available straight away
+const createPostQuery = `
+	INSERT INTO posts (user_id, title, content, category, image, is_donation, donation_country, donation_status)
+	VALUES (?, ?, ?, ?, ?, ?, ?, CASE WHEN ? THEN 'available' END)
+`
+
+// CreatePostWithImages inserts a post along with its gallery and returns the new post's ID
+func (store *SQLStore) CreatePostWithImages(userID int, title, content, category string, isDonation bool, donationCountry string, gallery []PostImage) (int, error) {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(createPostQuery, userID, title, content, category, cover(gallery), isDonation, donationCountry, isDonation)
+	if err != nil {
+		log.Println("Error creating post:", err)
+		return 0, err
+	}
+	postID, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+	if err := writeGallery(tx, int(postID), gallery); err != nil {
+		return 0, err
+	}
+	return int(postID), tx.Commit()
+}
+
+// UpdatePostWithImages saves an edited post and replaces its gallery with the photos given,
+// in order. Like UpdatePost, it returns ErrDonationUnavailable for taking a requested or
+// reserved item off offer.
+func (store *SQLStore) UpdatePostWithImages(postID int, title, content, category string, isDonation bool, gallery []PostImage) error {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setDonationFlag(tx, postID, isDonation); err != nil {
+		return err
+	}
+	_, err = tx.Exec("UPDATE posts SET title = ?, content = ?, category = ? WHERE id = ?", title, content, category, postID)
+	if err != nil {
+		log.Println("Error updating post with images:", err)
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM post_images WHERE post_id = ?", postID); err != nil {
+		return err
+	}
+	if err := writeGallery(tx, postID, gallery); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// writeGallery inserts a post's photos numbered from 0 in the order given and makes the
+// first one the post's cover
+func writeGallery(tx *sql.Tx, postID int, gallery []PostImage) error {
+	for position, image := range gallery {
+		_, err := tx.Exec("INSERT INTO post_images (post_id, image, position, alt_text) VALUES (?, ?, ?, ?)",
+			postID, image.Image, position, image.AltText)
+		if err != nil {
+			log.Println("Error saving post image:", err)
+			return err
+		}
+	}
+	_, err := tx.Exec("UPDATE posts SET image = ? WHERE id = ?", cover(gallery), postID)
+	return err
+}
+
+// cover is the picture shown for a post in lists: its first photo, or the placeholder
+func cover(gallery []PostImage) string {
+	if len(gallery) == 0 {
+		return images.PlaceholderImage
+	}
+	return gallery[0].Image
+}
+
+// FetchImagesForPosts loads the galleries of many posts at once, keyed by post ID
+func (store *SQLStore) FetchImagesForPosts(postIDs []int) (map[int][]PostImage, error) {
+	galleries := make(map[int][]PostImage, len(postIDs))
+
+	for start := 0; start < len(postIDs); start += commentBatchSize {
+		end := start + commentBatchSize
+		if end > len(postIDs) {
+			end = len(postIDs)
+		}
+		batch := postIDs[start:end]
+
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(batch)), ", ")
+		args := make([]interface{}, len(batch))
+		for i, id := range batch {
+			args[i] = id
+		}
+		rows, err := store.db.Conn.Query(`
+			SELECT id, post_id, image, alt_text, position
+			FROM post_images
+			WHERE post_id IN (`+placeholders+`)
+			ORDER BY post_id, position, id`, args...)
+		if err != nil {
+			return nil, err
+		}
+		for rows.Next() {
+			var image PostImage
+			if err := rows.Scan(&image.ID, &image.PostID, &image.Image, &image.AltText, &image.Position); err != nil {
+				rows.Close()
+				return nil, err
+			}
+			galleries[image.PostID] = append(galleries[image.PostID], image)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return galleries, nil
+}
+
+// attachImages loads the galleries for all of posts in one batch and sets each post's Images
+func (store *SQLStore) attachImages(posts []Post) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	postIDs := make([]int, len(posts))
+	for i := range posts {
+		postIDs[i] = posts[i].ID
+	}
+
+	galleries, err := store.FetchImagesForPosts(postIDs)
+	if err != nil {
+		log.Println("Error fetching images for posts:", err)
+		return err
+	}
+	for i := range posts {
+		posts[i].Images = galleries[posts[i].ID]
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package repository_test
+
+import (
+	"strconv"
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+// imageNames lists the photos of a gallery in order
+func imageNames(gallery []repository.PostImage) []string {
+	var names []string
+	for _, image := range gallery {
+		names = append(names, image.Image+"@"+strconv.Itoa(image.Position))
+	}
+	return names
+}
+
+func TestPostGallery(t *testing.T) {
+	t.Parallel()
+	store, conn := seedFeed(t, 2, 1, 0)
+
+	gallery := []repository.PostImage{
+		{Image: "folded.jpg", AltText: "The pram folded flat"},
+		{Image: "open.jpg", AltText: "The pram unfolded"},
+		{Image: "label.jpg", AltText: "The care label"},
+	}
+	postID, err := store.CreatePostWithImages(1, "Pram", "Folds flat", "General", false, "no_location", gallery)
+	if err != nil {
+		t.Fatalf("CreatePostWithImages failed: %v", err)
+	}
+
+	post, err := store.GetPostByID(strconv.Itoa(postID), 1)
+	if err != nil || post == nil {
+		t.Fatalf("GetPostByID failed: %v", err)
+	}
+	if post.Image != "folded.jpg" {
+		t.Errorf("expected the first photo to be the cover, got %q", post.Image)
+	}
+	if got := imageNames(post.Images); len(got) != 3 || got[0] != "folded.jpg@0" || got[2] != "label.jpg@2" || post.Images[1].AltText != "The pram unfolded" {
+		t.Errorf("unexpected gallery %v", post.Images)
+	}
+
+	// Feeds load every post's gallery in one go
+	page, err := store.FetchPostPage(repository.PostQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("FetchPostPage failed: %v", err)
+	}
+	for _, p := range page.Posts {
+		want := 0
+		if p.ID == postID {
+			want = 3
+		}
+		if len(p.Images) != want {
+			t.Errorf("post %d: expected %d photos in the feed, got %d", p.ID, want, len(p.Images))
+		}
+	}
+
+	// Reordering and removing photos moves the cover along with them
+	reordered := []repository.PostImage{post.Images[2], post.Images[0]}
+	if err := store.UpdatePostWithImages(postID, "Pram", "Folds flat", "General", false, reordered); err != nil {
+		t.Fatalf("UpdatePostWithImages failed: %v", err)
+	}
+	post, _ = store.GetPostByID(strconv.Itoa(postID), 1)
+	if got := imageNames(post.Images); len(got) != 2 || got[0] != "label.jpg@0" || got[1] != "folded.jpg@1" || post.Image != "label.jpg" {
+		t.Errorf("unexpected gallery after reordering %v (cover %q)", got, post.Image)
+	}
+
+	// Without photos the post falls back to the placeholder
+	if err := store.UpdatePostWithImages(postID, "Pram", "Folds flat", "General", false, nil); err != nil {
+		t.Fatalf("UpdatePostWithImages failed: %v", err)
+	}
+	post, _ = store.GetPostByID(strconv.Itoa(postID), 1)
+	if len(post.Images) != 0 || post.Image != "placeholder.jpg" {
+		t.Errorf("expected no photos and the placeholder, got %v (cover %q)", post.Images, post.Image)
+	}
+
+	// Deleting a post takes its photos with it
+	if err := store.UpdatePostWithImages(postID, "Pram", "Folds flat", "General", false, gallery); err != nil {
+		t.Fatalf("UpdatePostWithImages failed: %v", err)
+	}
+	if err := store.DeletePost(postID); err != nil {
+		t.Fatalf("DeletePost failed: %v", err)
+	}
+	var left int
+	if err := conn.Conn.QueryRow("SELECT COUNT(*) FROM post_images").Scan(&left); err != nil || left != 0 {
+		t.Errorf("expected the photos to be deleted with the post, got %d (err %v)", left, err)
+	}
+}
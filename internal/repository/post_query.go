@@ -0,0 +1,389 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// PostSort is the order posts are listed in
+type PostSort string
+
+const (
+	SortNewest        PostSort = "newest"
+	SortOldest        PostSort = "oldest"
+	SortMostLiked     PostSort = "most_liked"
+	SortMostCommented PostSort = "most_commented"
+	SortRelevance     PostSort = "relevance" // Best search matches first; only applies when searching
+)
+
+// postSortOrders maps each supported sort to its ORDER BY clause. Only these fixed
+// strings are ever placed in the SQL, so the sort can come straight from a URL.
+var postSortOrders = map[PostSort]string{
+	SortNewest:        "posts.created_at DESC, posts.id DESC",
+	SortOldest:        "posts.created_at ASC, posts.id ASC",
+	SortMostLiked:     "likes DESC, posts.created_at DESC, posts.id DESC",
+	SortMostCommented: "comment_count DESC, posts.created_at DESC, posts.id DESC",
+	SortRelevance:     "search.rank ASC, posts.created_at DESC, posts.id DESC",
+}
+
+// DefaultPageSize is how many posts FetchPostPage returns when the query sets no Limit
+const DefaultPageSize = 20
+
+// postCursorTimeLayout matches how SQLite's CURRENT_TIMESTAMP stores posts.created_at, so
+// cursors compare directly against the column and can use its index
+const postCursorTimeLayout = "2006-01-02 15:04:05"
+
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// PostCursor marks the last post on a page. The next page starts after it in
+// (created_at, id) order, so new posts arriving don't shift or repeat results.
+type PostCursor struct {
+	CreatedAt time.Time
+	ID        int
+}
+
+// String encodes the cursor as an opaque, URL-safe token
+func (c PostCursor) String() string {
+	raw := c.CreatedAt.UTC().Format(postCursorTimeLayout) + "|" + strconv.Itoa(c.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParsePostCursor decodes a token made by PostCursor.String
+func ParsePostCursor(token string) (PostCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return PostCursor{}, ErrInvalidCursor
+	}
+	createdAt, id, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return PostCursor{}, ErrInvalidCursor
+	}
+
+	var cursor PostCursor
+	if cursor.CreatedAt, err = time.Parse(postCursorTimeLayout, createdAt); err != nil {
+		return PostCursor{}, ErrInvalidCursor
+	}
+	if cursor.ID, err = strconv.Atoi(id); err != nil || cursor.ID <= 0 {
+		return PostCursor{}, ErrInvalidCursor
+	}
+	return cursor, nil
+}
+
+// PostQuery describes which posts to list. Zero values mean "no filter", so an empty
+// PostQuery lists every post, newest first. All values are passed to SQL as parameters.
+type PostQuery struct {
+	Categories    []string  // Match any of these categories, by name or slug
+	StartDate     time.Time // Posts created on or after this day
+	EndDate       time.Time // Posts created on or before this day
+	Author        string    // Username of the author
+	CreatedBy     int       // User ID of the author
+	LikedBy       int       // Only posts this user has liked
+	DonationsOnly bool      // Only posts offered as donations
+	Country       string    // Only donations offered in this country
+	Search        string    // Words, "phrases" and prefix* terms to look for, see parseSearchTerms
+	Sort          PostSort
+	IncludeHidden bool // Include posts hidden by moderators, for the moderation dashboard
+
+	// Paging. After continues from a cursor and only applies to the date sorts (see
+	// SupportsCursor); Offset skips posts instead and works with any sort. Limit 0 means no limit.
+	After  *PostCursor
+	Limit  int
+	Offset int
+
+	// ViewerID is the logged-in user, used to fill in Post.UserReaction and comment reactions
+	ViewerID int
+}
+
+// HasCategory reports whether the query filters on the category, for pre-selecting form fields
+func (q PostQuery) HasCategory(category Category) bool {
+	for _, c := range q.Categories {
+		if c == category.Name || strings.EqualFold(c, category.Slug) {
+			return true
+		}
+	}
+	return false
+}
+
+// SortOrDefault returns the query's sort, falling back to relevance for searches and
+// newest first otherwise
+func (q PostQuery) SortOrDefault() PostSort {
+	if _, ok := postSortOrders[q.Sort]; ok && (q.Sort != SortRelevance || q.Search != "") {
+		return q.Sort
+	}
+	if q.Search != "" {
+		return SortRelevance
+	}
+	return SortNewest
+}
+
+// rankedSearch reports whether the query searches the full-text index, which ranks and
+// highlights matches. Without FTS5 (fullText false) searches still filter, but relevance
+// sorts by newest.
+func (q PostQuery) rankedSearch(fullText bool) bool {
+	return q.Search != "" && fullText && len(parseSearchTerms(q.Search)) > 0
+}
+
+// orderBy returns the ORDER BY clause for the query's sort
+func (q PostQuery) orderBy(fullText bool) string {
+	sort := q.SortOrDefault()
+	if sort == SortRelevance && !q.rankedSearch(fullText) {
+		sort = SortNewest
+	}
+	return postSortOrders[sort]
+}
+
+// SupportsCursor reports whether the query's sort can be paged with a PostCursor. The
+// popularity sorts change as people react, so they are paged by offset instead.
+func (q PostQuery) SupportsCursor() bool {
+	sort := q.SortOrDefault()
+	return sort == SortNewest || sort == SortOldest
+}
+
+// where builds the WHERE clause and its arguments for the query's filters
+func (q PostQuery) where(fullText bool) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if !q.IncludeHidden {
+		conditions = append(conditions, "posts.hidden_at IS NULL")
+	}
+	if len(q.Categories) > 0 {
+		placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(q.Categories)), ", ")
+		conditions = append(conditions, "(posts.category IN ("+placeholders+") OR "+
+			"posts.category IN (SELECT name FROM categories WHERE slug IN ("+placeholders+")))")
+		for _, c := range q.Categories {
+			args = append(args, c)
+		}
+		for _, c := range q.Categories {
+			args = append(args, c)
+		}
+	}
+	if !q.StartDate.IsZero() {
+		conditions = append(conditions, "DATE(posts.created_at) >= DATE(?)")
+		args = append(args, q.StartDate.Format("2006-01-02"))
+	}
+	if !q.EndDate.IsZero() {
+		conditions = append(conditions, "DATE(posts.created_at) <= DATE(?)")
+		args = append(args, q.EndDate.Format("2006-01-02"))
+	}
+	if q.Author != "" {
+		conditions = append(conditions, "users.username = ?")
+		args = append(args, q.Author)
+	}
+	if q.CreatedBy != 0 {
+		conditions = append(conditions, "posts.user_id = ?")
+		args = append(args, q.CreatedBy)
+	}
+	if q.LikedBy != 0 {
+		conditions = append(conditions, "posts.id IN (SELECT post_id FROM post_reactions WHERE user_id = ? AND reaction_type = 'like')")
+		args = append(args, q.LikedBy)
+	}
+	if q.DonationsOnly {
+		conditions = append(conditions, "posts.is_donation = 1")
+	}
+	if q.Country != "" {
+		conditions = append(conditions, "posts.is_donation = 1 AND posts.donation_country = ?")
+		args = append(args, q.Country)
+	}
+	if q.Search != "" && !q.rankedSearch(fullText) {
+		terms := parseSearchTerms(q.Search)
+		if len(terms) == 0 {
+			// Nothing searchable, such as a lone quote or *
+			conditions = append(conditions, "0 = 1")
+		}
+		termConditions, termArgs := likeSearchConditions(terms)
+		conditions = append(conditions, termConditions...)
+		args = append(args, termArgs...)
+	}
+	if q.After != nil && q.SupportsCursor() {
+		comparison := "<"
+		if q.SortOrDefault() == SortOldest {
+			comparison = ">"
+		}
+		createdAt := q.After.CreatedAt.UTC().Format(postCursorTimeLayout)
+		conditions = append(conditions, "(posts.created_at "+comparison+" ? OR (posts.created_at = ? AND posts.id "+comparison+" ?))")
+		args = append(args, createdAt, createdAt, q.After.ID)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+	return "WHERE " + strings.Join(conditions, "\n\t\t  AND "), args
+}
+
+// postAggregateJoins adds each post's reaction counts, comment count and the viewer's
+// reaction as joined, pre-aggregated tables. The first placeholder is the viewer's user ID.
+const postAggregateJoins = `LEFT JOIN (
+			SELECT post_id,
+			       SUM(CASE WHEN reaction_type = 'like' THEN 1 ELSE 0 END) AS likes,
+			       SUM(CASE WHEN reaction_type = 'dislike' THEN 1 ELSE 0 END) AS dislikes
+			FROM post_reactions
+			GROUP BY post_id
+		) AS reaction_counts ON reaction_counts.post_id = posts.id
+		LEFT JOIN (
+			SELECT post_id, COUNT(*) AS comment_count
+			FROM comments
+			WHERE hidden_at IS NULL
+			GROUP BY post_id
+		) AS comment_counts ON comment_counts.post_id = posts.id
+		LEFT JOIN (
+			SELECT post_id, MAX(reaction_type) AS reaction_type
+			FROM post_reactions
+			WHERE user_id = ?
+			GROUP BY post_id
+		) AS viewer_reaction ON viewer_reaction.post_id = posts.id`
+
+// FetchPostsByQuery lists the posts matching q, with reaction counts, the viewer's
+// reaction and each post's comments. However many posts match, this takes two queries:
+// one for the posts and one for all of their comments.
+func (store *SQLStore) FetchPostsByQuery(q PostQuery) ([]Post, error) {
+	posts, err := store.fetchPostRows(q)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch comments and photos once the post rows are closed
+	if err := store.attachComments(posts, q.ViewerID); err != nil {
+		return nil, err
+	}
+	if err := store.attachImages(posts); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// fetchPostRows runs the post listing query for q without loading comments
+func (store *SQLStore) fetchPostRows(q PostQuery) ([]Post, error) {
+	fullText := store.db.FullTextSearch
+	where, whereArgs := q.where(fullText)
+	args := []interface{}{q.ViewerID}
+
+	// Full-text searches join the matching rows of the search index with their rank and a
+	// highlighted snippet; bm25 weights title matches highest and comment matches lowest
+	snippetColumn, searchJoin := "''", ""
+	if q.rankedSearch(fullText) {
+		snippetColumn = "search.snippet"
+		searchJoin = `JOIN (
+			SELECT rowid AS post_id,
+			       bm25(post_search, 10.0, 5.0, 3.0, 2.0, 1.0) AS rank,
+			       snippet(post_search, -1, char(2), char(3), '…', 16) AS snippet
+			FROM post_search
+			WHERE post_search MATCH ?
+		) AS search ON search.post_id = posts.id`
+		args = append(args, ftsMatchQuery(parseSearchTerms(q.Search)))
+	}
+	args = append(args, whereArgs...)
+
+	query := `
+		SELECT posts.id, posts.title, posts.content, posts.user_id, posts.category, posts.created_at,
+		       users.username, users.profile_picture, COALESCE(posts.image, '') AS image,
+		       posts.is_donation, COALESCE(posts.donation_country, '') AS donation_country,
+		       COALESCE(posts.donation_status, '') AS donation_status,
+		       COALESCE(reaction_counts.likes, 0) AS likes,
+		       COALESCE(reaction_counts.dislikes, 0) AS dislikes,
+		       COALESCE(comment_counts.comment_count, 0) AS comment_count,
+		       COALESCE(viewer_reaction.reaction_type, '') AS user_reaction,
+		       ` + snippetColumn + ` AS snippet,
+		       posts.hidden_at IS NOT NULL AS hidden
+		FROM posts
+		JOIN users ON posts.user_id = users.id
+		` + postAggregateJoins + `
+		` + searchJoin + `
+		` + where + `
+		ORDER BY ` + q.orderBy(fullText)
+
+	if q.Limit > 0 {
+		query += "\n\t\tLIMIT ? OFFSET ?"
+		args = append(args, q.Limit, q.Offset)
+	} else if q.Offset > 0 {
+		query += "\n\t\tLIMIT -1 OFFSET ?"
+		args = append(args, q.Offset)
+	}
+	rows, err := store.db.Conn.Query(query, args...)
+	if err != nil {
+		log.Println("Error fetching posts by query:", err)
+		return nil, err
+	}
+
+	var posts []Post
+	for rows.Next() {
+		var post Post
+		var createdAt time.Time
+		var commentCount int
+		var snippet string
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID, &post.Category, &createdAt,
+			&post.Username, &post.ProfilePicture, &post.Image, &post.IsDonation, &post.DonationCountry, &post.DonationStatus,
+			&post.Likes, &post.Dislikes, &commentCount, &post.UserReaction, &snippet, &post.Hidden)
+		if err != nil {
+			rows.Close()
+			log.Println("Error scanning post:", err)
+			return nil, err
+		}
+
+		post.CreatedAt = createdAt.Format(time.RFC3339)
+		post.FormattedCreatedAt = createdAt.Format("02 Jan 2006, 15:04")
+		if snippet != "" {
+			post.Snippet = highlightSnippet(snippet)
+		}
+		posts = append(posts, post)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// PostPage is one page of a post listing
+type PostPage struct {
+	Posts   []Post
+	HasMore bool
+	// NextCursor continues the listing after this page. It is empty on the last page and
+	// for sorts that are paged by offset.
+	NextCursor string
+}
+
+// FetchPostPage returns a single page of the posts matching q, at most q.Limit posts
+// (DefaultPageSize if unset), and whether more follow
+func (store *SQLStore) FetchPostPage(q PostQuery) (PostPage, error) {
+	if q.Limit <= 0 {
+		q.Limit = DefaultPageSize
+	}
+	limit := q.Limit
+
+	// Fetch one extra post to find out whether there is another page
+	q.Limit++
+	posts, err := store.fetchPostRows(q)
+	if err != nil {
+		return PostPage{}, err
+	}
+
+	page := PostPage{Posts: posts}
+	if len(posts) > limit {
+		page.Posts = posts[:limit]
+		page.HasMore = true
+
+		if q.SupportsCursor() {
+			last := page.Posts[limit-1]
+			createdAt, err := time.Parse(time.RFC3339, last.CreatedAt)
+			if err != nil {
+				return PostPage{}, err
+			}
+			page.NextCursor = PostCursor{CreatedAt: createdAt, ID: last.ID}.String()
+		}
+	}
+
+	if err := store.attachComments(page.Posts, q.ViewerID); err != nil {
+		return PostPage{}, err
+	}
+	if err := store.attachImages(page.Posts); err != nil {
+		return PostPage{}, err
+	}
+	return page, nil
+}
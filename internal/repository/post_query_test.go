@@ -0,0 +1,199 @@
+package repository_test
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/repository"
+)
+
+// Sets up a file-backed migrated database seeded with two users and a few posts
+func setupPostQueryDB(t *testing.T) *repository.SQLStore {
+	conn, err := db.InitDB(filepath.Join(t.TempDir(), "query.db"))
+	if err != nil {
+		t.Fatalf("failed to open test DB: %v", err)
+	}
+	t.Cleanup(func() { conn.Conn.Close() })
+	if err := conn.RunMigrations(); err != nil {
+		t.Fatalf("failed to run migrations: %v", err)
+	}
+	store := repository.NewSQLStore(conn)
+
+	for _, u := range []string{"ella", "sam"} {
+		if err := store.CreateUser(u, u+"@example.com", "hash", "1.png"); err != nil {
+			t.Fatalf("failed to create user: %v", err)
+		}
+	}
+
+	posts := []struct {
+		userID             int
+		title, category    string
+		isDonation         bool
+		country, createdAt string
+	}{
+		{1, "Pram", "Newborn", false, "no_location", "2024-01-10 09:00:00"},
+		{1, "Cot", "Sleep", true, "Estonia", "2024-02-10 09:00:00"},
+		{2, "Bottles", "Feeding", true, "Finland", "2024-03-10 09:00:00"},
+		{2, "Sling", "Newborn", false, "no_location", "2024-04-10 09:00:00"},
+	}
+	for i, p := range posts {
+		if err := store.CreatePost(p.userID, p.title, "content", p.category, "", p.isDonation, p.country); err != nil {
+			t.Fatalf("failed to create post: %v", err)
+		}
+		if _, err := conn.Conn.Exec("UPDATE posts SET created_at = ? WHERE id = ?", p.createdAt, i+1); err != nil {
+			t.Fatalf("failed to set created_at: %v", err)
+		}
+	}
+	return store
+}
+
+func postTitles(posts []repository.Post) []string {
+	titles := make([]string, len(posts))
+	for i, p := range posts {
+		titles[i] = p.Title
+	}
+	return titles
+}
+
+func TestFetchPostsByQuery(t *testing.T) {
+	t.Parallel()
+	store := setupPostQueryDB(t)
+
+	if err := store.AddReaction(2, 1, "like"); err != nil {
+		t.Fatalf("AddReaction failed: %v", err)
+	}
+	if err := store.CreateComment(1, "3", "Still available?", nil); err != nil {
+		t.Fatalf("CreateComment failed: %v", err)
+	}
+
+	tests := []struct {
+		name  string
+		query repository.PostQuery
+		want  []string
+	}{
+		{"no filters lists newest first", repository.PostQuery{}, []string{"Sling", "Bottles", "Cot", "Pram"}},
+		{"injection attempt is a literal category", repository.PostQuery{Categories: []string{"' OR 1=1--"}}, nil},
+		{"multiple categories", repository.PostQuery{Categories: []string{"Newborn", "Sleep"}}, []string{"Sling", "Cot", "Pram"}},
+		{"date range", repository.PostQuery{
+			StartDate: time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			EndDate:   time.Date(2024, 3, 10, 0, 0, 0, 0, time.UTC),
+		}, []string{"Bottles", "Cot"}},
+		{"author", repository.PostQuery{Author: "sam"}, []string{"Sling", "Bottles"}},
+		{"created by", repository.PostQuery{CreatedBy: 1}, []string{"Cot", "Pram"}},
+		{"liked by", repository.PostQuery{LikedBy: 2}, []string{"Pram"}},
+		{"donations in a country", repository.PostQuery{Country: "Finland"}, []string{"Bottles"}},
+		{"filters compose", repository.PostQuery{DonationsOnly: true, Author: "ella"}, []string{"Cot"}},
+		{"search matches category", repository.PostQuery{Search: "newb*", Sort: repository.SortOldest}, []string{"Pram", "Sling"}},
+		{"oldest first", repository.PostQuery{Sort: repository.SortOldest}, []string{"Pram", "Cot", "Bottles", "Sling"}},
+		{"most liked", repository.PostQuery{Sort: repository.SortMostLiked}, []string{"Pram", "Sling", "Bottles", "Cot"}},
+		{"most commented", repository.PostQuery{Sort: repository.SortMostCommented}, []string{"Bottles", "Sling", "Cot", "Pram"}},
+		{"unknown sort falls back to newest", repository.PostQuery{Sort: "title; DROP TABLE posts"}, []string{"Sling", "Bottles", "Cot", "Pram"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			posts, err := store.FetchPostsByQuery(tt.query)
+			if err != nil {
+				t.Fatalf("FetchPostsByQuery failed: %v", err)
+			}
+			got := postTitles(posts)
+			if len(got) != len(tt.want) {
+				t.Fatalf("expected %v, got %v", tt.want, got)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+			}
+		})
+	}
+
+	posts, err := store.FetchPostsByQuery(repository.PostQuery{Categories: []string{"Newborn"}, ViewerID: 2})
+	if err != nil {
+		t.Fatalf("FetchPostsByQuery failed: %v", err)
+	}
+	if pram := posts[1]; pram.Likes != 1 || pram.UserReaction != "like" {
+		t.Errorf("expected viewer's like on Pram, got likes=%d reaction=%q", pram.Likes, pram.UserReaction)
+	}
+}
+
+func TestFetchPostPage(t *testing.T) {
+	t.Parallel()
+	// 45 posts, several sharing a created_at so the id tiebreaker matters
+	store, conn := seedFeed(t, 3, 45, 1)
+	times := []string{"2024-05-01 10:00:00", "2024-05-01 10:00:00", "2024-05-02 08:30:00"}
+	for id := 1; id <= 45; id++ {
+		if _, err := conn.Conn.Exec("UPDATE posts SET created_at = ? WHERE id = ?", times[id%len(times)], id); err != nil {
+			t.Fatalf("failed to set created_at: %v", err)
+		}
+	}
+
+	walk := func(sort repository.PostSort) []int {
+		var ids []int
+		query := repository.PostQuery{Sort: sort, Limit: 10}
+		for pages := 0; ; pages++ {
+			if pages > 10 {
+				t.Fatal("cursor pagination did not terminate")
+			}
+			page, err := store.FetchPostPage(query)
+			if err != nil {
+				t.Fatalf("FetchPostPage failed: %v", err)
+			}
+			for _, p := range page.Posts {
+				ids = append(ids, p.ID)
+				if len(p.Comments) != 1 {
+					t.Errorf("post %d: expected its comment to be loaded", p.ID)
+				}
+			}
+			if !page.HasMore {
+				if page.NextCursor != "" {
+					t.Error("expected no cursor on the last page")
+				}
+				return ids
+			}
+			cursor, err := repository.ParsePostCursor(page.NextCursor)
+			if err != nil {
+				t.Fatalf("ParsePostCursor failed: %v", err)
+			}
+			query.After = &cursor
+		}
+	}
+
+	all, err := store.FetchPostsByQuery(repository.PostQuery{})
+	if err != nil {
+		t.Fatalf("FetchPostsByQuery failed: %v", err)
+	}
+	newest := walk(repository.SortNewest)
+	if len(newest) != len(all) {
+		t.Fatalf("expected %d posts across pages, got %d", len(all), len(newest))
+	}
+	for i := range all {
+		if newest[i] != all[i].ID {
+			t.Fatalf("page order differs from the full listing at %d: %v", i, newest)
+		}
+	}
+
+	oldest := walk(repository.SortOldest)
+	for i := range oldest {
+		if oldest[i] != newest[len(newest)-1-i] {
+			t.Fatalf("oldest-first pages are not the reverse of newest-first: %v", oldest)
+		}
+	}
+
+	// Popularity sorts page by offset and never hand out a cursor
+	page, err := store.FetchPostPage(repository.PostQuery{Sort: repository.SortMostLiked, Limit: 10, Offset: 40})
+	if err != nil {
+		t.Fatalf("FetchPostPage failed: %v", err)
+	}
+	if len(page.Posts) != 5 || page.HasMore || page.NextCursor != "" {
+		t.Errorf("expected a final page of 5 posts without a cursor, got %d (more=%v)", len(page.Posts), page.HasMore)
+	}
+
+	for _, token := range []string{"", "not-base64!", "MjAyNC0wNS0wMQ"} {
+		if _, err := repository.ParsePostCursor(token); err != repository.ErrInvalidCursor {
+			t.Errorf("ParsePostCursor(%q): expected ErrInvalidCursor, got %v", token, err)
+		}
+	}
+}
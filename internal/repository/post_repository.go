@@ -2,13 +2,8 @@ package repository
 
 import (
 	"database/sql"
-	"fmt"
-	"io"
+	"html/template"
 	"log"
-	"mime/multipart"
-	"os"
-	"path/filepath"
-	"strconv"
 	"time"
 )
 
@@ -26,82 +21,76 @@ type Post struct {
 	Likes              int
 	Dislikes           int
 	UserReaction       string
-	Image              string
+	Image              string      // The cover: the first of Images, or the placeholder
+	Images             []PostImage // The gallery, in order
 	ShowDonatedLabel   bool
 	IsDonation         bool
 	DonationCountry    string
+	DonationStatus     DonationStatus // Empty unless the post is a donation
+	Snippet            template.HTML  // Highlighted extract of a search match
+	Hidden             bool           // Hidden by a moderator
 }
 
-func CreatePost(userID int, title, content, category, image string, isDonation bool, donationCountry string) error {
-	query := `
-	INSERT INTO posts (user_id, title, content, category, image, is_donation, donation_country)
-	VALUES (?, ?, ?, ?, ?, ?, ?)
-`
-	_, err := database.Conn.Exec(query, userID, title, content, category, image, isDonation, donationCountry)
+// CommentCount returns the number of comments on the post, including nested replies
+func (p Post) CommentCount() int {
+	return CountComments(p.Comments)
+}
+
+func (store *SQLStore) CreatePost(userID int, title, content, category, image string, isDonation bool, donationCountry string) error {
+	_, err := store.CreatePostReturningID(userID, title, content, category, image, isDonation, donationCountry)
+	return err
+}
+
+// CreatePostReturningID inserts a post and returns the new post's ID
+func (store *SQLStore) CreatePostReturningID(userID int, title, content, category, image string, isDonation bool, donationCountry string) (int, error) {
+	result, err := store.db.Conn.Exec(createPostQuery, userID, title, content, category, image, isDonation, donationCountry, isDonation)
 	if err != nil {
 		log.Println("Error creating post:", err)
-		return err
+		return 0, err
 	}
-	return nil
+	postID, err := result.LastInsertId()
+	return int(postID), err
 }
 
-func FetchPosts(userID int) ([]Post, error) {
-	query := `
-        SELECT posts.id, posts.title, posts.content, posts.user_id, posts.category, posts.created_at, users.username, users.profile_picture, COALESCE(posts.image, '') AS image, posts.is_donation, COALESCE(posts.donation_country, '') AS donation_country
-
-        FROM posts
-        JOIN users ON posts.user_id = users.id
-        ORDER BY posts.created_at DESC`
+// FetchPosts lists every post, newest first, with reactions and comments for the given viewer
+func (store *SQLStore) FetchPosts(userID int) ([]Post, error) {
+	return store.FetchPostsByQuery(PostQuery{ViewerID: userID})
+}
 
-	rows, err := database.Conn.Query(query)
-	if err != nil {
-		log.Println("Error fetching posts:", err)
-		return nil, err
+// attachComments loads the comment trees for all of posts in one batch and sets each post's Comments
+func (store *SQLStore) attachComments(posts []Post, viewerID int) error {
+	if len(posts) == 0 {
+		return nil
 	}
-	defer rows.Close()
-
-	var posts []Post
-	for rows.Next() {
-		var post Post
-		err = rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID, &post.Category, &post.CreatedAt, &post.Username, &post.ProfilePicture, &post.Image, &post.IsDonation, &post.DonationCountry)
-		if err != nil {
-			log.Println("Error scanning post:", err)
-			return nil, err
-		}
 
-		// Parse and format CreatedAt
-		parsedTime, err := time.Parse(time.RFC3339, post.CreatedAt)
-		if err != nil {
-			log.Println("Error parsing CreatedAt:", err)
-			post.FormattedCreatedAt = post.CreatedAt // Fallback if parsing fails
-		} else {
-			post.FormattedCreatedAt = parsedTime.Format("02 Jan 2006, 15:04")
-		}
+	postIDs := make([]int, len(posts))
+	for i := range posts {
+		postIDs[i] = posts[i].ID
+	}
 
-		// Fetch comments
-		comments, err := FetchCommentsForPost(post.ID, userID)
-		if err != nil {
-			log.Println("Error fetching comments for post:", err)
-			return nil, err
-		}
-		post.Comments = comments
-		posts = append(posts, post)
+	comments, err := store.FetchCommentsForPosts(postIDs, viewerID)
+	if err != nil {
+		log.Println("Error fetching comments for posts:", err)
+		return err
 	}
-	return posts, nil
+	for i := range posts {
+		posts[i].Comments = comments[posts[i].ID]
+	}
+	return nil
 }
 
-func GetPostByID(postID string, userID int) (*Post, error) {
+func (store *SQLStore) GetPostByID(postID string, userID int) (*Post, error) {
 	query := `
         SELECT posts.id, posts.title, posts.content, posts.user_id, posts.category, posts.created_at,
        users.username, users.profile_picture, COALESCE(posts.image, ''),
-       posts.is_donation, COALESCE(posts.donation_country, '')
+       posts.is_donation, COALESCE(posts.donation_country, ''), COALESCE(posts.donation_status, ''), posts.hidden_at IS NOT NULL
 
         FROM posts
         JOIN users ON posts.user_id = users.id
         WHERE posts.id = ?`
 
 	var post Post
-	err := database.Conn.QueryRow(query, postID).Scan(
+	err := store.db.Conn.QueryRow(query, postID).Scan(
 		&post.ID,
 		&post.Title,
 		&post.Content,
@@ -113,6 +102,8 @@ func GetPostByID(postID string, userID int) (*Post, error) {
 		&post.Image,
 		&post.IsDonation,
 		&post.DonationCountry,
+		&post.DonationStatus,
+		&post.Hidden,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -133,65 +124,84 @@ func GetPostByID(postID string, userID int) (*Post, error) {
 	}
 
 	// Fetch comments
-	comments, err := FetchCommentsForPost(post.ID, userID)
+	comments, err := store.FetchCommentsForPost(post.ID, userID)
 	if err != nil {
 		log.Println("Error fetching comments for post:", err)
 		return nil, err
 	}
 	post.Comments = comments
 
+	gallery, err := store.FetchImagesForPosts([]int{post.ID})
+	if err != nil {
+		log.Println("Error fetching images for post:", err)
+		return nil, err
+	}
+	post.Images = gallery[post.ID]
+
 	return &post, nil
 }
 
-func AddReaction(userID int, postID int, reactionType string) error {
+func (store *SQLStore) AddReaction(userID int, postID int, reactionType string) error {
 	// First, check if the user already reacted to this post
 	query := `SELECT reaction_type FROM post_reactions WHERE post_id = ? AND user_id = ?`
 	var existingReaction string
-	err := database.Conn.QueryRow(query, postID, userID).Scan(&existingReaction)
+	err := store.db.Conn.QueryRow(query, postID, userID).Scan(&existingReaction)
 
 	if err == sql.ErrNoRows {
 		// No previous reaction, insert a new one
 		insertQuery := `INSERT INTO post_reactions (post_id, user_id, reaction_type) VALUES (?, ?, ?)`
-		log.Printf("AddReaction: Inserting new reaction for userID=%d, postID=%d, reactionType=%s", userID, postID, reactionType)
-		_, err := database.Conn.Exec(insertQuery, postID, userID, reactionType)
-		return err
+		if _, err := store.db.Conn.Exec(insertQuery, postID, userID, reactionType); err != nil {
+			return err
+		}
+		notify(store.db.Conn, store.contentAuthor("posts", postID), userID, NotificationReaction, postID, 0, reactionType)
+		return nil
 	} else if err != nil {
 		log.Println("AddReaction: Error checking reaction:", err)
 		return err
 	}
 
 	// If the user has already reacted, update the reaction
-	log.Printf("AddReaction: Updating reaction for userID=%d, postID=%d, existingReaction=%s, newReaction=%s", userID, postID, existingReaction, reactionType)
 	if existingReaction != reactionType {
 		updateQuery := `UPDATE post_reactions SET reaction_type = ? WHERE post_id = ? AND user_id = ?`
-		_, err = database.Conn.Exec(updateQuery, reactionType, postID, userID)
-		return err
+		if _, err = store.db.Conn.Exec(updateQuery, reactionType, postID, userID); err != nil {
+			return err
+		}
+		notify(store.db.Conn, store.contentAuthor("posts", postID), userID, NotificationReaction, postID, 0, reactionType)
+		return nil
 	}
 
 	// If the user has already reacted with the same type, no action needed
-	log.Printf("AddReaction: No update needed, userID=%d, postID=%d, reactionType=%s", userID, postID, reactionType)
 	return nil
 }
 
-func FetchReactionsCount(postID int) (likes int, dislikes int, err error) {
+// RemoveReaction clears the user's like or dislike on a post
+func (store *SQLStore) RemoveReaction(userID int, postID int) error {
+	_, err := store.db.Conn.Exec("DELETE FROM post_reactions WHERE post_id = ? AND user_id = ?", postID, userID)
+	if err != nil {
+		log.Println("Error removing reaction:", err)
+	}
+	return err
+}
+
+func (store *SQLStore) FetchReactionsCount(postID int) (likes int, dislikes int, err error) {
 	query := `
         SELECT 
             COALESCE(SUM(CASE WHEN reaction_type = 'like' THEN 1 ELSE 0 END), 0) AS likes,
             COALESCE(SUM(CASE WHEN reaction_type = 'dislike' THEN 1 ELSE 0 END), 0) AS dislikes
         FROM post_reactions WHERE post_id = ?`
-	err = database.Conn.QueryRow(query, postID).Scan(&likes, &dislikes)
+	err = store.db.Conn.QueryRow(query, postID).Scan(&likes, &dislikes)
 	if err != nil {
 		log.Println("Error fetching reactions count:", err)
 	}
 	return likes, dislikes, err
 }
 
-func FetchUserReaction(userID int, postID int) (string, error) {
+func (store *SQLStore) FetchUserReaction(userID int, postID int) (string, error) {
 	var reaction string
 
 	query := `SELECT reaction_type FROM post_reactions WHERE user_id = ? AND post_id = ?`
 
-	err := database.Conn.QueryRow(query, userID, postID).Scan(&reaction)
+	err := store.db.Conn.QueryRow(query, userID, postID).Scan(&reaction)
 	if err == sql.ErrNoRows {
 		// No reaction found, return an empty string
 		return "", nil
@@ -203,237 +213,52 @@ func FetchUserReaction(userID int, postID int) (string, error) {
 	return reaction, nil
 }
 
-//Filtering
-
-func FetchCategories() ([]string, error) {
-	query := `SELECT DISTINCT category FROM posts ORDER BY category`
-	rows, err := database.Conn.Query(query)
-	if err != nil {
-		log.Println("Error fetching categories from DB:", err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	var categories []string
-	for rows.Next() {
-		var category string
-		if err := rows.Scan(&category); err != nil {
-			log.Println("Error scanning category row:", err)
-			return nil, err
-		}
-		log.Println("Fetched category:", category)
-		categories = append(categories, category)
-	}
-
-	// Check if any categories were fetched
-	if len(categories) == 0 {
-		log.Println("No categories found in database.")
-	}
-
-	return categories, nil
-}
-
-func FetchFilteredPosts(category, createdPosts, likedPosts, startDate, endDate string, userID int, isLoggedIn bool) ([]Post, error) {
-	query := `
-		SELECT posts.id, posts.title, posts.content, posts.user_id, posts.category, posts.created_at,
-		       users.username, users.profile_picture, COALESCE(posts.image, '') AS image, posts.is_donation, COALESCE(posts.donation_country, '')
-		FROM posts
-		JOIN users ON posts.user_id = users.id
-		WHERE 1=1`
-
-	// Dynamic filters
-	if category != "" {
-		query += " AND posts.category = '" + category + "'"
-	}
-	if startDate != "" {
-		query += " AND DATE(posts.created_at) >= DATE('" + startDate + "')"
-	}
-	if endDate != "" {
-		query += " AND DATE(posts.created_at) <= DATE('" + endDate + "')"
-	}
-	if createdPosts == "true" && isLoggedIn {
-		query += " AND posts.user_id = " + strconv.Itoa(userID)
-	}
-	if likedPosts == "true" && isLoggedIn {
-		query += ` AND posts.id IN (SELECT post_id FROM post_reactions WHERE user_id = ` + strconv.Itoa(userID) + ` AND reaction_type = 'like')`
-	}
-
-	query += " ORDER BY posts.created_at DESC"
+// DeletePost removes a post from the database by its ID
+func (store *SQLStore) DeletePost(postID int) error {
+	query := "DELETE FROM posts WHERE id = ?"
 
-	rows, err := database.Conn.Query(query)
+	_, err := store.db.Conn.Exec(query, postID)
 	if err != nil {
-		log.Println("Error fetching filtered posts:", err)
-		return nil, err
-	}
-	defer rows.Close()
-
-	var posts []Post
-	for rows.Next() {
-		var post Post
-		var createdAt time.Time
-
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.UserID, &post.Category, &createdAt, &post.Username, &post.ProfilePicture, &post.Image, &post.IsDonation, &post.DonationCountry)
-		if err != nil {
-			log.Println("Error scanning filtered post:", err)
-			return nil, err
-		}
-
-		post.CreatedAt = createdAt.Format(time.RFC3339)
-		post.FormattedCreatedAt = createdAt.Format("02 Jan 2006, 15:04")
-
-		// Fetch comments
-		comments, err := FetchCommentsForPost(post.ID, userID)
-		if err != nil {
-			log.Println("Error fetching comments:", err)
-			return nil, err
-		}
-		post.Comments = comments
-
-		// Fetch reactions
-		likes, dislikes, err := FetchReactionsCount(post.ID)
-		if err != nil {
-			log.Println("Error fetching reactions count:", err)
-			return nil, err
-		}
-		post.Likes = likes
-		post.Dislikes = dislikes
-
-		// If logged in, fetch user reaction
-		if isLoggedIn {
-			reaction, err := FetchUserReaction(userID, post.ID)
-			if err != nil {
-				log.Println("Error fetching user reaction:", err)
-				return nil, err
-			}
-			post.UserReaction = reaction
-		}
-
-		posts = append(posts, post)
+		log.Println("Error deleting post:", err)
+		return err
 	}
 
-	return posts, nil
+	return nil
 }
 
-//Search
-
-func SearchPosts(searchQuery string, userID int, isLoggedIn bool) ([]Post, error) {
-	query := `
-    SELECT posts.id, posts.title, posts.content, posts.category, posts.created_at,
-           users.username, users.profile_picture, COALESCE(posts.image, '') AS image, posts.is_donation, COALESCE(posts.donation_country, '')
-    FROM posts
-    JOIN users ON posts.user_id = users.id
-    WHERE posts.title LIKE '%' || ? || '%' 
-       OR posts.content LIKE '%' || ? || '%'
-       OR posts.category LIKE '%' || ? || '%'
-       OR users.username LIKE '%' || ? || '%'
-    ORDER BY posts.created_at DESC`
-
-	rows, err := database.Conn.Query(query, searchQuery, searchQuery, searchQuery, searchQuery)
+// UpdatePost updates a post's title, content, and category in the database. Changing
+// whether it is a donation goes through the donation lifecycle, see setDonationFlag.
+func (store *SQLStore) UpdatePost(postID int, title, content, category string, isDonation bool) error {
+	tx, err := store.db.Conn.Begin()
 	if err != nil {
-		log.Println("Error searching posts:", err)
-		return nil, err
+		return err
 	}
-	defer rows.Close()
-
-	var posts []Post
-	for rows.Next() {
-		var post Post
-		err := rows.Scan(
-			&post.ID,
-			&post.Title,
-			&post.Content,
-			&post.Category,
-			&post.CreatedAt,
-			&post.Username,
-			&post.ProfilePicture,
-			&post.Image,
-			&post.IsDonation,
-			&post.DonationCountry,
-		)
-		if err != nil {
-			log.Println("Error scanning post during search:", err)
-			return nil, err
-		}
-
-		// Format date
-		parsedTime, err := time.Parse(time.RFC3339, post.CreatedAt)
-		if err != nil {
-			log.Println("Error parsing CreatedAt:", err)
-			post.FormattedCreatedAt = post.CreatedAt
-		} else {
-			post.FormattedCreatedAt = parsedTime.Format("02 Jan 2006, 15:04")
-		}
-
-		// Fetch comments
-		comments, err := FetchCommentsForPost(post.ID, userID)
-		if err != nil {
-			log.Println("Error fetching comments for post:", err)
-			return nil, err
-		}
-		post.Comments = comments
+	defer tx.Rollback()
 
-		// Fetch reaction counts
-		likes, dislikes, err := FetchReactionsCount(post.ID)
-		if err != nil {
-			log.Println("Error fetching reaction counts:", err)
-			return nil, err
-		}
-		post.Likes = likes
-		post.Dislikes = dislikes
-
-		// If logged in, get user's reaction
-		if isLoggedIn {
-			userReaction, err := FetchUserReaction(userID, post.ID)
-			if err != nil {
-				log.Println("Error fetching user reaction for post:", err)
-				return nil, err
-			}
-			post.UserReaction = userReaction
-		}
-
-		posts = append(posts, post)
+	if err := setDonationFlag(tx, postID, isDonation); err != nil {
+		return err
 	}
-
-	return posts, nil
-}
-
-// DeletePost removes a post from the database by its ID
-func DeletePost(postID int) error {
-	query := "DELETE FROM posts WHERE id = ?"
-
-	_, err := database.Conn.Exec(query, postID)
+	_, err = tx.Exec("UPDATE posts SET title = ?, content = ?, category = ? WHERE id = ?", title, content, category, postID)
 	if err != nil {
-		log.Println("Error deleting post:", err)
+		log.Println("Error updating post:", err)
 		return err
 	}
-
-	return nil
+	return tx.Commit()
 }
 
-// UpdatePost updates a post's title, content, and category in the database
-func UpdatePost(postID int, title, content, category string, isDonation bool) error {
-	query := `
-		UPDATE posts
-		SET title = ?, content = ?, category = ?, is_donation = ?
-		WHERE id = ?
-	`
-	_, err := database.Conn.Exec(query, title, content, category, isDonation, postID)
-	return err
-}
-
-func FetchLikedPosts(userID int) ([]Post, error) {
+func (store *SQLStore) FetchLikedPosts(userID int) ([]Post, error) {
 	query := `
 		SELECT posts.id, posts.title, posts.content, posts.user_id, posts.category, posts.created_at,
-       users.username, users.profile_picture, posts.is_donation, COALESCE(posts.donation_country, '')
+       users.username, users.profile_picture, posts.is_donation, COALESCE(posts.donation_country, ''), COALESCE(posts.donation_status, '')
  
 		FROM posts
 		JOIN post_reactions ON posts.id = post_reactions.post_id
 		JOIN users ON posts.user_id = users.id
-		WHERE post_reactions.user_id = ? AND post_reactions.reaction_type = 'like'
+		WHERE post_reactions.user_id = ? AND post_reactions.reaction_type = 'like' AND posts.hidden_at IS NULL
 		ORDER BY posts.created_at DESC
 	`
 
-	rows, err := database.Conn.Query(query, userID)
+	rows, err := store.db.Conn.Query(query, userID)
 	if err != nil {
 		log.Println("Error fetching liked posts:", err)
 		return nil, err
@@ -456,6 +281,7 @@ func FetchLikedPosts(userID int) ([]Post, error) {
 			&post.ProfilePicture,
 			&post.IsDonation,
 			&post.DonationCountry,
+			&post.DonationStatus,
 		)
 		if err != nil {
 			log.Println("Error scanning liked post:", err)
@@ -471,32 +297,22 @@ func FetchLikedPosts(userID int) ([]Post, error) {
 	return posts, nil
 }
 
-// UpdatePostWithImage updates a post's title, content, category, donation flag, and image in the database
-func UpdatePostWithImage(postID int, title, content, category string, isDonation bool, image string) error {
+// FetchTopPostsByLikes returns the most liked posts with their reaction counts and the viewer's reaction
+func (store *SQLStore) FetchTopPostsByLikes(limit int, viewerID int) ([]Post, error) {
 	query := `
-		UPDATE posts
-		SET title = ?, content = ?, category = ?, is_donation = ?, image = ?
-		WHERE id = ?
-	`
-	_, err := database.Conn.Exec(query, title, content, category, isDonation, image, postID)
-	if err != nil {
-		log.Println("Error updating post with image:", err)
-	}
-	return err
-}
-
-func FetchTopPostsByLikes(limit int) ([]Post, error) {
-	query := `
-		SELECT posts.id, posts.title, posts.content, posts.category, posts.image, posts.created_at,
-		       users.username, users.profile_picture
+		SELECT posts.id, posts.title, posts.content, posts.category, COALESCE(posts.image, ''), posts.created_at,
+		       users.username, users.profile_picture,
+		       COALESCE(reaction_counts.likes, 0) AS likes,
+		       COALESCE(reaction_counts.dislikes, 0) AS dislikes,
+		       COALESCE(viewer_reaction.reaction_type, '') AS user_reaction
 		FROM posts
 		JOIN users ON posts.user_id = users.id
-		LEFT JOIN post_reactions AS likes ON posts.id = likes.post_id AND likes.reaction_type = 'like'
-		GROUP BY posts.id
-		ORDER BY COUNT(likes.id) DESC
+		` + postAggregateJoins + `
+		WHERE posts.hidden_at IS NULL
+		ORDER BY likes DESC, posts.created_at DESC, posts.id DESC
 		LIMIT ?`
 
-	rows, err := database.Conn.Query(query, limit)
+	rows, err := store.db.Conn.Query(query, viewerID, limit)
 	if err != nil {
 		return nil, err
 	}
@@ -506,7 +322,8 @@ func FetchTopPostsByLikes(limit int) ([]Post, error) {
 	for rows.Next() {
 		var post Post
 		var createdAt time.Time
-		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.Category, &post.Image, &createdAt, &post.Username, &post.ProfilePicture)
+		err := rows.Scan(&post.ID, &post.Title, &post.Content, &post.Category, &post.Image, &createdAt, &post.Username, &post.ProfilePicture,
+			&post.Likes, &post.Dislikes, &post.UserReaction)
 		if err != nil {
 			return nil, err
 		}
@@ -516,29 +333,3 @@ func FetchTopPostsByLikes(limit int) ([]Post, error) {
 	}
 	return posts, nil
 }
-
-func SaveImageFile(file multipart.File, handler *multipart.FileHeader) (string, error) {
-	// Ensure the target directory exists
-	err := os.MkdirAll("web/static/uploads", os.ModePerm)
-	if err != nil {
-		return "", err
-	}
-
-	// Use a unique filename
-	filename := fmt.Sprintf("%d_%s", time.Now().UnixNano(), filepath.Base(handler.Filename))
-
-	dstPath := filepath.Join("web/static/uploads", filename)
-
-	dst, err := os.Create(dstPath)
-	if err != nil {
-		return "", err
-	}
-	defer dst.Close()
-
-	_, err = io.Copy(dst, file)
-	if err != nil {
-		return "", err
-	}
-
-	return filename, nil
-}
@@ -2,6 +2,7 @@ package repository_test
 
 import (
 	"database/sql"
+	"path/filepath"
 	"testing"
 
 	_ "github.com/mattn/go-sqlite3"
@@ -10,9 +11,11 @@ import (
 	"ellas-corner/internal/repository"
 )
 
-// Sets up a test database for the test run only, does not affect forum.db
-func setupTestDB(t *testing.T) *sql.DB {
-	conn, err := sql.Open("sqlite3", ":memory:")
+// Sets up a test database for the test run only, does not affect forum.db. The file lives in
+// a temporary directory; with ":memory:" each connection in the pool would see a different,
+// empty database.
+func setupTestDB(t *testing.T) (*repository.SQLStore, *sql.DB) {
+	conn, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "forum.db"))
 	if err != nil {
 		t.Fatalf("failed to open test DB: %v", err)
 	}
@@ -27,6 +30,8 @@ CREATE TABLE posts (
 	image TEXT,
 	is_donation BOOLEAN,
 	donation_country TEXT,
+	donation_status TEXT,
+	donation_recipient_id INTEGER,
 	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
 );
 CREATE TABLE users (
@@ -46,14 +51,12 @@ CREATE TABLE post_reactions (
 		t.Fatalf("failed to create schema: %v", err)
 	}
 
-	// Inject the test DB into the repository
-	repository.SetDatabase(&db.Database{Conn: conn})
-
-	return conn
+	return repository.NewSQLStore(&db.Database{Conn: conn}), conn
 }
 
 func TestCreatePost(t *testing.T) {
-	testConn := setupTestDB(t)
+	t.Parallel()
+	store, testConn := setupTestDB(t)
 	defer testConn.Close()
 
 	userID := 1
@@ -62,7 +65,7 @@ func TestCreatePost(t *testing.T) {
 		t.Fatalf("failed to insert test user: %v", err)
 	}
 
-	err = repository.CreatePost(userID, "Test Title", "Test Content", "General", "image.jpg", true, "Germany")
+	err = store.CreatePost(userID, "Test Title", "Test Content", "General", "image.jpg", true, "Germany")
 	if err != nil {
 		t.Fatalf("CreatePost failed: %v", err)
 	}
@@ -79,7 +82,8 @@ func TestCreatePost(t *testing.T) {
 }
 
 func TestAddReaction(t *testing.T) {
-	testConn := setupTestDB(t)
+	t.Parallel()
+	store, testConn := setupTestDB(t)
 	defer testConn.Close()
 
 	// Create test user and post
@@ -96,7 +100,7 @@ func TestAddReaction(t *testing.T) {
 	}
 
 	// Insert new "like" reaction
-	err = repository.AddReaction(userID, postID, "like")
+	err = store.AddReaction(userID, postID, "like")
 	if err != nil {
 		t.Fatalf("AddReaction failed on insert: %v", err)
 	}
@@ -111,7 +115,7 @@ func TestAddReaction(t *testing.T) {
 	}
 
 	// Change to "dislike"
-	err = repository.AddReaction(userID, postID, "dislike")
+	err = store.AddReaction(userID, postID, "dislike")
 	if err != nil {
 		t.Fatalf("AddReaction failed on update: %v", err)
 	}
@@ -125,7 +129,7 @@ func TestAddReaction(t *testing.T) {
 	}
 
 	// React again with "dislike" (same) → should be no-op but still same value
-	err = repository.AddReaction(userID, postID, "dislike")
+	err = store.AddReaction(userID, postID, "dislike")
 	if err != nil {
 		t.Fatalf("AddReaction failed on no-op: %v", err)
 	}
@@ -0,0 +1,100 @@
+package repository
+
+import (
+	"html"
+	"html/template"
+	"strings"
+)
+
+// Markers placed around matched words by snippet(); they can't appear in user text after
+// escaping, so they are safe to swap for <mark> tags
+const (
+	snippetMatchStart = "\x02"
+	snippetMatchEnd   = "\x03"
+)
+
+// searchTerm is one word or quoted phrase from a search box query
+type searchTerm struct {
+	Text   string
+	Phrase bool // Came from "double quotes" and must match as a whole
+	Prefix bool // Ended with *, so matches any word starting with Text
+}
+
+// parseSearchTerms splits a search into terms. "Quoted text" is kept together as a phrase,
+// and a trailing * on a word makes it a prefix search. Everything else is a separate word.
+func parseSearchTerms(search string) []searchTerm {
+	var terms []searchTerm
+
+	rest := strings.TrimSpace(search)
+	for rest != "" {
+		if rest[0] == '"' {
+			phrase, after, _ := strings.Cut(rest[1:], `"`)
+			if phrase = strings.Join(strings.Fields(phrase), " "); phrase != "" {
+				terms = append(terms, searchTerm{Text: phrase, Phrase: true})
+			}
+			rest = strings.TrimSpace(after)
+			continue
+		}
+
+		word := rest
+		if i := strings.IndexAny(rest, " \t\n\r\""); i >= 0 {
+			word, rest = rest[:i], rest[i:]
+			if rest[0] != '"' {
+				rest = strings.TrimSpace(rest)
+			}
+		} else {
+			rest = ""
+		}
+
+		term := searchTerm{Text: word}
+		if strings.HasSuffix(term.Text, "*") {
+			term.Text = strings.TrimRight(term.Text, "*")
+			term.Prefix = true
+		}
+		if term.Text != "" {
+			terms = append(terms, term)
+		}
+	}
+	return terms
+}
+
+// ftsMatchQuery turns search terms into an FTS5 MATCH expression where every term must
+// match. Each term is quoted, so FTS5 operators and syntax in user input are treated as text.
+func ftsMatchQuery(terms []searchTerm) string {
+	parts := make([]string, 0, len(terms))
+	for _, term := range terms {
+		part := `"` + strings.ReplaceAll(term.Text, `"`, `""`) + `"`
+		if term.Prefix {
+			part += "*"
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, " ")
+}
+
+// likeSearchConditions is the search used when FTS5 is unavailable: every term must appear
+// somewhere in the post's title, content, category, author or visible comments
+func likeSearchConditions(terms []searchTerm) ([]string, []interface{}) {
+	escaper := strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+	var conditions []string
+	var args []interface{}
+	for _, term := range terms {
+		pattern := "%" + escaper.Replace(term.Text) + "%"
+		conditions = append(conditions, `(posts.title LIKE ? ESCAPE '\'
+			OR posts.content LIKE ? ESCAPE '\'
+			OR posts.category LIKE ? ESCAPE '\'
+			OR users.username LIKE ? ESCAPE '\'
+			OR EXISTS (SELECT 1 FROM comments WHERE comments.post_id = posts.id AND comments.hidden_at IS NULL AND comments.content LIKE ? ESCAPE '\'))`)
+		args = append(args, pattern, pattern, pattern, pattern, pattern)
+	}
+	return conditions, args
+}
+
+// highlightSnippet escapes a snippet() result and wraps the matched words in <mark>
+func highlightSnippet(raw string) template.HTML {
+	escaped := html.EscapeString(raw)
+	escaped = strings.ReplaceAll(escaped, snippetMatchStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, snippetMatchEnd, "</mark>")
+	return template.HTML(escaped)
+}
@@ -0,0 +1,117 @@
+package repository_test
+
+import (
+	"sort"
+	"strings"
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+// Search behaviour shared by the FTS5 index and the LIKE fallback. Run with
+// -tags sqlite_fts5 to exercise the full-text index.
+func TestSearchPosts(t *testing.T) {
+	t.Parallel()
+	store, conn := seedFeed(t, 1, 0, 0)
+
+	posts := []struct{ title, content, category string }{
+		{"Travel pram", "Folds flat in one hand, fits a small car boot", "Travel"},
+		{"Cot", "Sturdy wooden cot, the pram stand is not included", "Sleep"},
+		{"Baby monitor", "Audio only, flat batteries", "Safety"},
+		{"Bottles", "Six anti-colic bottles <b>like new</b>", "Feeding"},
+	}
+	for _, p := range posts {
+		if err := store.CreatePost(1, p.title, p.content, p.category, "", false, "no_location"); err != nil {
+			t.Fatalf("failed to create post: %v", err)
+		}
+	}
+	if err := store.CreateComment(1, "3", "Does it have a night light?", nil); err != nil {
+		t.Fatalf("failed to create comment: %v", err)
+	}
+
+	search := func(q repository.PostQuery) []string {
+		t.Helper()
+		results, err := store.FetchPostsByQuery(q)
+		if err != nil {
+			t.Fatalf("FetchPostsByQuery(%q) failed: %v", q.Search, err)
+		}
+		return postTitles(results)
+	}
+	expectSet := func(q repository.PostQuery, want ...string) {
+		t.Helper()
+		got := search(q)
+		sort.Strings(got)
+		sort.Strings(want)
+		if strings.Join(got, "|") != strings.Join(want, "|") {
+			t.Errorf("search %q: expected %v, got %v", q.Search, want, got)
+		}
+	}
+
+	expectSet(repository.PostQuery{Search: "pram"}, "Travel pram", "Cot")
+	expectSet(repository.PostQuery{Search: "flat pram"}, "Travel pram")
+	expectSet(repository.PostQuery{Search: `"folds flat"`}, "Travel pram")
+	expectSet(repository.PostQuery{Search: "batt*"}, "Baby monitor")
+	expectSet(repository.PostQuery{Search: "night light"}, "Baby monitor")
+	expectSet(repository.PostQuery{Search: "pram", Categories: []string{"Sleep"}}, "Cot")
+	expectSet(repository.PostQuery{Search: "pram", DonationsOnly: true})
+
+	// FTS5 syntax and stray quotes are searched as plain text rather than causing errors
+	for _, q := range []string{`"`, `*`, `pram OR cot`, `NEAR(pram cot)`, `col:pram`, `"unclosed phrase`} {
+		if _, err := store.FetchPostsByQuery(repository.PostQuery{Search: q}); err != nil {
+			t.Errorf("search %q returned an error: %v", q, err)
+		}
+	}
+
+	// The index follows edits and deletes
+	if err := store.UpdatePost(4, "Bottles", "Six bottles with a steriliser", "Feeding", false); err != nil {
+		t.Fatalf("UpdatePost failed: %v", err)
+	}
+	expectSet(repository.PostQuery{Search: "steriliser"}, "Bottles")
+	if err := store.DeletePost(2); err != nil {
+		t.Fatalf("DeletePost failed: %v", err)
+	}
+	expectSet(repository.PostQuery{Search: "pram"}, "Travel pram")
+
+	// Hidden comments can't be searched for, and an author is found by their new name
+	if err := store.SetCommentHidden(1, 1, true, "spam"); err != nil {
+		t.Fatalf("SetCommentHidden failed: %v", err)
+	}
+	expectSet(repository.PostQuery{Search: "night light"})
+	if err := store.SetCommentHidden(1, 1, false, ""); err != nil {
+		t.Fatalf("SetCommentHidden failed: %v", err)
+	}
+	expectSet(repository.PostQuery{Search: "night light"}, "Baby monitor")
+	if _, err := conn.Conn.Exec("UPDATE users SET username = 'grandma' WHERE id = 1"); err != nil {
+		t.Fatalf("failed to rename user: %v", err)
+	}
+	expectSet(repository.PostQuery{Search: "grandma"}, "Travel pram", "Baby monitor", "Bottles")
+
+	if !conn.FullTextSearch {
+		t.Log("FTS5 not available; skipping ranking and highlighting checks")
+		return
+	}
+
+	// Stemming and bm25 ranking: a title match outranks a mention in the content
+	if err := store.CreatePost(1, "Changing mat", "Wipe clean, pairs well with a pram", "Changing", "", false, "no_location"); err != nil {
+		t.Fatalf("failed to create post: %v", err)
+	}
+	if got := search(repository.PostQuery{Search: "prams"}); len(got) != 2 || got[0] != "Travel pram" {
+		t.Errorf("expected the stemmed title match first, got %v", got)
+	}
+
+	results, err := store.FetchPostsByQuery(repository.PostQuery{Search: "bottles"})
+	if err != nil || len(results) != 1 {
+		t.Fatalf("expected one result, got %d (%v)", len(results), err)
+	}
+	if snippet := string(results[0].Snippet); !strings.Contains(snippet, "<mark>") {
+		t.Errorf("expected a highlighted snippet, got %q", snippet)
+	}
+
+	if err := store.UpdatePost(4, "Bottles", "Bottles <b>like new</b>", "Feeding", false); err != nil {
+		t.Fatalf("UpdatePost failed: %v", err)
+	}
+	results, _ = store.FetchPostsByQuery(repository.PostQuery{Search: "new"})
+	if len(results) != 1 || strings.Contains(string(results[0].Snippet), "<b>") {
+		t.Errorf("expected post text in the snippet to be escaped, got %v", results)
+	}
+}
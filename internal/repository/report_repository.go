@@ -0,0 +1,277 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"sort"
+	"time"
+)
+
+// ReportThreshold is how many open reports from different users hide a post or comment
+// automatically until a moderator reviews it
+const ReportThreshold = 3
+
+// ErrAlreadyReported is returned when a user reports the same post or comment twice
+var ErrAlreadyReported = errors.New("already reported")
+
+// ReportReason is the category chosen when reporting a post or comment
+type ReportReason string
+
+const (
+	ReasonRecalled ReportReason = "recalled"
+	ReasonUnsafe   ReportReason = "unsafe"
+	ReasonSpam     ReportReason = "spam"
+	ReasonAbusive  ReportReason = "abusive"
+	ReasonOther    ReportReason = "other"
+)
+
+// ReportReasons lists the reasons in the order they are offered
+var ReportReasons = []ReportReason{ReasonRecalled, ReasonUnsafe, ReasonSpam, ReasonAbusive, ReasonOther}
+
+var reportReasonLabels = map[ReportReason]string{
+	ReasonRecalled: "Recalled product",
+	ReasonUnsafe:   "Unsafe advice",
+	ReasonSpam:     "Spam or advertising",
+	ReasonAbusive:  "Abusive or offensive",
+	ReasonOther:    "Something else",
+}
+
+// ValidReportReason reports whether reason is one of ReportReasons
+func ValidReportReason(reason ReportReason) bool {
+	_, ok := reportReasonLabels[reason]
+	return ok
+}
+
+// Label is the reason as shown to users and moderators
+func (r ReportReason) Label() string {
+	return reportReasonLabels[r]
+}
+
+// ReportResolution is how a moderator closes the open reports on an item
+type ReportResolution string
+
+const (
+	ResolutionDismiss ReportResolution = "dismissed" // Nothing wrong; the item is shown again if reports hid it
+	ResolutionHide    ReportResolution = "hidden"    // The item stays hidden
+	ResolutionWarn    ReportResolution = "warned"    // The author is warned and the item is shown again if reports hid it
+)
+
+// Moderation log actions for reports
+const (
+	ActionAutoHidePost    = "auto_hide_post"
+	ActionAutoHideComment = "auto_hide_comment"
+	ActionDismissReports  = "dismiss_reports"
+	ActionWarnUser        = "warn_user"
+)
+
+// reportTargets maps a report's target_type to its table and automatic hide action. Table
+// names can't be query parameters, so they only ever come from here.
+var reportTargets = map[string]struct {
+	table    string
+	autoHide string
+	hide     string
+}{
+	"post":    {"posts", ActionAutoHidePost, ActionHidePost},
+	"comment": {"comments", ActionAutoHideComment, ActionHideComment},
+}
+
+// ValidReportTarget reports whether targetType is "post" or "comment"
+func ValidReportTarget(targetType string) bool {
+	_, ok := reportTargets[targetType]
+	return ok
+}
+
+// Report is one user's report about a post or comment
+type Report struct {
+	ID                 int
+	ReporterID         int
+	ReporterName       string
+	Reason             ReportReason
+	Details            string
+	CreatedAt          time.Time
+	FormattedCreatedAt string
+}
+
+// ReportedItem is a post or comment with open reports, as shown in the review queue
+type ReportedItem struct {
+	TargetType string // "post" or "comment"
+	TargetID   int
+	PostID     int
+	Title      string // The post title, or the title of the post a comment is on
+	Content    string
+	AuthorID   int
+	AuthorName string
+	Hidden     bool
+	Reports    []Report
+}
+
+// CreateReport records a report about a post or comment and hides the item once it has
+// ReportThreshold open reports. Returns ErrAlreadyReported if the user has reported it before,
+// and sql.ErrNoRows if the item does not exist.
+func (store *SQLStore) CreateReport(reporterID int, targetType string, targetID int, reason ReportReason, details string) (autoHidden bool, err error) {
+	target, ok := reportTargets[targetType]
+	if !ok {
+		return false, sql.ErrNoRows
+	}
+
+	var exists bool
+	if err := store.db.Conn.QueryRow("SELECT EXISTS (SELECT 1 FROM "+target.table+" WHERE id = ?)", targetID).Scan(&exists); err != nil {
+		return false, err
+	}
+	if !exists {
+		return false, sql.ErrNoRows
+	}
+
+	result, err := store.db.Conn.Exec(`
+		INSERT INTO reports (reporter_id, target_type, target_id, reason, details) VALUES (?, ?, ?, ?, ?)
+		ON CONFLICT (reporter_id, target_type, target_id) DO NOTHING`,
+		reporterID, targetType, targetID, reason, details)
+	if err != nil {
+		log.Println("Error creating report:", err)
+		return false, err
+	}
+	if affected, err := result.RowsAffected(); err == nil && affected == 0 {
+		return false, ErrAlreadyReported
+	}
+
+	var open int
+	err = store.db.Conn.QueryRow("SELECT COUNT(*) FROM reports WHERE target_type = ? AND target_id = ? AND status = 'open'", targetType, targetID).Scan(&open)
+	if err != nil || open < ReportThreshold {
+		return false, err
+	}
+
+	// Logged without a moderator. ErrNoRows means the item was already hidden.
+	err = store.moderate(0, target.autoHide, targetType, targetID, "Reached the report threshold",
+		change("UPDATE "+target.table+" SET hidden_at = CURRENT_TIMESTAMP WHERE id = ? AND hidden_at IS NULL", targetID))
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// FetchReportQueue returns every post and comment with open reports, most reported first
+func (store *SQLStore) FetchReportQueue() ([]ReportedItem, error) {
+	query := `
+		SELECT reports.id, reports.reporter_id, reporters.username, reports.reason, reports.details, reports.created_at,
+		       reports.target_type, reports.target_id, COALESCE(posts.id, comment_posts.id),
+		       COALESCE(posts.title, comment_posts.title), COALESCE(posts.content, comments.content),
+		       COALESCE(posts.user_id, comments.user_id), authors.username,
+		       COALESCE(posts.hidden_at, comments.hidden_at) IS NOT NULL
+		FROM reports
+		JOIN users reporters ON reports.reporter_id = reporters.id
+		LEFT JOIN posts ON reports.target_type = 'post' AND posts.id = reports.target_id
+		LEFT JOIN comments ON reports.target_type = 'comment' AND comments.id = reports.target_id
+		LEFT JOIN posts comment_posts ON comments.post_id = comment_posts.id
+		JOIN users authors ON authors.id = COALESCE(posts.user_id, comments.user_id)
+		WHERE reports.status = 'open'
+		ORDER BY reports.created_at, reports.id`
+
+	rows, err := store.db.Conn.Query(query)
+	if err != nil {
+		log.Println("Error fetching report queue:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	type targetKey struct {
+		targetType string
+		targetID   int
+	}
+	var items []*ReportedItem
+	byTarget := map[targetKey]*ReportedItem{}
+	for rows.Next() {
+		var report Report
+		var item ReportedItem
+		if err := rows.Scan(&report.ID, &report.ReporterID, &report.ReporterName, &report.Reason, &report.Details, &report.CreatedAt,
+			&item.TargetType, &item.TargetID, &item.PostID, &item.Title, &item.Content, &item.AuthorID, &item.AuthorName, &item.Hidden); err != nil {
+			return nil, err
+		}
+		report.FormattedCreatedAt = report.CreatedAt.Format("02 Jan 2006, 15:04")
+
+		key := targetKey{item.TargetType, item.TargetID}
+		existing, ok := byTarget[key]
+		if !ok {
+			existing = &item
+			byTarget[key] = existing
+			items = append(items, existing)
+		}
+		existing.Reports = append(existing.Reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	queue := make([]ReportedItem, len(items))
+	for i, item := range items {
+		queue[i] = *item
+	}
+	sort.SliceStable(queue, func(i, j int) bool { return len(queue[i].Reports) > len(queue[j].Reports) })
+	return queue, nil
+}
+
+// ResolveReports closes every open report on a post or comment. Hiding keeps the item
+// hidden; dismissing or warning the author shows it again if reports had hidden it.
+// Returns sql.ErrNoRows if the item has no open reports.
+func (store *SQLStore) ResolveReports(moderatorID int, targetType string, targetID int, resolution ReportResolution, note string) error {
+	target, ok := reportTargets[targetType]
+	if !ok {
+		return sql.ErrNoRows
+	}
+
+	closeReports := change(`UPDATE reports SET status = ?, resolved_by = ?, resolved_at = CURRENT_TIMESTAMP
+		WHERE target_type = ? AND target_id = ? AND status = 'open'`, resolution, moderatorID, targetType, targetID)
+
+	// Only undo a hide made by the report threshold, not one made by a moderator
+	unhideIfAutoHidden := change(`UPDATE `+target.table+` SET hidden_at = NULL WHERE id = ? AND (
+		SELECT action FROM moderation_log WHERE target_type = ? AND target_id = ? ORDER BY id DESC LIMIT 1) = ?`,
+		targetID, targetType, targetID, target.autoHide)
+
+	switch resolution {
+	case ResolutionDismiss:
+		return store.moderate(moderatorID, ActionDismissReports, targetType, targetID, note, closeReports, unhideIfAutoHidden)
+	case ResolutionHide:
+		return store.moderate(moderatorID, target.hide, targetType, targetID, note, closeReports,
+			change("UPDATE "+target.table+" SET hidden_at = COALESCE(hidden_at, CURRENT_TIMESTAMP) WHERE id = ?", targetID))
+	case ResolutionWarn:
+		return store.moderate(moderatorID, ActionWarnUser, targetType, targetID, note, closeReports, unhideIfAutoHidden,
+			change(`INSERT INTO user_warnings (user_id, moderator_id, target_type, target_id, message)
+				SELECT user_id, ?, ?, id, ? FROM `+target.table+` WHERE id = ?`, moderatorID, targetType, note, targetID))
+	}
+	return errors.New("unknown report resolution " + string(resolution))
+}
+
+// Warning is a moderator's warning to an author about one of their posts or comments
+type Warning struct {
+	ID                 int
+	TargetType         string
+	TargetID           int
+	Message            string
+	CreatedAt          time.Time
+	FormattedCreatedAt string
+}
+
+// FetchWarningsForUser returns the warnings a user has received, newest first
+func (store *SQLStore) FetchWarningsForUser(userID int) ([]Warning, error) {
+	rows, err := store.db.Conn.Query(`
+		SELECT id, target_type, target_id, message, created_at
+		FROM user_warnings
+		WHERE user_id = ?
+		ORDER BY created_at DESC, id DESC`, userID)
+	if err != nil {
+		log.Println("Error fetching warnings:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var warnings []Warning
+	for rows.Next() {
+		var w Warning
+		if err := rows.Scan(&w.ID, &w.TargetType, &w.TargetID, &w.Message, &w.CreatedAt); err != nil {
+			return nil, err
+		}
+		w.FormattedCreatedAt = w.CreatedAt.Format("02 Jan 2006, 15:04")
+		warnings = append(warnings, w)
+	}
+	return warnings, rows.Err()
+}
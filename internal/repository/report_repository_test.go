@@ -0,0 +1,117 @@
+package repository_test
+
+import (
+	"database/sql"
+	"testing"
+
+	"ellas-corner/internal/repository"
+)
+
+// postHidden reports whether a post is hidden, failing the test if it can't be loaded
+func postHidden(t *testing.T, store repository.Store, postID int) bool {
+	t.Helper()
+	posts, err := store.FetchPostsByQuery(repository.PostQuery{IncludeHidden: true})
+	if err != nil {
+		t.Fatalf("FetchPostsByQuery failed: %v", err)
+	}
+	for _, p := range posts {
+		if p.ID == postID {
+			return p.Hidden
+		}
+	}
+	t.Fatalf("post %d not found", postID)
+	return false
+}
+
+func TestReportThresholdHidesUntilReviewed(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 5, 2, 0)
+	const moderatorID = 5
+
+	for reporter := 1; reporter < repository.ReportThreshold; reporter++ {
+		hidden, err := store.CreateReport(reporter, "post", 1, repository.ReasonRecalled, "")
+		if err != nil || hidden {
+			t.Fatalf("report %d: expected the post to stay visible, got hidden=%v err=%v", reporter, hidden, err)
+		}
+	}
+	if _, err := store.CreateReport(1, "post", 1, repository.ReasonSpam, ""); err != repository.ErrAlreadyReported {
+		t.Errorf("expected ErrAlreadyReported for a second report from the same user, got %v", err)
+	}
+	if _, err := store.CreateReport(1, "post", 404, repository.ReasonSpam, ""); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows reporting a missing post, got %v", err)
+	}
+	if postHidden(t, store, 1) {
+		t.Fatal("duplicate reports should not count towards the threshold")
+	}
+
+	hidden, err := store.CreateReport(repository.ReportThreshold, "post", 1, repository.ReasonUnsafe, "recall notice")
+	if err != nil || !hidden || !postHidden(t, store, 1) {
+		t.Fatalf("expected the threshold report to hide the post, got hidden=%v err=%v", hidden, err)
+	}
+
+	queue, err := store.FetchReportQueue()
+	if err != nil {
+		t.Fatalf("FetchReportQueue failed: %v", err)
+	}
+	if len(queue) != 1 || queue[0].TargetID != 1 || len(queue[0].Reports) != repository.ReportThreshold || !queue[0].Hidden {
+		t.Fatalf("expected post 1 in the queue with %d reports, got %+v", repository.ReportThreshold, queue)
+	}
+
+	// Dismissing undoes the automatic hide and empties the queue
+	if err := store.ResolveReports(moderatorID, "post", 1, repository.ResolutionDismiss, ""); err != nil {
+		t.Fatalf("ResolveReports failed: %v", err)
+	}
+	if postHidden(t, store, 1) {
+		t.Error("expected dismissing the reports to show the post again")
+	}
+	if queue, _ := store.FetchReportQueue(); len(queue) != 0 {
+		t.Errorf("expected an empty queue, got %d items", len(queue))
+	}
+	if err := store.ResolveReports(moderatorID, "post", 1, repository.ResolutionDismiss, ""); err != sql.ErrNoRows {
+		t.Errorf("expected sql.ErrNoRows with no open reports, got %v", err)
+	}
+}
+
+func TestResolveReports(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 5, 3, 0)
+	const moderatorID = 5
+
+	// A hide by a moderator is not undone by dismissing later reports
+	if err := store.SetPostHidden(moderatorID, 1, true, "off topic"); err != nil {
+		t.Fatalf("SetPostHidden failed: %v", err)
+	}
+	for postID := 1; postID <= 3; postID++ {
+		if _, err := store.CreateReport(1, "post", postID, repository.ReasonOther, ""); err != nil {
+			t.Fatalf("CreateReport failed: %v", err)
+		}
+	}
+	if err := store.ResolveReports(moderatorID, "post", 1, repository.ResolutionDismiss, ""); err != nil {
+		t.Fatalf("ResolveReports failed: %v", err)
+	}
+	if !postHidden(t, store, 1) {
+		t.Error("expected the moderator's hide to stand")
+	}
+
+	if err := store.ResolveReports(moderatorID, "post", 2, repository.ResolutionHide, "unsafe"); err != nil {
+		t.Fatalf("ResolveReports failed: %v", err)
+	}
+	if !postHidden(t, store, 2) {
+		t.Error("expected the post to be hidden")
+	}
+
+	// seedFeed gives post p to user p%users+1, so post 3 is by user 4
+	if err := store.ResolveReports(moderatorID, "post", 3, repository.ResolutionWarn, "Please link the recall notice"); err != nil {
+		t.Fatalf("ResolveReports failed: %v", err)
+	}
+	warnings, err := store.FetchWarningsForUser(4)
+	if err != nil {
+		t.Fatalf("FetchWarningsForUser failed: %v", err)
+	}
+	if len(warnings) != 1 || warnings[0].TargetID != 3 || warnings[0].Message != "Please link the recall notice" {
+		t.Errorf("expected a warning about post 3, got %+v", warnings)
+	}
+	if postHidden(t, store, 3) {
+		t.Error("warning the author should leave the post visible")
+	}
+}
@@ -0,0 +1,130 @@
+package repository
+
+import (
+	"database/sql"
+	"log"
+	"time"
+)
+
+// Session is a signed-in browser or device. Only a hash of the session token is stored.
+type Session struct {
+	ID         int
+	UserID     int
+	TokenHash  string
+	CreatedAt  time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	UserAgent  string
+	IPAddress  string
+	IsCurrent  bool // Set when listing sessions, for the session making the request
+}
+
+// CreateSession stores a new session for the user. A user can have many sessions at once.
+func (store *SQLStore) CreateSession(userID int, tokenHash, userAgent, ipAddress string, expiresAt time.Time) error {
+	now := time.Now().UTC()
+	query := `
+		INSERT INTO sessions (user_id, token_hash, created_at, last_seen_at, expires_at, user_agent, ip_address)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`
+	_, err := store.db.Conn.Exec(query, userID, tokenHash, now, now, expiresAt.UTC(), userAgent, ipAddress)
+	if err != nil {
+		log.Println("Error creating session:", err)
+		return err
+	}
+	return nil
+}
+
+// GetSessionByTokenHash returns the session with the given token hash, or nil if there is none.
+// Expired sessions are still returned; callers check ExpiresAt.
+func (store *SQLStore) GetSessionByTokenHash(tokenHash string) (*Session, error) {
+	query := `
+		SELECT id, user_id, token_hash, created_at, last_seen_at, expires_at, user_agent, ip_address
+		FROM sessions WHERE token_hash = ?`
+
+	var s Session
+	err := store.db.Conn.QueryRow(query, tokenHash).Scan(&s.ID, &s.UserID, &s.TokenHash, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.UserAgent, &s.IPAddress)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	} else if err != nil {
+		log.Println("Error retrieving session:", err)
+		return nil, err
+	}
+	return &s, nil
+}
+
+// TouchSession records activity on a session and moves its expiry forward
+func (store *SQLStore) TouchSession(sessionID int, lastSeenAt, expiresAt time.Time) error {
+	query := "UPDATE sessions SET last_seen_at = ?, expires_at = ? WHERE id = ?"
+	_, err := store.db.Conn.Exec(query, lastSeenAt.UTC(), expiresAt.UTC(), sessionID)
+	if err != nil {
+		log.Println("Error updating session activity:", err)
+	}
+	return err
+}
+
+// FetchSessionsForUser lists a user's unexpired sessions, most recently active first
+func (store *SQLStore) FetchSessionsForUser(userID int) ([]Session, error) {
+	query := `
+		SELECT id, user_id, token_hash, created_at, last_seen_at, expires_at, user_agent, ip_address
+		FROM sessions
+		WHERE user_id = ? AND expires_at > ?
+		ORDER BY last_seen_at DESC`
+
+	rows, err := store.db.Conn.Query(query, userID, time.Now().UTC())
+	if err != nil {
+		log.Println("Error fetching sessions:", err)
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.ID, &s.UserID, &s.TokenHash, &s.CreatedAt, &s.LastSeenAt, &s.ExpiresAt, &s.UserAgent, &s.IPAddress); err != nil {
+			log.Println("Error scanning session:", err)
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+// DeleteSession removes a session from the database based on the session token hash
+func (store *SQLStore) DeleteSession(tokenHash string) error {
+	query := "DELETE FROM sessions WHERE token_hash = ?"
+	_, err := store.db.Conn.Exec(query, tokenHash)
+	if err != nil {
+		log.Println("Error deleting session:", err)
+		return err
+	}
+	return nil
+}
+
+// DeleteSessionByID revokes one of the user's sessions. The user ID is checked so
+// users can only revoke their own sessions.
+func (store *SQLStore) DeleteSessionByID(userID, sessionID int) error {
+	_, err := store.db.Conn.Exec("DELETE FROM sessions WHERE id = ? AND user_id = ?", sessionID, userID)
+	if err != nil {
+		log.Println("Error revoking session:", err)
+	}
+	return err
+}
+
+// DeleteOtherSessions signs the user out everywhere except the session with keepTokenHash
+func (store *SQLStore) DeleteOtherSessions(userID int, keepTokenHash string) (int64, error) {
+	result, err := store.db.Conn.Exec("DELETE FROM sessions WHERE user_id = ? AND token_hash != ?", userID, keepTokenHash)
+	if err != nil {
+		log.Println("Error deleting other sessions:", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// DeleteExpiredSessions removes every session that expired before now and returns how many were removed
+func (store *SQLStore) DeleteExpiredSessions(now time.Time) (int64, error) {
+	result, err := store.db.Conn.Exec("DELETE FROM sessions WHERE expires_at <= ?", now.UTC())
+	if err != nil {
+		log.Println("Error deleting expired sessions:", err)
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,194 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"ellas-corner/internal/db"
+)
+
+// Store is everything the site reads from and writes to its database. SQLStore implements it
+// with SQLite; handlers, sessions and the digest sender only depend on the interface, so each
+// test can give them a store of its own.
+type Store interface {
+	PostStore
+	CategoryStore
+	CommentStore
+	ReactionStore
+	UserStore
+	SessionStore
+	DonationStore
+	MessageStore
+	NotificationStore
+	ModerationStore
+	UploadStore
+
+	// Used by the readiness checks
+	Ping(ctx context.Context) error
+	PendingMigrations() ([]db.Migration, error)
+}
+
+// Make sure SQLStore keeps up with the interface
+var _ Store = (*SQLStore)(nil)
+
+// PostStore creates, edits and lists posts
+type PostStore interface {
+	CreatePost(userID int, title, content, category, image string, isDonation bool, donationCountry string) error
+	CreatePostReturningID(userID int, title, content, category, image string, isDonation bool, donationCountry string) (int, error)
+	GetPostByID(postID string, userID int) (*Post, error)
+	UpdatePost(postID int, title, content, category string, isDonation bool) error
+	CreatePostWithImages(userID int, title, content, category string, isDonation bool, donationCountry string, gallery []PostImage) (int, error)
+	UpdatePostWithImages(postID int, title, content, category string, isDonation bool, gallery []PostImage) error
+	DeletePost(postID int) error
+
+	FetchPosts(userID int) ([]Post, error)
+	FetchPostsByQuery(q PostQuery) ([]Post, error)
+	FetchPostPage(q PostQuery) (PostPage, error)
+	FetchTopPostsByLikes(limit int, viewerID int) ([]Post, error)
+	FetchLikedPosts(userID int) ([]Post, error)
+	FetchPostsByUser(userID int) ([]Post, error)
+	FetchLikedPostsByUser(userID int) ([]Post, error)
+	FetchDislikedPostsByUser(userID int) ([]Post, error)
+	FetchImagesForPosts(postIDs []int) (map[int][]PostImage, error)
+}
+
+// CategoryStore manages the age and stage categories posts are filed under
+type CategoryStore interface {
+	FetchCategories() ([]Category, error)
+	GetCategory(categoryID int) (*Category, error)
+	FindCategory(nameOrSlug string) (*Category, error)
+	CreateCategory(c Category) (int, error)
+	UpdateCategory(c Category) error
+	DeleteCategory(categoryID, moveToID int) error
+}
+
+// CommentStore creates, edits and lists comments and replies
+type CommentStore interface {
+	CreateComment(userID int, postIDStr string, content string, parentCommentID *int) error
+	CreateCommentReturningID(userID int, postID int, content string, parentCommentID *int) (int, error)
+	GetCommentByID(commentID int, userID int) (*Comment, error)
+	UpdateComment(commentID int, content string) error
+	DeleteComment(commentID int) error
+
+	FetchCommentsForPost(postID int, userID int) ([]Comment, error)
+	FetchCommentsForPosts(postIDs []int, userID int) (map[int][]Comment, error)
+	FetchCommentsByUser(userID int) ([]Comment, error)
+	FetchRecentComments(limit int) ([]Comment, error)
+}
+
+// ReactionStore records likes and dislikes on posts and comments
+type ReactionStore interface {
+	AddReaction(userID int, postID int, reactionType string) error
+	RemoveReaction(userID int, postID int) error
+	FetchReactionsCount(postID int) (likes int, dislikes int, err error)
+	FetchUserReaction(userID int, postID int) (string, error)
+
+	AddCommentReaction(userID int, commentID int, reactionType string) error
+	RemoveCommentReaction(userID int, commentID int) error
+	FetchCommentReactionsCount(commentID int) (likes int, dislikes int, err error)
+	FetchUserCommentReaction(userID int, commentID int) (string, error)
+}
+
+// UserStore manages accounts, their settings and their emailed reset and verification tokens
+type UserStore interface {
+	CreateUser(username, email, password, profilePicture string) error
+	GetUserByID(userID int) (User, error)
+	GetUserByEmail(email string) (*User, error)
+	GetUserByUsernameOrEmail(identifier string) (*User, error)
+	FetchUsers() ([]User, error)
+
+	CheckCookieConsent(userID int) (bool, error)
+	SaveCookieConsent(userID int, consentGiven bool) error
+	UpdateProfilePicture(userID int, filePath string) error
+	UpdateUserPreferences(userID int, country string, showDonations bool) error
+	UpdateDonationCountryForUser(userID int, newCountry string) error
+
+	CreateUserToken(userID int, purpose TokenPurpose, tokenHash string, expiresAt time.Time) error
+	CheckUserToken(purpose TokenPurpose, tokenHash string, now time.Time) (int, error)
+	ResetPassword(tokenHash, passwordHash string, now time.Time) (int, error)
+	VerifyEmail(tokenHash string, now time.Time) (int, error)
+	MarkEmailVerified(userID int) error
+}
+
+// SessionStore keeps login sessions and API tokens
+type SessionStore interface {
+	CreateSession(userID int, tokenHash, userAgent, ipAddress string, expiresAt time.Time) error
+	GetSessionByTokenHash(tokenHash string) (*Session, error)
+	TouchSession(sessionID int, lastSeenAt, expiresAt time.Time) error
+	FetchSessionsForUser(userID int) ([]Session, error)
+	DeleteSession(tokenHash string) error
+	DeleteSessionByID(userID, sessionID int) error
+	DeleteOtherSessions(userID int, keepTokenHash string) (int64, error)
+	DeleteExpiredSessions(now time.Time) (int64, error)
+
+	CreateAPIToken(userID int, tokenHash, name string) (int64, error)
+	GetUserIDByAPIToken(tokenHash string) (int, error)
+	DeleteAPIToken(tokenHash string) error
+}
+
+// DonationStore moves donated items through requests, reservations and hand-over
+type DonationStore interface {
+	GetDonation(postID int) (*Donation, error)
+	RequestDonation(postID, requesterID int, message string) error
+	CancelDonationRequest(postID, requesterID int) error
+	ReserveDonation(postID, donorID, requestID int, note string) error
+	ReleaseDonation(postID, actorID int, note string) error
+	CompleteDonation(postID, donorID int, note string) error
+	WithdrawDonation(postID, donorID int, note string) error
+	RelistDonation(postID, donorID int, note string) error
+}
+
+// MessageStore keeps private conversations and who has blocked whom
+type MessageStore interface {
+	StartConversation(postID, senderID, recipientID int, body string) (int, error)
+	SendMessage(conversationID, senderID int, body string) error
+	FetchConversations(userID int) ([]ConversationSummary, error)
+	GetConversation(conversationID, userID int) (*Conversation, error)
+	MarkConversationRead(conversationID, userID int) error
+	CountUnreadMessages(userID int) (int, error)
+
+	IsBlocked(userID, otherID int) (bool, error)
+	BlockUser(blockerID, blockedID int) error
+	UnblockUser(blockerID, blockedID int) error
+	FetchBlockedUsers(userID int) ([]User, error)
+}
+
+// NotificationStore lists notifications, their settings and the emailed digests
+type NotificationStore interface {
+	FetchNotifications(userID, limit int) ([]Notification, error)
+	CountUnreadNotifications(userID int) (int, error)
+	ReadNotification(notificationID, userID int) (*Notification, error)
+	MarkAllNotificationsRead(userID int) error
+	FetchNotificationSettings(userID int) ([]NotificationSetting, error)
+	UpdateNotificationSettings(userID int, enabled []NotificationType, emailDigest bool) error
+
+	FetchPendingDigests() ([]Digest, error)
+	MarkDigestSent(userID, lastNotificationID int) error
+}
+
+// ModerationStore holds moderators' actions, member reports and warnings
+type ModerationStore interface {
+	SetPostHidden(moderatorID, postID int, hidden bool, reason string) error
+	SetCommentHidden(moderatorID, commentID int, hidden bool, reason string) error
+	ModeratorDeletePost(moderatorID, postID int, reason string) error
+	ModeratorDeleteComment(moderatorID, commentID int, reason string) error
+	BanUser(moderatorID, userID int, reason string) error
+	UnbanUser(moderatorID, userID int, reason string) error
+	SetUserRole(moderatorID, userID int, role Role) error
+	FetchModerationLog(limit int) ([]ModerationLogEntry, error)
+
+	CreateReport(reporterID int, targetType string, targetID int, reason ReportReason, details string) (autoHidden bool, err error)
+	FetchReportQueue() ([]ReportedItem, error)
+	ResolveReports(moderatorID int, targetType string, targetID int, resolution ReportResolution, note string) error
+	FetchWarningsForUser(userID int) ([]Warning, error)
+}
+
+// UploadStore reports which uploaded images are still shown somewhere or were uploaded
+// recently, for the sweeper that removes the rest. Uploads are kept per store, such as
+// PostImageUploads.
+type UploadStore interface {
+	ReferencedImages() (postImages, profilePictures []string, err error)
+	RecordUpload(store, name string, now time.Time) error
+	RecentUploads(store string, since time.Time) ([]string, error)
+	ForgetUploads(before time.Time) (int64, error)
+}
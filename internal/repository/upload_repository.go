@@ -0,0 +1,69 @@
+package repository
+
+import "time"
+
+// The stores uploads are recorded for
+const (
+	PostImageUploads      = "uploads"
+	ProfilePictureUploads = "profile_pictures"
+)
+
+// ReferencedImages returns the distinct image names posts, their galleries and users point
+// to. An image replaced by an edit or left behind by a deleted post or account is in neither
+// list.
+func (store *SQLStore) ReferencedImages() (postImages, profilePictures []string, err error) {
+	postImages, err = store.distinctNames(`
+		SELECT image FROM posts WHERE COALESCE(image, '') != ''
+		UNION
+		SELECT post_images.image FROM post_images JOIN posts ON posts.id = post_images.post_id`)
+	if err != nil {
+		return nil, nil, err
+	}
+	profilePictures, err = store.distinctNames("SELECT DISTINCT profile_picture FROM users WHERE COALESCE(profile_picture, '') != ''")
+	if err != nil {
+		return nil, nil, err
+	}
+	return postImages, profilePictures, nil
+}
+
+// RecordUpload notes that name was just uploaded to store, whether or not it was stored already
+func (store *SQLStore) RecordUpload(uploadStore, name string, now time.Time) error {
+	_, err := store.db.Conn.Exec(`
+		INSERT INTO uploads (store, name, uploaded_at) VALUES (?, ?, ?)
+		ON CONFLICT (store, name) DO UPDATE SET uploaded_at = excluded.uploaded_at`,
+		uploadStore, name, now.UTC())
+	return err
+}
+
+// RecentUploads returns the names uploaded to store since the given time
+func (store *SQLStore) RecentUploads(uploadStore string, since time.Time) ([]string, error) {
+	return store.distinctNames("SELECT name FROM uploads WHERE store = ? AND uploaded_at >= ?", uploadStore, since.UTC())
+}
+
+// ForgetUploads removes the record of uploads made before the given time and returns how many went
+func (store *SQLStore) ForgetUploads(before time.Time) (int64, error) {
+	result, err := store.db.Conn.Exec("DELETE FROM uploads WHERE uploaded_at < ?", before.UTC())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// distinctNames runs a query returning one text column
+func (store *SQLStore) distinctNames(query string, args ...interface{}) ([]string, error) {
+	rows, err := store.db.Conn.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, rows.Err()
+}
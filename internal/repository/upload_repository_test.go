@@ -0,0 +1,85 @@
+package repository_test
+
+import (
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"ellas-corner/internal/repository"
+)
+
+func TestReferencedImages(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 2, 3, 0)
+
+	// Two posts can share a picture, since uploads are named after their content
+	galleries := map[int][]string{1: {"old.jpg"}, 2: {"shared.jpg", "label.jpg"}, 3: {"shared.jpg", "gone.jpg"}}
+	for postID, names := range galleries {
+		var gallery []repository.PostImage
+		for _, name := range names {
+			gallery = append(gallery, repository.PostImage{Image: name})
+		}
+		if err := store.UpdatePostWithImages(postID, "Pram", "Folds flat", "General", false, gallery); err != nil {
+			t.Fatalf("UpdatePostWithImages failed: %v", err)
+		}
+	}
+	if err := store.UpdatePostWithImages(1, "Pram", "Folds flat", "General", false, []repository.PostImage{{Image: "new.jpg"}}); err != nil {
+		t.Fatalf("UpdatePostWithImages failed: %v", err)
+	}
+	if err := store.DeletePost(3); err != nil {
+		t.Fatalf("DeletePost failed: %v", err)
+	}
+	if err := store.UpdateProfilePicture(2, "me.png"); err != nil {
+		t.Fatalf("UpdateProfilePicture failed: %v", err)
+	}
+
+	postImages, profilePictures, err := store.ReferencedImages()
+	if err != nil {
+		t.Fatalf("ReferencedImages failed: %v", err)
+	}
+	sort.Strings(postImages)
+	sort.Strings(profilePictures)
+	if !slices.Equal(postImages, []string{"label.jpg", "new.jpg", "shared.jpg"}) {
+		t.Errorf("expected the current post images once each, got %v", postImages)
+	}
+	if len(profilePictures) != 2 || profilePictures[0] != "1.png" || profilePictures[1] != "me.png" {
+		t.Errorf("expected the users' current pictures, got %v", profilePictures)
+	}
+}
+
+func TestRecentUploads(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 1, 0, 0)
+	now := time.Now()
+
+	for _, upload := range []struct {
+		store, name string
+		age         time.Duration
+	}{
+		{repository.PostImageUploads, "old.jpg", 2 * time.Hour},
+		{repository.PostImageUploads, "again.jpg", 3 * time.Hour},
+		{repository.PostImageUploads, "again.jpg", time.Minute},
+		{repository.ProfilePictureUploads, "me.png", time.Minute},
+	} {
+		if err := store.RecordUpload(upload.store, upload.name, now.Add(-upload.age)); err != nil {
+			t.Fatalf("RecordUpload failed: %v", err)
+		}
+	}
+
+	// Uploading a picture again moves its time forward
+	recent, err := store.RecentUploads(repository.PostImageUploads, now.Add(-time.Hour))
+	if err != nil || !slices.Equal(recent, []string{"again.jpg"}) {
+		t.Errorf("expected only the picture uploaded again to be recent, got %v (err %v)", recent, err)
+	}
+
+	if removed, err := store.ForgetUploads(now.Add(-time.Hour)); err != nil || removed != 1 {
+		t.Errorf("expected the old upload to be forgotten, got %d (err %v)", removed, err)
+	}
+	if recent, _ := store.RecentUploads(repository.PostImageUploads, now.Add(-24*time.Hour)); !slices.Equal(recent, []string{"again.jpg"}) {
+		t.Errorf("expected the recent upload to be kept, got %v", recent)
+	}
+	if recent, _ := store.RecentUploads(repository.ProfilePictureUploads, now.Add(-time.Hour)); !slices.Equal(recent, []string{"me.png"}) {
+		t.Errorf("expected the profile picture upload, got %v", recent)
+	}
+}
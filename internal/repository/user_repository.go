@@ -6,6 +6,20 @@ import (
 	"time"
 )
 
+// Role is what a user may do beyond their own content. See the authz package.
+type Role string
+
+const (
+	RoleMember    Role = "member"
+	RoleModerator Role = "moderator"
+	RoleAdmin     Role = "admin"
+)
+
+// ValidRole reports whether role is one of the known roles
+func ValidRole(role Role) bool {
+	return role == RoleMember || role == RoleModerator || role == RoleAdmin
+}
+
 type User struct {
 	ID                         int
 	Username                   string
@@ -14,11 +28,16 @@ type User struct {
 	ProfilePicture             string
 	Country                    string
 	ShowDonationsInCountryOnly bool
+	Role                       Role
+	Banned                     bool
+	BanReason                  string
+	EmailDigest                bool // Gets an email listing unread notifications
+	EmailVerified              bool // Has confirmed their email address, so can post
 }
 
-func CreateUser(username, email, password, profilePicture string) error {
+func (store *SQLStore) CreateUser(username, email, password, profilePicture string) error {
 	query := "INSERT INTO users (username, email, password, profile_picture) VALUES (?, ?, ?, ?)"
-	_, err := database.Conn.Exec(query, username, email, password, profilePicture)
+	_, err := store.db.Conn.Exec(query, username, email, password, profilePicture)
 	if err != nil {
 		log.Println("Error creating user:", err)
 		return err
@@ -26,11 +45,13 @@ func CreateUser(username, email, password, profilePicture string) error {
 	return nil
 }
 
-func GetUserByEmail(email string) (*User, error) {
+func (store *SQLStore) GetUserByEmail(email string) (*User, error) {
 	var user User
-	query := "SELECT id, username, email, password, profile_picture FROM users WHERE email = ?"
+	query := `SELECT id, username, email, password, profile_picture, role, banned_at IS NOT NULL, ban_reason, email_verified_at IS NOT NULL
+	          FROM users WHERE email = ?`
 	var profilePicture sql.NullString
-	err := database.Conn.QueryRow(query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &profilePicture)
+	err := store.db.Conn.QueryRow(query, email).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &profilePicture, &user.Role, &user.Banned, &user.BanReason,
+		&user.EmailVerified)
 
 	// If profile_picture is NULL, assign an empty string
 	if profilePicture.Valid {
@@ -47,36 +68,10 @@ func GetUserByEmail(email string) (*User, error) {
 	return &user, nil
 }
 
-// GetUserIDBySession retrieves the user ID associated with the given session token
-func GetUserIDBySession(sessionToken string) (int, error) {
-	var userID int
-	query := "SELECT user_id FROM sessions WHERE session_token = ?"
-	err := database.Conn.QueryRow(query, sessionToken).Scan(&userID)
-	if err == sql.ErrNoRows {
-		log.Println("No session found for the given token")
-		return 0, nil
-	} else if err != nil {
-		log.Println("Error retrieving user ID by session token:", err)
-		return 0, err
-	}
-	return userID, nil
-}
-
-// SaveSessionToken stores the session token in the database
-func SaveSessionToken(userID int, sessionToken string) error {
-	query := "INSERT INTO sessions (user_id, session_token) VALUES (?, ?) ON CONFLICT(user_id) DO UPDATE SET session_token = ?"
-	_, err := database.Conn.Exec(query, userID, sessionToken, sessionToken)
-	if err != nil {
-		log.Println("Error saving session token:", err)
-		return err
-	}
-	return nil
-}
-
-func CheckCookieConsent(userID int) (bool, error) {
+func (store *SQLStore) CheckCookieConsent(userID int) (bool, error) {
 	var consentGiven bool
 	query := "SELECT consent_given FROM cookie_consent WHERE user_id = ?"
-	err := database.Conn.QueryRow(query, userID).Scan(&consentGiven)
+	err := store.db.Conn.QueryRow(query, userID).Scan(&consentGiven)
 	if err == sql.ErrNoRows {
 		// No consent record found, treat this as consent not given
 		return false, nil
@@ -89,9 +84,9 @@ func CheckCookieConsent(userID int) (bool, error) {
 }
 
 // SaveCookieConsent saves the user's consent decision
-func SaveCookieConsent(userID int, consentGiven bool) error {
+func (store *SQLStore) SaveCookieConsent(userID int, consentGiven bool) error {
 	query := "INSERT INTO cookie_consent (user_id, consent_given) VALUES (?, ?) ON CONFLICT(user_id) DO UPDATE SET consent_given = ?"
-	_, err := database.Conn.Exec(query, userID, consentGiven, consentGiven)
+	_, err := store.db.Conn.Exec(query, userID, consentGiven, consentGiven)
 	if err != nil {
 		log.Println("Error saving cookie consent:", err)
 		return err
@@ -99,29 +94,21 @@ func SaveCookieConsent(userID int, consentGiven bool) error {
 	return nil
 }
 
-// DeleteSession removes a session from the database based on the session token
-func DeleteSession(sessionToken string) error {
-	query := "DELETE FROM sessions WHERE session_token = ?"
-	_, err := database.Conn.Exec(query, sessionToken)
-	if err != nil {
-		log.Println("Error deleting session:", err)
-		return err
-	}
-	return nil
-}
-
 //Fetch data for user profile with these functions
 
 // GetUserByID retrieves a user by their ID and handles NULL values for profile_picture
-func GetUserByID(userID int) (User, error) {
-	query := "SELECT id, username, email, password, profile_picture, country, show_donations_in_country_only FROM users WHERE id = ?"
+func (store *SQLStore) GetUserByID(userID int) (User, error) {
+	query := `SELECT id, username, email, password, profile_picture, country, show_donations_in_country_only,
+	                 role, banned_at IS NOT NULL, ban_reason, email_digest, email_verified_at IS NOT NULL
+	          FROM users WHERE id = ?`
 
 	var user User
 	var profilePicture sql.NullString
 	var country sql.NullString
 	var showDonations bool
 
-	err := database.Conn.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &profilePicture, &country, &showDonations)
+	err := store.db.Conn.QueryRow(query, userID).Scan(&user.ID, &user.Username, &user.Email, &user.Password, &profilePicture, &country, &showDonations,
+		&user.Role, &user.Banned, &user.BanReason, &user.EmailDigest, &user.EmailVerified)
 	if err != nil {
 		return User{}, err
 	}
@@ -145,19 +132,21 @@ func GetUserByID(userID int) (User, error) {
 }
 
 // FetchPostsByUser fetches all posts by a specific user
-func FetchPostsByUser(userID int) ([]Post, error) {
+func (store *SQLStore) FetchPostsByUser(userID int) ([]Post, error) {
 	query := `
 		SELECT posts.id, posts.title, posts.content, posts.category, posts.created_at,
 		       users.username, users.profile_picture,
 		       COALESCE(posts.image, '') AS image, 
 		       (SELECT COUNT(*) FROM post_reactions WHERE post_id = posts.id AND reaction_type = 'like') AS likes,
-		       (SELECT COUNT(*) FROM post_reactions WHERE post_id = posts.id AND reaction_type = 'dislike') AS dislikes, posts.is_donation, COALESCE(posts.donation_country, '') AS donation_country
+		       (SELECT COUNT(*) FROM post_reactions WHERE post_id = posts.id AND reaction_type = 'dislike') AS dislikes, posts.is_donation, COALESCE(posts.donation_country, '') AS donation_country,
+		       COALESCE(posts.donation_status, '') AS donation_status,
+		       posts.hidden_at IS NOT NULL
 		FROM posts
 		JOIN users ON posts.user_id = users.id
 		WHERE posts.user_id = ?
 		ORDER BY posts.created_at DESC`
 
-	rows, err := database.Conn.Query(query, userID)
+	rows, err := store.db.Conn.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -179,6 +168,8 @@ func FetchPostsByUser(userID int) ([]Post, error) {
 			&post.Dislikes,
 			&post.IsDonation,
 			&post.DonationCountry,
+			&post.DonationStatus,
+			&post.Hidden,
 		)
 		if err != nil {
 			return nil, err
@@ -192,22 +183,23 @@ func FetchPostsByUser(userID int) ([]Post, error) {
 			post.FormattedCreatedAt = post.CreatedAt
 		}
 
-		// Fetch and attach comments
-		comments, err := FetchCommentsForPost(post.ID, userID)
-
-		if err != nil {
-			return nil, err
-		}
-		post.Comments = comments
-
 		posts = append(posts, post)
 	}
+	rows.Close()
+
+	// Fetch and attach comments and photos once the post rows are closed
+	if err := store.attachComments(posts, userID); err != nil {
+		return nil, err
+	}
+	if err := store.attachImages(posts); err != nil {
+		return nil, err
+	}
 
 	return posts, nil
 }
 
 // FetchCommentsByUser retrieves all comments made by a specific user, along with the post titles
-func FetchCommentsByUser(userID int) ([]Comment, error) {
+func (store *SQLStore) FetchCommentsByUser(userID int) ([]Comment, error) {
 	query := `
         SELECT comments.id, comments.content, comments.created_at, posts.title,
                users.username, users.profile_picture
@@ -217,7 +209,7 @@ func FetchCommentsByUser(userID int) ([]Comment, error) {
         WHERE comments.user_id = ? 
         ORDER BY comments.created_at DESC`
 
-	rows, err := database.Conn.Query(query, userID)
+	rows, err := store.db.Conn.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -252,20 +244,21 @@ func FetchCommentsByUser(userID int) ([]Comment, error) {
 	return comments, nil
 }
 
-func FetchLikedPostsByUser(userID int) ([]Post, error) {
+func (store *SQLStore) FetchLikedPostsByUser(userID int) ([]Post, error) {
 	query := `
         SELECT posts.id, posts.title, posts.content, posts.category, posts.created_at,
                users.username, users.profile_picture, COALESCE(posts.image, '') AS image,
                (SELECT COUNT(*) FROM post_reactions WHERE post_id = posts.id AND reaction_type = 'like') AS likes,
-               (SELECT COUNT(*) FROM post_reactions WHERE post_id = posts.id AND reaction_type = 'dislike') AS dislikes, posts.is_donation, COALESCE(posts.donation_country, '')
+               (SELECT COUNT(*) FROM post_reactions WHERE post_id = posts.id AND reaction_type = 'dislike') AS dislikes, posts.is_donation, COALESCE(posts.donation_country, ''),
+               COALESCE(posts.donation_status, '')
 
         FROM posts
         JOIN post_reactions ON posts.id = post_reactions.post_id
         JOIN users ON posts.user_id = users.id
-        WHERE post_reactions.user_id = ? AND post_reactions.reaction_type = 'like'
+        WHERE post_reactions.user_id = ? AND post_reactions.reaction_type = 'like' AND posts.hidden_at IS NULL
         ORDER BY posts.created_at DESC`
 
-	rows, err := database.Conn.Query(query, userID)
+	rows, err := store.db.Conn.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -287,6 +280,7 @@ func FetchLikedPostsByUser(userID int) ([]Post, error) {
 			&post.Dislikes,
 			&post.IsDonation,
 			&post.DonationCountry,
+			&post.DonationStatus,
 		)
 		if err != nil {
 			return nil, err
@@ -299,32 +293,36 @@ func FetchLikedPostsByUser(userID int) ([]Post, error) {
 			post.FormattedCreatedAt = post.CreatedAt
 		}
 
-		comments, err := FetchCommentsForPost(post.ID, userID)
-		if err != nil {
-			return nil, err
-		}
-		post.Comments = comments
-
 		post.UserReaction = "like" // For consistency in the template
 		likedPosts = append(likedPosts, post)
 	}
 
+	rows.Close()
+
+	if err := store.attachComments(likedPosts, userID); err != nil {
+		return nil, err
+	}
+	if err := store.attachImages(likedPosts); err != nil {
+		return nil, err
+	}
+
 	return likedPosts, nil
 }
 
-func FetchDislikedPostsByUser(userID int) ([]Post, error) {
+func (store *SQLStore) FetchDislikedPostsByUser(userID int) ([]Post, error) {
 	query := `
         SELECT posts.id, posts.title, posts.content, posts.category, posts.created_at,
                users.username, users.profile_picture, COALESCE(posts.image, '') AS image,
                (SELECT COUNT(*) FROM post_reactions WHERE post_id = posts.id AND reaction_type = 'like') AS likes,
-               (SELECT COUNT(*) FROM post_reactions WHERE post_id = posts.id AND reaction_type = 'dislike') AS dislikes, posts.is_donation, COALESCE(posts.donation_country, '')
+               (SELECT COUNT(*) FROM post_reactions WHERE post_id = posts.id AND reaction_type = 'dislike') AS dislikes, posts.is_donation, COALESCE(posts.donation_country, ''),
+               COALESCE(posts.donation_status, '')
         FROM posts
         JOIN post_reactions ON posts.id = post_reactions.post_id
         JOIN users ON posts.user_id = users.id
-        WHERE post_reactions.user_id = ? AND post_reactions.reaction_type = 'dislike'
+        WHERE post_reactions.user_id = ? AND post_reactions.reaction_type = 'dislike' AND posts.hidden_at IS NULL
         ORDER BY posts.created_at DESC`
 
-	rows, err := database.Conn.Query(query, userID)
+	rows, err := store.db.Conn.Query(query, userID)
 	if err != nil {
 		return nil, err
 	}
@@ -346,6 +344,7 @@ func FetchDislikedPostsByUser(userID int) ([]Post, error) {
 			&post.Dislikes,
 			&post.IsDonation,
 			&post.DonationCountry,
+			&post.DonationStatus,
 		)
 		if err != nil {
 			return nil, err
@@ -358,23 +357,26 @@ func FetchDislikedPostsByUser(userID int) ([]Post, error) {
 			post.FormattedCreatedAt = post.CreatedAt
 		}
 
-		comments, err := FetchCommentsForPost(post.ID, userID)
-		if err != nil {
-			return nil, err
-		}
-		post.Comments = comments
-
 		post.UserReaction = "dislike"
 		dislikedPosts = append(dislikedPosts, post)
 	}
 
+	rows.Close()
+
+	if err := store.attachComments(dislikedPosts, userID); err != nil {
+		return nil, err
+	}
+	if err := store.attachImages(dislikedPosts); err != nil {
+		return nil, err
+	}
+
 	return dislikedPosts, nil
 }
 
 // UpdateProfilePicture updates the profile picture path in the database
-func UpdateProfilePicture(userID int, filePath string) error {
+func (store *SQLStore) UpdateProfilePicture(userID int, filePath string) error {
 	query := "UPDATE users SET profile_picture = ? WHERE id = ?"
-	_, err := database.Conn.Exec(query, filePath, userID)
+	_, err := store.db.Conn.Exec(query, filePath, userID)
 	if err != nil {
 		log.Println("Error updating profile picture:", err)
 		return err
@@ -382,14 +384,14 @@ func UpdateProfilePicture(userID int, filePath string) error {
 	return nil
 }
 
-func UpdateUserPreferences(userID int, country string, showDonations bool) error {
+func (store *SQLStore) UpdateUserPreferences(userID int, country string, showDonations bool) error {
 	query := `
 		UPDATE users 
 		SET country = ?, show_donations_in_country_only = ? 
 		WHERE id = ?
 	`
 
-	_, err := database.Conn.Exec(query, country, showDonations, userID)
+	_, err := store.db.Conn.Exec(query, country, showDonations, userID)
 	if err != nil {
 		log.Println("Error updating user preferences:", err)
 		return err
@@ -398,12 +400,12 @@ func UpdateUserPreferences(userID int, country string, showDonations bool) error
 	return nil
 }
 
-func UpdateDonationCountryForUser(userID int, newCountry string) error {
+func (store *SQLStore) UpdateDonationCountryForUser(userID int, newCountry string) error {
 	query := `
 		UPDATE posts
 		SET donation_country = ?
 		WHERE user_id = ? AND is_donation = 1
 	`
-	_, err := database.Conn.Exec(query, newCountry, userID)
+	_, err := store.db.Conn.Exec(query, newCountry, userID)
 	return err
 }
@@ -0,0 +1,124 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"time"
+)
+
+// TokenPurpose is what an emailed link lets its holder do
+type TokenPurpose string
+
+const (
+	TokenPasswordReset TokenPurpose = "password_reset"
+	TokenVerifyEmail   TokenPurpose = "verify_email"
+)
+
+// ErrInvalidToken is returned for a token that doesn't exist, has expired or was already used
+var ErrInvalidToken = errors.New("invalid or expired token")
+
+// CreateUserToken stores a new single-use token for userID. Any earlier unused token for the
+// same purpose stops working, so only the latest link in the member's inbox is valid.
+func (store *SQLStore) CreateUserToken(userID int, purpose TokenPurpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	now := time.Now().UTC()
+	_, err = tx.Exec("UPDATE user_tokens SET used_at = ? WHERE user_id = ? AND purpose = ? AND used_at IS NULL", now, userID, purpose)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec("INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at, created_at) VALUES (?, ?, ?, ?, ?)",
+		userID, purpose, tokenHash, expiresAt.UTC(), now)
+	if err != nil {
+		log.Println("Error creating user token:", err)
+		return err
+	}
+	return tx.Commit()
+}
+
+// CheckUserToken returns the member a token belongs to without using it up. Returns
+// ErrInvalidToken unless the token is unused and unexpired.
+func (store *SQLStore) CheckUserToken(purpose TokenPurpose, tokenHash string, now time.Time) (int, error) {
+	var userID int
+	err := store.db.Conn.QueryRow(`
+		SELECT user_id FROM user_tokens
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?`,
+		tokenHash, purpose, now.UTC()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	return userID, err
+}
+
+// useToken marks a token used inside tx and returns its member. The check and the update are
+// one statement, so two requests racing with the same link can't both succeed.
+func useToken(tx *sql.Tx, purpose TokenPurpose, tokenHash string, now time.Time) (int, error) {
+	var userID int
+	err := tx.QueryRow(`
+		UPDATE user_tokens SET used_at = ?
+		WHERE token_hash = ? AND purpose = ? AND used_at IS NULL AND expires_at > ?
+		RETURNING user_id`,
+		now.UTC(), tokenHash, purpose, now.UTC()).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	return userID, err
+}
+
+// ResetPassword uses a password reset token to set a new password hash, and signs the member
+// out of every session and revokes their API tokens, as whoever had the old password may
+// have made either. Returns the member's ID, or ErrInvalidToken.
+func (store *SQLStore) ResetPassword(tokenHash, passwordHash string, now time.Time) (int, error) {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := useToken(tx, TokenPasswordReset, tokenHash, now)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE users SET password = ? WHERE id = ?", passwordHash, userID); err != nil {
+		log.Println("Error resetting password:", err)
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM sessions WHERE user_id = ?", userID); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("DELETE FROM api_tokens WHERE user_id = ?", userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// VerifyEmail uses an email verification token to mark the member's address as confirmed.
+// Returns the member's ID, or ErrInvalidToken.
+func (store *SQLStore) VerifyEmail(tokenHash string, now time.Time) (int, error) {
+	tx, err := store.db.Conn.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	userID, err := useToken(tx, TokenVerifyEmail, tokenHash, now)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, ?) WHERE id = ?", now.UTC(), userID); err != nil {
+		return 0, err
+	}
+	return userID, tx.Commit()
+}
+
+// MarkEmailVerified confirms a member's email address without a token, for admins setting up
+// accounts from the command line
+func (store *SQLStore) MarkEmailVerified(userID int) error {
+	_, err := store.db.Conn.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, CURRENT_TIMESTAMP) WHERE id = ?", userID)
+	return err
+}
@@ -0,0 +1,108 @@
+package repository_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"ellas-corner/internal/repository"
+)
+
+func TestPasswordResetTokens(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 2, 0, 0)
+	now := time.Now()
+	expires := now.Add(time.Hour)
+
+	if err := store.CreateSession(1, "session-hash", "Laptop", "127.0.0.1", now.Add(24*time.Hour)); err != nil {
+		t.Fatalf("CreateSession failed: %v", err)
+	}
+	if _, err := store.CreateAPIToken(1, "api-hash", "script"); err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+	if _, err := store.CreateAPIToken(2, "other-api-hash", "script"); err != nil {
+		t.Fatalf("CreateAPIToken failed: %v", err)
+	}
+	if err := store.CreateUserToken(1, repository.TokenPasswordReset, "first", expires); err != nil {
+		t.Fatalf("CreateUserToken failed: %v", err)
+	}
+	if err := store.CreateUserToken(1, repository.TokenPasswordReset, "second", expires); err != nil {
+		t.Fatalf("CreateUserToken failed: %v", err)
+	}
+
+	// Only the latest link works, and only for its purpose and lifetime
+	if _, err := store.CheckUserToken(repository.TokenPasswordReset, "first", now); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Errorf("expected a superseded token to be invalid, got %v", err)
+	}
+	if _, err := store.CheckUserToken(repository.TokenVerifyEmail, "second", now); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Errorf("expected a reset token not to verify an email address, got %v", err)
+	}
+	if _, err := store.ResetPassword("second", "new-hash", expires.Add(time.Second)); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Errorf("expected an expired token to be rejected, got %v", err)
+	}
+	if userID, err := store.CheckUserToken(repository.TokenPasswordReset, "second", now); err != nil || userID != 1 {
+		t.Fatalf("expected the latest token to belong to user 1, got %d (err %v)", userID, err)
+	}
+
+	userID, err := store.ResetPassword("second", "new-hash", now)
+	if err != nil || userID != 1 {
+		t.Fatalf("ResetPassword failed: %d, %v", userID, err)
+	}
+	user, _ := store.GetUserByID(1)
+	if user.Password != "new-hash" {
+		t.Errorf("expected the new password hash, got %q", user.Password)
+	}
+	if session, err := store.GetSessionByTokenHash("session-hash"); err == nil && session != nil {
+		t.Errorf("expected resetting the password to delete sessions, got %+v", session)
+	}
+	if userID, err := store.GetUserIDByAPIToken("api-hash"); err != nil || userID != 0 {
+		t.Errorf("expected resetting the password to revoke API tokens, got user %d (err %v)", userID, err)
+	}
+	if userID, _ := store.GetUserIDByAPIToken("other-api-hash"); userID != 2 {
+		t.Error("expected other members' API tokens to keep working")
+	}
+
+	// Tokens are single use
+	if _, err := store.ResetPassword("second", "other-hash", now); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Errorf("expected a used token to be rejected, got %v", err)
+	}
+	if other, _ := store.GetUserByID(2); other.Password == "new-hash" {
+		t.Error("expected other members' passwords to be untouched")
+	}
+}
+
+func TestVerifyEmailTokens(t *testing.T) {
+	t.Parallel()
+	store, _ := seedFeed(t, 2, 0, 0)
+	now := time.Now()
+
+	if user, _ := store.GetUserByID(2); user.EmailVerified {
+		t.Fatal("expected new members to start unverified")
+	}
+	if err := store.CreateUserToken(2, repository.TokenVerifyEmail, "verify", now.Add(time.Hour)); err != nil {
+		t.Fatalf("CreateUserToken failed: %v", err)
+	}
+	if _, err := store.ResetPassword("verify", "new-hash", now); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Errorf("expected a verification token not to reset a password, got %v", err)
+	}
+
+	if userID, err := store.VerifyEmail("verify", now); err != nil || userID != 2 {
+		t.Fatalf("VerifyEmail failed: %d, %v", userID, err)
+	}
+	if user, _ := store.GetUserByID(2); !user.EmailVerified {
+		t.Error("expected the member to be verified")
+	}
+	if user, _ := store.GetUserByID(1); user.EmailVerified {
+		t.Error("expected other members to stay unverified")
+	}
+	if _, err := store.VerifyEmail("verify", now); !errors.Is(err, repository.ErrInvalidToken) {
+		t.Errorf("expected a used token to be rejected, got %v", err)
+	}
+
+	if err := store.MarkEmailVerified(1); err != nil {
+		t.Fatalf("MarkEmailVerified failed: %v", err)
+	}
+	if user, _ := store.GetUserByID(1); !user.EmailVerified {
+		t.Error("expected MarkEmailVerified to confirm the address")
+	}
+}
@@ -0,0 +1,161 @@
+package storage
+
+import (
+	"context"
+	"io"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps blobs as files in Dir, which is created when the first blob is saved
+type LocalStore struct {
+	Dir string
+}
+
+// path returns where key is kept, or ErrInvalidKey for keys that would reach outside Dir or
+// name the temporary files Put writes
+func (s LocalStore) path(key string) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	return filepath.Join(s.Dir, key), nil
+}
+
+// Put writes data to a temporary file and renames it into place, so a half-written blob is
+// never served
+func (s LocalStore) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// Open returns the file itself, so callers can seek in it to serve ranges
+func (s LocalStore) Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil, BlobInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, BlobInfo{}, err
+	}
+	if info.IsDir() {
+		f.Close()
+		return nil, BlobInfo{}, ErrNotFound
+	}
+	return f, localInfo(key, info), nil
+}
+
+func (s LocalStore) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	info, err := os.Stat(path)
+	if os.IsNotExist(err) || (err == nil && info.IsDir()) {
+		return BlobInfo{}, ErrNotFound
+	}
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	return localInfo(key, info), nil
+}
+
+func (s LocalStore) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// List walks Dir, leaving out the temporary files Put and Check write. A Dir that doesn't
+// exist yet holds no blobs.
+func (s LocalStore) List(ctx context.Context) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+	err := filepath.WalkDir(s.Dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			if path == s.Dir && os.IsNotExist(err) {
+				return fs.SkipAll
+			}
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		hidden := path != s.Dir && strings.HasPrefix(entry.Name(), ".")
+		if entry.IsDir() && hidden {
+			return fs.SkipDir
+		}
+		if entry.IsDir() || hidden {
+			return nil
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		key, err := filepath.Rel(s.Dir, path)
+		if err != nil {
+			return err
+		}
+		blobs = append(blobs, localInfo(filepath.ToSlash(key), info))
+		return nil
+	})
+	return blobs, err
+}
+
+// Check makes sure blobs can be saved by creating and removing a file in Dir
+func (s LocalStore) Check(ctx context.Context) error {
+	f, err := os.CreateTemp(s.Dir, ".readyz-*")
+	if err != nil {
+		return err
+	}
+	f.Close()
+	return os.Remove(f.Name())
+}
+
+// localInfo describes a file, guessing its content type from its extension
+func localInfo(key string, info os.FileInfo) BlobInfo {
+	return BlobInfo{
+		Key:         key,
+		Size:        info.Size(),
+		ContentType: mime.TypeByExtension(filepath.Ext(key)),
+		ModTime:     info.ModTime(),
+	}
+}
@@ -0,0 +1,74 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"ellas-corner/internal/storage"
+)
+
+func TestLocalStore(t *testing.T) {
+	t.Parallel()
+	dir := filepath.Join(t.TempDir(), "uploads")
+	store := storage.LocalStore{Dir: dir}
+	ctx := context.Background()
+
+	if err := store.Put(ctx, "3f2a9c.jpg", []byte("picture"), "image/jpeg"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	body, info, err := store.Open(ctx, "3f2a9c.jpg")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	data, _ := io.ReadAll(body)
+	body.Close()
+	if string(data) != "picture" || info.Size != 7 || info.ContentType != "image/jpeg" {
+		t.Errorf("unexpected blob %q %+v", data, info)
+	}
+	if err := store.Check(ctx); err != nil {
+		t.Errorf("Check failed: %v", err)
+	}
+	// No temporary files are left behind
+	if files, _ := os.ReadDir(dir); len(files) != 1 {
+		t.Errorf("expected only the blob in the directory, got %d files", len(files))
+	}
+
+	if err := store.Put(ctx, "2024/a.png", []byte("nested"), "image/png"); err != nil {
+		t.Fatalf("Put failed: %v", err)
+	}
+	// A temporary file from a Put that was interrupted
+	if err := os.WriteFile(filepath.Join(dir, ".upload-123"), []byte("half"), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	blobs, err := store.List(ctx)
+	if err != nil || len(blobs) != 2 || blobs[0].Key != "2024/a.png" || blobs[1].Key != "3f2a9c.jpg" {
+		t.Errorf("expected both blobs and no temporary files to be listed, got %+v (err %v)", blobs, err)
+	}
+	if blobs, err := (storage.LocalStore{Dir: filepath.Join(dir, "missing")}).List(ctx); err != nil || len(blobs) != 0 {
+		t.Errorf("expected a missing directory to hold no blobs, got %v (err %v)", blobs, err)
+	}
+
+	for _, key := range []string{"../config.toml", "/etc/passwd", ".upload-123", ""} {
+		if _, err := store.Stat(ctx, key); !errors.Is(err, storage.ErrInvalidKey) {
+			t.Errorf("expected key %q to be refused, got %v", key, err)
+		}
+	}
+
+	if err := store.Delete(ctx, "3f2a9c.jpg"); err != nil {
+		t.Fatalf("Delete failed: %v", err)
+	}
+	if err := store.Delete(ctx, "3f2a9c.jpg"); err != nil {
+		t.Errorf("expected deleting a missing blob to succeed, got %v", err)
+	}
+	if _, err := store.Stat(ctx, "3f2a9c.jpg"); err != storage.ErrNotFound {
+		t.Errorf("expected ErrNotFound after Delete, got %v", err)
+	}
+
+	if err := (storage.LocalStore{Dir: filepath.Join(dir, "missing")}).Check(ctx); err == nil {
+		t.Error("expected Check to fail for a missing directory")
+	}
+}
@@ -0,0 +1,387 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// S3Config is how to reach a bucket on an S3-compatible service
+type S3Config struct {
+	// Endpoint is the service's address, such as https://s3.eu-north-1.amazonaws.com or
+	// http://minio:9000
+	Endpoint  string
+	Region    string
+	Bucket    string
+	AccessKey string
+	SecretKey string
+	// PathStyle puts the bucket in the path (endpoint/bucket/key) rather than the host name
+	// (bucket.endpoint/key). MinIO and most self-hosted services need it.
+	PathStyle bool
+}
+
+// S3Store keeps blobs in a bucket, under a common prefix so several stores can share it.
+// Requests are signed with AWS Signature Version 4.
+type S3Store struct {
+	config   S3Config
+	endpoint *url.URL
+	prefix   string
+	client   *http.Client
+	now      func() time.Time
+}
+
+const (
+	s3Timeout       = 30 * time.Second
+	unsignedPayload = "UNSIGNED-PAYLOAD"
+	signingAlgo     = "AWS4-HMAC-SHA256"
+	amzDateFormat   = "20060102T150405Z"
+)
+
+// NewS3Store returns a store for the keys under prefix in the configured bucket
+func NewS3Store(config S3Config, prefix string) (*S3Store, error) {
+	endpoint, err := url.Parse(config.Endpoint)
+	if err != nil || (endpoint.Scheme != "http" && endpoint.Scheme != "https") || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid S3 endpoint %q", config.Endpoint)
+	}
+	if config.Bucket == "" || config.Region == "" {
+		return nil, fmt.Errorf("an S3 bucket and region are required")
+	}
+	return &S3Store{
+		config:   config,
+		endpoint: endpoint,
+		prefix:   prefix,
+		client:   &http.Client{Timeout: s3Timeout},
+		now:      time.Now,
+	}, nil
+}
+
+// bucketURL is the address of the bucket itself
+func (s *S3Store) bucketURL() *url.URL {
+	u := *s.endpoint
+	path := strings.TrimSuffix(u.Path, "/") + "/"
+	if s.config.PathStyle {
+		path += s.config.Bucket
+	} else {
+		u.Host = s.config.Bucket + "." + u.Host
+	}
+	u.Path, u.RawPath = path, uriEncode(path, false)
+	return &u
+}
+
+// Origin is the scheme and host that signed links point to, for the Content-Security-Policy
+func (s *S3Store) Origin() string {
+	u := s.bucketURL()
+	return u.Scheme + "://" + u.Host
+}
+
+// objectURL is the address of the object holding key
+func (s *S3Store) objectURL(key string) *url.URL {
+	u := s.bucketURL()
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.prefix + key
+	u.RawPath = uriEncode(u.Path, false)
+	return u
+}
+
+func (s *S3Store) Put(ctx context.Context, key string, data []byte, contentType string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(key).String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	sum := sha256.Sum256(data)
+	resp, err := s.do(req, hex.EncodeToString(sum[:]))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+func (s *S3Store) Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error) {
+	if err := checkKey(key); err != nil {
+		return nil, BlobInfo{}, err
+	}
+	resp, err := s.request(ctx, http.MethodGet, s.objectURL(key))
+	if err != nil {
+		return nil, BlobInfo{}, err
+	}
+	return resp.Body, s3Info(key, resp), nil
+}
+
+func (s *S3Store) Stat(ctx context.Context, key string) (BlobInfo, error) {
+	if err := checkKey(key); err != nil {
+		return BlobInfo{}, err
+	}
+	resp, err := s.request(ctx, http.MethodHead, s.objectURL(key))
+	if err != nil {
+		return BlobInfo{}, err
+	}
+	resp.Body.Close()
+	return s3Info(key, resp), nil
+}
+
+func (s *S3Store) Delete(ctx context.Context, key string) error {
+	if err := checkKey(key); err != nil {
+		return err
+	}
+	resp, err := s.request(ctx, http.MethodDelete, s.objectURL(key))
+	if err == ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// List pages through the keys under the store's prefix with ListObjectsV2
+func (s *S3Store) List(ctx context.Context) ([]BlobInfo, error) {
+	var blobs []BlobInfo
+	token := ""
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {s.prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+		u := s.bucketURL()
+		u.RawQuery = canonicalQuery(query)
+		resp, err := s.request(ctx, http.MethodGet, u)
+		if err != nil {
+			return nil, err
+		}
+
+		var page struct {
+			IsTruncated           bool   `xml:"IsTruncated"`
+			NextContinuationToken string `xml:"NextContinuationToken"`
+			Contents              []struct {
+				Key          string    `xml:"Key"`
+				Size         int64     `xml:"Size"`
+				LastModified time.Time `xml:"LastModified"`
+			} `xml:"Contents"`
+		}
+		err = xml.NewDecoder(resp.Body).Decode(&page)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("s3 list %s: %w", s.prefix, err)
+		}
+
+		for _, object := range page.Contents {
+			key := strings.TrimPrefix(object.Key, s.prefix)
+			if key == "" || strings.HasSuffix(key, "/") {
+				continue
+			}
+			blobs = append(blobs, BlobInfo{Key: key, Size: object.Size, ModTime: object.LastModified})
+		}
+		if !page.IsTruncated || page.NextContinuationToken == "" {
+			return blobs, nil
+		}
+		token = page.NextContinuationToken
+	}
+}
+
+// Check makes sure the bucket exists and the credentials can reach it
+func (s *S3Store) Check(ctx context.Context) error {
+	resp, err := s.request(ctx, http.MethodHead, s.bucketURL())
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// SignedURL returns a link that fetches the blob straight from the bucket until it expires
+func (s *S3Store) SignedURL(key string, expiry time.Duration) (string, error) {
+	if err := checkKey(key); err != nil {
+		return "", err
+	}
+	if expiry < time.Second || expiry > 7*24*time.Hour {
+		return "", fmt.Errorf("signed URLs must last between a second and a week, got %s", expiry)
+	}
+	return s.presign(http.MethodGet, s.objectURL(key), expiry, s.now()), nil
+}
+
+// request sends a bodiless request
+func (s *S3Store) request(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return s.do(req, hex.EncodeToString(emptySHA256[:]))
+}
+
+var emptySHA256 = sha256.Sum256(nil)
+
+// do signs and sends req. A 404 becomes ErrNotFound and any other failure an error naming
+// the service's error code.
+func (s *S3Store) do(req *http.Request, payloadHash string) (*http.Response, error) {
+	s.sign(req, payloadHash, s.now())
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, ErrNotFound
+	}
+
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if xml.Unmarshal(body, &s3Err) == nil && s3Err.Code != "" {
+		return nil, fmt.Errorf("s3 %s %s: %s: %s", req.Method, req.URL.Path, s3Err.Code, s3Err.Message)
+	}
+	return nil, fmt.Errorf("s3 %s %s: %s", req.Method, req.URL.Path, resp.Status)
+}
+
+// s3Info reads a blob's details from the response headers
+func s3Info(key string, resp *http.Response) BlobInfo {
+	info := BlobInfo{Key: key, Size: resp.ContentLength, ContentType: resp.Header.Get("Content-Type")}
+	if size, err := strconv.ParseInt(resp.Header.Get("Content-Length"), 10, 64); err == nil {
+		info.Size = size
+	}
+	info.ModTime, _ = http.ParseTime(resp.Header.Get("Last-Modified"))
+	return info
+}
+
+// sign adds the date, payload hash and Authorization headers. Every header already set on
+// req is signed along with the host.
+func (s *S3Store) sign(req *http.Request, payloadHash string, now time.Time) {
+	amzDate := now.UTC().Format(amzDateFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	signedHeaders := []string{"host"}
+	for name := range req.Header {
+		signedHeaders = append(signedHeaders, strings.ToLower(name))
+	}
+	sort.Strings(signedHeaders)
+
+	scope := s.scope(amzDate)
+	signature := s.signature(amzDate, canonicalRequest(req, signedHeaders, payloadHash))
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signingAlgo, s.config.AccessKey, scope, strings.Join(signedHeaders, ";"), signature))
+}
+
+// presign returns u with the signature in its query string, valid for expiry from now
+func (s *S3Store) presign(method string, u *url.URL, expiry time.Duration, now time.Time) string {
+	amzDate := now.UTC().Format(amzDateFormat)
+	signed := *u
+	query := url.Values{
+		"X-Amz-Algorithm":     {signingAlgo},
+		"X-Amz-Credential":    {s.config.AccessKey + "/" + s.scope(amzDate)},
+		"X-Amz-Date":          {amzDate},
+		"X-Amz-Expires":       {strconv.Itoa(int(expiry.Seconds()))},
+		"X-Amz-SignedHeaders": {"host"},
+	}
+	signed.RawQuery = canonicalQuery(query)
+
+	req := &http.Request{Method: method, URL: &signed, Header: http.Header{}}
+	signature := s.signature(amzDate, canonicalRequest(req, []string{"host"}, unsignedPayload))
+	signed.RawQuery += "&X-Amz-Signature=" + signature
+	return signed.String()
+}
+
+// scope is the date, region and service a signature is valid for
+func (s *S3Store) scope(amzDate string) string {
+	return amzDate[:8] + "/" + s.config.Region + "/s3/aws4_request"
+}
+
+// signature signs a canonical request with a key derived from the secret, date and region
+func (s *S3Store) signature(amzDate, canonical string) string {
+	hashed := sha256.Sum256([]byte(canonical))
+	stringToSign := signingAlgo + "\n" + amzDate + "\n" + s.scope(amzDate) + "\n" + hex.EncodeToString(hashed[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.config.SecretKey), amzDate[:8])
+	key = hmacSHA256(key, s.config.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalRequest is the text a signature covers. It reads the request the same way
+// whether it is about to be sent or has just been received: the host comes from req.Host
+// when set, as on a server, and from the URL otherwise.
+func canonicalRequest(req *http.Request, signedHeaders []string, payloadHash string) string {
+	query := req.URL.Query()
+	query.Del("X-Amz-Signature")
+
+	var headers strings.Builder
+	for _, name := range signedHeaders {
+		value := req.Header.Get(name)
+		if name == "host" {
+			value = req.URL.Host
+			if req.Host != "" {
+				value = req.Host
+			}
+		}
+		headers.WriteString(name + ":" + strings.Join(strings.Fields(value), " ") + "\n")
+	}
+
+	return strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		canonicalQuery(query),
+		headers.String(),
+		strings.Join(signedHeaders, ";"),
+		payloadHash,
+	}, "\n")
+}
+
+// canonicalQuery sorts and encodes query parameters the way SigV4 expects
+func canonicalQuery(query url.Values) string {
+	var pairs []string
+	for name, values := range query {
+		for _, value := range values {
+			pairs = append(pairs, uriEncode(name, true)+"="+uriEncode(value, true))
+		}
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, "&")
+}
+
+// uriEncode percent-encodes everything but unreserved characters and, unless encodeSlash is
+// set, slashes. url.PathEscape and QueryEscape leave or change other characters, which would
+// break the signature.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
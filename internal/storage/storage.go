@@ -0,0 +1,60 @@
+// Package storage keeps uploaded files. A BlobStore saves files by key, either in a local
+// directory or in a bucket on an S3-compatible service such as AWS S3 or MinIO.
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when there is no blob with the requested key
+	ErrNotFound = errors.New("blob not found")
+	// ErrInvalidKey is returned for a key that can't name a blob, such as "../config.toml"
+	ErrInvalidKey = errors.New("invalid blob key")
+)
+
+// checkKey refuses keys that would reach outside the store and names starting with a dot,
+// which LocalStore uses for its temporary files
+func checkKey(key string) error {
+	if !filepath.IsLocal(key) || strings.HasPrefix(path.Base(key), ".") {
+		return fmt.Errorf("%w %q", ErrInvalidKey, key)
+	}
+	return nil
+}
+
+// BlobInfo describes a stored blob
+type BlobInfo struct {
+	Key         string
+	Size        int64
+	ContentType string
+	ModTime     time.Time
+}
+
+// BlobStore saves and loads files by key. Keys are relative paths such as "3f2a9c.jpg".
+type BlobStore interface {
+	// Put saves data under key, replacing anything already there
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	// Open returns the contents of a blob, which the caller must close, and its details
+	Open(ctx context.Context, key string) (io.ReadCloser, BlobInfo, error)
+	// Stat returns a blob's details without its contents
+	Stat(ctx context.Context, key string) (BlobInfo, error)
+	// Delete removes a blob. Deleting one that doesn't exist is not an error.
+	Delete(ctx context.Context, key string) error
+	// List returns the details of every blob in the store
+	List(ctx context.Context) ([]BlobInfo, error)
+	// Check reports whether blobs can currently be saved, for the readiness probe
+	Check(ctx context.Context) error
+}
+
+// URLSigner is implemented by stores that can give out short-lived links to a blob, so
+// browsers can fetch it from the store instead of through the site
+type URLSigner interface {
+	SignedURL(key string, expiry time.Duration) (string, error)
+}
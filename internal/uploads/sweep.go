@@ -0,0 +1,177 @@
+// Package uploads removes uploaded images that nothing refers to any more. Editing a post
+// replaces its image, deleting a post leaves its image behind and every new profile picture
+// replaces the last one, so without sweeping the image stores only ever grow.
+package uploads
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"ellas-corner/internal/db"
+	"ellas-corner/internal/images"
+	"ellas-corner/internal/repository"
+	"ellas-corner/internal/storage"
+)
+
+// Report is what a sweep found in one image store
+type Report struct {
+	Store string
+	// Blobs is everything in the store, InUse what posts or users still point to and
+	// Recent what isn't used yet but was saved within the grace period
+	Blobs  int
+	InUse  int
+	Recent int
+	// Orphans are the unused blobs old enough to remove. A dry run only lists them.
+	Orphans []storage.BlobInfo
+	Removed int
+}
+
+// OrphanBytes is the space the orphans take up
+func (r Report) OrphanBytes() int64 {
+	var total int64
+	for _, blob := range r.Orphans {
+		total += blob.Size
+	}
+	return total
+}
+
+// Sweeper finds images that no post or user refers to and removes them
+type Sweeper struct {
+	Store           repository.UploadStore
+	PostImages      storage.BlobStore
+	ProfilePictures storage.BlobStore
+	// GracePeriod spares blobs saved more recently than this. An upload is stored before the
+	// post or profile that shows it, so a new blob may not be referenced yet.
+	GracePeriod time.Duration
+}
+
+// Sweep removes unreferenced images from both stores, or with dryRun only reports them.
+// Blobs that can't be removed are skipped and reported in the error.
+func (s Sweeper) Sweep(ctx context.Context, dryRun bool) ([]Report, error) {
+	// List before loading the references, so an image saved and used in between is seen as
+	// in use rather than as an orphan
+	postBlobs, err := s.PostImages.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing post images: %w", err)
+	}
+	profileBlobs, err := s.ProfilePictures.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("listing profile pictures: %w", err)
+	}
+	postImages, profilePictures, err := s.Store.ReferencedImages()
+	if err != nil {
+		return nil, fmt.Errorf("loading referenced images: %w", err)
+	}
+
+	// The defaults and the baby box suggestions are shown without being referenced
+	postImages = append(postImages, images.PlaceholderImage)
+	for _, items := range db.CuratedBabyBox {
+		for _, item := range items {
+			postImages = append(postImages, item.Image)
+		}
+	}
+	profilePictures = append(profilePictures, images.DefaultProfilePictures...)
+
+	now := time.Now()
+	posts, postErr := s.sweep(ctx, repository.PostImageUploads, s.PostImages, postBlobs, keep(postImages), now, dryRun)
+	profiles, profileErr := s.sweep(ctx, repository.ProfilePictureUploads, s.ProfilePictures, profileBlobs, keep(profilePictures), now, dryRun)
+	if dryRun {
+		return []Report{posts, profiles}, errors.Join(postErr, profileErr)
+	}
+	// Uploads older than the grace period are either used by now or orphans
+	_, forgetErr := s.Store.ForgetUploads(now.Add(-s.GracePeriod))
+	if forgetErr != nil {
+		forgetErr = fmt.Errorf("forgetting old uploads: %w", forgetErr)
+	}
+	return []Report{posts, profiles}, errors.Join(postErr, profileErr, forgetErr)
+}
+
+// keep is the set of blobs to leave alone: the referenced images and their thumbnails
+func keep(referenced []string) map[string]bool {
+	names := make(map[string]bool, len(referenced)*(1+len(images.Thumbnails)))
+	for _, name := range referenced {
+		names[name] = true
+		for _, size := range images.Thumbnails {
+			names[images.ThumbnailName(name, size.Name)] = true
+		}
+	}
+	return names
+}
+
+func (s Sweeper) sweep(ctx context.Context, name string, store storage.BlobStore, blobs []storage.BlobInfo, inUse map[string]bool, now time.Time, dryRun bool) (Report, error) {
+	report := Report{Store: name, Blobs: len(blobs)}
+	var errs []error
+	for _, blob := range blobs {
+		switch {
+		case inUse[blob.Key]:
+			report.InUse++
+		case now.Sub(blob.ModTime) < s.GracePeriod:
+			report.Recent++
+		default:
+			if err := ctx.Err(); err != nil {
+				return report, errors.Join(append(errs, err)...)
+			}
+			// Uploading a picture that is already stored doesn't write it again, so an orphan
+			// uploaded since the references were loaded is about to be used all the same
+			uploaded, err := s.Store.RecentUploads(name, now.Add(-s.GracePeriod))
+			if err != nil {
+				errs = append(errs, fmt.Errorf("checking %s/%s: %w", name, blob.Key, err))
+				continue
+			}
+			if keep(uploaded)[blob.Key] {
+				report.Recent++
+				continue
+			}
+			report.Orphans = append(report.Orphans, blob)
+			if dryRun {
+				continue
+			}
+			// The check above and Delete aren't atomic, so the same picture uploaded in
+			// between is still removed and its post shows a missing image. That window is one
+			// query long; closing it would mean locking uploads for the whole sweep.
+			if err := store.Delete(ctx, blob.Key); err != nil {
+				errs = append(errs, fmt.Errorf("removing %s/%s: %w", name, blob.Key, err))
+				continue
+			}
+			report.Removed++
+		}
+	}
+	return report, errors.Join(errs...)
+}
+
+// StartSweeper sweeps every interval until the returned stop function is called. Stopping
+// cancels a sweep under way and waits for it to return.
+func StartSweeper(s Sweeper, interval time.Duration) (stop func()) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				reports, err := s.Sweep(ctx, false)
+				if err != nil {
+					log.Println("Upload sweeper: Error removing unreferenced images:", err)
+				}
+				for _, report := range reports {
+					if report.Removed > 0 {
+						log.Printf("Upload sweeper: Removed %d unreferenced images from %s", report.Removed, report.Store)
+					}
+				}
+			}
+		}
+	}()
+
+	return func() {
+		cancel()
+		<-stopped
+	}
+}
@@ -0,0 +1,192 @@
+package uploads_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"testing"
+	"time"
+
+	"ellas-corner/internal/images"
+	"ellas-corner/internal/storage"
+	"ellas-corner/internal/uploads"
+)
+
+// references stands in for the database
+type references struct {
+	posts, profilePictures []string
+	// uploaded holds the recent uploads of each store
+	uploaded map[string][]string
+}
+
+func (r references) ReferencedImages() ([]string, []string, error) {
+	return r.posts, r.profilePictures, nil
+}
+
+func (r references) RecordUpload(store, name string, now time.Time) error {
+	r.uploaded[store] = append(r.uploaded[store], name)
+	return nil
+}
+
+func (r references) RecentUploads(store string, since time.Time) ([]string, error) {
+	return r.uploaded[store], nil
+}
+
+func (r references) ForgetUploads(before time.Time) (int64, error) {
+	return 0, nil
+}
+
+// putAged saves blobs in store as if they had been uploaded age ago
+func putAged(t *testing.T, store storage.LocalStore, age time.Duration, keys ...string) {
+	t.Helper()
+	for _, key := range keys {
+		if err := store.Put(context.Background(), key, []byte("picture"), ""); err != nil {
+			t.Fatalf("Put failed: %v", err)
+		}
+		when := time.Now().Add(-age)
+		if err := os.Chtimes(filepath.Join(store.Dir, key), when, when); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+}
+
+func keys(t *testing.T, store storage.LocalStore) []string {
+	t.Helper()
+	blobs, err := store.List(context.Background())
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	var names []string
+	for _, blob := range blobs {
+		names = append(names, blob.Key)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestSweep(t *testing.T) {
+	t.Parallel()
+	posts, profiles := storage.LocalStore{Dir: t.TempDir()}, storage.LocalStore{Dir: t.TempDir()}
+	const used, replaced = "0123456789abcdef0123456789abcdef.jpg", "fedcba9876543210fedcba9876543210.jpg"
+
+	putAged(t, posts, 48*time.Hour, used, images.ThumbnailName(used, "small"), replaced,
+		images.ThumbnailName(replaced, "small"), images.PlaceholderImage, "winter1.jpg", "7.png")
+	putAged(t, posts, time.Minute, "aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.png")
+	putAged(t, profiles, 48*time.Hour, "1.png", "user_12_1751581579.jpg", "user_12_1751581999.jpg")
+
+	sweeper := uploads.Sweeper{
+		Store:           references{posts: []string{used}, profilePictures: []string{"user_12_1751581999.jpg"}},
+		PostImages:      posts,
+		ProfilePictures: profiles,
+		GracePeriod:     time.Hour,
+	}
+
+	// A dry run reports the orphans and leaves them in place
+	reports, err := sweeper.Sweep(context.Background(), true)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	postReport, profileReport := reports[0], reports[1]
+	if postReport.Blobs != 8 || postReport.InUse != 4 || postReport.Recent != 1 || len(postReport.Orphans) != 3 || postReport.Removed != 0 {
+		t.Errorf("unexpected post image report %+v", postReport)
+	}
+	if postReport.OrphanBytes() != 3*int64(len("picture")) {
+		t.Errorf("expected the orphans' sizes to add up, got %d", postReport.OrphanBytes())
+	}
+	if len(profileReport.Orphans) != 1 || profileReport.Orphans[0].Key != "user_12_1751581579.jpg" {
+		t.Errorf("expected only the replaced profile picture to be an orphan, got %+v", profileReport)
+	}
+	if got := len(keys(t, posts)); got != 8 {
+		t.Errorf("expected a dry run to remove nothing, got %d blobs left", got)
+	}
+
+	// The real thing removes the replaced image with its thumbnail and the unused seed picture,
+	// but keeps the upload still inside its grace period
+	reports, err = sweeper.Sweep(context.Background(), false)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if reports[0].Removed != 3 || reports[1].Removed != 1 {
+		t.Errorf("unexpected reports %+v", reports)
+	}
+	want := []string{"0123456789abcdef0123456789abcdef.jpg", "0123456789abcdef0123456789abcdef_small.jpg",
+		"aaaaaaaaaaaaaaaaaaaaaaaaaaaaaaaa.png", "placeholder.jpg", "winter1.jpg"}
+	if got := keys(t, posts); !slices.Equal(got, want) {
+		t.Errorf("expected %v to be left, got %v", want, got)
+	}
+	if got := keys(t, profiles); !slices.Equal(got, []string{"1.png", "user_12_1751581999.jpg"}) {
+		t.Errorf("expected the default and current profile pictures to be left, got %v", got)
+	}
+}
+
+// listThenUpload is a store where an upload lands just after the sweeper lists it
+type listThenUpload struct {
+	storage.LocalStore
+	upload func()
+}
+
+func (s listThenUpload) List(ctx context.Context) ([]storage.BlobInfo, error) {
+	blobs, err := s.LocalStore.List(ctx)
+	s.upload()
+	return blobs, err
+}
+
+func TestSweepSparesReuploadedOrphan(t *testing.T) {
+	t.Parallel()
+	ctx := context.Background()
+	posts := storage.LocalStore{Dir: t.TempDir()}
+	service := images.Service{MaxDimension: 500}
+
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewRGBA(image.Rect(0, 0, 30, 20))); err != nil {
+		t.Fatalf("png.Encode failed: %v", err)
+	}
+	name, err := service.Save(ctx, bytes.NewReader(picture.Bytes()), posts)
+	if err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	// Left behind by a deleted post two days ago
+	for _, key := range keys(t, posts) {
+		when := time.Now().Add(-48 * time.Hour)
+		if err := os.Chtimes(filepath.Join(posts.Dir, key), when, when); err != nil {
+			t.Fatalf("Chtimes failed: %v", err)
+		}
+	}
+
+	// Someone uploads the same picture for a new post while the sweep is under way. It is
+	// stored already, so only the upload is recorded.
+	db := references{uploaded: map[string][]string{}}
+	racing := listThenUpload{LocalStore: posts, upload: func() {
+		if again, err := service.Save(ctx, bytes.NewReader(picture.Bytes()), posts); err != nil || again != name {
+			t.Errorf("expected the upload to get %q, got %q (err %v)", name, again, err)
+		}
+		db.RecordUpload("uploads", name, time.Now())
+	}}
+	sweeper := uploads.Sweeper{
+		Store:           db,
+		PostImages:      racing,
+		ProfilePictures: storage.LocalStore{Dir: t.TempDir()},
+		GracePeriod:     time.Hour,
+	}
+	reports, err := sweeper.Sweep(ctx, false)
+	if err != nil {
+		t.Fatalf("Sweep failed: %v", err)
+	}
+	if reports[0].Removed != 0 || reports[0].Recent != 1+len(images.Thumbnails) {
+		t.Errorf("expected the re-uploaded picture to count as recent, got %+v", reports[0])
+	}
+	blobs, err := posts.List(ctx)
+	if err != nil || len(blobs) != 1+len(images.Thumbnails) {
+		t.Fatalf("expected the picture and its thumbnails to be kept, got %v (err %v)", blobs, err)
+	}
+	for _, blob := range blobs {
+		if time.Since(blob.ModTime) < time.Hour {
+			t.Errorf("expected %s to be left as it was rather than written again", blob.Key)
+		}
+	}
+}
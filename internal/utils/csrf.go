@@ -0,0 +1,44 @@
+package utils
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+)
+
+const (
+	// CSRFFieldName is the hidden form field carrying the CSRF token
+	CSRFFieldName = "csrf_token"
+	// CSRFHeaderName carries the CSRF token for requests that aren't form posts, such as
+	// JSON API calls made with the login cookie
+	CSRFHeaderName = "X-CSRF-Token"
+)
+
+// CSRFToken returns the CSRF token for the request's session, or "" if there is no session
+// cookie. The token is derived from the session token, so it is different for every session
+// and can't be worked out by another site, which never sees the cookie.
+func CSRFToken(r *http.Request) string {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(cookie.Value))
+	mac.Write([]byte("csrf"))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// ValidCSRFToken reports whether a request sent its session's CSRF token, in the
+// X-CSRF-Token header or the csrf_token form field
+func ValidCSRFToken(r *http.Request) bool {
+	expected := CSRFToken(r)
+	if expected == "" {
+		return false
+	}
+	sent := r.Header.Get(CSRFHeaderName)
+	if sent == "" {
+		sent = r.FormValue(CSRFFieldName)
+	}
+	return subtle.ConstantTimeCompare([]byte(sent), []byte(expected)) == 1
+}
@@ -1,12 +1,18 @@
 package utils
 
 import (
+	"ellas-corner/internal/config"
+
 	"golang.org/x/crypto/bcrypt"
 )
 
+// bcryptCost is the work factor for new password hashes. The default of 14 is higher than
+// bcrypt's own; existing hashes keep the cost they were made with.
+var bcryptCost = config.Default().Auth.BcryptCost
+
 func HashPassword(password string) (string, error) {
-	// HashPassword hashes a plain-text password using bcrypt with a cost of 14 (higher than default)
-	bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
+	// HashPassword hashes a plain-text password using bcrypt with the configured cost
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
 	if err != nil {
 		return "", err
 	}
@@ -1,13 +1,44 @@
 package utils
 
 import (
+	"context"
 	"crypto/rand"
+	"crypto/sha256"
+	"ellas-corner/internal/config"
 	"ellas-corner/internal/repository"
 	"encoding/hex"
 	"errors"
+	"log"
+	"net"
 	"net/http"
+	"strings"
+	"time"
 )
 
+const (
+	// SessionCookieName is the browser cookie holding the session token
+	SessionCookieName = "session_token"
+
+	// sessionTouchInterval limits how often activity is written back to the database
+	sessionTouchInterval = 5 * time.Minute
+)
+
+var (
+	// SessionIdleTimeout is how long a session stays valid without activity. Each request
+	// made with the session slides its expiry forward by this much.
+	SessionIdleTimeout = config.Default().Auth.SessionIdleTimeout
+
+	// SessionMaxLifetime caps how long a session can be kept alive by sliding expiry
+	SessionMaxLifetime = config.Default().Auth.SessionMaxLifetime
+)
+
+// Configure applies the password hashing and session settings from the configuration
+func Configure(auth config.Auth) {
+	bcryptCost = auth.BcryptCost
+	SessionIdleTimeout = auth.SessionIdleTimeout
+	SessionMaxLifetime = auth.SessionMaxLifetime
+}
+
 // GenerateSessionToken generates a random token for user sessions
 func GenerateSessionToken() string {
 	token := make([]byte, 16)
@@ -15,35 +46,211 @@ func GenerateSessionToken() string {
 	return hex.EncodeToString(token)
 }
 
+// HashToken returns the SHA-256 hex digest of a token, so only hashes are stored in the database
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 type SessionUser struct {
 	ID             int
 	Username       string
 	ProfilePicture string
 	Country        string
+	Role           repository.Role
+	EmailVerified  bool
 }
 
-var ErrUnauthenticated = errors.New("user not authenticated")
-
-func GetSessionUser(r *http.Request) (*SessionUser, error) {
-	cookie, err := r.Cookie("session_token")
+// sessionUserFor loads a signed-in user. Banned users are treated as signed out.
+func sessionUserFor(store repository.Store, userID int) (*SessionUser, error) {
+	user, err := store.GetUserByID(userID)
 	if err != nil {
-		return nil, ErrUnauthenticated
+		return nil, err
 	}
-
-	userID, err := repository.GetUserIDBySession(cookie.Value)
-	if err != nil || userID == 0 {
+	if user.Banned {
 		return nil, ErrUnauthenticated
 	}
 
-	user, err := repository.GetUserByID(userID)
-	if err != nil {
-		return nil, err 
-	}
-
 	return &SessionUser{
 		ID:             user.ID,
 		Username:       user.Username,
 		ProfilePicture: user.ProfilePicture,
 		Country:        user.Country,
+		Role:           user.Role,
+		EmailVerified:  user.EmailVerified,
 	}, nil
 }
+
+var ErrUnauthenticated = errors.New("user not authenticated")
+
+// StartSession creates a new server-side session for the user and sets the session cookie.
+// Existing sessions on other devices are left signed in.
+func StartSession(store repository.Store, w http.ResponseWriter, r *http.Request, userID int) error {
+	token := GenerateSessionToken()
+	now := time.Now().UTC()
+
+	err := store.CreateSession(userID, HashToken(token), r.UserAgent(), ClientIP(r), now.Add(SessionIdleTimeout))
+	if err != nil {
+		return err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    token,
+		Expires:  now.Add(SessionMaxLifetime),
+		Path:     "/",
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return nil
+}
+
+// EndSession deletes the current session, if any, and clears the session cookie
+func EndSession(store repository.Store, w http.ResponseWriter, r *http.Request) error {
+	if tokenHash := CurrentSessionHash(r); tokenHash != "" {
+		if err := store.DeleteSession(tokenHash); err != nil {
+			return err
+		}
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     SessionCookieName,
+		Value:    "",
+		Path:     "/",             // Applies site-wide
+		Expires:  time.Unix(0, 0), // Expire it immediately
+		HttpOnly: true,
+	})
+	return nil
+}
+
+// CurrentSessionHash returns the hash of the request's session token, or "" if there is no session cookie
+func CurrentSessionHash(r *http.Request) string {
+	cookie, err := r.Cookie(SessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+	return HashToken(cookie.Value)
+}
+
+// ClientIP returns the remote address of the request without the port
+func ClientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// requestUserKey holds the *int that TrackRequestUser puts in a request's context
+type requestUserKey struct{}
+
+// TrackRequestUser returns the request with a context that records the ID of the user that
+// GetSessionUser or GetAPIUser signs in, and a function that reads it back (0 if nobody was
+// signed in). The request log uses it to show who made each request without looking the
+// session up a second time.
+func TrackRequestUser(r *http.Request) (*http.Request, func() int) {
+	userID := new(int)
+	return r.WithContext(context.WithValue(r.Context(), requestUserKey{}, userID)), func() int { return *userID }
+}
+
+// noteRequestUser records the signed-in user for TrackRequestUser, if the request is tracked
+func noteRequestUser(r *http.Request, user *SessionUser) {
+	if userID, ok := r.Context().Value(requestUserKey{}).(*int); ok && user != nil {
+		*userID = user.ID
+	}
+}
+
+// GetSessionUser returns the user signed in with the request's session cookie.
+// Expired sessions are rejected, and active ones have their expiry slid forward.
+func GetSessionUser(store repository.Store, r *http.Request) (*SessionUser, error) {
+	tokenHash := CurrentSessionHash(r)
+	if tokenHash == "" {
+		return nil, ErrUnauthenticated
+	}
+
+	session, err := store.GetSessionByTokenHash(tokenHash)
+	if err != nil || session == nil {
+		return nil, ErrUnauthenticated
+	}
+
+	now := time.Now().UTC()
+	if !now.Before(session.ExpiresAt) {
+		if err := store.DeleteSession(tokenHash); err != nil {
+			log.Println("GetSessionUser: Error deleting expired session:", err)
+		}
+		return nil, ErrUnauthenticated
+	}
+
+	if now.Sub(session.LastSeenAt) >= sessionTouchInterval {
+		expiresAt := now.Add(SessionIdleTimeout)
+		if maxExpiry := session.CreatedAt.Add(SessionMaxLifetime); expiresAt.After(maxExpiry) {
+			expiresAt = maxExpiry
+		}
+		if err := store.TouchSession(session.ID, now, expiresAt); err != nil {
+			log.Println("GetSessionUser: Error sliding session expiry:", err)
+		}
+	}
+
+	user, err := sessionUserFor(store, session.UserID)
+	noteRequestUser(r, user)
+	return user, err
+}
+
+// StartSessionReaper deletes expired sessions every interval until the returned stop function is
+// called. Stopping waits for a sweep that is under way to finish.
+func StartSessionReaper(store repository.Store, interval time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer close(stopped)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case now := <-ticker.C:
+				removed, err := store.DeleteExpiredSessions(now)
+				if err != nil {
+					log.Println("Session reaper: Error deleting expired sessions:", err)
+				} else if removed > 0 {
+					log.Printf("Session reaper: Removed %d expired sessions", removed)
+				}
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// BearerToken returns the token from an "Authorization: Bearer <token>" header, if present
+func BearerToken(r *http.Request) string {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// GetAPIUser authenticates an API request using a bearer token if one is sent,
+// and falls back to the browser session cookie otherwise
+func GetAPIUser(store repository.Store, r *http.Request) (*SessionUser, error) {
+	token := BearerToken(r)
+	if token == "" {
+		return GetSessionUser(store, r)
+	}
+
+	userID, err := store.GetUserIDByAPIToken(HashToken(token))
+	if err != nil || userID == 0 {
+		return nil, ErrUnauthenticated
+	}
+
+	user, err := sessionUserFor(store, userID)
+	noteRequestUser(r, user)
+	return user, err
+}
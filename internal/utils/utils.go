@@ -2,12 +2,8 @@ package utils
 
 import (
 	"html/template"
-	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
-	"os"
-	"path/filepath"
 )
 
 // RenderServerErrorPage renders a custom 500 error page.
@@ -35,24 +31,18 @@ func RenderServerErrorPage(w http.ResponseWriter) {
 	}
 }
 
-func SaveUploadedFile(file multipart.File, filename, uploadPath string) (string, error) {
-	// Make sure the directory exists
-	err := os.MkdirAll(uploadPath, os.ModePerm)
-	if err != nil {
-		return "", err
-	}
+// RenderForbiddenPage renders the 403 page shown when a form is sent without a valid CSRF
+// token, for example from another site or from a page opened before logging in
+func RenderForbiddenPage(w http.ResponseWriter) {
+	w.WriteHeader(http.StatusForbidden)
 
-	dstPath := filepath.Join(uploadPath, filename)
-	dst, err := os.Create(dstPath)
+	tmpl, err := template.ParseFiles("web/templates/403.html")
 	if err != nil {
-		return "", err
+		log.Println("RenderForbiddenPage: error loading 403.html:", err)
+		w.Write([]byte("Forbidden"))
+		return
 	}
-	defer dst.Close()
-
-	_, err = io.Copy(dst, file)
-	if err != nil {
-		return "", err
+	if err := tmpl.Execute(w, nil); err != nil {
+		log.Println("RenderForbiddenPage: error executing 403 template:", err)
 	}
-
-	return filename, nil
 }
@@ -0,0 +1,291 @@
+package viewmodels
+
+import (
+	"time"
+
+	"ellas-corner/internal/repository"
+)
+
+// JSON representations used by the /api/v1 endpoints
+
+type APIError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+type APIErrorResponse struct {
+	Error APIError `json:"error"`
+}
+
+type PostJSON struct {
+	ID              int           `json:"id"`
+	UserID          int           `json:"user_id"`
+	Username        string        `json:"username"`
+	Title           string        `json:"title"`
+	Content         string        `json:"content"`
+	Category        string        `json:"category"`
+	ImageURL        string        `json:"image_url,omitempty"`
+	Images          []ImageJSON   `json:"images,omitempty"`
+	CreatedAt       string        `json:"created_at"`
+	Likes           int           `json:"likes"`
+	Dislikes        int           `json:"dislikes"`
+	UserReaction    string        `json:"user_reaction,omitempty"`
+	IsDonation      bool          `json:"is_donation"`
+	DonationCountry string        `json:"donation_country,omitempty"`
+	DonationStatus  string        `json:"donation_status,omitempty"`
+	CommentCount    int           `json:"comment_count"`
+	Comments        []CommentJSON `json:"comments,omitempty"`
+}
+
+// ImageJSON is one photo of a post's gallery
+type ImageJSON struct {
+	URL     string `json:"url"`
+	AltText string `json:"alt_text"`
+}
+
+// CategoryJSON is a category posts can be filed under. The age limits are in months and
+// left out when there is none.
+type CategoryJSON struct {
+	Slug         string `json:"slug"`
+	Name         string `json:"name"`
+	MinAgeMonths *int   `json:"min_age_months,omitempty"`
+	MaxAgeMonths *int   `json:"max_age_months,omitempty"`
+	Description  string `json:"description,omitempty"`
+	PostCount    int    `json:"post_count"`
+}
+
+// NewCategoriesJSON converts categories for the API, keeping their order
+func NewCategoriesJSON(categories []repository.Category) []CategoryJSON {
+	out := make([]CategoryJSON, len(categories))
+	for i, c := range categories {
+		out[i] = CategoryJSON{
+			Slug:         c.Slug,
+			Name:         c.Name,
+			MinAgeMonths: c.MinAgeMonths,
+			MaxAgeMonths: c.MaxAgeMonths,
+			Description:  c.Description,
+			PostCount:    c.Posts,
+		}
+	}
+	return out
+}
+
+// PostPageJSON is one page of a post listing. NextCursor is null on the last page and
+// for sorts that are paged with ?page= instead.
+type PostPageJSON struct {
+	Posts      []PostJSON `json:"posts"`
+	NextCursor *string    `json:"next_cursor"`
+	HasMore    bool       `json:"has_more"`
+}
+
+type CommentJSON struct {
+	ID              int           `json:"id"`
+	PostID          int           `json:"post_id"`
+	UserID          int           `json:"user_id"`
+	Username        string        `json:"username"`
+	ParentCommentID *int          `json:"parent_comment_id"`
+	Content         string        `json:"content"`
+	CreatedAt       string        `json:"created_at"`
+	Likes           int           `json:"likes"`
+	Dislikes        int           `json:"dislikes"`
+	UserReaction    string        `json:"user_reaction,omitempty"`
+	ReplyCount      int           `json:"reply_count"`
+	Replies         []CommentJSON `json:"replies,omitempty"`
+}
+
+type UserJSON struct {
+	ID                         int    `json:"id"`
+	Username                   string `json:"username"`
+	ProfilePictureURL          string `json:"profile_picture_url,omitempty"`
+	Email                      string `json:"email,omitempty"`
+	Country                    string `json:"country,omitempty"`
+	ShowDonationsInCountryOnly *bool  `json:"show_donations_in_country_only,omitempty"`
+}
+
+type ReactionJSON struct {
+	Likes        int    `json:"likes"`
+	Dislikes     int    `json:"dislikes"`
+	UserReaction string `json:"user_reaction"`
+}
+
+type TokenJSON struct {
+	ID    int64  `json:"id"`
+	Token string `json:"token"`
+	Name  string `json:"name"`
+}
+
+// ReportJSON confirms a report. Hidden is true when this report took the item over the
+// report threshold and hid it until a moderator reviews it.
+type ReportJSON struct {
+	TargetType string `json:"target_type"`
+	TargetID   int    `json:"target_id"`
+	Reason     string `json:"reason"`
+	Hidden     bool   `json:"hidden"`
+}
+
+// DonationJSON is the lifecycle of a donated item. Requests are only listed for the donor;
+// anyone else sees just their own request, if they made one.
+type DonationJSON struct {
+	PostID        int                   `json:"post_id"`
+	DonorID       int                   `json:"donor_id"`
+	Status        string                `json:"status"`
+	RecipientID   int                   `json:"recipient_id,omitempty"`
+	RecipientName string                `json:"recipient_name,omitempty"`
+	Requests      []DonationRequestJSON `json:"requests,omitempty"`
+	MyRequest     *DonationRequestJSON  `json:"my_request,omitempty"`
+	History       []DonationEventJSON   `json:"history"`
+}
+
+type DonationRequestJSON struct {
+	ID            int    `json:"id"`
+	RequesterID   int    `json:"requester_id"`
+	RequesterName string `json:"requester_name"`
+	Message       string `json:"message,omitempty"`
+	Status        string `json:"status"`
+	CreatedAt     string `json:"created_at"`
+}
+
+type DonationEventJSON struct {
+	Event       string `json:"event"`
+	ActorID     int    `json:"actor_id"`
+	ActorName   string `json:"actor_name"`
+	FromStatus  string `json:"from_status"`
+	ToStatus    string `json:"to_status"`
+	RecipientID int    `json:"recipient_id,omitempty"`
+	Note        string `json:"note,omitempty"`
+	CreatedAt   string `json:"created_at"`
+}
+
+func newDonationRequestJSON(request repository.DonationRequest) DonationRequestJSON {
+	return DonationRequestJSON{
+		ID:            request.ID,
+		RequesterID:   request.RequesterID,
+		RequesterName: request.RequesterName,
+		Message:       request.Message,
+		Status:        string(request.Status),
+		CreatedAt:     request.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// NewDonationJSON converts a donation for the API as seen by viewerID (0 for anonymous requests)
+func NewDonationJSON(donation repository.Donation, viewerID int) DonationJSON {
+	d := DonationJSON{
+		PostID:        donation.PostID,
+		DonorID:       donation.DonorID,
+		Status:        string(donation.Status),
+		RecipientID:   donation.RecipientID,
+		RecipientName: donation.RecipientName,
+		History:       make([]DonationEventJSON, 0, len(donation.History)),
+	}
+	if viewerID != 0 && viewerID == donation.DonorID {
+		for _, request := range donation.Requests {
+			d.Requests = append(d.Requests, newDonationRequestJSON(request))
+		}
+	} else if request := donation.RequestBy(viewerID); viewerID != 0 && request != nil {
+		mine := newDonationRequestJSON(*request)
+		d.MyRequest = &mine
+	}
+	for _, event := range donation.History {
+		d.History = append(d.History, DonationEventJSON{
+			Event:       event.Event,
+			ActorID:     event.ActorID,
+			ActorName:   event.ActorName,
+			FromStatus:  string(event.FromStatus),
+			ToStatus:    string(event.ToStatus),
+			RecipientID: event.RecipientID,
+			Note:        event.Note,
+			CreatedAt:   event.CreatedAt.Format(time.RFC3339),
+		})
+	}
+	return d
+}
+
+// NewPostJSON converts a post for the API. Comments are only included when withComments is set.
+func NewPostJSON(post repository.Post, withComments bool) PostJSON {
+	p := PostJSON{
+		ID:              post.ID,
+		UserID:          post.UserID,
+		Username:        post.Username,
+		Title:           post.Title,
+		Content:         post.Content,
+		Category:        post.Category,
+		CreatedAt:       post.CreatedAt,
+		Likes:           post.Likes,
+		Dislikes:        post.Dislikes,
+		UserReaction:    post.UserReaction,
+		IsDonation:      post.IsDonation,
+		DonationCountry: post.DonationCountry,
+		DonationStatus:  string(post.DonationStatus),
+		CommentCount:    post.CommentCount(),
+	}
+	if post.Image != "" {
+		p.ImageURL = "/static/uploads/" + post.Image
+	}
+	for _, image := range post.Images {
+		p.Images = append(p.Images, ImageJSON{URL: "/static/uploads/" + image.Image, AltText: image.AltText})
+	}
+	if withComments {
+		p.Comments = NewCommentsJSON(post.Comments)
+	}
+	return p
+}
+
+func NewPostsJSON(posts []repository.Post) []PostJSON {
+	result := make([]PostJSON, 0, len(posts))
+	for _, post := range posts {
+		result = append(result, NewPostJSON(post, false))
+	}
+	return result
+}
+
+func NewCommentJSON(comment repository.Comment) CommentJSON {
+	return CommentJSON{
+		ID:              comment.ID,
+		PostID:          comment.PostID,
+		UserID:          comment.UserID,
+		Username:        comment.Username,
+		ParentCommentID: comment.ParentCommentID,
+		Content:         comment.Content,
+		CreatedAt:       comment.CreatedAt,
+		Likes:           comment.Likes,
+		Dislikes:        comment.Dislikes,
+		UserReaction:    comment.UserReaction,
+		ReplyCount:      comment.ReplyCount,
+		Replies:         NewCommentsJSON(comment.Replies),
+	}
+}
+
+func NewCommentsJSON(comments []repository.Comment) []CommentJSON {
+	if comments == nil {
+		return nil
+	}
+	result := make([]CommentJSON, 0, len(comments))
+	for _, comment := range comments {
+		result = append(result, NewCommentJSON(comment))
+	}
+	return result
+}
+
+// NewUserJSON converts a user for the API. Private fields are only included for the user themself.
+func NewUserJSON(user repository.User, isSelf bool) UserJSON {
+	u := UserJSON{
+		ID:       user.ID,
+		Username: user.Username,
+	}
+	if user.ProfilePicture != "" {
+		u.ProfilePictureURL = "/static/profile_pictures/" + user.ProfilePicture
+	}
+	if isSelf {
+		showDonations := user.ShowDonationsInCountryOnly
+		u.Email = user.Email
+		u.Country = user.Country
+		u.ShowDonationsInCountryOnly = &showDonations
+	}
+	return u
+}
+
+// HealthJSON is the body of /healthz and /readyz. Checks maps each check to "ok" or "failed".
+type HealthJSON struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
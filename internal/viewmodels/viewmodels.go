@@ -5,56 +5,84 @@ import (
 	"ellas-corner/internal/repository"
 )
 
+// Pagination holds the links between pages of a post listing. Page is 0 when the
+// listing was continued from a cursor rather than a page number.
+type Pagination struct {
+	Page     int
+	PrevURL  string
+	NextURL  string
+	FirstURL string
+}
+
 type HomePageData struct {
 	IsLoggedIn             bool
 	ProfilePicture         string
+	UnreadMessages         int // Shown next to the Messages link in the navbar
+	UnreadNotifications    int // Shown next to the Notifications link in the navbar
 	ShowConsentBanner      bool
 	TopPosts               []repository.Post
 	Posts                  []repository.Post
-	Categories             []string
+	Categories             []repository.Category
+	Pagination             Pagination
 	ShowCommentFormForPost int
 	ShowEditControls       bool
 	ErrorMessage           string
 }
 
 type CreatePostPageData struct {
-	IsLoggedIn     bool
-	ProfilePicture string
-	Error          string
-	Title          string
-	Content        string
-	Category       string
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Error               string
+	Title               string
+	Content             string
+	Category            string
+	Categories          []repository.Category
+	MaxImages           int
 }
 
 type EditPostPageData struct {
-	IsLoggedIn     bool
-	ProfilePicture string
-	Post           repository.Post
-	Categories     []string
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Post                repository.Post
+	Categories          []repository.Category
+	Error               string
+	MaxImages           int
 }
 
 type FilterPageData struct {
 	IsLoggedIn             bool
 	ProfilePicture         string
+	UnreadMessages         int
+	UnreadNotifications    int
 	Posts                  []repository.Post
-	Categories             []string
-	Category               string // selected category
+	Categories             []repository.Category
+	Category               *repository.Category // The selected category, when exactly one is
+	Query                  repository.PostQuery
+	Pagination             Pagination
 	ShowCommentFormForPost int
 	ShowEditControls       bool
 }
 
 type LikedPostsPageData struct {
-	IsLoggedIn     bool
-	ProfilePicture string
-	Username       string
-	LikedPosts     []repository.Post
-	CuratedItems   []db.BabyBoxItem
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Username            string
+	LikedPosts          []repository.Post
+	CuratedItems        []db.BabyBoxItem
 }
 
 type ProfilePageData struct {
 	Username                   string
 	Email                      string
 	ProfilePicture             string
+	UnreadMessages             int
+	UnreadNotifications        int
 	Country                    string
 	ShowDonationsInCountryOnly bool
 	IsLoggedIn                 bool
@@ -62,13 +90,124 @@ type ProfilePageData struct {
 	Comments                   []repository.Comment
 	LikedPosts                 []repository.Post
 	DislikedPosts              []repository.Post
+	Sessions                   []repository.Session
+	Warnings                   []repository.Warning
+	NotificationSettings       []repository.NotificationSetting
+	EmailDigest                bool
+	EmailVerified              bool
+	CanModerate                bool
 }
 
 type SearchPageData struct {
 	IsLoggedIn             bool
 	ProfilePicture         string
+	UnreadMessages         int
+	UnreadNotifications    int
 	SearchQuery            string
 	Posts                  []repository.Post
+	Categories             []repository.Category
+	Query                  repository.PostQuery
+	Pagination             Pagination
 	ShowEditControls       bool
 	ShowCommentFormForPost int
 }
+
+// AdminUser is a row in the dashboard's user list, with what the viewing moderator may do to them
+type AdminUser struct {
+	repository.User
+	CanBan        bool
+	CanChangeRole bool
+}
+
+type AdminPageData struct {
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Role                repository.Role
+	Roles               []repository.Role
+	Posts               []repository.Post
+	Comments            []repository.Comment
+	Users               []AdminUser
+	Log                 []repository.ModerationLogEntry
+	ReportedItems       int // Posts and comments waiting in the review queue
+}
+
+// CategoriesPageData is the admin page listing every category, with a form for adding one or,
+// when Form.ID is set, editing it
+type CategoriesPageData struct {
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Categories          []repository.Category
+	Form                repository.Category
+	Error               string
+}
+
+type ReportQueuePageData struct {
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Items               []repository.ReportedItem
+	ReportThreshold     int
+}
+
+// DonationPageData is the donation page for one item. Only the donor sees every request;
+// anyone else sees their own request, if they made one.
+type DonationPageData struct {
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Post                repository.Post
+	Donation            repository.Donation
+	IsDonor             bool
+	IsRecipient         bool
+	CanRequest          bool // Signed in, not the donor, and the item is still open
+	MyRequest           *repository.DonationRequest
+	Message             string
+}
+
+// MessagesPageData is a member's inbox and the members they have blocked
+type MessagesPageData struct {
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Conversations       []repository.ConversationSummary
+	BlockedUsers        []repository.User
+}
+
+// ConversationPageData is one conversation with the form to reply
+type ConversationPageData struct {
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	ViewerID            int
+	Conversation        repository.Conversation
+	Error               string
+}
+
+// NotificationsPageData is a member's latest notifications, newest first
+type NotificationsPageData struct {
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Notifications       []repository.Notification
+}
+
+// VerifyEmailPageData tells a member whether their email address is confirmed
+type VerifyEmailPageData struct {
+	IsLoggedIn          bool
+	ProfilePicture      string
+	UnreadMessages      int
+	UnreadNotifications int
+	Email               string
+	Verified            bool
+	Message             string
+	Error               string
+}
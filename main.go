@@ -1,68 +1,202 @@
 package main
 
 import (
+	"context"
 	"log"
+	"log/slog"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
+	"ellas-corner/internal/config"
 	"ellas-corner/internal/db"
 	"ellas-corner/internal/handlers"
+	"ellas-corner/internal/mail"
+	"ellas-corner/internal/middleware"
 	"ellas-corner/internal/repository"
+	"ellas-corner/internal/storage"
+	"ellas-corner/internal/uploads"
+	"ellas-corner/internal/utils"
 )
 
 func main() {
+	// Settings come from the defaults, then config.toml or the file named by CONFIG_FILE, then
+	// environment variables
+	cfg, err := config.Load(os.Getenv("CONFIG_FILE"))
+	if err != nil {
+		log.Fatalf("Failed to load configuration: %v", err)
+	}
+	utils.Configure(cfg.Auth)
+
 	// Initialise the SQLite database
-	dbInstance, err := db.InitDB("data/forum.db")
+	dbInstance, err := db.InitDB(cfg.Database.Path)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
-	repository.SetDatabase(dbInstance)
+	store := repository.NewSQLStore(dbInstance)
+
+	// Run a subcommand (e.g. "migrate down") instead of the server if one was given
+	if len(os.Args) > 1 {
+		os.Exit(runCommand(dbInstance, store, cfg, os.Args[1:]))
+	}
+
 	if err := dbInstance.RunMigrations(); err != nil {
 		log.Fatalf("Failed to run migrations: %v", err)
 	}
 
-	// Create router
-	mux := http.NewServeMux()
+	// Periodically remove expired sessions
+	stopReaper := utils.StartSessionReaper(store, time.Hour)
 
-	// Serve static files from "web/static" when requested at "/static/..." (web added to keep frontend assets in one place)
-	mux.Handle("/static/", http.StripPrefix("/static/", http.FileServer(http.Dir("web/static"))))
+	// Email goes through SMTP when an SMTP server is configured and to the outbox otherwise
+	mailer, err := newMailer(cfg.Mail)
+	if err != nil {
+		log.Fatalf("Failed to set up email: %v", err)
+	}
+	stopDigests := mail.StartDigestSender(store, mailer, cfg.Server.SiteURL, cfg.Mail.DigestInterval)
 
-	// Set up route handlers
+	postImages, profilePictures, err := newBlobStores(cfg)
+	if err != nil {
+		log.Fatalf("Failed to set up image storage: %v", err)
+	}
 
-	// Home page and about page
-	mux.HandleFunc("/", handlers.HomeHandler)
-	mux.HandleFunc("/about", handlers.AboutHandler)
+	// Periodically remove images that no post or user refers to any more
+	stopSweeper := func() {}
+	if cfg.Uploads.SweepInterval > 0 {
+		stopSweeper = uploads.StartSweeper(newSweeper(store, cfg, postImages, profilePictures), cfg.Uploads.SweepInterval)
+	}
 
-	// Posts
-	mux.HandleFunc("/api/posts", handlers.PostsHandler)
-	mux.HandleFunc("/create-post", handlers.CreatePostHandler)
-	mux.HandleFunc("/delete-post", handlers.DeletePostHandler)
-	mux.HandleFunc("/edit-post", handlers.EditPostHandler)
+	app := &handlers.App{
+		Store:           store,
+		Mailer:          mailer,
+		SiteURL:         cfg.Server.SiteURL,
+		Uploads:         cfg.Uploads,
+		PostImages:      postImages,
+		ProfilePictures: profilePictures,
+		ImageURLExpiry:  cfg.Storage.SignedURLExpiry,
+	}
 
-	// Authentication
-	mux.HandleFunc("/register", handlers.RegisterHandler)
-	mux.HandleFunc("/login", handlers.LoginHandler)
-	mux.HandleFunc("/logout", handlers.LogoutHandler)
+	// Signed image links point at the bucket, so pages must allow images from there
+	securityHeaders := middleware.SecurityHeaders
+	if bucket, ok := postImages.(*storage.S3Store); ok && cfg.Storage.SignedURLExpiry > 0 {
+		securityHeaders = middleware.SecurityHeadersWithImagesFrom(bucket.Origin())
+	}
+
+	// Every request gets an ID and a log line; panics become the 500 page, and every form
+	// post must carry the session's CSRF token
+	handler := middleware.Chain(app.Routes(),
+		middleware.RequestID,
+		middleware.Logger(slog.Default()),
+		middleware.Recover,
+		securityHeaders,
+		app.CSRFMiddleware,
+	)
 
-	// User
-	mux.HandleFunc("/accept-cookies", handlers.AcceptCookiesHandler)
-	mux.HandleFunc("/profile", handlers.ProfileHandler)
-	mux.HandleFunc("/upload-profile-picture", handlers.UploadProfilePictureHandler)
-	mux.HandleFunc("/liked-posts", handlers.LikedPostsHandler)
-	mux.HandleFunc("/update-profile-settings", handlers.UpdateProfileSettingsHandler)
+	// Timeouts stop slow or stalled clients holding connections open. Writes get longer than
+	// reads since pages are rendered after the upload has been read.
+	server := &http.Server{
+		Addr:              cfg.Server.Addr,
+		Handler:           handler,
+		ReadHeaderTimeout: 5 * time.Second,
+		ReadTimeout:       cfg.Server.ReadTimeout,
+		WriteTimeout:      cfg.Server.WriteTimeout,
+		IdleTimeout:       2 * time.Minute,
+	}
 
-	//Comments and reactions
-	mux.HandleFunc("/add-comment", handlers.AddCommentHandler)
-	mux.HandleFunc("/react", handlers.ReactionHandler)
-	mux.HandleFunc("/react-comment", handlers.CommentReactionHandler)
-	mux.HandleFunc("/delete-comment", handlers.DeleteCommentHandler)
+	// SIGTERM (sent by docker stop) or Ctrl+C starts a graceful shutdown
+	ctx, stopSignals := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopSignals()
 
-	//Filtering and search
-	mux.HandleFunc("/filter", handlers.FilterHandler)
-	mux.HandleFunc("/search", handlers.SearchHandler)
+	// Serve HTTPS when a certificate is configured, which also turns on HSTS
+	serverErr := make(chan error, 1)
+	go func() {
+		if cfg.Server.TLSCertFile != "" {
+			log.Println("Starting server with TLS on", server.Addr)
+			serverErr <- server.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			log.Println("Starting server on", server.Addr)
+			serverErr <- server.ListenAndServe()
+		}
+	}()
 
-	// Start the server on port 8080
-	log.Println("Starting server on :8080")
-	if err := http.ListenAndServe(":8080", mux); err != nil {
+	select {
+	case err := <-serverErr:
 		log.Fatalf("Server failed: %v", err)
+	case <-ctx.Done():
+	}
+	// A second signal skips the wait and exits straight away
+	stopSignals()
+
+	// Stop accepting connections and let in-flight requests, such as uploads, finish
+	log.Printf("Shutting down; waiting up to %s for requests to finish", cfg.Server.ShutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error shutting down server:", err)
+	}
+
+	// Background jobs finish what they are doing before the database is closed
+	stopDigests()
+	stopReaper()
+	stopSweeper()
+	if err := dbInstance.Conn.Close(); err != nil {
+		log.Println("Error closing database:", err)
+	}
+	log.Println("Server stopped")
+}
+
+// newMailer sends email through the configured SMTP server (for example localhost:1025 for
+// MailHog), or writes it to the outbox directory when no server is configured
+func newMailer(cfg config.Mail) (mail.Mailer, error) {
+	if cfg.SMTPAddr != "" {
+		return mail.SMTPMailer{
+			Addr:     cfg.SMTPAddr,
+			From:     cfg.From,
+			Username: cfg.SMTPUsername,
+			Password: cfg.SMTPPassword,
+		}, nil
+	}
+	log.Println("SMTP_ADDR is not set; writing emails to", cfg.OutboxDir)
+	return mail.NewOutboxMailer(cfg.OutboxDir, cfg.From)
+}
+
+// newBlobStores returns where post images and profile pictures are kept: the upload
+// directories, which are created if needed, or two prefixes in the configured S3 bucket
+func newBlobStores(cfg config.Config) (posts, profilePictures storage.BlobStore, err error) {
+	if cfg.Storage.Backend == "s3" {
+		s3 := storage.S3Config{
+			Endpoint:  cfg.Storage.S3Endpoint,
+			Region:    cfg.Storage.S3Region,
+			Bucket:    cfg.Storage.S3Bucket,
+			AccessKey: cfg.Storage.S3AccessKey,
+			SecretKey: cfg.Storage.S3SecretKey,
+			PathStyle: cfg.Storage.S3PathStyle,
+		}
+		postStore, err := storage.NewS3Store(s3, "uploads/")
+		if err != nil {
+			return nil, nil, err
+		}
+		profileStore, err := storage.NewS3Store(s3, "profile_pictures/")
+		if err != nil {
+			return nil, nil, err
+		}
+		return postStore, profileStore, nil
+	}
+
+	for _, dir := range []string{cfg.Uploads.PostDir, cfg.Uploads.ProfilePictureDir} {
+		if err := os.MkdirAll(dir, os.ModePerm); err != nil {
+			return nil, nil, err
+		}
+	}
+	return storage.LocalStore{Dir: cfg.Uploads.PostDir}, storage.LocalStore{Dir: cfg.Uploads.ProfilePictureDir}, nil
+}
+
+func newSweeper(store repository.UploadStore, cfg config.Config, postImages, profilePictures storage.BlobStore) uploads.Sweeper {
+	return uploads.Sweeper{
+		Store:           store,
+		PostImages:      postImages,
+		ProfilePictures: profilePictures,
+		GracePeriod:     cfg.Uploads.SweepGracePeriod,
 	}
 }
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+DROP INDEX IF EXISTS idx_sessions_user_id;
+DROP TABLE IF EXISTS sessions;
+
+CREATE TABLE sessions (
+    user_id INTEGER PRIMARY KEY,
+    session_token TEXT NOT NULL UNIQUE,
+    FOREIGN KEY(user_id) REFERENCES users(id)
+);
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS idx_comment_reactions_comment_id;
+DROP INDEX IF EXISTS idx_comments_post_id;
+DROP INDEX IF EXISTS idx_post_reactions_user_id;
+DROP INDEX IF EXISTS idx_post_reactions_post_id;
+DROP INDEX IF EXISTS idx_posts_created_at;
@@ -0,0 +1,7 @@
+-- Indexes for loading feeds: reaction counts, the viewer's reactions and comments are
+-- looked up by post or comment for every post on a page.
+CREATE INDEX IF NOT EXISTS idx_posts_created_at ON posts(created_at, id);
+CREATE INDEX IF NOT EXISTS idx_post_reactions_post_id ON post_reactions(post_id, reaction_type);
+CREATE INDEX IF NOT EXISTS idx_post_reactions_user_id ON post_reactions(user_id, post_id);
+CREATE INDEX IF NOT EXISTS idx_comments_post_id ON comments(post_id);
+CREATE INDEX IF NOT EXISTS idx_comment_reactions_comment_id ON comment_reactions(comment_id, reaction_type);
@@ -0,0 +1,9 @@
+DROP INDEX IF EXISTS idx_moderation_log_created_at;
+DROP TABLE IF EXISTS moderation_log;
+
+ALTER TABLE comments DROP COLUMN hidden_at;
+ALTER TABLE posts DROP COLUMN hidden_at;
+
+ALTER TABLE users DROP COLUMN ban_reason;
+ALTER TABLE users DROP COLUMN banned_at;
+ALTER TABLE users DROP COLUMN role;
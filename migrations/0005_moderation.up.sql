@@ -0,0 +1,22 @@
+-- Roles and bans for moderation. Roles are 'member', 'moderator' or 'admin'.
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('member', 'moderator', 'admin'));
+ALTER TABLE users ADD COLUMN banned_at DATETIME;
+ALTER TABLE users ADD COLUMN ban_reason TEXT NOT NULL DEFAULT '';
+
+-- Hidden posts and comments stay in the database but are left out of every listing
+ALTER TABLE posts ADD COLUMN hidden_at DATETIME;
+ALTER TABLE comments ADD COLUMN hidden_at DATETIME;
+
+-- moderator_id is NULL for changes made from the command line
+CREATE TABLE IF NOT EXISTS moderation_log (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    moderator_id INTEGER,
+    action TEXT NOT NULL,
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    reason TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(moderator_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_moderation_log_created_at ON moderation_log(created_at);
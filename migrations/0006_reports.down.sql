@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_user_warnings_user_id;
+DROP TABLE IF EXISTS user_warnings;
+DROP INDEX IF EXISTS idx_reports_open;
+DROP TABLE IF EXISTS reports;
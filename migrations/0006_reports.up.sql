@@ -0,0 +1,34 @@
+-- Reports of unsafe or unwanted posts and comments. Each user can report an item once.
+-- status is 'open' until a moderator resolves it as 'dismissed', 'hidden' or 'warned'.
+CREATE TABLE IF NOT EXISTS reports (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    reporter_id INTEGER NOT NULL,
+    target_type TEXT NOT NULL CHECK (target_type IN ('post', 'comment')),
+    target_id INTEGER NOT NULL,
+    reason TEXT NOT NULL CHECK (reason IN ('recalled', 'unsafe', 'spam', 'abusive', 'other')),
+    details TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'dismissed', 'hidden', 'warned')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    resolved_by INTEGER,
+    resolved_at DATETIME,
+    FOREIGN KEY(reporter_id) REFERENCES users(id),
+    FOREIGN KEY(resolved_by) REFERENCES users(id),
+    UNIQUE(reporter_id, target_type, target_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_reports_open ON reports(status, target_type, target_id);
+
+-- Warnings sent to authors when a moderator upholds a report without removing the content
+CREATE TABLE IF NOT EXISTS user_warnings (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    moderator_id INTEGER,
+    target_type TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(moderator_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_warnings_user_id ON user_warnings(user_id);
@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_donation_history_post_id;
+DROP TABLE IF EXISTS donation_history;
+DROP TABLE IF EXISTS donation_requests;
+
+ALTER TABLE posts DROP COLUMN donation_recipient_id;
+ALTER TABLE posts DROP COLUMN donation_status;
@@ -0,0 +1,39 @@
+-- Donation lifecycle. donation_status is NULL for posts that aren't donations, and moves
+-- between 'available', 'requested', 'reserved', 'handed_over' and 'withdrawn'.
+-- donation_recipient_id is the member the item is reserved for or was handed to.
+ALTER TABLE posts ADD COLUMN donation_status TEXT
+    CHECK (donation_status IN ('available', 'requested', 'reserved', 'handed_over', 'withdrawn'));
+ALTER TABLE posts ADD COLUMN donation_recipient_id INTEGER;
+
+UPDATE posts SET donation_status = 'available' WHERE is_donation = 1;
+
+-- Requests from members who would like a donated item. Each member can ask once per item;
+-- a cancelled or declined request can be made again.
+CREATE TABLE IF NOT EXISTS donation_requests (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    requester_id INTEGER NOT NULL,
+    message TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'accepted', 'declined', 'cancelled')),
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY(requester_id) REFERENCES users(id) ON DELETE CASCADE,
+    UNIQUE(post_id, requester_id)
+);
+
+-- Every change to a donation, so donor and recipients can see who was promised what and when
+CREATE TABLE IF NOT EXISTS donation_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    event TEXT NOT NULL,
+    from_status TEXT NOT NULL,
+    to_status TEXT NOT NULL,
+    recipient_id INTEGER,
+    note TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY(actor_id) REFERENCES users(id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_donation_history_post_id ON donation_history(post_id);
@@ -0,0 +1,6 @@
+DROP TABLE IF EXISTS user_blocks;
+DROP INDEX IF EXISTS idx_messages_conversation_id;
+DROP TABLE IF EXISTS messages;
+DROP INDEX IF EXISTS idx_conversation_members_user_id;
+DROP TABLE IF EXISTS conversation_members;
+DROP TABLE IF EXISTS conversations;
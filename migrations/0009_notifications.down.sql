@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS notification_opt_outs;
+DROP INDEX IF EXISTS idx_notifications_user_id;
+DROP TABLE IF EXISTS notifications;
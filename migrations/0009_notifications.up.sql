@@ -0,0 +1,28 @@
+-- Things that happened to a member's posts, comments and donations. type is one of the
+-- notification types members can opt out of; detail holds the reaction or donation event.
+-- comment_id is the member's own comment the notification is about, or NULL for their post.
+CREATE TABLE IF NOT EXISTS notifications (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    actor_id INTEGER NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('comment', 'reply', 'reaction', 'donation')),
+    post_id INTEGER NOT NULL,
+    comment_id INTEGER,
+    detail TEXT NOT NULL DEFAULT '',
+    read_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(actor_id) REFERENCES users(id) ON DELETE CASCADE,
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE,
+    FOREIGN KEY(comment_id) REFERENCES comments(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_notifications_user_id ON notifications(user_id, id);
+
+-- Notification types a member has turned off. Everything is on by default.
+CREATE TABLE IF NOT EXISTS notification_opt_outs (
+    user_id INTEGER NOT NULL,
+    type TEXT NOT NULL CHECK (type IN ('comment', 'reply', 'reaction', 'donation')),
+    PRIMARY KEY (user_id, type),
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
@@ -0,0 +1,7 @@
+-- Members get a periodic email listing unread notifications unless they turn it off.
+-- emailed_at marks notifications that have been in a digest, so each is only sent once.
+ALTER TABLE users ADD COLUMN email_digest BOOLEAN NOT NULL DEFAULT 1;
+ALTER TABLE notifications ADD COLUMN emailed_at DATETIME;
+
+-- Don't email notifications from before digests existed
+UPDATE notifications SET emailed_at = CURRENT_TIMESTAMP;
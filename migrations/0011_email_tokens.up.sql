@@ -0,0 +1,19 @@
+-- Members confirm their email address before they can post. Everyone who joined before
+-- verification existed is treated as verified.
+ALTER TABLE users ADD COLUMN email_verified_at DATETIME;
+UPDATE users SET email_verified_at = CURRENT_TIMESTAMP;
+
+-- Single-use links emailed to members, for resetting a password or verifying an email
+-- address. Only the SHA-256 hash of the token is stored, like sessions and API tokens.
+CREATE TABLE IF NOT EXISTS user_tokens (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    purpose TEXT NOT NULL CHECK (purpose IN ('password_reset', 'verify_email')),
+    token_hash TEXT NOT NULL UNIQUE,
+    expires_at DATETIME NOT NULL,
+    used_at DATETIME,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(user_id) REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_user_tokens_user_id ON user_tokens(user_id, purpose);
@@ -0,0 +1,3 @@
+DROP TRIGGER IF EXISTS post_images_after_post_delete;
+DROP INDEX IF EXISTS idx_post_images_post_id;
+DROP TABLE IF EXISTS post_images;
@@ -0,0 +1,23 @@
+-- The photos of a post, shown as a gallery in order of position. posts.image stays as the
+-- cover shown in lists and is kept equal to the first photo, or the placeholder when a post
+-- has none.
+CREATE TABLE IF NOT EXISTS post_images (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    image TEXT NOT NULL,
+    position INTEGER NOT NULL,
+    alt_text TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY(post_id) REFERENCES posts(id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_post_images_post_id ON post_images(post_id, position);
+
+-- Foreign keys aren't enforced on the site's connections, so the photos go with their post here
+CREATE TRIGGER IF NOT EXISTS post_images_after_post_delete AFTER DELETE ON posts BEGIN
+    DELETE FROM post_images WHERE post_id = OLD.id;
+END;
+
+-- Each post's uploaded picture becomes the first photo of its gallery
+INSERT INTO post_images (post_id, image, position, alt_text)
+SELECT id, image, 0, title FROM posts WHERE COALESCE(image, '') NOT IN ('', 'placeholder.jpg');
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_posts_category;
+DROP TABLE IF EXISTS categories;
@@ -0,0 +1,61 @@
+-- The age and stage categories posts are filed under. posts.category keeps holding the
+-- category's name, so links and the search index work as before; renaming a category
+-- renames it on its posts too. The slug is a stable name for links, and the age range is in
+-- months, with NULL for no lower or upper limit. Categories that aren't about an age, like
+-- Parents, have neither.
+CREATE TABLE IF NOT EXISTS categories (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    slug TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    name TEXT NOT NULL UNIQUE COLLATE NOCASE,
+    sort_order INTEGER NOT NULL DEFAULT 0,
+    min_age_months INTEGER,
+    max_age_months INTEGER,
+    description TEXT NOT NULL DEFAULT '',
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    CHECK (min_age_months IS NULL OR max_age_months IS NULL OR min_age_months <= max_age_months)
+);
+
+CREATE INDEX IF NOT EXISTS idx_posts_category ON posts(category);
+
+-- The categories the submit form has always offered
+INSERT OR IGNORE INTO categories (slug, name, sort_order, min_age_months, max_age_months, description) VALUES
+    ('newborn', 'Newborn', 10, 0, 3, 'The first weeks and months at home'),
+    ('3-6-months', '3-6 months', 20, 3, 6, ''),
+    ('6-9-months', '6-9 months', 30, 6, 9, ''),
+    ('9-12-months', '9-12 months', 40, 9, 12, ''),
+    ('over-12-months', 'Over 12 months', 50, 12, NULL, 'Toddlers and up'),
+    ('parents', 'Parents', 60, NULL, NULL, 'For mums, dads and carers'),
+    ('older-siblings', 'Older siblings', 70, NULL, NULL, 'Helping big brothers and sisters adjust'),
+    ('outside-the-house', 'Outside the house', 80, NULL, NULL, 'Walks, visits and days out'),
+    ('travelling', 'Travelling', 90, NULL, NULL, ''),
+    ('books', 'Books', 100, NULL, NULL, ''),
+    ('general', 'General', 110, NULL, NULL, 'Anything that doesn''t fit elsewhere');
+
+-- Posts were filed under whatever the form or the API sent. Values that only differ from a
+-- category by case, spacing or an en dash, or that are its slug, are filed under it.
+UPDATE posts SET category = (
+    SELECT name FROM categories
+    WHERE name = TRIM(REPLACE(posts.category, '–', '-'))
+       OR slug = LOWER(REPLACE(TRIM(REPLACE(posts.category, '–', '-')), ' ', '-'))
+)
+WHERE EXISTS (
+    SELECT 1 FROM categories
+    WHERE name = TRIM(REPLACE(posts.category, '–', '-'))
+       OR slug = LOWER(REPLACE(TRIM(REPLACE(posts.category, '–', '-')), ' ', '-'))
+);
+
+UPDATE posts SET category = 'General' WHERE TRIM(COALESCE(category, '')) = '';
+
+-- Anything else becomes a category of its own after the rest, for an admin to rename, merge
+-- or describe
+INSERT OR IGNORE INTO categories (slug, name, sort_order)
+SELECT LOWER(REPLACE(TRIM(category), ' ', '-')), TRIM(category), 1000
+FROM posts
+WHERE category NOT IN (SELECT name FROM categories)
+GROUP BY TRIM(category) COLLATE NOCASE;
+
+UPDATE posts SET category = (SELECT name FROM categories WHERE name = TRIM(posts.category))
+WHERE EXISTS (SELECT 1 FROM categories WHERE name = TRIM(posts.category));
+
+-- A value whose slug clashed with another category's has nowhere else to go
+UPDATE posts SET category = 'General' WHERE category NOT IN (SELECT name FROM categories);
@@ -0,0 +1,9 @@
+-- When each picture was last uploaded. Uploads are named after their content, so uploading
+-- a picture that is already stored doesn't write it again; this lets the upload sweeper
+-- tell such a picture from an orphan. The sweeper clears rows older than its grace period.
+CREATE TABLE IF NOT EXISTS uploads (
+    store TEXT NOT NULL,
+    name TEXT NOT NULL,
+    uploaded_at DATETIME NOT NULL,
+    PRIMARY KEY (store, name)
+);
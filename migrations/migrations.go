@@ -0,0 +1,11 @@
+// Package migrations embeds the versioned SQL schema files into the binary.
+//
+// Files are named NNNN_description.up.sql and NNNN_description.down.sql.
+// The up file applies the change and the down file reverts it. Versions must
+// be unique and are applied in ascending order.
+package migrations
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS
@@ -0,0 +1,20 @@
+// Adds a description field for each photo chosen in a file input with data-alt-fields, so
+// every photo can be given alt text. The fields are sent in the same order as the photos.
+document.addEventListener("DOMContentLoaded", function () {
+  document.querySelectorAll("input[type=file][data-alt-fields]").forEach(function (input) {
+    const container = document.getElementById(input.dataset.altFields);
+    input.addEventListener("change", function () {
+      container.replaceChildren();
+      Array.from(input.files).forEach(function (file, i) {
+        const label = document.createElement("label");
+        label.textContent = "Describe photo " + (i + 1) + " (" + file.name + "):";
+        const field = document.createElement("input");
+        field.type = "text";
+        field.name = "image_alt";
+        field.maxLength = 200;
+        field.placeholder = "For example: the pram folded flat";
+        container.append(label, field);
+      });
+    });
+  });
+});